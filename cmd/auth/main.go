@@ -1,32 +1,205 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
 	"github.com/soicchi/auth_api/internal/models"
 	"github.com/soicchi/auth_api/internal/routes"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/usecase"
 	"github.com/soicchi/auth_api/internal/utils"
 )
 
 func main() {
-	// Validate environment variables
-	envVars := utils.NewENVVars()
-	if err := utils.ValidateENVVars(envVars); err != nil {
-		log.Fatalf("Failed to validate environment variables: %v", err)
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("failed to load configuration", err)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.Log)
+	if err != nil {
+		fatal("failed to setup logging", err)
+	}
+	slog.SetDefault(logger)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			fatal("failed to migrate database", err)
+		}
+		return
 	}
 
+	// Setup tracing before anything that creates spans
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to setup tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+
 	// Setup database
-	db, err := models.SetupDB()
+	db, err := models.SetupDB(cfg.Database)
+	if err != nil {
+		fatal("failed to connect database", err)
+	}
+	defer func() {
+		if err := models.CloseDB(db); err != nil {
+			slog.Error("failed to close database", "error", err)
+		}
+	}()
+
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatalf("Failed to connect database: %v", err)
+		fatal("failed to get database pool", err)
+	}
+	if err := metrics.RegisterDBStats(sqlDB, cfg.Database.Name); err != nil {
+		fatal("failed to register database metrics", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Load signing keys rotated with authctl
+	keys := utils.NewKeyring(cfg.Auth.JWTSecret)
+	keyService := usecase.NewSigningKeyServiceImpl(models.NewSigningKeyPostgresRepository(db), keys, cfg.Auth.MaxAccessTokenTTL)
+	keyService.FallbackGrace = cfg.Auth.JWTSecretGracePeriod
+	if err := keyService.LoadKeys(ctx); err != nil {
+		fatal("failed to load signing keys", err)
 	}
+	go reloadSigningKeys(ctx, keyService, cfg.Auth.SigningKeyReloadInterval)
+
+	// Send webhooks queued in the outbox
+	webhookService := usecase.NewWebhookServiceImpl(models.NewWebhookPostgresRepository(db), &http.Client{Timeout: cfg.Webhook.Timeout}, usecase.WebhookRetryPolicy{
+		MaxAttempts: cfg.Webhook.MaxAttempts,
+		BaseDelay:   cfg.Webhook.RetryBaseDelay,
+		MaxDelay:    cfg.Webhook.RetryMaxDelay,
+	})
+	go dispatchWebhooks(ctx, webhookService, cfg.Webhook.DispatchInterval)
 
-	log.Println("Successfully setup database")
+	// Purge expired tokens and deleted users, one replica at a time
+	if cfg.Janitor.Enabled {
+		janitor := usecase.NewJanitorServiceImpl(
+			models.NewJobLockPostgresRepository(db),
+			models.NewUserPostgresRepository(db),
+			models.NewRefreshTokenPostgresRepository(db),
+			usecase.JanitorPolicy{
+				ExpiredTokensInterval: cfg.Janitor.ExpiredTokensInterval,
+				DeletedUsersInterval:  cfg.Janitor.DeletedUsersInterval,
+				DeletedUserRetention:  cfg.Janitor.DeletedUserRetention,
+			},
+		)
+		go janitor.Run(ctx)
+	}
 
 	// Setup routes
-	e := routes.SetupRoutes(db)
-	e.Validator = utils.NewCustomValidator()
+	e, err := routes.SetupRoutes(db, cfg, keys, logger)
+	if err != nil {
+		fatal("failed to setup routes", err)
+	}
+
+	serverErr := make(chan error, 2)
+	slog.Info("starting server", "addr", cfg.Server.Addr())
+	go func() {
+		serverErr <- e.Start(cfg.Server.Addr())
+	}()
+
+	var metricsServer *http.Server
+	if cfg.Server.MetricsAddr != "" {
+		metricsServer = &http.Server{
+			Addr:              cfg.Server.MetricsAddr,
+			Handler:           metrics.Handler(),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		slog.Info("starting metrics server", "addr", cfg.Server.MetricsAddr)
+		go func() {
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight requests finish
+	slog.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shut down server gracefully", "error", err)
+	}
+
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("failed to shut down metrics server", "error", err)
+		}
+	}
+
+	slog.Info("server stopped")
+}
+
+func reloadSigningKeys(ctx context.Context, service *usecase.SigningKeyServiceImpl, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.LoadKeys(ctx); err != nil {
+				slog.Error("failed to reload signing keys", "error", err)
+			}
+		}
+	}
+}
+
+func dispatchWebhooks(ctx context.Context, service *usecase.WebhookServiceImpl, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep sending until nothing is due
+			for {
+				attempted, err := service.DispatchPending(ctx)
+				if err != nil {
+					slog.Error("failed to dispatch webhooks", "error", err)
+				}
+				if err != nil || attempted == 0 {
+					break
+				}
+			}
+		}
+	}
+}
 
-	e.Logger.Fatal(e.Start(":" + os.Getenv("API_PORT")))
+// fatal logs err and exits. Like log.Fatal, it skips deferred calls.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"github.com/soicchi/auth_api/internal/cli"
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/models"
+)
+
+// runMigrate handles `auth migrate [up|down [steps]|status]`.
+func runMigrate(cfg *config.Config, args []string) error {
+	db, err := models.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	return cli.RunMigrate(db, args, os.Stdout)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/cli"
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+type credentialsRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,password_policy"`
+}
+
+func newApp(db *gorm.DB, cfg *config.Config) *app {
+	userRepo := models.NewUserPostgresRepository(db)
+	tokenRepo := models.NewRefreshTokenPostgresRepository(db)
+	tx := models.NewTxPostgresManager(db, func(tx *gorm.DB) usecase.TxRepositories {
+		return usecase.TxRepositories{
+			Users:         models.NewUserPostgresRepository(tx),
+			Tokens:        models.NewRefreshTokenPostgresRepository(tx),
+			Organizations: models.NewOrganizationPostgresRepository(tx),
+			Identities:    models.NewIdentityPostgresRepository(tx),
+		}
+	})
+	keys := utils.NewKeyring(cfg.Auth.JWTSecret)
+	auditService := usecase.NewAuditServiceImpl(models.NewAuditEventPostgresRepository(db))
+	issuer := utils.NewTokenIssuer(keys, utils.TokenSettings{
+		Issuer:          cfg.Auth.Issuer,
+		Audience:        cfg.Auth.Audience,
+		AccessTokenTTL:  cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL: cfg.Auth.RefreshTokenTTL,
+	})
+
+	return &app{
+		users:   usecase.NewUserServiceImpl(userRepo, tokenRepo, tx, issuer, auditService),
+		tokens:  usecase.NewRefreshTokenServiceImpl(tokenRepo, issuer, auditService),
+		keys:    usecase.NewSigningKeyServiceImpl(models.NewSigningKeyPostgresRepository(db), keys, cfg.Auth.MaxAccessTokenTTL),
+		apiKeys: usecase.NewAPIKeyServiceImpl(models.NewAPIKeyPostgresRepository(db), auditService, cfg.Auth.MaxAccessTokenTTL),
+		scim:    usecase.NewSCIMTokenServiceImpl(models.NewSCIMTokenPostgresRepository(db), auditService),
+		audit:   auditService,
+		janitor: usecase.NewJanitorServiceImpl(models.NewJobLockPostgresRepository(db), userRepo, tokenRepo, usecase.JanitorPolicy{
+			DeletedUserRetention: cfg.Janitor.DeletedUserRetention,
+		}),
+		migrate: func(args []string) error {
+			return cli.RunMigrate(db, args, os.Stdout)
+		},
+	}
+}
+
+// operatorContext attributes audit events to the OS user running authctl and
+// scopes users and API keys to AUTHCTL_TENANT, or the default tenant.
+func operatorContext() context.Context {
+	operator := "unknown"
+	if u, err := user.Current(); err == nil {
+		operator = u.Username
+	}
+
+	id := os.Getenv("AUTHCTL_TENANT")
+	if id == "" {
+		id = tenant.Default
+	}
+
+	ctx := tenant.WithContext(context.Background(), id)
+	return utils.WithRequestInfo(ctx, utils.RequestInfo{Operator: operator})
+}
+
+// parseCredentials reads -email and -password, falling back to
+// AUTHCTL_PASSWORD, and applies the same rules as signup.
+func parseCredentials(name string, args []string) (credentialsRequest, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	email := fs.String("email", "", "user email")
+	password := fs.String("password", os.Getenv("AUTHCTL_PASSWORD"), "new password")
+	if err := fs.Parse(args); err != nil {
+		return credentialsRequest{}, err
+	}
+
+	req := credentialsRequest{Email: *email, Password: *password}
+	if err := utils.NewCustomValidator().Validate(req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+func parseEmail(name string, args []string) (string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	email := fs.String("email", "", "user email")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+
+	if *email == "" {
+		return "", fmt.Errorf("-email is required")
+	}
+
+	return *email, nil
+}
+
+func createAdmin(app *app, args []string) error {
+	req, err := parseCredentials("create-admin", args)
+	if err != nil {
+		return err
+	}
+
+	userID, err := app.users.CreateAdminUser(operatorContext(), req.Email, req.Password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin user %d (%s)\n", userID, req.Email)
+	return nil
+}
+
+func resetPassword(app *app, args []string) error {
+	req, err := parseCredentials("reset-password", args)
+	if err != nil {
+		return err
+	}
+
+	if err := app.users.ResetPassword(operatorContext(), req.Email, req.Password); err != nil {
+		return err
+	}
+
+	fmt.Printf("reset password for %s and revoked its sessions\n", req.Email)
+	return nil
+}
+
+func revokeSessions(app *app, args []string) error {
+	email, err := parseEmail("revoke-sessions", args)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := app.users.RevokeSessions(operatorContext(), email)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %d sessions for %s\n", revoked, email)
+	return nil
+}
+
+func tokens(app *app, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected list-expired or purge-expired")
+	}
+
+	switch args[0] {
+	case "list-expired":
+		expired, err := app.tokens.ListExpiredTokens(context.Background())
+		if err != nil {
+			return err
+		}
+
+		for _, token := range expired {
+			fmt.Printf("%d\tuser=%d\texpired_at=%s\n", token.ID, token.UserID, token.ExpiredAt.Format(time.RFC3339))
+		}
+		fmt.Printf("%d expired refresh tokens\n", len(expired))
+		return nil
+	case "purge-expired":
+		purged, err := app.tokens.PurgeExpiredTokens(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("purged %d expired refresh tokens\n", purged)
+		return nil
+	default:
+		return fmt.Errorf("unknown tokens command %q", args[0])
+	}
+}
+
+// janitor runs the given janitor job, or every job, once. Jobs the server
+// is running at the same time are skipped.
+func janitor(app *app, args []string) error {
+	if len(args) < 1 || len(args) > 2 || args[0] != "run" {
+		return fmt.Errorf("expected run [JOB]")
+	}
+
+	jobs := usecase.JanitorJobs
+	if len(args) == 2 {
+		jobs = args[1:]
+	}
+
+	for _, job := range jobs {
+		purged, ran, err := app.janitor.RunJob(context.Background(), job)
+		if err != nil {
+			return err
+		}
+
+		if !ran {
+			fmt.Printf("%s: skipped, running elsewhere\n", job)
+			continue
+		}
+		fmt.Printf("%s: purged %d rows\n", job, purged)
+	}
+
+	return nil
+}
+
+func rotateKeys(app *app, args []string) error {
+	kid, err := app.keys.RotateKey(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("rotated signing key, new key id %s\n", kid)
+	return nil
+}
+
+func mintAPIKey(app *app, args []string) error {
+	fs := flag.NewFlagSet("mint-api-key", flag.ContinueOnError)
+	name := fs.String("name", "", "name describing who uses the key")
+	audience := fs.String("audience", "", "audience of tokens issued through the key (default: configured audience)")
+	accessTTL := fs.Duration("access-ttl", 0, "access token lifetime, at most MAX_ACCESS_TOKEN_TTL (default: configured lifetime)")
+	refreshTTL := fs.Duration("refresh-ttl", 0, "refresh token lifetime (default: configured lifetime)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("-name is required")
+	}
+
+	if *accessTTL < 0 || *refreshTTL < 0 {
+		return fmt.Errorf("-access-ttl and -refresh-ttl must not be negative")
+	}
+
+	key, apiKey, err := app.apiKeys.MintAPIKey(operatorContext(), *name, utils.TokenOverrides{
+		Audience:        *audience,
+		AccessTokenTTL:  *accessTTL,
+		RefreshTokenTTL: *refreshTTL,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("minted api key %d (%s) for %s\n", apiKey.ID, apiKey.Prefix, apiKey.Name)
+	fmt.Printf("%s\n", key)
+	fmt.Println("store this key now, it cannot be shown again")
+	return nil
+}
+
+// mintSCIMToken creates the bearer token an IdP provisions AUTHCTL_TENANT
+// with.
+func mintSCIMToken(app *app, args []string) error {
+	fs := flag.NewFlagSet("mint-scim-token", flag.ContinueOnError)
+	name := fs.String("name", "", "name describing the provisioning client")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("-name is required")
+	}
+
+	token, scimToken, err := app.scim.MintSCIMToken(operatorContext(), *name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("minted scim token %d (%s) for %s\n", scimToken.ID, scimToken.Prefix, scimToken.Name)
+	fmt.Printf("%s\n", token)
+	fmt.Println("store this token now, it cannot be shown again")
+	return nil
+}
+
+// revokeSCIMToken revokes a SCIM token of AUTHCTL_TENANT.
+func revokeSCIMToken(app *app, args []string) error {
+	fs := flag.NewFlagSet("revoke-scim-token", flag.ContinueOnError)
+	id := fs.Uint("id", 0, "ID of the token, as printed by mint-scim-token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *id == 0 {
+		return fmt.Errorf("-id is required")
+	}
+
+	if err := app.scim.RevokeSCIMToken(operatorContext(), *id); err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked scim token %d\n", *id)
+	return nil
+}
+
+func migrate(app *app, args []string) error {
+	return app.migrate(args)
+}
+
+func audit(app *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected export or verify")
+	}
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("audit export", flag.ContinueOnError)
+		since := fs.String("since", "", "only events at or after this RFC 3339 time")
+		until := fs.String("until", "", "only events before this RFC 3339 time")
+		eventType := fs.String("type", "", "only events of this type")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		filter := models.AuditFilter{Type: *eventType}
+		var err error
+		if filter.Since, err = parseTime(*since); err != nil {
+			return fmt.Errorf("-since: %w", err)
+		}
+		if filter.Until, err = parseTime(*until); err != nil {
+			return fmt.Errorf("-until: %w", err)
+		}
+
+		exported, err := app.audit.ExportAuditEvents(context.Background(), os.Stdout, filter)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "exported %d audit events\n", exported)
+		return nil
+	case "verify":
+		checked, err := app.audit.VerifyAuditChain(context.Background())
+		if err != nil {
+			return fmt.Errorf("checked %d events: %w", checked, err)
+		}
+
+		fmt.Printf("audit chain intact, %d events checked\n", checked)
+		return nil
+	default:
+		return fmt.Errorf("unknown audit command %q", args[0])
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,88 @@
+// Command authctl runs administrative tasks directly against the database
+// using the same repositories and services as the API server.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+)
+
+type command struct {
+	usage string
+	run   func(app *app, args []string) error
+}
+
+type app struct {
+	users   *usecase.UserServiceImpl
+	tokens  *usecase.RefreshTokenServiceImpl
+	keys    *usecase.SigningKeyServiceImpl
+	apiKeys *usecase.APIKeyServiceImpl
+	scim    *usecase.SCIMTokenServiceImpl
+	audit   *usecase.AuditServiceImpl
+	janitor *usecase.JanitorServiceImpl
+	migrate func(args []string) error
+}
+
+var commands = map[string]command{
+	"create-admin":      {usage: "create-admin -email EMAIL [-password PASSWORD]", run: createAdmin},
+	"reset-password":    {usage: "reset-password -email EMAIL [-password PASSWORD]", run: resetPassword},
+	"revoke-sessions":   {usage: "revoke-sessions -email EMAIL", run: revokeSessions},
+	"tokens":            {usage: "tokens list-expired|purge-expired", run: tokens},
+	"rotate-keys":       {usage: "rotate-keys", run: rotateKeys},
+	"mint-api-key":      {usage: "mint-api-key -name NAME [-audience AUD] [-access-ttl DURATION] [-refresh-ttl DURATION]", run: mintAPIKey},
+	"mint-scim-token":   {usage: "mint-scim-token -name NAME", run: mintSCIMToken},
+	"revoke-scim-token": {usage: "revoke-scim-token -id ID", run: revokeSCIMToken},
+	"migrate":           {usage: "migrate [up|down [steps]|status]", run: migrate},
+	"audit":             {usage: "audit export [-since TIME] [-until TIME] [-type TYPE] | audit verify", run: audit},
+	"janitor":           {usage: "janitor run [expired_tokens|deleted_users]", run: janitor},
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := models.ConnectDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect database: %v", err)
+	}
+
+	if err := cmd.run(newApp(db, cfg), os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: authctl COMMAND [ARGS]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nPasswords can also be passed with AUTHCTL_PASSWORD to keep them out of shell history.")
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/soicchi/auth_api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// RunMigrate handles `migrate [up|down [steps]|status]` for both binaries.
+func RunMigrate(db *gorm.DB, args []string, out io.Writer) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return models.MigrateUp(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return models.MigrateDown(db, steps)
+	case "status":
+		status, err := models.GetMigrationStatus(db)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "current version: %d\nlatest version: %d\n", status.Current, status.Latest)
+		for _, m := range status.Pending {
+			fmt.Fprintf(out, "pending: %06d_%s\n", m.Version, m.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMigrateInvalidArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "unknown command",
+			args: []string{"sideways"},
+		},
+		{
+			name: "invalid steps",
+			args: []string{"down", "zero"},
+		},
+		{
+			name: "negative steps",
+			args: []string{"down", "-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := RunMigrate(nil, test.args, &out)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"gopkg.in/yaml.v3"
+)
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Config is loaded once at startup and passed to the constructors that need
+// it. Values come from, in increasing precedence: the default tags, the YAML
+// file named by CONFIG_FILE, environment variables, and files named by
+// <ENV>_FILE for secrets mounted on disk.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Cookie   CookieConfig   `yaml:"cookie"`
+	Signup   SignupConfig   `yaml:"signup"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Log      LogConfig      `yaml:"log"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+	Janitor  JanitorConfig  `yaml:"janitor"`
+	Tenancy  TenancyConfig  `yaml:"tenancy"`
+	Org      OrgConfig      `yaml:"org"`
+	OIDC     OIDCConfig     `yaml:"oidc"`
+	LDAP     LDAPConfig     `yaml:"ldap"`
+}
+
+type ServerConfig struct {
+	Host string `yaml:"host" env:"API_HOST"`
+	Port string `yaml:"port" env:"API_PORT" default:"8080"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// after SIGTERM or SIGINT.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"15s"`
+	// MetricsAddr serves /metrics on a separate admin listener, which is
+	// not exposed with the API. Empty disables metrics.
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR" default:":9090"`
+}
+
+type DatabaseConfig struct {
+	// Driver is postgres or sqlite. SQLite is meant for tests and local
+	// development and stores the database at Path.
+	Driver          string        `yaml:"driver" env:"DB_DRIVER" default:"postgres"`
+	Path            string        `yaml:"path" env:"DB_PATH"`
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            string        `yaml:"port" env:"DB_PORT" default:"5432"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD"`
+	SSLMode         string        `yaml:"ssl_mode" env:"DB_SSL_MODE" default:"require"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"5"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+	MigrateOnStart  bool          `yaml:"migrate_on_start" env:"MIGRATE_ON_START" default:"false"`
+	// SlowQueryThreshold logs queries taking longer as warnings.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD" default:"200ms"`
+	// QueryTimeout bounds each database query.
+	QueryTimeout time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT" default:"5s"`
+}
+
+type AuthConfig struct {
+	BasicAuthUser            string        `yaml:"basic_auth_user" env:"BASIC_AUTH_USER"`
+	BasicAuthPassword        string        `yaml:"basic_auth_password" env:"BASIC_AUTH_PASSWORD"`
+	APIKey                   string        `yaml:"api_key" env:"API_KEY"`
+	JWTSecret                string        `yaml:"jwt_secret" env:"JWT_SECRET"`
+	Issuer                   string        `yaml:"issuer" env:"JWT_ISSUER" default:"auth_api"`
+	Audience                 string        `yaml:"audience" env:"JWT_AUDIENCE" default:"auth_api"`
+	AcceptedAudiences        []string      `yaml:"accepted_audiences" env:"JWT_ACCEPTED_AUDIENCES"`
+	AccessTokenTTL           time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"1h"`
+	RefreshTokenTTL          time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"168h"`
+	SigningKeyReloadInterval time.Duration `yaml:"signing_key_reload_interval" env:"SIGNING_KEY_RELOAD_INTERVAL" default:"1m"`
+	// JWTSecretGracePeriod keeps tokens signed with JWTSecret valid for this
+	// long after the first signing key was rotated in.
+	JWTSecretGracePeriod time.Duration `yaml:"jwt_secret_grace_period" env:"JWT_SECRET_GRACE_PERIOD" default:"0s"`
+	// MaxAccessTokenTTL bounds ACCESS_TOKEN_TTL and the lifetimes of API keys,
+	// and is how long retired signing keys keep verifying tokens.
+	MaxAccessTokenTTL time.Duration `yaml:"max_access_token_ttl" env:"MAX_ACCESS_TOKEN_TTL" default:"24h"`
+}
+
+type CookieConfig struct {
+	Secure   bool   `yaml:"secure" env:"COOKIE_SECURE" default:"true"`
+	SameSite string `yaml:"same_site" env:"COOKIE_SAME_SITE" default:"strict"`
+	Domain   string `yaml:"domain" env:"COOKIE_DOMAIN"`
+}
+
+type SignupConfig struct {
+	DiscloseEmailTaken  bool     `yaml:"disclose_email_taken" env:"SIGNUP_DISCLOSE_EMAIL_TAKEN" default:"false"`
+	AllowedEmailDomains []string `yaml:"allowed_email_domains" env:"ALLOWED_EMAIL_DOMAINS"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp.
+	Exporter    string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" default:"none"`
+	ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME" default:"auth_api"`
+	// OTLPEndpoint is the host:port of an OTLP/HTTP collector.
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"localhost:4318"`
+	OTLPInsecure bool   `yaml:"otlp_insecure" env:"OTEL_EXPORTER_OTLP_INSECURE" default:"false"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+}
+
+type WebhookConfig struct {
+	// DispatchInterval is how often pending deliveries are looked for.
+	DispatchInterval time.Duration `yaml:"dispatch_interval" env:"WEBHOOK_DISPATCH_INTERVAL" default:"5s"`
+	Timeout          time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" default:"10s"`
+	// MaxAttempts failed attempts move a delivery to the dead-letter state.
+	MaxAttempts int `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	// Retries wait RetryBaseDelay doubled per failed attempt, up to
+	// RetryMaxDelay.
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay" env:"WEBHOOK_RETRY_BASE_DELAY" default:"30s"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay" env:"WEBHOOK_RETRY_MAX_DELAY" default:"6h"`
+}
+
+type JanitorConfig struct {
+	// Enabled runs the jobs inside the server. authctl janitor run works
+	// either way.
+	Enabled               bool          `yaml:"enabled" env:"JANITOR_ENABLED" default:"true"`
+	ExpiredTokensInterval time.Duration `yaml:"expired_tokens_interval" env:"JANITOR_EXPIRED_TOKENS_INTERVAL" default:"1h"`
+	DeletedUsersInterval  time.Duration `yaml:"deleted_users_interval" env:"JANITOR_DELETED_USERS_INTERVAL" default:"24h"`
+	// DeletedUserRetention is how long soft-deleted users can be restored
+	// before they are purged.
+	DeletedUserRetention time.Duration `yaml:"deleted_user_retention" env:"JANITOR_DELETED_USER_RETENTION" default:"720h"`
+}
+
+type TenancyConfig struct {
+	// Resolver picks the tenant of each API request: none serves every
+	// request as the default tenant, host uses the first label of the host
+	// name, path reads the /t/{tenant} prefix of /t/{tenant}/api/v1 and
+	// header reads Header.
+	Resolver string `yaml:"resolver" env:"TENANT_RESOLVER" default:"none"`
+	Header   string `yaml:"header" env:"TENANT_HEADER" default:"X-Tenant-ID"`
+	// Tenants lists the tenants requests may name; others are rejected.
+	Tenants []string `yaml:"tenants" env:"TENANTS"`
+}
+
+type OrgConfig struct {
+	// InvitationTTL is how long an organization invitation can be accepted.
+	InvitationTTL time.Duration `yaml:"invitation_ttl" env:"ORG_INVITATION_TTL" default:"168h"`
+}
+
+type OIDCConfig struct {
+	// StateTTL is how long users have to sign in at a provider.
+	StateTTL time.Duration `yaml:"state_ttl" env:"OIDC_STATE_TTL" default:"10m"`
+	// Providers are read from the config file only.
+	Providers []OIDCProviderConfig `yaml:"providers"`
+}
+
+// OIDCProviderConfig is an identity provider users can sign in with. The
+// endpoints left empty are discovered from the issuer.
+type OIDCProviderConfig struct {
+	// Name appears in the sign-in URLs, as in /oidc/google/login.
+	Name         string `yaml:"name"`
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// ClientSecretFile, when set, is read into ClientSecret.
+	ClientSecretFile string   `yaml:"client_secret_file"`
+	RedirectURL      string   `yaml:"redirect_url"`
+	Scopes           []string `yaml:"scopes"`
+	AuthURL          string   `yaml:"auth_url"`
+	TokenURL         string   `yaml:"token_url"`
+	UserInfoURL      string   `yaml:"userinfo_url"`
+	JWKSURL          string   `yaml:"jwks_url"`
+	// SubjectClaim and EmailClaim name the userinfo fields of providers
+	// without ID tokens, such as id for GitHub.
+	SubjectClaim string `yaml:"subject_claim"`
+	EmailClaim   string `yaml:"email_claim"`
+	// DisableSignup rejects accounts not yet linked to a user instead of
+	// creating one.
+	DisableSignup bool `yaml:"disable_signup"`
+	// LinkVerifiedEmail links accounts to the existing user with the same
+	// email when the provider verified it. Only enable it for providers
+	// trusted to verify emails.
+	LinkVerifiedEmail bool `yaml:"link_verified_email"`
+}
+
+// LDAPConfig moves password sign-in from the users table to a directory.
+// In UserDNTemplates and UserFilter, {email} stands for the email signed in
+// with and {username} for its part before the @.
+type LDAPConfig struct {
+	Enabled  bool          `yaml:"enabled" env:"LDAP_ENABLED" default:"false"`
+	URL      string        `yaml:"url" env:"LDAP_URL"`
+	StartTLS bool          `yaml:"start_tls" env:"LDAP_START_TLS" default:"false"`
+	Timeout  time.Duration `yaml:"timeout" env:"LDAP_TIMEOUT" default:"10s"`
+	// BindDN and BindPassword are the account users are searched for with.
+	// Searches are anonymous when BindDN is empty.
+	BindDN       string `yaml:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	// UserDNTemplates are the DNs users bind as, tried in order, instead of
+	// the DN a search finds. They are read from the config file only, since
+	// DNs contain commas.
+	UserDNTemplates []string `yaml:"user_dn_templates"`
+	BaseDN          string   `yaml:"base_dn" env:"LDAP_BASE_DN"`
+	UserFilter      string   `yaml:"user_filter" env:"LDAP_USER_FILTER" default:"(mail={email})"`
+	EmailAttribute  string   `yaml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE" default:"mail"`
+	GroupAttribute  string   `yaml:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE" default:"memberOf"`
+	// GroupRoles maps group DNs to the role of their members, which then
+	// follows their groups. It is read from the config file only.
+	GroupRoles map[string]string `yaml:"group_roles"`
+	// DisableSignup rejects directory users without a user instead of
+	// creating one.
+	DisableSignup bool `yaml:"disable_signup" env:"LDAP_DISABLE_SIGNUP" default:"false"`
+}
+
+// Load builds the configuration from CONFIG_FILE and the environment.
+func Load() (*Config, error) {
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadFile builds the configuration from the given YAML file, which may be
+// empty, and the environment.
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{}
+	if err := applyDefaults(cfg); err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	for i, provider := range cfg.OIDC.Providers {
+		if provider.ClientSecretFile == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(provider.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client secret file of OIDC provider %q: %w", provider.Name, err)
+		}
+		cfg.OIDC.Providers[i].ClientSecret = strings.TrimSpace(string(data))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	required := map[string]string{
+		"API_PORT":            c.Server.Port,
+		"BASIC_AUTH_USER":     c.Auth.BasicAuthUser,
+		"BASIC_AUTH_PASSWORD": c.Auth.BasicAuthPassword,
+		"JWT_SECRET":          c.Auth.JWTSecret,
+		"JWT_ISSUER":          c.Auth.Issuer,
+		"JWT_AUDIENCE":        c.Auth.Audience,
+	}
+	switch c.Database.Driver {
+	case "postgres":
+		required["DB_HOST"] = c.Database.Host
+		required["DB_PORT"] = c.Database.Port
+		required["DB_USER"] = c.Database.User
+		required["DB_NAME"] = c.Database.Name
+	case "sqlite":
+		required["DB_PATH"] = c.Database.Path
+	default:
+		return fmt.Errorf("DB_DRIVER must be postgres or sqlite, got %q", c.Database.Driver)
+	}
+	for _, name := range sortedKeys(required) {
+		if required[name] == "" {
+			return fmt.Errorf("%s is not set", name)
+		}
+	}
+
+	durations := map[string]time.Duration{
+		"ACCESS_TOKEN_TTL":                c.Auth.AccessTokenTTL,
+		"MAX_ACCESS_TOKEN_TTL":            c.Auth.MaxAccessTokenTTL,
+		"REFRESH_TOKEN_TTL":               c.Auth.RefreshTokenTTL,
+		"SIGNING_KEY_RELOAD_INTERVAL":     c.Auth.SigningKeyReloadInterval,
+		"SHUTDOWN_TIMEOUT":                c.Server.ShutdownTimeout,
+		"DB_SLOW_QUERY_THRESHOLD":         c.Database.SlowQueryThreshold,
+		"DB_QUERY_TIMEOUT":                c.Database.QueryTimeout,
+		"WEBHOOK_DISPATCH_INTERVAL":       c.Webhook.DispatchInterval,
+		"WEBHOOK_TIMEOUT":                 c.Webhook.Timeout,
+		"WEBHOOK_RETRY_BASE_DELAY":        c.Webhook.RetryBaseDelay,
+		"WEBHOOK_RETRY_MAX_DELAY":         c.Webhook.RetryMaxDelay,
+		"JANITOR_EXPIRED_TOKENS_INTERVAL": c.Janitor.ExpiredTokensInterval,
+		"JANITOR_DELETED_USERS_INTERVAL":  c.Janitor.DeletedUsersInterval,
+		"JANITOR_DELETED_USER_RETENTION":  c.Janitor.DeletedUserRetention,
+		"ORG_INVITATION_TTL":              c.Org.InvitationTTL,
+		"OIDC_STATE_TTL":                  c.OIDC.StateTTL,
+		"LDAP_TIMEOUT":                    c.LDAP.Timeout,
+	}
+	for _, name := range sortedKeys(durations) {
+		if durations[name] <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	if c.Auth.AccessTokenTTL > c.Auth.MaxAccessTokenTTL {
+		return fmt.Errorf("ACCESS_TOKEN_TTL must not exceed MAX_ACCESS_TOKEN_TTL")
+	}
+
+	if c.Auth.JWTSecretGracePeriod < 0 {
+		return fmt.Errorf("JWT_SECRET_GRACE_PERIOD must not be negative")
+	}
+
+	if c.Database.MaxOpenConns < 1 || c.Database.MaxIdleConns < 0 {
+		return fmt.Errorf("DB_MAX_OPEN_CONNS must be positive and DB_MAX_IDLE_CONNS must not be negative")
+	}
+
+	if c.Webhook.MaxAttempts < 1 {
+		return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+
+	switch c.Tenancy.Resolver {
+	case "none":
+	case "host", "path", "header":
+		if len(c.Tenancy.Tenants) == 0 {
+			return fmt.Errorf("TENANTS must be set when TENANT_RESOLVER is %s", c.Tenancy.Resolver)
+		}
+		for _, id := range c.Tenancy.Tenants {
+			if !tenant.Valid(id) {
+				return fmt.Errorf("TENANTS must be lowercase DNS labels, got %q", id)
+			}
+		}
+		if c.Tenancy.Resolver == "header" && c.Tenancy.Header == "" {
+			return fmt.Errorf("TENANT_HEADER is not set")
+		}
+	default:
+		return fmt.Errorf("TENANT_RESOLVER must be none, host, path or header, got %q", c.Tenancy.Resolver)
+	}
+
+	names := make(map[string]bool, len(c.OIDC.Providers))
+	for _, provider := range c.OIDC.Providers {
+		if !oidcProviderName.MatchString(provider.Name) {
+			return fmt.Errorf("OIDC provider names must be lowercase letters, digits and hyphens, got %q", provider.Name)
+		}
+		if names[provider.Name] {
+			return fmt.Errorf("OIDC provider %q is configured twice", provider.Name)
+		}
+		names[provider.Name] = true
+
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer, client_id and redirect_url", provider.Name)
+		}
+	}
+
+	if c.LDAP.Enabled {
+		if c.LDAP.URL == "" {
+			return fmt.Errorf("LDAP_URL is not set")
+		}
+		if len(c.LDAP.UserDNTemplates) == 0 && c.LDAP.BaseDN == "" {
+			return fmt.Errorf("LDAP_BASE_DN or user_dn_templates must be set when LDAP_ENABLED is true")
+		}
+		for group, role := range c.LDAP.GroupRoles {
+			// The roles of models.Roles
+			if role != "user" && role != "admin" {
+				return fmt.Errorf("LDAP group %q must map to user or admin, got %q", group, role)
+			}
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		return fmt.Errorf("OTEL_TRACES_EXPORTER must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	if _, err := c.Cookie.SameSiteMode(); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(c.Cookie.SameSite, "none") && !c.Cookie.Secure {
+		return fmt.Errorf("COOKIE_SAME_SITE=none requires COOKIE_SECURE=true")
+	}
+
+	return nil
+}
+
+// Audiences returns the audiences accepted on incoming tokens. Without an
+// explicit list only the default audience is accepted, so tokens minted for
+// clients with their own audience must be listed to be usable here.
+func (c AuthConfig) Audiences() []string {
+	if len(c.AcceptedAudiences) > 0 {
+		return c.AcceptedAudiences
+	}
+
+	return []string{c.Audience}
+}
+
+func (c ServerConfig) Addr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+func (c CookieConfig) SameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, fmt.Errorf("COOKIE_SAME_SITE must be strict, lax or none, got %q", c.SameSite)
+	}
+}
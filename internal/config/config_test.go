@@ -0,0 +1,392 @@
+package config
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_NAME", "auth")
+	t.Setenv("BASIC_AUTH_USER", "basic")
+	t.Setenv("BASIC_AUTH_PASSWORD", "basic_password")
+	t.Setenv("JWT_SECRET", "secret")
+}
+
+func TestLoadFileDefaults(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := LoadFile("")
+	assert.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Server.Addr())
+	assert.Equal(t, 15*time.Second, cfg.Server.ShutdownTimeout)
+	assert.Equal(t, ":9090", cfg.Server.MetricsAddr)
+	assert.Equal(t, "postgres", cfg.Database.Driver)
+	assert.Equal(t, "5432", cfg.Database.Port)
+	assert.Equal(t, 25, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 30*time.Minute, cfg.Database.ConnMaxLifetime)
+	assert.Equal(t, 5*time.Second, cfg.Database.QueryTimeout)
+	assert.Equal(t, time.Hour, cfg.Auth.AccessTokenTTL)
+	assert.Equal(t, 24*time.Hour, cfg.Auth.MaxAccessTokenTTL)
+	assert.Equal(t, 7*24*time.Hour, cfg.Auth.RefreshTokenTTL)
+	assert.Equal(t, "auth_api", cfg.Auth.Issuer)
+	assert.Equal(t, []string{"auth_api"}, cfg.Auth.Audiences())
+	assert.True(t, cfg.Cookie.Secure)
+	assert.False(t, cfg.Signup.DiscloseEmailTaken)
+	assert.Equal(t, "none", cfg.Tracing.Exporter)
+	assert.Equal(t, "info", cfg.Log.Level)
+	assert.Equal(t, 8, cfg.Webhook.MaxAttempts)
+	assert.Equal(t, 30*time.Second, cfg.Webhook.RetryBaseDelay)
+	assert.True(t, cfg.Janitor.Enabled)
+	assert.Equal(t, 30*24*time.Hour, cfg.Janitor.DeletedUserRetention)
+	assert.Equal(t, 7*24*time.Hour, cfg.Org.InvitationTTL)
+	assert.Equal(t, 10*time.Minute, cfg.OIDC.StateTTL)
+	assert.Empty(t, cfg.OIDC.Providers)
+	assert.False(t, cfg.LDAP.Enabled)
+	assert.Equal(t, "(mail={email})", cfg.LDAP.UserFilter)
+	assert.Equal(t, "memberOf", cfg.LDAP.GroupAttribute)
+}
+
+func TestLoadFilePrecedence(t *testing.T) {
+	setRequiredEnv(t)
+	dir := t.TempDir()
+
+	configFile := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(configFile, []byte(`
+server:
+  port: "9000"
+database:
+  max_open_conns: 10
+  password: from_file
+auth:
+  access_token_ttl: 15m
+signup:
+  allowed_email_domains: [example.com]
+`), 0o600)
+	assert.NoError(t, err)
+
+	secretFile := filepath.Join(dir, "jwt_secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("from_secret_file\n"), 0o600))
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "50")
+	t.Setenv("JWT_SECRET_FILE", secretFile)
+	t.Setenv("ALLOWED_EMAIL_DOMAINS", "test.com, example.org")
+	t.Setenv("JWT_ACCEPTED_AUDIENCES", "auth_api,mobile")
+
+	cfg, err := LoadFile(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "9000", cfg.Server.Port)
+	assert.Equal(t, "from_file", cfg.Database.Password)
+	assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.AccessTokenTTL)
+	assert.Equal(t, "from_secret_file", cfg.Auth.JWTSecret)
+	assert.Equal(t, []string{"test.com", "example.org"}, cfg.Signup.AllowedEmailDomains)
+	assert.Equal(t, []string{"auth_api", "mobile"}, cfg.Auth.Audiences())
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{
+			name: "missing required value",
+			env:  map[string]string{"JWT_SECRET": ""},
+		},
+		{
+			name: "invalid duration",
+			env:  map[string]string{"ACCESS_TOKEN_TTL": "soon"},
+		},
+		{
+			name: "non positive duration",
+			env:  map[string]string{"REFRESH_TOKEN_TTL": "0s"},
+		},
+		{
+			name: "access token ttl above the maximum",
+			env:  map[string]string{"ACCESS_TOKEN_TTL": "48h"},
+		},
+		{
+			name: "invalid same site",
+			env:  map[string]string{"COOKIE_SAME_SITE": "sometimes"},
+		},
+		{
+			name: "same site none without secure",
+			env:  map[string]string{"COOKIE_SAME_SITE": "none", "COOKIE_SECURE": "false"},
+		},
+		{
+			name: "unknown trace exporter",
+			env:  map[string]string{"OTEL_TRACES_EXPORTER": "jaeger"},
+		},
+		{
+			name: "unknown log level",
+			env:  map[string]string{"LOG_LEVEL": "verbose"},
+		},
+		{
+			name: "no webhook attempts",
+			env:  map[string]string{"WEBHOOK_MAX_ATTEMPTS": "0"},
+		},
+		{
+			name: "tenant resolver without tenants",
+			env:  map[string]string{"TENANT_RESOLVER": "header"},
+		},
+		{
+			name: "invalid tenant",
+			env:  map[string]string{"TENANT_RESOLVER": "host", "TENANTS": "acme,Globex"},
+		},
+		{
+			name: "unknown database driver",
+			env:  map[string]string{"DB_DRIVER": "mysql"},
+		},
+		{
+			name: "sqlite without a path",
+			env:  map[string]string{"DB_DRIVER": "sqlite"},
+		},
+		{
+			name: "missing secret file",
+			env:  map[string]string{"DB_PASSWORD_FILE": "/nonexistent/secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := LoadFile("")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadFileOIDCProviders(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "google_secret")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("from_secret_file\n"), 0o600))
+
+	tests := []struct {
+		name    string
+		yaml    string
+		want    []OIDCProviderConfig
+		wantErr bool
+	}{
+		{
+			name: "providers",
+			yaml: `
+oidc:
+  providers:
+    - name: google
+      issuer: https://accounts.google.com
+      client_id: google-client
+      client_secret_file: ` + secretFile + `
+      redirect_url: https://auth.example.com/api/v1/oidc/google/callback
+      link_verified_email: true
+    - name: github
+      issuer: https://github.com
+      client_id: github-client
+      client_secret: github-secret
+      redirect_url: https://auth.example.com/api/v1/oidc/github/callback
+      scopes: [read:user, user:email]
+      auth_url: https://github.com/login/oauth/authorize
+      token_url: https://github.com/login/oauth/access_token
+      userinfo_url: https://api.github.com/user
+      subject_claim: id
+`,
+			want: []OIDCProviderConfig{
+				{
+					Name:              "google",
+					Issuer:            "https://accounts.google.com",
+					ClientID:          "google-client",
+					ClientSecret:      "from_secret_file",
+					ClientSecretFile:  secretFile,
+					RedirectURL:       "https://auth.example.com/api/v1/oidc/google/callback",
+					LinkVerifiedEmail: true,
+				},
+				{
+					Name:         "github",
+					Issuer:       "https://github.com",
+					ClientID:     "github-client",
+					ClientSecret: "github-secret",
+					RedirectURL:  "https://auth.example.com/api/v1/oidc/github/callback",
+					Scopes:       []string{"read:user", "user:email"},
+					AuthURL:      "https://github.com/login/oauth/authorize",
+					TokenURL:     "https://github.com/login/oauth/access_token",
+					UserInfoURL:  "https://api.github.com/user",
+					SubjectClaim: "id",
+				},
+			},
+		},
+		{
+			name: "duplicate name",
+			yaml: `
+oidc:
+  providers:
+    - {name: okta, issuer: https://a.okta.com, client_id: a, redirect_url: https://auth.example.com/a}
+    - {name: okta, issuer: https://b.okta.com, client_id: b, redirect_url: https://auth.example.com/b}
+`,
+			wantErr: true,
+		},
+		{
+			name: "name unfit for urls",
+			yaml: `
+oidc:
+  providers:
+    - {name: Corporate Okta, issuer: https://a.okta.com, client_id: a, redirect_url: https://auth.example.com/a}
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing client id",
+			yaml: `
+oidc:
+  providers:
+    - {name: okta, issuer: https://a.okta.com, redirect_url: https://auth.example.com/a}
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing client secret file",
+			yaml: `
+oidc:
+  providers:
+    - {name: okta, issuer: https://a.okta.com, client_id: a, client_secret_file: /nonexistent/secret, redirect_url: https://auth.example.com/a}
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			configFile := filepath.Join(t.TempDir(), "config.yaml")
+			assert.NoError(t, os.WriteFile(configFile, []byte(test.yaml), 0o600))
+
+			cfg, err := LoadFile(configFile)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, cfg.OIDC.Providers)
+			}
+		})
+	}
+}
+
+func TestLoadFileLDAP(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		want    LDAPConfig
+		wantErr bool
+	}{
+		{
+			name: "directory",
+			yaml: `
+ldap:
+  enabled: true
+  url: ldaps://ldap.example.com
+  user_dn_templates:
+    - uid={username},ou=people,dc=example,dc=com
+  group_roles:
+    cn=admins,ou=groups,dc=example,dc=com: admin
+`,
+			env: map[string]string{"LDAP_TIMEOUT": "3s"},
+			want: LDAPConfig{
+				Enabled:         true,
+				URL:             "ldaps://ldap.example.com",
+				Timeout:         3 * time.Second,
+				UserDNTemplates: []string{"uid={username},ou=people,dc=example,dc=com"},
+				UserFilter:      "(mail={email})",
+				EmailAttribute:  "mail",
+				GroupAttribute:  "memberOf",
+				GroupRoles:      map[string]string{"cn=admins,ou=groups,dc=example,dc=com": "admin"},
+			},
+		},
+		{
+			name:    "missing url",
+			yaml:    "ldap: {enabled: true, base_dn: 'dc=example,dc=com'}",
+			wantErr: true,
+		},
+		{
+			name:    "no way to find users",
+			yaml:    "ldap: {enabled: true, url: 'ldap://ldap.example.com'}",
+			wantErr: true,
+		},
+		{
+			name: "unknown role",
+			yaml: `
+ldap:
+  enabled: true
+  url: ldap://ldap.example.com
+  base_dn: dc=example,dc=com
+  group_roles:
+    cn=admins,ou=groups,dc=example,dc=com: root
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			configFile := filepath.Join(t.TempDir(), "config.yaml")
+			assert.NoError(t, os.WriteFile(configFile, []byte(test.yaml), 0o600))
+
+			cfg, err := LoadFile(configFile)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, cfg.LDAP)
+			}
+		})
+	}
+}
+
+func TestLoadFileSQLite(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", "auth.db")
+	t.Setenv("BASIC_AUTH_USER", "basic")
+	t.Setenv("BASIC_AUTH_PASSWORD", "basic_password")
+	t.Setenv("JWT_SECRET", "secret")
+
+	cfg, err := LoadFile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "auth.db", cfg.Database.Path)
+}
+
+func TestSameSiteMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    http.SameSite
+		wantErr bool
+	}{
+		{in: "strict", want: http.SameSiteStrictMode},
+		{in: "Lax", want: http.SameSiteLaxMode},
+		{in: "none", want: http.SameSiteNoneMode},
+		{in: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := CookieConfig{SameSite: test.in}.SameSiteMode()
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, got)
+			}
+		})
+	}
+}
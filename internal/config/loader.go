@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type lookupFunc func(name string) (string, bool)
+
+// applyDefaults sets every field from its default tag.
+func applyDefaults(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		def, ok := field.Tag.Lookup("default")
+		if !ok {
+			return nil
+		}
+
+		return setValue(value, def)
+	})
+}
+
+// applyEnv overrides fields from their env tag, and from the file named by
+// <env>_FILE so that secrets can be mounted instead of passed as variables.
+func applyEnv(cfg *Config, lookup lookupFunc) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+
+		if raw, ok := lookup(name); ok {
+			if err := setValue(value, raw); err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+
+		if path, ok := lookup(name + "_FILE"); ok && path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s_FILE: %w", name, err)
+			}
+
+			if err := setValue(value, strings.TrimSpace(string(data))); err != nil {
+				return fmt.Errorf("invalid %s_FILE: %w", name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func walk(v reflect.Value, fn func(field reflect.StructField, value reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := walk(value, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(n))
+	case reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", value.Type())
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AdminUserService interface {
+	FetchUser(ctx context.Context, userID uint) (*models.User, error)
+	DisableUser(ctx context.Context, userID uint) error
+	EnableUser(ctx context.Context, userID uint) error
+	ForcePasswordReset(ctx context.Context, userID uint) (int64, error)
+	RevokeUserSessions(ctx context.Context, userID uint) (int64, error)
+	DeleteUser(ctx context.Context, userID uint) error
+	RestoreUser(ctx context.Context, userID uint) error
+}
+
+type AdminUserHandler struct {
+	Service AdminUserService
+}
+
+type AdminUserResponse struct {
+	ID                    uint       `json:"id"`
+	Email                 string     `json:"email"`
+	Role                  string     `json:"role"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type RevokedSessionsResponse struct {
+	RevokedSessions int64 `json:"revoked_sessions"`
+}
+
+func NewAdminUserHandler(service AdminUserService) *AdminUserHandler {
+	return &AdminUserHandler{
+		Service: service,
+	}
+}
+
+func newAdminUserResponse(user models.User) AdminUserResponse {
+	response := AdminUserResponse{
+		ID:                    user.ID,
+		Email:                 user.Email,
+		Role:                  user.Role,
+		PasswordResetRequired: user.PasswordResetRequired,
+		DisabledAt:            user.DisabledAt,
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+	}
+	if user.DeletedAt.Valid {
+		response.DeletedAt = &user.DeletedAt.Time
+	}
+
+	return response
+}
+
+func (h *AdminUserHandler) FetchUser(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.Service.FetchUser(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched user", newAdminUserResponse(*user))
+}
+
+func (h *AdminUserHandler) DisableUser(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.DisableUser(ctx.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully disabled user", nil)
+}
+
+func (h *AdminUserHandler) EnableUser(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.EnableUser(ctx.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to enable user: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully enabled user", nil)
+}
+
+func (h *AdminUserHandler) ForcePasswordReset(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := h.Service.ForcePasswordReset(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to force password reset: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully required password reset", RevokedSessionsResponse{RevokedSessions: revoked})
+}
+
+func (h *AdminUserHandler) RevokeSessions(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := h.Service.RevokeUserSessions(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully revoked sessions", RevokedSessionsResponse{RevokedSessions: revoked})
+}
+
+// DeleteUser removes the user for good; it cannot be restored.
+func (h *AdminUserHandler) DeleteUser(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.DeleteUser(ctx.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully deleted user", nil)
+}
+
+func (h *AdminUserHandler) RestoreUser(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.RestoreUser(ctx.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully restored user", nil)
+}
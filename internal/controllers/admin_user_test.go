@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockAdminUserService struct {
+	mock.Mock
+}
+
+func (m *MockAdminUserService) FetchUser(ctx context.Context, userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockAdminUserService) DisableUser(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockAdminUserService) EnableUser(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockAdminUserService) ForcePasswordReset(ctx context.Context, userID uint) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAdminUserService) RevokeUserSessions(ctx context.Context, userID uint) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAdminUserService) DeleteUser(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockAdminUserService) RestoreUser(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// serveAdminUser calls handler for a request on the user with the id path
+// parameter.
+func serveAdminUser(handler echo.HandlerFunc, method, id string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+	req := httptest.NewRequest(method, "/jwt/admin/users/"+id, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(id)
+
+	if err := handler(ctx); err != nil {
+		e.HTTPErrorHandler(err, ctx)
+	}
+
+	return rec
+}
+
+func TestAdminFetchUser(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		id       string
+		wantMock func(mockService *MockAdminUserService)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "deleted user",
+			id:   "2",
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("FetchUser", uint(2)).Return(&models.User{
+					Model: gorm.Model{
+						ID:        2,
+						CreatedAt: createdAt,
+						UpdatedAt: createdAt,
+						DeletedAt: gorm.DeletedAt{Time: createdAt, Valid: true},
+					},
+					Email: "test@test.com",
+					Role:  models.RoleUser,
+				}, nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"id\":2,\"email\":\"test@test.com\",\"role\":\"user\",\"password_reset_required\":false,\"deleted_at\":\"2024-01-02T03:04:05Z\",\"created_at\":\"2024-01-02T03:04:05Z\",\"updated_at\":\"2024-01-02T03:04:05Z\"},\"message\":\"Successfully fetched user\"}\n",
+		},
+		{
+			name: "unknown user",
+			id:   "3",
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("FetchUser", uint(3)).Return((*models.User)(nil), utils.ErrNotFound)
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "invalid id",
+			id:       "me",
+			wantMock: func(mockService *MockAdminUserService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockAdminUserService
+			test.wantMock(&mockService)
+			h := NewAdminUserHandler(&mockService)
+
+			rec := serveAdminUser(h.FetchUser, http.MethodGet, test.id)
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, rec.Body.String())
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminUserActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  func(h *AdminUserHandler) echo.HandlerFunc
+		method   string
+		wantMock func(mockService *MockAdminUserService)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:    "disable",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.DisableUser },
+			method:  http.MethodPost,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("DisableUser", uint(2)).Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:    "disable own account",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.DisableUser },
+			method:  http.MethodPost,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("DisableUser", uint(2)).Return(utils.ErrForbidden)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:    "enable",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.EnableUser },
+			method:  http.MethodPost,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("EnableUser", uint(2)).Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:    "force password reset",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.ForcePasswordReset },
+			method:  http.MethodPost,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("ForcePasswordReset", uint(2)).Return(int64(1), nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"revoked_sessions\":1},\"message\":\"Successfully required password reset\"}\n",
+		},
+		{
+			name:    "revoke sessions",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.RevokeSessions },
+			method:  http.MethodDelete,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("RevokeUserSessions", uint(2)).Return(int64(3), nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"revoked_sessions\":3},\"message\":\"Successfully revoked sessions\"}\n",
+		},
+		{
+			name:    "delete",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.DeleteUser },
+			method:  http.MethodDelete,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("DeleteUser", uint(2)).Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:    "restore a user that is not deleted",
+			handler: func(h *AdminUserHandler) echo.HandlerFunc { return h.RestoreUser },
+			method:  http.MethodPost,
+			wantMock: func(mockService *MockAdminUserService) {
+				mockService.On("RestoreUser", uint(2)).Return(utils.ErrNotFound)
+			},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockAdminUserService
+			test.wantMock(&mockService)
+			h := NewAdminUserHandler(&mockService)
+
+			rec := serveAdminUser(test.handler(h), test.method, "2")
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, rec.Body.String())
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
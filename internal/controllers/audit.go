@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuditService interface {
+	ListAuditEvents(ctx context.Context, filter models.AuditFilter) (usecase.AuditPage, error)
+}
+
+type AuditHandler struct {
+	Service AuditService
+}
+
+func NewAuditHandler(service AuditService) *AuditHandler {
+	return &AuditHandler{
+		Service: service,
+	}
+}
+
+// ListAuditEvents returns audit events newest first. It accepts the type,
+// outcome, actor and target filters, since and until as RFC 3339 times, and
+// limit and cursor for pagination.
+func (h *AuditHandler) ListAuditEvents(ctx echo.Context) error {
+	var filter models.AuditFilter
+	err := echo.QueryParamsBinder(ctx).
+		String("type", &filter.Type).
+		String("outcome", &filter.Outcome).
+		String("actor", &filter.Actor).
+		String("target", &filter.Target).
+		Time("since", &filter.Since, time.RFC3339).
+		Time("until", &filter.Until, time.RFC3339).
+		Uint("cursor", &filter.Cursor).
+		Int("limit", &filter.Limit).
+		BindError()
+	if err != nil {
+		return utils.ErrBadRequest.WithDetail("The query parameters are invalid.").Wrap(err)
+	}
+
+	page, err := h.Service.ListAuditEvents(ctx.Request().Context(), filter)
+	if err != nil {
+		return fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched audit events", page)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAuditService struct {
+	mock.Mock
+}
+
+func (m *MockAuditService) ListAuditEvents(ctx context.Context, filter models.AuditFilter) (usecase.AuditPage, error) {
+	args := m.Called(filter)
+	return args.Get(0).(usecase.AuditPage), args.Error(1)
+}
+
+func TestListAuditEvents(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		query    string
+		mock     func(mockAuditService *MockAuditService)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:  "success with filters",
+			query: "?type=user.signin&outcome=failure&since=2024-01-01T00:00:00Z&limit=1&cursor=5",
+			mock: func(mockAuditService *MockAuditService) {
+				mockAuditService.On("ListAuditEvents", models.AuditFilter{
+					Type:    "user.signin",
+					Outcome: "failure",
+					Since:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+					Limit:   1,
+					Cursor:  5,
+				}).Return(usecase.AuditPage{
+					Events: []models.AuditEvent{{
+						ID:        4,
+						CreatedAt: createdAt,
+						TenantID:  "default",
+						Type:      "user.signin",
+						Outcome:   "failure",
+						Reason:    "invalid_credentials",
+						Target:    "user:1",
+						Hash:      "hash",
+					}},
+					NextCursor: 4,
+				}, nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"events\":[{\"id\":4,\"created_at\":\"2024-01-02T03:04:05Z\",\"tenant_id\":\"default\",\"type\":\"user.signin\",\"outcome\":\"failure\",\"reason\":\"invalid_credentials\",\"target\":\"user:1\",\"prev_hash\":\"\",\"hash\":\"hash\"}],\"next_cursor\":4},\"message\":\"Successfully fetched audit events\"}\n",
+		},
+		{
+			name:     "invalid time",
+			query:    "?since=yesterday",
+			mock:     func(mockAuditService *MockAuditService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockAuditService MockAuditService
+			test.mock(&mockAuditService)
+			h := NewAuditHandler(&mockAuditService)
+
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/admin/audit-events"+test.query, nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if err := h.ListAuditEvents(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, rec.Body.String())
+			}
+			mockAuditService.AssertExpectations(t)
+		})
+	}
+}
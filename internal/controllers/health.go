@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/soicchi/auth_api/internal/usecase"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HealthService interface {
+	CheckReadiness(ctx context.Context) usecase.ReadinessReport
+}
+
+type HealthHandler struct {
+	Service HealthService
+}
+
+type healthResponse struct {
+	Status string                         `json:"status"`
+	Checks map[string]usecase.CheckResult `json:"checks,omitempty"`
+}
+
+func NewHealthHandler(service HealthService) *HealthHandler {
+	return &HealthHandler{
+		Service: service,
+	}
+}
+
+// Healthz reports that the process is up. It checks no dependencies so that
+// an unavailable database does not get the server restarted.
+func (h *HealthHandler) Healthz(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Readyz reports whether the server can take traffic, with the status of
+// every dependency.
+func (h *HealthHandler) Readyz(ctx echo.Context) error {
+	report := h.Service.CheckReadiness(ctx.Request().Context())
+	if !report.Ready {
+		return ctx.JSON(http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Checks: report.Checks})
+	}
+
+	return ctx.JSON(http.StatusOK, healthResponse{Status: "ok", Checks: report.Checks})
+}
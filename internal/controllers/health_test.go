@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/usecase"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockHealthService struct {
+	mock.Mock
+}
+
+func (m *MockHealthService) CheckReadiness(ctx context.Context) usecase.ReadinessReport {
+	args := m.Called()
+	return args.Get(0).(usecase.ReadinessReport)
+}
+
+func TestHealthz(t *testing.T) {
+	var mockHealthService MockHealthService
+	h := NewHealthHandler(&mockHealthService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	assert.NoError(t, h.Healthz(ctx))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"status\":\"ok\"}\n", rec.Body.String())
+	mockHealthService.AssertNotCalled(t, "CheckReadiness")
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   usecase.ReadinessReport
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "ready",
+			report: usecase.ReadinessReport{
+				Ready: true,
+				Checks: map[string]usecase.CheckResult{
+					"database":     {Status: usecase.CheckStatusOK},
+					"migrations":   {Status: usecase.CheckStatusOK},
+					"signing_keys": {Status: usecase.CheckStatusOK},
+				},
+			},
+			wantCode: http.StatusOK,
+			wantBody: "{\"status\":\"ok\",\"checks\":{\"database\":{\"status\":\"ok\"},\"migrations\":{\"status\":\"ok\"},\"signing_keys\":{\"status\":\"ok\"}}}\n",
+		},
+		{
+			name: "not ready",
+			report: usecase.ReadinessReport{
+				Ready: false,
+				Checks: map[string]usecase.CheckResult{
+					"database":     {Status: usecase.CheckStatusOK},
+					"migrations":   {Status: usecase.CheckStatusFail, Error: "1 pending migrations, schema is at version 5 of 6"},
+					"signing_keys": {Status: usecase.CheckStatusOK},
+				},
+			},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "{\"status\":\"unavailable\",\"checks\":{\"database\":{\"status\":\"ok\"},\"migrations\":{\"status\":\"fail\",\"error\":\"1 pending migrations, schema is at version 5 of 6\"},\"signing_keys\":{\"status\":\"ok\"}}}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockHealthService MockHealthService
+			mockHealthService.On("CheckReadiness").Return(test.report)
+			h := NewHealthHandler(&mockHealthService)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			assert.NoError(t, h.Readyz(ctx))
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, test.wantBody, rec.Body.String())
+			mockHealthService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// loginStateCookie keeps the sealed login state while the user is at the
+// identity provider.
+const loginStateCookie = "oidc_state"
+
+var errSignInRefused = utils.ErrInvalidCredentials.WithDetail("The identity provider did not complete the sign-in.")
+
+type OIDCService interface {
+	StartLogin(ctx context.Context, provider string) (usecase.OIDCLogin, error)
+	FinishLogin(ctx context.Context, provider, sealedState, state, code string, overrides utils.TokenOverrides) (utils.TokenPair, error)
+	StartLink(ctx context.Context, provider, password string) (usecase.OIDCLogin, error)
+	ListIdentities(ctx context.Context) (usecase.Credentials, error)
+	UnlinkIdentity(ctx context.Context, identityID uint, password string) error
+}
+
+type OIDCHandler struct {
+	Service OIDCService
+	Cookie  utils.CookieOptions
+}
+
+// LinkIdentityRequest starts linking an account at provider. Password
+// confirms it is the user asking, unless they signed in recently.
+type LinkIdentityRequest struct {
+	Provider string `json:"provider" validate:"required"`
+	Password string `json:"password"`
+}
+
+type UnlinkIdentityRequest struct {
+	Password string `json:"password"`
+}
+
+type LinkIdentityResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+type IdentityResponse struct {
+	ID            uint      `json:"id"`
+	Provider      string    `json:"provider"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ListIdentitiesResponse lists how the user can sign in: with a password when
+// Password is true, and with each identity.
+type ListIdentitiesResponse struct {
+	Password   bool               `json:"password"`
+	Identities []IdentityResponse `json:"identities"`
+}
+
+func NewOIDCHandler(service OIDCService, cookie utils.CookieOptions) *OIDCHandler {
+	return &OIDCHandler{
+		Service: service,
+		Cookie:  cookie,
+	}
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(ctx echo.Context) error {
+	login, err := h.Service.StartLogin(ctx.Request().Context(), ctx.Param("provider"))
+	if err != nil {
+		return fmt.Errorf("failed to start sign in: %w", err)
+	}
+
+	utils.SetCookie(ctx, h.stateCookie(), loginStateCookie, login.State, callbackPath(ctx, ctx.Param("provider")), login.ExpiresAt)
+	return ctx.Redirect(http.StatusFound, login.URL)
+}
+
+// Callback is where the identity provider redirects the browser back to. It
+// signs the user in like SignUp does, after linking the account when the
+// sign-in was started by LinkIdentity.
+func (h *OIDCHandler) Callback(ctx echo.Context) error {
+	// The login state is used once, whatever the outcome
+	var sealedState string
+	if cookie, err := ctx.Cookie(loginStateCookie); err == nil {
+		sealedState = cookie.Value
+	}
+	utils.SetCookie(ctx, h.stateCookie(), loginStateCookie, "", ctx.Request().URL.Path, time.Unix(0, 0))
+
+	// Users who cancel at the provider come back with an error instead of a code
+	if ctx.QueryParam("error") != "" {
+		return errSignInRefused
+	}
+
+	tokens, err := h.Service.FinishLogin(ctx.Request().Context(), ctx.Param("provider"), sealedState, ctx.QueryParam("state"), ctx.QueryParam("code"), utils.TokenOverridesFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to sign in: %w", err)
+	}
+
+	utils.SetCookie(ctx, h.Cookie, "refresh_token", tokens.RefreshToken, refreshCookiePath(ctx), tokens.RefreshTokenExpiresAt)
+
+	response := newSignUpResponse(tokens.AccessToken)
+	return utils.StatusOKResponse(ctx, "Successfully signed in", response)
+}
+
+// stateCookie relaxes SameSite=Strict to Lax, since browsers leave strict
+// cookies out of the redirect back from the provider.
+func (h *OIDCHandler) stateCookie() utils.CookieOptions {
+	cookie := h.Cookie
+	if cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+
+	return cookie
+}
+
+// callbackPath is the path of the callback of provider.
+func callbackPath(ctx echo.Context, provider string) string {
+	prefix, _, _ := strings.Cut(ctx.Request().URL.Path, BASE_URI)
+	return prefix + BASE_URI + "/oidc/" + provider + "/callback"
+}
+
+func (h *OIDCHandler) ListIdentities(ctx echo.Context) error {
+	credentials, err := h.Service.ListIdentities(ctx.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list identities: %w", err)
+	}
+
+	response := ListIdentitiesResponse{
+		Password:   credentials.Password,
+		Identities: make([]IdentityResponse, 0, len(credentials.Identities)),
+	}
+	for _, identity := range credentials.Identities {
+		response.Identities = append(response.Identities, IdentityResponse{
+			ID:            identity.ID,
+			Provider:      identity.Provider,
+			Email:         identity.Email,
+			EmailVerified: identity.EmailVerified,
+			CreatedAt:     identity.CreatedAt,
+		})
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched identities", response)
+}
+
+// LinkIdentity starts linking an account to the user. The browser is sent to
+// the returned URL and comes back to Callback with the state cookie set here.
+func (h *OIDCHandler) LinkIdentity(ctx echo.Context) error {
+	var req LinkIdentityRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return err
+	}
+
+	login, err := h.Service.StartLink(ctx.Request().Context(), req.Provider, req.Password)
+	if err != nil {
+		return fmt.Errorf("failed to start linking identity: %w", err)
+	}
+
+	utils.SetCookie(ctx, h.stateCookie(), loginStateCookie, login.State, callbackPath(ctx, req.Provider), login.ExpiresAt)
+
+	response := LinkIdentityResponse{
+		AuthorizationURL: login.URL,
+		ExpiresAt:        login.ExpiresAt,
+	}
+	return utils.StatusOKResponse(ctx, "Successfully started linking identity", response)
+}
+
+func (h *OIDCHandler) UnlinkIdentity(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req UnlinkIdentityRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := h.Service.UnlinkIdentity(ctx.Request().Context(), id, req.Password); err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully unlinked identity", nil)
+}
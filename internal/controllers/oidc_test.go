@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOIDCService struct {
+	mock.Mock
+}
+
+func (m *MockOIDCService) StartLogin(ctx context.Context, provider string) (usecase.OIDCLogin, error) {
+	args := m.Called(provider)
+	return args.Get(0).(usecase.OIDCLogin), args.Error(1)
+}
+
+func (m *MockOIDCService) FinishLogin(ctx context.Context, provider, sealedState, state, code string, overrides utils.TokenOverrides) (utils.TokenPair, error) {
+	args := m.Called(provider, sealedState, state, code)
+	return args.Get(0).(utils.TokenPair), args.Error(1)
+}
+
+func (m *MockOIDCService) StartLink(ctx context.Context, provider, password string) (usecase.OIDCLogin, error) {
+	args := m.Called(provider, password)
+	return args.Get(0).(usecase.OIDCLogin), args.Error(1)
+}
+
+func (m *MockOIDCService) ListIdentities(ctx context.Context) (usecase.Credentials, error) {
+	args := m.Called()
+	return args.Get(0).(usecase.Credentials), args.Error(1)
+}
+
+func (m *MockOIDCService) UnlinkIdentity(ctx context.Context, identityID uint, password string) error {
+	args := m.Called(identityID, password)
+	return args.Error(0)
+}
+
+// serveOIDC routes target to handler as the v1 routes do.
+func serveOIDC(handler *OIDCHandler, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return serveOIDCRequest(handler, req)
+}
+
+func serveOIDCRequest(handler *OIDCHandler, req *http.Request) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+	e.Validator = utils.NewCustomValidator()
+	e.GET("/api/v1/oidc/:provider/login", handler.Login)
+	e.GET("/api/v1/oidc/:provider/callback", handler.Callback)
+	e.GET("/api/v1/jwt/identities", handler.ListIdentities)
+	e.POST("/api/v1/jwt/identities", handler.LinkIdentity)
+	e.DELETE("/api/v1/jwt/identities/:id", handler.UnlinkIdentity)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func newJSONRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return req
+}
+
+func findCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		mock         func(m *MockOIDCService)
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name: "redirects to the provider",
+			mock: func(m *MockOIDCService) {
+				m.On("StartLogin", "google").Return(usecase.OIDCLogin{
+					URL:       "https://accounts.google.com/authorize?state=abc",
+					State:     "sealed",
+					ExpiresAt: time.Now().Add(10 * time.Minute),
+				}, nil)
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "https://accounts.google.com/authorize?state=abc",
+		},
+		{
+			name: "unknown provider",
+			mock: func(m *MockOIDCService) {
+				m.On("StartLogin", "google").Return(usecase.OIDCLogin{}, utils.ErrNotFound.WithDetail("The identity provider was not found."))
+			},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockOIDCService
+			test.mock(&mockService)
+			handler := NewOIDCHandler(&mockService, utils.CookieOptions{Secure: true, SameSite: http.SameSiteStrictMode})
+
+			rec := serveOIDC(handler, "/api/v1/oidc/google/login")
+			assert.Equal(t, test.wantCode, rec.Code)
+			mockService.AssertExpectations(t)
+			if test.wantLocation == "" {
+				assert.Nil(t, findCookie(rec, loginStateCookie))
+				return
+			}
+
+			assert.Equal(t, test.wantLocation, rec.Header().Get(echo.HeaderLocation))
+			cookie := findCookie(rec, loginStateCookie)
+			if assert.NotNil(t, cookie) {
+				assert.Equal(t, "sealed", cookie.Value)
+				assert.Equal(t, "/api/v1/oidc/google/callback", cookie.Path)
+				assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+				assert.True(t, cookie.HttpOnly)
+				assert.True(t, cookie.Secure)
+			}
+		})
+	}
+}
+
+func TestOIDCCallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		stateCookie string
+		mock        func(m *MockOIDCService)
+		wantCode    int
+		wantBody    string
+		wantRefresh bool
+	}{
+		{
+			name:        "signs in",
+			target:      "/api/v1/oidc/google/callback?code=code&state=abc",
+			stateCookie: "sealed",
+			mock: func(m *MockOIDCService) {
+				m.On("FinishLogin", "google", "sealed", "abc", "code").Return(utils.TokenPair{
+					AccessToken:           "access_token",
+					RefreshToken:          "refresh_token",
+					RefreshTokenExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+			},
+			wantCode:    http.StatusOK,
+			wantBody:    "{\"data\":{\"access_token\":\"access_token\"},\"message\":\"Successfully signed in\"}\n",
+			wantRefresh: true,
+		},
+		{
+			name:     "missing state cookie",
+			target:   "/api/v1/oidc/google/callback?code=code&state=abc",
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"type\":\"/problems/bad_request\",\"title\":\"Bad request\",\"status\":400,\"detail\":\"The sign-in has expired or was started in another browser.\",\"instance\":\"/api/v1/oidc/google/callback\",\"code\":\"bad_request\"}",
+			mock: func(m *MockOIDCService) {
+				m.On("FinishLogin", "google", "", "abc", "code").Return(utils.TokenPair{}, utils.ErrBadRequest.WithDetail("The sign-in has expired or was started in another browser."))
+			},
+		},
+		{
+			name:        "cancelled at the provider",
+			target:      "/api/v1/oidc/google/callback?error=access_denied&state=abc",
+			stateCookie: "sealed",
+			mock:        func(m *MockOIDCService) {},
+			wantCode:    http.StatusUnauthorized,
+			wantBody:    "{\"type\":\"/problems/invalid_credentials\",\"title\":\"Invalid credentials\",\"status\":401,\"detail\":\"The identity provider did not complete the sign-in.\",\"instance\":\"/api/v1/oidc/google/callback\",\"code\":\"invalid_credentials\"}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockOIDCService
+			test.mock(&mockService)
+			handler := NewOIDCHandler(&mockService, utils.CookieOptions{SameSite: http.SameSiteStrictMode})
+
+			var cookies []*http.Cookie
+			if test.stateCookie != "" {
+				cookies = append(cookies, &http.Cookie{Name: loginStateCookie, Value: test.stateCookie})
+			}
+			rec := serveOIDC(handler, test.target, cookies...)
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, test.wantBody, rec.Body.String())
+			mockService.AssertExpectations(t)
+
+			// The state cookie is cleared whatever the outcome
+			if cookie := findCookie(rec, loginStateCookie); assert.NotNil(t, cookie) {
+				assert.Empty(t, cookie.Value)
+				assert.True(t, cookie.Expires.Before(time.Now()))
+			}
+
+			refresh := findCookie(rec, "refresh_token")
+			if test.wantRefresh && assert.NotNil(t, refresh) {
+				assert.Equal(t, "refresh_token", refresh.Value)
+				assert.Equal(t, "/api/v1/key/refresh", refresh.Path)
+			} else if !test.wantRefresh {
+				assert.Nil(t, refresh)
+			}
+		})
+	}
+}
+
+func TestListIdentities(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	identity := models.Identity{Provider: "google", Email: "alice@example.com", EmailVerified: true}
+	identity.ID = 3
+	identity.CreatedAt = createdAt
+
+	var mockService MockOIDCService
+	mockService.On("ListIdentities").Return(usecase.Credentials{Password: true, Identities: []models.Identity{identity}}, nil)
+	handler := NewOIDCHandler(&mockService, utils.CookieOptions{})
+
+	rec := serveOIDCRequest(handler, httptest.NewRequest(http.MethodGet, "/api/v1/jwt/identities", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"data\":{\"password\":true,\"identities\":[{\"id\":3,\"provider\":\"google\",\"email\":\"alice@example.com\",\"email_verified\":true,\"created_at\":\"2024-01-02T03:04:05Z\"}]},\"message\":\"Successfully fetched identities\"}\n", rec.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestLinkIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		mock     func(m *MockOIDCService)
+		wantCode int
+	}{
+		{
+			name: "starts linking",
+			body: `{"provider":"google","password":"password"}`,
+			mock: func(m *MockOIDCService) {
+				m.On("StartLink", "google", "password").Return(usecase.OIDCLogin{
+					URL:       "https://accounts.google.com/authorize?state=abc",
+					State:     "sealed",
+					ExpiresAt: time.Now().Add(10 * time.Minute),
+				}, nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "missing provider",
+			body:     `{"password":"password"}`,
+			mock:     func(m *MockOIDCService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "not re-authenticated",
+			body: `{"provider":"google"}`,
+			mock: func(m *MockOIDCService) {
+				m.On("StartLink", "google", "").Return(usecase.OIDCLogin{}, utils.ErrInvalidCredentials)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockOIDCService
+			test.mock(&mockService)
+			handler := NewOIDCHandler(&mockService, utils.CookieOptions{SameSite: http.SameSiteStrictMode})
+
+			rec := serveOIDCRequest(handler, newJSONRequest(http.MethodPost, "/api/v1/jwt/identities", test.body))
+			assert.Equal(t, test.wantCode, rec.Code)
+			mockService.AssertExpectations(t)
+			if test.wantCode != http.StatusOK {
+				assert.Nil(t, findCookie(rec, loginStateCookie))
+				return
+			}
+
+			assert.Contains(t, rec.Body.String(), "\"authorization_url\":\"https://accounts.google.com/authorize?state=abc\"")
+			// The provider redirects back to the callback of sign-ins
+			cookie := findCookie(rec, loginStateCookie)
+			if assert.NotNil(t, cookie) {
+				assert.Equal(t, "sealed", cookie.Value)
+				assert.Equal(t, "/api/v1/oidc/google/callback", cookie.Path)
+				assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+			}
+		})
+	}
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		mock     func(m *MockOIDCService)
+		wantCode int
+	}{
+		{
+			name:   "unlinks",
+			target: "/api/v1/jwt/identities/3",
+			mock: func(m *MockOIDCService) {
+				m.On("UnlinkIdentity", uint(3), "password").Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "last way to sign in",
+			target: "/api/v1/jwt/identities/3",
+			mock: func(m *MockOIDCService) {
+				m.On("UnlinkIdentity", uint(3), "password").Return(utils.ErrConflict.WithDetail("The last way to sign in cannot be removed."))
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "invalid id",
+			target:   "/api/v1/jwt/identities/google",
+			mock:     func(m *MockOIDCService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockOIDCService
+			test.mock(&mockService)
+			handler := NewOIDCHandler(&mockService, utils.CookieOptions{})
+
+			rec := serveOIDCRequest(handler, newJSONRequest(http.MethodDelete, test.target, `{"password":"password"}`))
+			assert.Equal(t, test.wantCode, rec.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type OrganizationService interface {
+	CreateOrganization(ctx context.Context, name string) (*models.Organization, error)
+	ListOrganizations(ctx context.Context) ([]models.Membership, error)
+	SwitchOrganization(ctx context.Context, orgID uint) (utils.TokenPair, error)
+	ListMembers(ctx context.Context, orgID uint) ([]models.Membership, error)
+	UpdateMemberRole(ctx context.Context, orgID, userID uint, role string) error
+	RemoveMember(ctx context.Context, orgID, userID uint) error
+	InviteMember(ctx context.Context, orgID uint, email, role string) (*models.Invitation, error)
+	ListInvitations(ctx context.Context, orgID uint) ([]models.Invitation, error)
+	RevokeInvitation(ctx context.Context, orgID, invitationID uint) error
+	AcceptInvitation(ctx context.Context, token string) (*models.Membership, error)
+}
+
+type OrganizationHandler struct {
+	Service OrganizationService
+	Cookie  utils.CookieOptions
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type OrganizationResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListOrganizationsResponse struct {
+	Organizations []OrganizationResponse `json:"organizations"`
+}
+
+type SwitchOrganizationResponse struct {
+	AccessToken    string `json:"access_token"`
+	OrganizationID uint   `json:"organization_id"`
+}
+
+type MemberResponse struct {
+	UserID   uint      `json:"user_id"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type ListMembersResponse struct {
+	Members []MemberResponse `json:"members"`
+}
+
+type InvitationResponse struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListInvitationsResponse struct {
+	Invitations []InvitationResponse `json:"invitations"`
+}
+
+func NewOrganizationHandler(service OrganizationService, cookie utils.CookieOptions) *OrganizationHandler {
+	return &OrganizationHandler{
+		Service: service,
+		Cookie:  cookie,
+	}
+}
+
+func newOrganizationResponse(membership models.Membership) OrganizationResponse {
+	return OrganizationResponse{
+		ID:        membership.Organization.ID,
+		Name:      membership.Organization.Name,
+		Role:      membership.Role,
+		CreatedAt: membership.Organization.CreatedAt,
+	}
+}
+
+func newMemberResponse(membership models.Membership) MemberResponse {
+	return MemberResponse{
+		UserID:   membership.UserID,
+		Email:    membership.User.Email,
+		Role:     membership.Role,
+		JoinedAt: membership.CreatedAt,
+	}
+}
+
+func newInvitationResponse(invitation models.Invitation) InvitationResponse {
+	return InvitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt,
+		CreatedAt: invitation.CreatedAt,
+	}
+}
+
+// CreateOrganization makes the calling user the owner of a new organization.
+func (h *OrganizationHandler) CreateOrganization(ctx echo.Context) error {
+	var req CreateOrganizationRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return err
+	}
+
+	org, err := h.Service.CreateOrganization(ctx.Request().Context(), req.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	response := OrganizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      models.OrgRoleOwner,
+		CreatedAt: org.CreatedAt,
+	}
+	return utils.NewResponse(http.StatusCreated, "Successfully created organization", response).JSONResponse(ctx)
+}
+
+// ListOrganizations lists the organizations of the calling user with the
+// user's role in each.
+func (h *OrganizationHandler) ListOrganizations(ctx echo.Context) error {
+	memberships, err := h.Service.ListOrganizations(ctx.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	response := ListOrganizationsResponse{
+		Organizations: make([]OrganizationResponse, 0, len(memberships)),
+	}
+	for _, membership := range memberships {
+		response.Organizations = append(response.Organizations, newOrganizationResponse(membership))
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched organizations", response)
+}
+
+// SwitchOrganization issues tokens carrying the organization, setting the
+// refresh token cookie like sign-up does.
+func (h *OrganizationHandler) SwitchOrganization(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := h.Service.SwitchOrganization(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to switch organization: %w", err)
+	}
+
+	utils.SetCookie(ctx, h.Cookie, "refresh_token", tokens.RefreshToken, refreshCookiePath(ctx), tokens.RefreshTokenExpiresAt)
+
+	response := SwitchOrganizationResponse{
+		AccessToken:    tokens.AccessToken,
+		OrganizationID: id,
+	}
+	return utils.StatusOKResponse(ctx, "Successfully switched organization", response)
+}
+
+func (h *OrganizationHandler) ListMembers(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	members, err := h.Service.ListMembers(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to list members: %w", err)
+	}
+
+	response := ListMembersResponse{
+		Members: make([]MemberResponse, 0, len(members)),
+	}
+	for _, member := range members {
+		response.Members = append(response.Members, newMemberResponse(member))
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched members", response)
+}
+
+func (h *OrganizationHandler) UpdateMemberRole(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	userID, err := pathUint(ctx, "user_id")
+	if err != nil {
+		return err
+	}
+
+	var req UpdateMemberRoleRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return err
+	}
+
+	if err := h.Service.UpdateMemberRole(ctx.Request().Context(), id, userID, req.Role); err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully updated member role", nil)
+}
+
+// RemoveMember also lets members leave an organization by removing
+// themselves.
+func (h *OrganizationHandler) RemoveMember(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	userID, err := pathUint(ctx, "user_id")
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.RemoveMember(ctx.Request().Context(), id, userID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully removed member", nil)
+}
+
+// InviteMember creates an invitation. Its token is not part of the response;
+// it is sent to invitation.created webhook subscribers, who email it.
+func (h *OrganizationHandler) InviteMember(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req InviteMemberRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return err
+	}
+
+	invitation, err := h.Service.InviteMember(ctx.Request().Context(), id, req.Email, req.Role)
+	if err != nil {
+		return fmt.Errorf("failed to invite member: %w", err)
+	}
+
+	return utils.NewResponse(http.StatusCreated, "Successfully invited member", newInvitationResponse(*invitation)).JSONResponse(ctx)
+}
+
+func (h *OrganizationHandler) ListInvitations(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	invitations, err := h.Service.ListInvitations(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	response := ListInvitationsResponse{
+		Invitations: make([]InvitationResponse, 0, len(invitations)),
+	}
+	for _, invitation := range invitations {
+		response.Invitations = append(response.Invitations, newInvitationResponse(invitation))
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched invitations", response)
+}
+
+func (h *OrganizationHandler) RevokeInvitation(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	invitationID, err := pathUint(ctx, "invitation_id")
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.RevokeInvitation(ctx.Request().Context(), id, invitationID); err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully revoked invitation", nil)
+}
+
+// AcceptInvitation joins the organization of an invitation addressed to the
+// calling user. New users accept theirs by signing up with it instead.
+func (h *OrganizationHandler) AcceptInvitation(ctx echo.Context) error {
+	var req AcceptInvitationRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return err
+	}
+
+	membership, err := h.Service.AcceptInvitation(ctx.Request().Context(), req.Token)
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully accepted invitation", newOrganizationResponse(*membership))
+}
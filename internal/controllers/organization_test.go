@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOrganizationService struct {
+	mock.Mock
+}
+
+func (m *MockOrganizationService) CreateOrganization(ctx context.Context, name string) (*models.Organization, error) {
+	args := m.Called(name)
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockOrganizationService) ListOrganizations(ctx context.Context) ([]models.Membership, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Membership), args.Error(1)
+}
+
+func (m *MockOrganizationService) SwitchOrganization(ctx context.Context, orgID uint) (utils.TokenPair, error) {
+	args := m.Called(orgID)
+	return args.Get(0).(utils.TokenPair), args.Error(1)
+}
+
+func (m *MockOrganizationService) ListMembers(ctx context.Context, orgID uint) ([]models.Membership, error) {
+	args := m.Called(orgID)
+	return args.Get(0).([]models.Membership), args.Error(1)
+}
+
+func (m *MockOrganizationService) UpdateMemberRole(ctx context.Context, orgID, userID uint, role string) error {
+	args := m.Called(orgID, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationService) RemoveMember(ctx context.Context, orgID, userID uint) error {
+	args := m.Called(orgID, userID)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationService) InviteMember(ctx context.Context, orgID uint, email, role string) (*models.Invitation, error) {
+	args := m.Called(orgID, email, role)
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
+func (m *MockOrganizationService) ListInvitations(ctx context.Context, orgID uint) ([]models.Invitation, error) {
+	args := m.Called(orgID)
+	return args.Get(0).([]models.Invitation), args.Error(1)
+}
+
+func (m *MockOrganizationService) RevokeInvitation(ctx context.Context, orgID, invitationID uint) error {
+	args := m.Called(orgID, invitationID)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationService) AcceptInvitation(ctx context.Context, token string) (*models.Membership, error) {
+	args := m.Called(token)
+	return args.Get(0).(*models.Membership), args.Error(1)
+}
+
+func TestSwitchOrganization(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		mock       func(mockOrgService *MockOrganizationService)
+		wantCode   int
+		wantCookie bool
+	}{
+		{
+			name: "member",
+			id:   "5",
+			mock: func(mockOrgService *MockOrganizationService) {
+				mockOrgService.On("SwitchOrganization", uint(5)).Return(utils.TokenPair{
+					AccessToken:           "access_token",
+					RefreshToken:          "refresh_token",
+					RefreshTokenExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+			},
+			wantCode:   http.StatusOK,
+			wantCookie: true,
+		},
+		{
+			name: "not a member",
+			id:   "6",
+			mock: func(mockOrgService *MockOrganizationService) {
+				mockOrgService.On("SwitchOrganization", uint(6)).Return(utils.TokenPair{}, utils.ErrNotFound)
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "invalid id",
+			id:       "abc",
+			mock:     func(mockOrgService *MockOrganizationService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockOrgService MockOrganizationService
+			test.mock(&mockOrgService)
+			h := NewOrganizationHandler(&mockOrgService, utils.CookieOptions{})
+
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jwt/orgs/"+test.id+"/switch", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(test.id)
+
+			if err := h.SwitchOrganization(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantCookie {
+				assert.Contains(t, rec.Header().Get(echo.HeaderSetCookie), "Path=/api/v1/key/refresh")
+				assert.Contains(t, rec.Body.String(), "\"organization_id\":5")
+			}
+			mockOrgService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestInviteMember(t *testing.T) {
+	expiresAt := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		body     string
+		mock     func(mockOrgService *MockOrganizationService)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "success",
+			body: `{"email":"new@test.com","role":"member"}`,
+			mock: func(mockOrgService *MockOrganizationService) {
+				mockOrgService.On("InviteMember", uint(5), "new@test.com", "member").Return(&models.Invitation{
+					ID:        9,
+					Email:     "new@test.com",
+					Role:      "member",
+					TokenHash: "hash",
+					ExpiresAt: expiresAt,
+				}, nil)
+			},
+			wantCode: http.StatusCreated,
+			wantBody: "{\"data\":{\"id\":9,\"email\":\"new@test.com\",\"role\":\"member\",\"expires_at\":\"2024-01-08T00:00:00Z\",\"created_at\":\"0001-01-01T00:00:00Z\"},\"message\":\"Successfully invited member\"}\n",
+		},
+		{
+			name:     "invalid email",
+			body:     `{"email":"new","role":"member"}`,
+			mock:     func(mockOrgService *MockOrganizationService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "forbidden",
+			body: `{"email":"new@test.com","role":"owner"}`,
+			mock: func(mockOrgService *MockOrganizationService) {
+				mockOrgService.On("InviteMember", uint(5), "new@test.com", "owner").Return((*models.Invitation)(nil), utils.ErrForbidden)
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockOrgService MockOrganizationService
+			test.mock(&mockOrgService)
+			h := NewOrganizationHandler(&mockOrgService, utils.CookieOptions{})
+
+			e := echo.New()
+			e.Validator = utils.NewCustomValidator()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("5")
+
+			if err := h.InviteMember(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, rec.Body.String())
+			}
+			mockOrgService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	var mockOrgService MockOrganizationService
+	mockOrgService.On("RemoveMember", uint(5), uint(2)).Return(nil)
+	h := NewOrganizationHandler(&mockOrgService, utils.CookieOptions{})
+
+	e := echo.New()
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("id", "user_id")
+	ctx.SetParamValues("5", "2")
+
+	assert.NoError(t, h.RemoveMember(ctx))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockOrgService.AssertExpectations(t)
+
+	ctx = e.NewContext(req, httptest.NewRecorder())
+	ctx.SetParamNames("id", "user_id")
+	ctx.SetParamValues("5", "me")
+	assert.ErrorIs(t, h.RemoveMember(ctx), utils.ErrBadRequest)
+}
@@ -1,7 +1,8 @@
 package controllers
 
 import (
-	"log"
+	"context"
+	"fmt"
 
 	"github.com/soicchi/auth_api/internal/utils"
 
@@ -13,7 +14,7 @@ type RefreshTokenHandler struct {
 }
 
 type RefreshTokenService interface {
-	RefreshAccessToken(token string) (string, error)
+	RefreshAccessToken(ctx context.Context, token string, overrides utils.TokenOverrides) (string, error)
 }
 
 type refreshTokenResponse struct {
@@ -35,14 +36,12 @@ func newRefreshTokenResponse(accessToken string) refreshTokenResponse {
 func (h *RefreshTokenHandler) PostRefreshToken(ctx echo.Context) error {
 	token, err := ctx.Cookie("refresh_token")
 	if err != nil {
-		log.Printf("failed to get cookie: %v", err)
-		return utils.BadRequestResponse(ctx, "bad request")
+		return utils.ErrTokenMissing.WithDetail("The refresh_token cookie is missing.").Wrap(err)
 	}
 
-	accessToken, err := h.Service.RefreshAccessToken(token.Value)
+	accessToken, err := h.Service.RefreshAccessToken(ctx.Request().Context(), token.Value, utils.TokenOverridesFromContext(ctx))
 	if err != nil {
-		log.Printf("failed to refresh access token: %v", err)
-		return utils.BadRequestResponse(ctx, "bad request")
+		return fmt.Errorf("failed to refresh access token: %w", err)
 	}
 
 	response := newRefreshTokenResponse(accessToken)
@@ -1,11 +1,13 @@
 package controllers
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/soicchi/auth_api/internal/utils"
+
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,8 +17,8 @@ type MockRefreshTokenService struct {
 	mock.Mock
 }
 
-func (m *MockRefreshTokenService) RefreshAccessToken(token string) (string, error) {
-	args := m.Called(token)
+func (m *MockRefreshTokenService) RefreshAccessToken(ctx context.Context, token string, overrides utils.TokenOverrides) (string, error) {
+	args := m.Called(token, overrides)
 	return args.String(0), args.Error(1)
 }
 
@@ -30,7 +32,7 @@ func TestPostRefreshToken(t *testing.T) {
 		{
 			name: "success to refresh access token",
 			mock: func(mockRefreshTokenService *MockRefreshTokenService) {
-				mockRefreshTokenService.On("RefreshAccessToken", "refresh_token").Return("token", nil)
+				mockRefreshTokenService.On("RefreshAccessToken", "refresh_token", utils.TokenOverrides{}).Return("token", nil)
 			},
 			wantBody: "{\"data\":{\"access_token\":\"token\"},\"message\":\"New access token has been issued\"}\n",
 			wantCode: http.StatusOK,
@@ -38,10 +40,10 @@ func TestPostRefreshToken(t *testing.T) {
 		{
 			name: "failed to refresh access token",
 			mock: func(mockRefreshTokenService *MockRefreshTokenService) {
-				mockRefreshTokenService.On("RefreshAccessToken", "refresh_token").Return("", fmt.Errorf("failed to verify refresh token"))
+				mockRefreshTokenService.On("RefreshAccessToken", "refresh_token", utils.TokenOverrides{}).Return("", utils.ErrTokenExpired.WithDetail("The refresh token has expired."))
 			},
-			wantBody: "{\"data\":null,\"message\":\"bad request\"}\n",
-			wantCode: http.StatusBadRequest,
+			wantBody: "{\"type\":\"/problems/token_expired\",\"title\":\"Token expired\",\"status\":401,\"detail\":\"The refresh token has expired.\",\"instance\":\"/key/refresh\",\"code\":\"token_expired\"}",
+			wantCode: http.StatusUnauthorized,
 		},
 	}
 
@@ -54,6 +56,7 @@ func TestPostRefreshToken(t *testing.T) {
 				Service: &mockRefreshTokenService,
 			}
 			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
 			req := httptest.NewRequest(http.MethodPost, "/key/refresh", nil)
 			req.AddCookie(&http.Cookie{
 				Name:  "refresh_token",
@@ -63,7 +66,9 @@ func TestPostRefreshToken(t *testing.T) {
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			h.PostRefreshToken(ctx)
+			if err := h.PostRefreshToken(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
 			assert.Equal(t, test.wantCode, rec.Code)
 			assert.Equal(t, test.wantBody, rec.Body.String())
 		})
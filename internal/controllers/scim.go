@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SCIMPrefix is where the SCIM endpoints are served.
+const SCIMPrefix = "/scim/v2"
+
+// Conditional request headers, which echo has no constants for.
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+type SCIMService interface {
+	ListUsers(ctx context.Context, filter string, startIndex, count int) ([]models.User, int64, error)
+	FetchUser(ctx context.Context, userID uint) (*models.User, error)
+	CreateUser(ctx context.Context, resource scim.User) (*models.User, error)
+	ReplaceUser(ctx context.Context, userID uint, resource scim.User, ifMatch string) (*models.User, error)
+	PatchUser(ctx context.Context, userID uint, patch scim.PatchRequest, ifMatch string) (*models.User, error)
+	DeleteUser(ctx context.Context, userID uint, ifMatch string) error
+	ListGroups(ctx context.Context, filter string, startIndex, count int) ([]usecase.SCIMGroup, int64, error)
+	FetchGroup(ctx context.Context, orgID uint) (*usecase.SCIMGroup, error)
+	CreateGroup(ctx context.Context, resource scim.Group) (*usecase.SCIMGroup, error)
+	ReplaceGroup(ctx context.Context, orgID uint, resource scim.Group, ifMatch string) (*usecase.SCIMGroup, error)
+	PatchGroup(ctx context.Context, orgID uint, patch scim.PatchRequest, ifMatch string) (*usecase.SCIMGroup, error)
+	DeleteGroup(ctx context.Context, orgID uint, ifMatch string) error
+}
+
+type SCIMHandler struct {
+	Service SCIMService
+}
+
+func NewSCIMHandler(service SCIMService) *SCIMHandler {
+	return &SCIMHandler{
+		Service: service,
+	}
+}
+
+// ServiceProviderConfig describes the supported SCIM features to clients.
+func (h *SCIMHandler) ServiceProviderConfig(ctx echo.Context) error {
+	supported := func(b bool) map[string]interface{} {
+		return map[string]interface{}{"supported": b}
+	}
+
+	config := map[string]interface{}{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": usecase.DefaultSCIMPageSize},
+		"changePassword": supported(true),
+		"sort":           supported(false),
+		"etag":           supported(true),
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A token minted with authctl mint-scim-token.",
+			"primary":     true,
+		}},
+	}
+	return scimResponse(ctx, http.StatusOK, config)
+}
+
+func (h *SCIMHandler) ListUsers(ctx echo.Context) error {
+	filter, startIndex, count, err := scimListParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	users, total, err := h.Service.ListUsers(ctx.Request().Context(), filter, startIndex, count)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	resources := make([]scim.User, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, newSCIMUser(ctx, user))
+	}
+
+	return scimResponse(ctx, http.StatusOK, scim.NewListResponse(total, startIndex, len(resources), resources))
+}
+
+// FetchUser answers 304 when If-None-Match lists the current version.
+func (h *SCIMHandler) FetchUser(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.Service.FetchUser(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusOK, newSCIMUser(ctx, *user))
+}
+
+func (h *SCIMHandler) CreateUser(ctx echo.Context) error {
+	var resource scim.User
+	if err := bindSCIM(ctx, &resource); err != nil {
+		return err
+	}
+
+	user, err := h.Service.CreateUser(ctx.Request().Context(), resource)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusCreated, newSCIMUser(ctx, *user))
+}
+
+func (h *SCIMHandler) ReplaceUser(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var resource scim.User
+	if err := bindSCIM(ctx, &resource); err != nil {
+		return err
+	}
+
+	user, err := h.Service.ReplaceUser(ctx.Request().Context(), id, resource, ctx.Request().Header.Get(headerIfMatch))
+	if err != nil {
+		return fmt.Errorf("failed to replace user: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusOK, newSCIMUser(ctx, *user))
+}
+
+func (h *SCIMHandler) PatchUser(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var patch scim.PatchRequest
+	if err := bindSCIM(ctx, &patch); err != nil {
+		return err
+	}
+
+	user, err := h.Service.PatchUser(ctx.Request().Context(), id, patch, ctx.Request().Header.Get(headerIfMatch))
+	if err != nil {
+		return fmt.Errorf("failed to patch user: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusOK, newSCIMUser(ctx, *user))
+}
+
+func (h *SCIMHandler) DeleteUser(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.DeleteUser(ctx.Request().Context(), id, ctx.Request().Header.Get(headerIfMatch)); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(ctx echo.Context) error {
+	filter, startIndex, count, err := scimListParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups, total, err := h.Service.ListGroups(ctx.Request().Context(), filter, startIndex, count)
+	if err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	resources := make([]scim.Group, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, newSCIMGroup(ctx, group))
+	}
+
+	return scimResponse(ctx, http.StatusOK, scim.NewListResponse(total, startIndex, len(resources), resources))
+}
+
+// FetchGroup answers 304 when If-None-Match lists the current version.
+func (h *SCIMHandler) FetchGroup(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.Service.FetchGroup(ctx.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch group: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusOK, newSCIMGroup(ctx, *group))
+}
+
+func (h *SCIMHandler) CreateGroup(ctx echo.Context) error {
+	var resource scim.Group
+	if err := bindSCIM(ctx, &resource); err != nil {
+		return err
+	}
+
+	group, err := h.Service.CreateGroup(ctx.Request().Context(), resource)
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusCreated, newSCIMGroup(ctx, *group))
+}
+
+func (h *SCIMHandler) ReplaceGroup(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var resource scim.Group
+	if err := bindSCIM(ctx, &resource); err != nil {
+		return err
+	}
+
+	group, err := h.Service.ReplaceGroup(ctx.Request().Context(), id, resource, ctx.Request().Header.Get(headerIfMatch))
+	if err != nil {
+		return fmt.Errorf("failed to replace group: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusOK, newSCIMGroup(ctx, *group))
+}
+
+func (h *SCIMHandler) PatchGroup(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var patch scim.PatchRequest
+	if err := bindSCIM(ctx, &patch); err != nil {
+		return err
+	}
+
+	group, err := h.Service.PatchGroup(ctx.Request().Context(), id, patch, ctx.Request().Header.Get(headerIfMatch))
+	if err != nil {
+		return fmt.Errorf("failed to patch group: %w", err)
+	}
+
+	return scimResource(ctx, http.StatusOK, newSCIMGroup(ctx, *group))
+}
+
+func (h *SCIMHandler) DeleteGroup(ctx echo.Context) error {
+	id, err := scimID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.DeleteGroup(ctx.Request().Context(), id, ctx.Request().Header.Get(headerIfMatch)); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func newSCIMUser(ctx echo.Context, user models.User) scim.User {
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	active := user.DisabledAt == nil
+	return scim.User{
+		Schemas:    []string{scim.SchemaUser},
+		ID:         id,
+		ExternalID: user.ExternalID,
+		UserName:   user.Email,
+		Active:     &active,
+		Emails:     []scim.MultiValue{{Value: user.Email, Primary: true}},
+		Roles:      []scim.MultiValue{{Value: user.Role, Primary: true}},
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimLocation(ctx, "Users", id),
+			Version:      scim.Version(user.UpdatedAt),
+		},
+	}
+}
+
+func newSCIMGroup(ctx echo.Context, group usecase.SCIMGroup) scim.Group {
+	org := group.Organization
+	id := strconv.FormatUint(uint64(org.ID), 10)
+	members := make([]scim.MultiValue, 0, len(group.Members))
+	for _, member := range group.Members {
+		userID := strconv.FormatUint(uint64(member.UserID), 10)
+		members = append(members, scim.MultiValue{
+			Value:   userID,
+			Display: member.User.Email,
+			Ref:     scimLocation(ctx, "Users", userID),
+		})
+	}
+
+	return scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          id,
+		ExternalID:  org.ExternalID,
+		DisplayName: org.Name,
+		Members:     members,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      org.CreatedAt,
+			LastModified: org.UpdatedAt,
+			Location:     scimLocation(ctx, "Groups", id),
+			Version:      scim.Version(org.UpdatedAt),
+		},
+	}
+}
+
+func scimLocation(ctx echo.Context, resourceType, id string) string {
+	return ctx.Scheme() + "://" + ctx.Request().Host + SCIMPrefix + "/" + resourceType + "/" + id
+}
+
+// scimID reads the resource ID from the path. IDs that cannot exist are not
+// found rather than malformed.
+func scimID(ctx echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, utils.ErrNotFound.WithDetail("The resource was not found.")
+	}
+
+	return uint(id), nil
+}
+
+// scimListParams reads the filter and the 1-based page of a list request.
+func scimListParams(ctx echo.Context) (filter string, startIndex, count int, err error) {
+	startIndex, count = 1, usecase.DefaultSCIMPageSize
+	err = echo.QueryParamsBinder(ctx).
+		String("filter", &filter).
+		Int("startIndex", &startIndex).
+		Int("count", &count).
+		BindError()
+	if err != nil {
+		return "", 0, 0, utils.ErrBadRequest.WithDetail("startIndex and count must be integers.").Wrap(err)
+	}
+
+	return filter, max(startIndex, 1), count, nil
+}
+
+// bindSCIM decodes a JSON body, which echo's binder rejects when it is sent
+// as application/scim+json.
+func bindSCIM(ctx echo.Context, v interface{}) error {
+	if err := json.NewDecoder(ctx.Request().Body).Decode(v); err != nil {
+		return utils.ErrBadRequest.WithDetail("The request body is not valid JSON.").Wrap(err)
+	}
+
+	return nil
+}
+
+// scimResource renders a single resource with its version as the ETag.
+func scimResource(ctx echo.Context, status int, resource interface{}) error {
+	var version string
+	switch r := resource.(type) {
+	case scim.User:
+		version = r.Meta.Version
+	case scim.Group:
+		version = r.Meta.Version
+	}
+
+	ctx.Response().Header().Set(headerETag, version)
+	if ctx.Request().Method == http.MethodGet && scim.MatchesVersion(ctx.Request().Header.Get(headerIfNoneMatch), version) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
+	return scimResponse(ctx, status, resource)
+}
+
+func scimResponse(ctx echo.Context, status int, body interface{}) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scim response: %w", err)
+	}
+
+	return ctx.Blob(status, scim.MIMEApplicationSCIMJSON, encoded)
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockSCIMService struct {
+	mock.Mock
+}
+
+func (m *MockSCIMService) ListUsers(ctx context.Context, filter string, startIndex, count int) ([]models.User, int64, error) {
+	args := m.Called(filter, startIndex, count)
+	return args.Get(0).([]models.User), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockSCIMService) FetchUser(ctx context.Context, userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockSCIMService) CreateUser(ctx context.Context, resource scim.User) (*models.User, error) {
+	args := m.Called(resource)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockSCIMService) ReplaceUser(ctx context.Context, userID uint, resource scim.User, ifMatch string) (*models.User, error) {
+	args := m.Called(userID, resource, ifMatch)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockSCIMService) PatchUser(ctx context.Context, userID uint, patch scim.PatchRequest, ifMatch string) (*models.User, error) {
+	args := m.Called(userID, patch, ifMatch)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockSCIMService) DeleteUser(ctx context.Context, userID uint, ifMatch string) error {
+	args := m.Called(userID, ifMatch)
+	return args.Error(0)
+}
+
+func (m *MockSCIMService) ListGroups(ctx context.Context, filter string, startIndex, count int) ([]usecase.SCIMGroup, int64, error) {
+	args := m.Called(filter, startIndex, count)
+	return args.Get(0).([]usecase.SCIMGroup), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockSCIMService) FetchGroup(ctx context.Context, orgID uint) (*usecase.SCIMGroup, error) {
+	args := m.Called(orgID)
+	return args.Get(0).(*usecase.SCIMGroup), args.Error(1)
+}
+
+func (m *MockSCIMService) CreateGroup(ctx context.Context, resource scim.Group) (*usecase.SCIMGroup, error) {
+	args := m.Called(resource)
+	return args.Get(0).(*usecase.SCIMGroup), args.Error(1)
+}
+
+func (m *MockSCIMService) ReplaceGroup(ctx context.Context, orgID uint, resource scim.Group, ifMatch string) (*usecase.SCIMGroup, error) {
+	args := m.Called(orgID, resource, ifMatch)
+	return args.Get(0).(*usecase.SCIMGroup), args.Error(1)
+}
+
+func (m *MockSCIMService) PatchGroup(ctx context.Context, orgID uint, patch scim.PatchRequest, ifMatch string) (*usecase.SCIMGroup, error) {
+	args := m.Called(orgID, patch, ifMatch)
+	return args.Get(0).(*usecase.SCIMGroup), args.Error(1)
+}
+
+func (m *MockSCIMService) DeleteGroup(ctx context.Context, orgID uint, ifMatch string) error {
+	args := m.Called(orgID, ifMatch)
+	return args.Error(0)
+}
+
+var scimTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestSCIMUser() *models.User {
+	return &models.User{
+		Model:      gorm.Model{ID: 2, CreatedAt: scimTime, UpdatedAt: scimTime},
+		Email:      "user@test.com",
+		ExternalID: "ext-2",
+		Role:       models.RoleUser,
+	}
+}
+
+// serveSCIM calls handler for a request with the id path parameter, if any,
+// rendering errors as the SCIM routes do.
+func serveSCIM(handler echo.HandlerFunc, req *http.Request, id string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.HTTPErrorHandler = utils.SCIMErrorHandler
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	if id != "" {
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+	}
+
+	if err := handler(ctx); err != nil {
+		e.HTTPErrorHandler(err, ctx)
+	}
+
+	return rec
+}
+
+func TestSCIMFetchUser(t *testing.T) {
+	version := scim.Version(scimTime)
+	tests := []struct {
+		name        string
+		id          string
+		ifNoneMatch string
+		wantMock    func(mockService *MockSCIMService)
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name: "success",
+			id:   "2",
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("FetchUser", uint(2)).Return(newTestSCIMUser(), nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"2","externalId":"ext-2","userName":"user@test.com","active":true,"emails":[{"value":"user@test.com","primary":true}],"roles":[{"value":"user","primary":true}],"meta":{"resourceType":"User","created":"2024-01-02T03:04:05Z","lastModified":"2024-01-02T03:04:05Z","location":"http://example.com/scim/v2/Users/2","version":"` + strings.ReplaceAll(version, `"`, `\"`) + `"}}`,
+		},
+		{
+			name:        "not modified",
+			id:          "2",
+			ifNoneMatch: version,
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("FetchUser", uint(2)).Return(newTestSCIMUser(), nil)
+			},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name: "unknown user",
+			id:   "3",
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("FetchUser", uint(3)).Return((*models.User)(nil), utils.ErrNotFound)
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "invalid id",
+			id:       "me",
+			wantMock: func(mockService *MockSCIMService) {},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockSCIMService
+			test.wantMock(&mockService)
+			h := NewSCIMHandler(&mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users/"+test.id, nil)
+			if test.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			rec := serveSCIM(h.FetchUser, req, test.id)
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantCode != http.StatusNotModified {
+				assert.Equal(t, scim.MIMEApplicationSCIMJSON, rec.Header().Get(echo.HeaderContentType))
+			}
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, rec.Body.String())
+				assert.Equal(t, version, rec.Header().Get("ETag"))
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMListUsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantMock func(mockService *MockSCIMService)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:  "filtered page",
+			query: "?filter=" + strings.ReplaceAll(`userName eq "user@test.com"`, " ", "+") + "&startIndex=1&count=5",
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("ListUsers", `userName eq "user@test.com"`, 1, 5).Return([]models.User{}, int64(0), nil)
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"schemas":["urn:ietf:params:scim:api:messages:2.0:ListResponse"],"totalResults":0,"startIndex":1,"itemsPerPage":0,"Resources":[]}`,
+		},
+		{
+			name: "defaults",
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("ListUsers", "", 1, usecase.DefaultSCIMPageSize).Return([]models.User{*newTestSCIMUser()}, int64(1), nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "invalid count",
+			query:    "?count=ten",
+			wantMock: func(mockService *MockSCIMService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:  "invalid filter",
+			query: "?filter=bogus",
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("ListUsers", "bogus", 1, usecase.DefaultSCIMPageSize).Return([]models.User(nil), int64(0), utils.ErrInvalidFilter)
+			},
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"400","scimType":"invalidFilter","detail":"The filter could not be parsed."}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockSCIMService
+			test.wantMock(&mockService)
+			h := NewSCIMHandler(&mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users"+test.query, nil)
+			rec := serveSCIM(h.ListUsers, req, "")
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantBody != "" {
+				assert.JSONEq(t, test.wantBody, rec.Body.String())
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMCreateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantMock func(mockService *MockSCIMService)
+		wantCode int
+	}{
+		{
+			name: "success",
+			body: `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"user@test.com","externalId":"ext-2"}`,
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("CreateUser", scim.User{
+					Schemas:    []string{scim.SchemaUser},
+					UserName:   "user@test.com",
+					ExternalID: "ext-2",
+				}).Return(newTestSCIMUser(), nil)
+			},
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "invalid json",
+			body:     `{"userName":`,
+			wantMock: func(mockService *MockSCIMService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "userName taken",
+			body: `{"userName":"user@test.com"}`,
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("CreateUser", scim.User{UserName: "user@test.com"}).Return((*models.User)(nil), utils.ErrEmailTaken)
+			},
+			wantCode: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockSCIMService
+			test.wantMock(&mockService)
+			h := NewSCIMHandler(&mockService)
+
+			req := httptest.NewRequest(http.MethodPost, "/scim/v2/Users", strings.NewReader(test.body))
+			req.Header.Set(echo.HeaderContentType, scim.MIMEApplicationSCIMJSON)
+			rec := serveSCIM(h.CreateUser, req, "")
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, scim.MIMEApplicationSCIMJSON, rec.Header().Get(echo.HeaderContentType))
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMPatchGroup(t *testing.T) {
+	patch := scim.PatchRequest{
+		Schemas:    []string{scim.SchemaPatchOp},
+		Operations: []scim.PatchOperation{{Op: "add", Path: "members", Value: []byte(`[{"value":"2"}]`)}},
+	}
+	tests := []struct {
+		name     string
+		ifMatch  string
+		wantMock func(mockService *MockSCIMService)
+		wantCode int
+	}{
+		{
+			name:    "success",
+			ifMatch: `W/"v1"`,
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("PatchGroup", uint(5), patch, `W/"v1"`).Return(&usecase.SCIMGroup{
+					Organization: models.Organization{Model: gorm.Model{ID: 5, CreatedAt: scimTime, UpdatedAt: scimTime}, Name: "Engineering"},
+					Members:      []models.Membership{{OrganizationID: 5, UserID: 2, User: *newTestSCIMUser()}},
+				}, nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:    "stale version",
+			ifMatch: `W/"v0"`,
+			wantMock: func(mockService *MockSCIMService) {
+				mockService.On("PatchGroup", uint(5), patch, `W/"v0"`).Return((*usecase.SCIMGroup)(nil), utils.ErrPreconditionFailed)
+			},
+			wantCode: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockService MockSCIMService
+			test.wantMock(&mockService)
+			h := NewSCIMHandler(&mockService)
+
+			body := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"add","path":"members","value":[{"value":"2"}]}]}`
+			req := httptest.NewRequest(http.MethodPatch, "/scim/v2/Groups/5", strings.NewReader(body))
+			req.Header.Set("If-Match", test.ifMatch)
+			rec := serveSCIM(h.PatchGroup, req, "5")
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantCode == http.StatusOK {
+				assert.Contains(t, rec.Body.String(), `"members":[{"value":"2","display":"user@test.com","$ref":"http://example.com/scim/v2/Users/2"}]`)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMDeleteUser(t *testing.T) {
+	var mockService MockSCIMService
+	mockService.On("DeleteUser", uint(2), "").Return(nil)
+	h := NewSCIMHandler(&mockService)
+
+	req := httptest.NewRequest(http.MethodDelete, "/scim/v2/Users/2", nil)
+	rec := serveSCIM(h.DeleteUser, req, "2")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	mockService.AssertExpectations(t)
+}
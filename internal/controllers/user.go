@@ -1,10 +1,13 @@
 package controllers
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
 	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/labstack/echo/v4"
@@ -15,23 +18,29 @@ const (
 )
 
 type UserService interface {
-	CreateUser(email, password string) (map[string]string, error)
-	CheckSignIn(email, password string) error
-	FetchAllUsers() ([]models.User, error)
+	CreateUser(ctx context.Context, email, password string, overrides utils.TokenOverrides) (utils.TokenPair, error)
+	CreateInvitedUser(ctx context.Context, email, password, invitationToken string, overrides utils.TokenOverrides) (utils.TokenPair, error)
+	SignIn(ctx context.Context, email, password string, orgID uint, overrides utils.TokenOverrides) (utils.TokenPair, error)
+	ListUsers(ctx context.Context, filter models.UserFilter) (usecase.UserPage, error)
 }
 
 type UserHandler struct {
 	Service UserService
+	Cookie  utils.CookieOptions
 }
 
 type SignUpRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Email    string `json:"email" validate:"required,email,email_domain"`
+	Password string `json:"password" validate:"required,password_policy"`
+	// InvitationToken signs up through an organization invitation.
+	InvitationToken string `json:"invitation_token"`
 }
 
 type SignInRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// OrganizationID starts the session in an organization of the user.
+	OrganizationID uint `json:"organization_id"`
 }
 
 type SignUpResponse struct {
@@ -43,15 +52,18 @@ type UserResponse struct {
 	Email     string `json:"email"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
 type ListUsersResponse struct {
-	Users []UserResponse `json:"users"`
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
-func NewUserHandler(service UserService) *UserHandler {
+func NewUserHandler(service UserService, cookie utils.CookieOptions) *UserHandler {
 	return &UserHandler{
 		Service: service,
+		Cookie:  cookie,
 	}
 }
 
@@ -62,73 +74,119 @@ func newSignUpResponse(accessToken string) SignUpResponse {
 }
 
 func newUserResponse(user models.User) UserResponse {
-	return UserResponse{
+	response := UserResponse{
 		ID:        user.ID,
 		Email:     user.Email,
 		CreatedAt: user.CreatedAt.String(),
 		UpdatedAt: user.UpdatedAt.String(),
 	}
+	if user.DeletedAt.Valid {
+		response.DeletedAt = user.DeletedAt.Time.String()
+	}
+
+	return response
 }
 
-func newListUserResponse(users []models.User) ListUsersResponse {
+func newListUserResponse(page usecase.UserPage) ListUsersResponse {
 	usersResponse := make([]UserResponse, 0)
-	for _, users := range users {
+	for _, users := range page.Users {
 		usersResponse = append(usersResponse, newUserResponse(users))
 	}
 
 	return ListUsersResponse{
-		Users: usersResponse,
+		Users:      usersResponse,
+		NextCursor: page.NextCursor,
 	}
 }
 
 func (c *UserHandler) SignUp(ctx echo.Context) error {
 	var req SignUpRequest
 	if err := ctx.Bind(&req); err != nil {
-		log.Printf("Failed to bind request: %v", err)
-		return utils.BadRequestResponse(ctx, "Invalid request")
+		return utils.ErrBadRequest.Wrap(err)
 	}
 
 	if err := ctx.Validate(req); err != nil {
-		log.Printf("Failed to validate request: %v", err)
-		return utils.BadRequestResponse(ctx, "Invalid request")
+		return err
 	}
 
-	tokens, err := c.Service.CreateUser(req.Email, req.Password)
+	var tokens utils.TokenPair
+	var err error
+	overrides := utils.TokenOverridesFromContext(ctx)
+	if req.InvitationToken != "" {
+		tokens, err = c.Service.CreateInvitedUser(ctx.Request().Context(), req.Email, req.Password, req.InvitationToken, overrides)
+	} else {
+		tokens, err = c.Service.CreateUser(ctx.Request().Context(), req.Email, req.Password, overrides)
+	}
 	if err != nil {
-		log.Printf("Failed to create user: %v", err)
-		return utils.InternalServerErrorResponse(ctx, "Failed to create user")
+		return fmt.Errorf("failed to create user: %w", err)
 	}
 
-	targetPath := BASE_URI + "/key/refresh"
-	utils.SetCookie(ctx, "refresh_token", tokens["refreshToken"], targetPath, time.Now().Add(time.Hour*24*7))
+	utils.SetCookie(ctx, c.Cookie, "refresh_token", tokens.RefreshToken, refreshCookiePath(ctx), tokens.RefreshTokenExpiresAt)
 
-	response := newSignUpResponse(tokens["accessToken"])
+	response := newSignUpResponse(tokens.AccessToken)
 	return utils.StatusOKResponse(ctx, "Successfully created user", response)
 }
 
+// refreshCookiePath is the path of the refresh endpoint under the prefix the
+// request came in on, which holds the tenant when tenants are resolved from
+// the path.
+func refreshCookiePath(ctx echo.Context) string {
+	prefix, _, _ := strings.Cut(ctx.Request().URL.Path, BASE_URI)
+	return prefix + BASE_URI + "/key/refresh"
+}
+
 func (c *UserHandler) SignIn(ctx echo.Context) error {
 	var req SignInRequest
 	if err := ctx.Bind(&req); err != nil {
-		log.Printf("Failed to bind request: %v", err)
-		return utils.BadRequestResponse(ctx, "Invalid request")
+		return utils.ErrBadRequest.Wrap(err)
 	}
 
-	if err := c.Service.CheckSignIn(req.Email, req.Password); err != nil {
-		log.Printf("Failed to sign in: %v", err)
-		return utils.BadRequestResponse(ctx, "Invalid email or password")
+	tokens, err := c.Service.SignIn(ctx.Request().Context(), req.Email, req.Password, req.OrganizationID, utils.TokenOverridesFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to sign in: %w", err)
 	}
 
-	return utils.StatusOKResponse(ctx, "Successfully signed in", nil)
+	utils.SetCookie(ctx, c.Cookie, "refresh_token", tokens.RefreshToken, refreshCookiePath(ctx), tokens.RefreshTokenExpiresAt)
+
+	response := newSignUpResponse(tokens.AccessToken)
+	return utils.StatusOKResponse(ctx, "Successfully signed in", response)
 }
 
+// ListUsers accepts the email_prefix, state (active, deleted or all) and
+// sort (created_at, email, or either prefixed with "-" for descending)
+// parameters, created_since and created_until as RFC 3339 times, and limit
+// and cursor for pagination.
 func (c *UserHandler) ListUsers(ctx echo.Context) error {
-	users, err := c.Service.FetchAllUsers()
+	var filter models.UserFilter
+	err := echo.QueryParamsBinder(ctx).
+		String("email_prefix", &filter.EmailPrefix).
+		Time("created_since", &filter.CreatedSince, time.RFC3339).
+		Time("created_until", &filter.CreatedUntil, time.RFC3339).
+		String("state", &filter.State).
+		String("sort", &filter.Sort).
+		String("cursor", &filter.Cursor).
+		Int("limit", &filter.Limit).
+		BindError()
 	if err != nil {
-		log.Printf("Failed to fetch users: %v", err)
-		return utils.InternalServerErrorResponse(ctx, "Failed to fetch users")
+		return utils.ErrBadRequest.WithDetail("The query parameters are invalid.").Wrap(err)
 	}
 
-	response := newListUserResponse(users)
+	page, err := c.Service.ListUsers(ctx.Request().Context(), filter)
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	response := newListUserResponse(page)
 
 	return utils.StatusOKResponse(ctx, "Successfully fetched users", response)
 }
+
+// ListActiveUsers is ListUsers for signed-in users, who may not list deleted
+// accounts: state must be empty or active.
+func (c *UserHandler) ListActiveUsers(ctx echo.Context) error {
+	if state := ctx.QueryParam("state"); state != "" && state != models.UserStateActive {
+		return utils.ErrBadRequest.WithDetail("Only active users can be listed.")
+	}
+
+	return c.ListUsers(ctx)
+}
@@ -1,56 +1,80 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
 	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 type MockUserService struct {
 	mock.Mock
 }
 
-func (m *MockUserService) CreateUser(email, password string) (map[string]string, error) {
-	args := m.Called(email, password)
-	return args.Get(0).(map[string]string), args.Error(1)
+func (m *MockUserService) CreateUser(ctx context.Context, email, password string, overrides utils.TokenOverrides) (utils.TokenPair, error) {
+	args := m.Called(email, password, overrides)
+	return args.Get(0).(utils.TokenPair), args.Error(1)
 }
 
-func (m *MockUserService) CheckSignIn(email, password string) error {
-	args := m.Called(email, password)
-	return args.Error(0)
+func (m *MockUserService) CreateInvitedUser(ctx context.Context, email, password, invitationToken string, overrides utils.TokenOverrides) (utils.TokenPair, error) {
+	args := m.Called(email, password, invitationToken, overrides)
+	return args.Get(0).(utils.TokenPair), args.Error(1)
 }
 
-func (m *MockUserService) FetchAllUsers() ([]models.User, error) {
-	args := m.Called()
-	return args.Get(0).([]models.User), args.Error(1)
+func (m *MockUserService) SignIn(ctx context.Context, email, password string, orgID uint, overrides utils.TokenOverrides) (utils.TokenPair, error) {
+	args := m.Called(email, password, orgID, overrides)
+	return args.Get(0).(utils.TokenPair), args.Error(1)
+}
+
+func (m *MockUserService) ListUsers(ctx context.Context, filter models.UserFilter) (usecase.UserPage, error) {
+	args := m.Called(filter)
+	return args.Get(0).(usecase.UserPage), args.Error(1)
 }
 
 func TestSignUp(t *testing.T) {
 	tests := []struct {
-		name     string
-		in       string
-		wantCode int
-		wantBody string
-		wantMock func(mockUserService *MockUserService)
+		name           string
+		in             string
+		acceptLanguage string
+		wantCode       int
+		wantBody       string
+		wantMock       func(mockUserService *MockUserService)
 	}{
 		{
 			name:     "Valid signup",
-			in:       `{"email": "test@test.com", "password": "password"}`,
+			in:       `{"email": "test@test.com", "password": "password1"}`,
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"access_token\":\"access_token\"},\"message\":\"Successfully created user\"}\n",
+			wantMock: func(mockUserService *MockUserService) {
+				mockUserService.On("CreateUser", "test@test.com", "password1", utils.TokenOverrides{}).Return(utils.TokenPair{
+					AccessToken:           "access_token",
+					RefreshToken:          "refresh_token",
+					RefreshTokenExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+			},
+		},
+		{
+			name:     "Valid signup with invitation",
+			in:       `{"email": "test@test.com", "password": "password1", "invitation_token": "invitation"}`,
 			wantCode: http.StatusOK,
 			wantBody: "{\"data\":{\"access_token\":\"access_token\"},\"message\":\"Successfully created user\"}\n",
 			wantMock: func(mockUserService *MockUserService) {
-				mockUserService.On("CreateUser", "test@test.com", "password").Return(map[string]string{
-					"accessToken":  "access_token",
-					"refreshToken": "refresh_token",
+				mockUserService.On("CreateInvitedUser", "test@test.com", "password1", "invitation", utils.TokenOverrides{}).Return(utils.TokenPair{
+					AccessToken:           "access_token",
+					RefreshToken:          "refresh_token",
+					RefreshTokenExpiresAt: time.Now().Add(time.Hour),
 				}, nil)
 			},
 		},
@@ -58,30 +82,47 @@ func TestSignUp(t *testing.T) {
 			name:     "Binding error",
 			in:       `{"email": "test@test.com", "invalid": }`,
 			wantCode: http.StatusBadRequest,
-			wantBody: "{\"data\":null,\"message\":\"Invalid request\"}\n",
+			wantBody: "{\"type\":\"/problems/bad_request\",\"title\":\"Bad request\",\"status\":400,\"detail\":\"The request could not be parsed.\",\"instance\":\"/basic/signup\",\"code\":\"bad_request\"}",
 			wantMock: func(mockUserService *MockUserService) {},
 		},
 		{
 			name:     "Email validation error",
-			in:       `{"email": "test", "password": "password"}`,
+			in:       `{"email": "test", "password": "password1"}`,
 			wantCode: http.StatusBadRequest,
-			wantBody: "{\"data\":null,\"message\":\"Invalid request\"}\n",
+			wantBody: "{\"type\":\"/problems/validation_failed\",\"title\":\"Validation failed\",\"status\":400,\"detail\":\"One or more fields are invalid.\",\"instance\":\"/basic/signup\",\"code\":\"validation_failed\",\"errors\":[{\"field\":\"email\",\"rule\":\"email\",\"message\":\"email must be a valid email address\"}]}",
 			wantMock: func(mockUserService *MockUserService) {},
 		},
 		{
 			name:     "Password validation error",
 			in:       `{"email": "test@test.com", "password": "pass"}`,
 			wantCode: http.StatusBadRequest,
-			wantBody: "{\"data\":null,\"message\":\"Invalid request\"}\n",
+			wantBody: "{\"type\":\"/problems/validation_failed\",\"title\":\"Validation failed\",\"status\":400,\"detail\":\"One or more fields are invalid.\",\"instance\":\"/basic/signup\",\"code\":\"validation_failed\",\"errors\":[{\"field\":\"password\",\"rule\":\"password_policy\",\"message\":\"password must be 8 to 72 bytes long and contain at least one letter and one number\"}]}",
 			wantMock: func(mockUserService *MockUserService) {},
 		},
+		{
+			name:           "Password validation error in Japanese",
+			in:             `{"email": "test@test.com", "password": "password"}`,
+			acceptLanguage: "ja-JP,ja;q=0.9,en;q=0.8",
+			wantCode:       http.StatusBadRequest,
+			wantBody:       "{\"type\":\"/problems/validation_failed\",\"title\":\"Validation failed\",\"status\":400,\"detail\":\"One or more fields are invalid.\",\"instance\":\"/basic/signup\",\"code\":\"validation_failed\",\"errors\":[{\"field\":\"password\",\"rule\":\"password_policy\",\"message\":\"passwordは8文字以上72バイト以下で、英字と数字をそれぞれ1文字以上含む必要があります\"}]}",
+			wantMock:       func(mockUserService *MockUserService) {},
+		},
 		{
 			name:     "Create user error",
-			in:       `{"email": "test@test.com", "password": "password"}`,
+			in:       `{"email": "test@test.com", "password": "password1"}`,
 			wantCode: http.StatusInternalServerError,
-			wantBody: "{\"data\":null,\"message\":\"Failed to create user\"}\n",
+			wantBody: "{\"type\":\"/problems/internal_error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"An unexpected error occurred.\",\"instance\":\"/basic/signup\",\"code\":\"internal_error\"}",
+			wantMock: func(mockUserService *MockUserService) {
+				mockUserService.On("CreateUser", "test@test.com", "password1", utils.TokenOverrides{}).Return(utils.TokenPair{}, fmt.Errorf("error"))
+			},
+		},
+		{
+			name:     "Email taken error",
+			in:       `{"email": "test@test.com", "password": "password1"}`,
+			wantCode: http.StatusConflict,
+			wantBody: "{\"type\":\"/problems/email_taken\",\"title\":\"Email taken\",\"status\":409,\"detail\":\"The email is already registered.\",\"instance\":\"/basic/signup\",\"code\":\"email_taken\"}",
 			wantMock: func(mockUserService *MockUserService) {
-				mockUserService.On("CreateUser", "test@test.com", "password").Return(map[string]string{}, fmt.Errorf("error"))
+				mockUserService.On("CreateUser", "test@test.com", "password1", utils.TokenOverrides{}).Return(utils.TokenPair{}, utils.ErrEmailTaken)
 			},
 		},
 	}
@@ -94,12 +135,16 @@ func TestSignUp(t *testing.T) {
 
 			e := echo.New()
 			e.Validator = utils.NewCustomValidator()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
 			req := httptest.NewRequest(http.MethodPost, "/basic/signup", strings.NewReader(test.in))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("Accept-Language", test.acceptLanguage)
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			handler.SignUp(ctx)
+			if err := handler.SignUp(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
 			assert.Equal(t, test.wantCode, rec.Code)
 			assert.Equal(t, test.wantBody, rec.Body.String())
 			mockUserService.AssertExpectations(t)
@@ -107,37 +152,76 @@ func TestSignUp(t *testing.T) {
 	}
 }
 
+func TestRefreshCookiePath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "/api/v1/key/signup", want: "/api/v1/key/refresh"},
+		{target: "/t/acme/api/v1/key/signup", want: "/t/acme/api/v1/key/refresh"},
+		{target: "/t/acme/api/v1/jwt/orgs/1/switch", want: "/t/acme/api/v1/key/refresh"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			e := echo.New()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodPost, test.target, nil), httptest.NewRecorder())
+			assert.Equal(t, test.want, refreshCookiePath(ctx))
+		})
+	}
+}
+
 func TestSignIn(t *testing.T) {
 	tests := []struct {
-		name     string
-		in       string
-		wantCode int
-		wantBody string
-		wantMock func(mockUserService *MockUserService)
+		name       string
+		in         string
+		wantCode   int
+		wantBody   string
+		wantCookie bool
+		wantMock   func(mockUserService *MockUserService)
 	}{
 		{
-			name:     "Valid signin",
-			in:       `{"email": "test@test.com", "password": "password"}`,
-			wantCode: http.StatusOK,
-			wantBody: "{\"data\":null,\"message\":\"Successfully signed in\"}\n",
+			name:       "Valid signin",
+			in:         `{"email": "test@test.com", "password": "password"}`,
+			wantCode:   http.StatusOK,
+			wantBody:   "{\"data\":{\"access_token\":\"access_token\"},\"message\":\"Successfully signed in\"}\n",
+			wantCookie: true,
 			wantMock: func(mockUserService *MockUserService) {
-				mockUserService.On("CheckSignIn", "test@test.com", "password").Return(nil)
+				mockUserService.On("SignIn", "test@test.com", "password", uint(0), utils.TokenOverrides{}).Return(utils.TokenPair{
+					AccessToken:           "access_token",
+					RefreshToken:          "refresh_token",
+					RefreshTokenExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+			},
+		},
+		{
+			name:       "Valid signin into an organization",
+			in:         `{"email": "test@test.com", "password": "password", "organization_id": 5}`,
+			wantCode:   http.StatusOK,
+			wantBody:   "{\"data\":{\"access_token\":\"access_token\"},\"message\":\"Successfully signed in\"}\n",
+			wantCookie: true,
+			wantMock: func(mockUserService *MockUserService) {
+				mockUserService.On("SignIn", "test@test.com", "password", uint(5), utils.TokenOverrides{}).Return(utils.TokenPair{
+					AccessToken:           "access_token",
+					RefreshToken:          "refresh_token",
+					RefreshTokenExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
 			},
 		},
 		{
 			name:     "Binding error",
 			in:       `{"email": "test@test.com", "invalid": }`,
 			wantCode: http.StatusBadRequest,
-			wantBody: "{\"data\":null,\"message\":\"Invalid request\"}\n",
+			wantBody: "{\"type\":\"/problems/bad_request\",\"title\":\"Bad request\",\"status\":400,\"detail\":\"The request could not be parsed.\",\"instance\":\"/key/signin\",\"code\":\"bad_request\"}",
 			wantMock: func(mockUserService *MockUserService) {},
 		},
 		{
 			name:     "Check signin error",
 			in:       `{"email": "test@test.com", "password": "password"}`,
-			wantCode: http.StatusBadRequest,
-			wantBody: "{\"data\":null,\"message\":\"Invalid email or password\"}\n",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "{\"type\":\"/problems/invalid_credentials\",\"title\":\"Invalid credentials\",\"status\":401,\"detail\":\"Invalid email or password.\",\"instance\":\"/key/signin\",\"code\":\"invalid_credentials\"}",
 			wantMock: func(mockUserService *MockUserService) {
-				mockUserService.On("CheckSignIn", "test@test.com", "password").Return(fmt.Errorf("error"))
+				mockUserService.On("SignIn", "test@test.com", "password", uint(0), utils.TokenOverrides{}).Return(utils.TokenPair{}, utils.ErrInvalidCredentials)
 			},
 		},
 	}
@@ -150,14 +234,18 @@ func TestSignIn(t *testing.T) {
 
 			e := echo.New()
 			e.Validator = utils.NewCustomValidator()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
 			req := httptest.NewRequest(http.MethodPost, "/key/signin", strings.NewReader(test.in))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			handler.SignIn(ctx)
+			if err := handler.SignIn(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
 			assert.Equal(t, test.wantCode, rec.Code)
 			assert.Equal(t, test.wantBody, rec.Body.String())
+			assert.Equal(t, test.wantCookie, strings.Contains(rec.Header().Get(echo.HeaderSetCookie), "refresh_token=refresh_token"))
 			mockUserService.AssertExpectations(t)
 		})
 	}
@@ -166,6 +254,7 @@ func TestSignIn(t *testing.T) {
 func TestListUsers(t *testing.T) {
 	tests := []struct {
 		name     string
+		query    string
 		wantCode int
 		wantBody string
 		wantMock func(mockUserService *MockUserService)
@@ -175,15 +264,41 @@ func TestListUsers(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "{\"data\":{\"users\":[]},\"message\":\"Successfully fetched users\"}\n",
 			wantMock: func(mockUserService *MockUserService) {
-				mockUserService.On("FetchAllUsers").Return([]models.User{}, nil)
+				mockUserService.On("ListUsers", models.UserFilter{}).Return(usecase.UserPage{Users: []models.User{}}, nil)
+			},
+		},
+		{
+			name:     "Filtered page with a next cursor",
+			query:    "?email_prefix=a&created_since=2024-01-01T00:00:00Z&state=all&sort=-email&cursor=abc&limit=1",
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"users\":[{\"id\":1,\"email\":\"a@test.com\",\"created_at\":\"0001-01-01 00:00:00 +0000 UTC\",\"updated_at\":\"0001-01-01 00:00:00 +0000 UTC\"}],\"next_cursor\":\"def\"},\"message\":\"Successfully fetched users\"}\n",
+			wantMock: func(mockUserService *MockUserService) {
+				mockUserService.On("ListUsers", models.UserFilter{
+					EmailPrefix:  "a",
+					CreatedSince: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+					State:        models.UserStateAll,
+					Sort:         models.UserSortEmailDesc,
+					Cursor:       "abc",
+					Limit:        1,
+				}).Return(usecase.UserPage{
+					Users:      []models.User{{Model: gorm.Model{ID: 1}, Email: "a@test.com"}},
+					NextCursor: "def",
+				}, nil)
 			},
 		},
+		{
+			name:     "Invalid limit",
+			query:    "?limit=many",
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"type\":\"/problems/bad_request\",\"title\":\"Bad request\",\"status\":400,\"detail\":\"The query parameters are invalid.\",\"instance\":\"/jwt/users\",\"code\":\"bad_request\"}",
+			wantMock: func(mockUserService *MockUserService) {},
+		},
 		{
 			name:     "Fetch all users error",
 			wantCode: http.StatusInternalServerError,
-			wantBody: "{\"data\":null,\"message\":\"Failed to fetch users\"}\n",
+			wantBody: "{\"type\":\"/problems/internal_error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"An unexpected error occurred.\",\"instance\":\"/jwt/users\",\"code\":\"internal_error\"}",
 			wantMock: func(mockUserService *MockUserService) {
-				mockUserService.On("FetchAllUsers").Return([]models.User{}, fmt.Errorf("error"))
+				mockUserService.On("ListUsers", models.UserFilter{}).Return(usecase.UserPage{}, fmt.Errorf("error"))
 			},
 		},
 	}
@@ -196,11 +311,70 @@ func TestListUsers(t *testing.T) {
 
 			e := echo.New()
 			e.Validator = utils.NewCustomValidator()
-			req := httptest.NewRequest(http.MethodGet, "/jwt/users", nil)
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/jwt/users"+test.query, nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if err := handler.ListUsers(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, test.wantBody, rec.Body.String())
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListActiveUsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantBody string
+		wantMock func(mockUserService *MockUserService)
+	}{
+		{
+			name:     "Active users",
+			query:    "?state=active",
+			wantCode: http.StatusOK,
+			wantBody: "{\"data\":{\"users\":[]},\"message\":\"Successfully fetched users\"}\n",
+			wantMock: func(mockUserService *MockUserService) {
+				mockUserService.On("ListUsers", models.UserFilter{State: models.UserStateActive}).Return(usecase.UserPage{Users: []models.User{}}, nil)
+			},
+		},
+		{
+			name:     "Deleted users",
+			query:    "?state=deleted",
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"type\":\"/problems/bad_request\",\"title\":\"Bad request\",\"status\":400,\"detail\":\"Only active users can be listed.\",\"instance\":\"/jwt/users\",\"code\":\"bad_request\"}",
+			wantMock: func(mockUserService *MockUserService) {},
+		},
+		{
+			name:     "All users",
+			query:    "?state=all",
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"type\":\"/problems/bad_request\",\"title\":\"Bad request\",\"status\":400,\"detail\":\"Only active users can be listed.\",\"instance\":\"/jwt/users\",\"code\":\"bad_request\"}",
+			wantMock: func(mockUserService *MockUserService) {},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockUserService MockUserService
+			test.wantMock(&mockUserService)
+			handler := &UserHandler{Service: &mockUserService}
+
+			e := echo.New()
+			e.Validator = utils.NewCustomValidator()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/jwt/users"+test.query, nil)
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			handler.ListUsers(ctx)
+			if err := handler.ListActiveUsers(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
 			assert.Equal(t, test.wantCode, rec.Code)
 			assert.Equal(t, test.wantBody, rec.Body.String())
 			mockUserService.AssertExpectations(t)
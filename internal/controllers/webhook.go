@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, url string, eventTypes []string) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uint) error
+	ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (usecase.WebhookDeliveryPage, error)
+	Redeliver(ctx context.Context, id uint) error
+}
+
+type WebhookHandler struct {
+	Service WebhookService
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,http_url"`
+	Events []string `json:"events" validate:"required,min=1"`
+}
+
+type WebhookSubscriptionResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListWebhookSubscriptionsResponse struct {
+	Subscriptions []WebhookSubscriptionResponse `json:"subscriptions"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uint       `json:"id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+	NextCursor uint                      `json:"next_cursor,omitempty"`
+}
+
+func NewWebhookHandler(service WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		Service: service,
+	}
+}
+
+func newWebhookSubscriptionResponse(subscription models.WebhookSubscription) WebhookSubscriptionResponse {
+	return WebhookSubscriptionResponse{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Events:    subscription.EventTypeList(),
+		CreatedAt: subscription.CreatedAt,
+	}
+}
+
+func newWebhookDeliveryResponse(delivery models.WebhookDelivery) WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+}
+
+// CreateSubscription returns the signing secret; it is not shown again.
+func (h *WebhookHandler) CreateSubscription(ctx echo.Context) error {
+	var req CreateWebhookRequest
+	if err := ctx.Bind(&req); err != nil {
+		return utils.ErrBadRequest.Wrap(err)
+	}
+
+	if err := ctx.Validate(req); err != nil {
+		return err
+	}
+
+	subscription, err := h.Service.CreateSubscription(ctx.Request().Context(), req.URL, req.Events)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	response := newWebhookSubscriptionResponse(*subscription)
+	response.Secret = subscription.Secret
+	return utils.NewResponse(http.StatusCreated, "Successfully created webhook subscription", response).JSONResponse(ctx)
+}
+
+func (h *WebhookHandler) ListSubscriptions(ctx echo.Context) error {
+	subscriptions, err := h.Service.ListSubscriptions(ctx.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	response := ListWebhookSubscriptionsResponse{
+		Subscriptions: make([]WebhookSubscriptionResponse, 0, len(subscriptions)),
+	}
+	for _, subscription := range subscriptions {
+		response.Subscriptions = append(response.Subscriptions, newWebhookSubscriptionResponse(subscription))
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched webhook subscriptions", response)
+}
+
+func (h *WebhookHandler) DeleteSubscription(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.DeleteSubscription(ctx.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully deleted webhook subscription", nil)
+}
+
+// ListDeliveries accepts the status filter and limit and cursor for
+// pagination.
+func (h *WebhookHandler) ListDeliveries(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := models.WebhookDeliveryFilter{SubscriptionID: id}
+	err = echo.QueryParamsBinder(ctx).
+		String("status", &filter.Status).
+		Uint("cursor", &filter.Cursor).
+		Int("limit", &filter.Limit).
+		BindError()
+	if err != nil {
+		return utils.ErrBadRequest.WithDetail("The query parameters are invalid.").Wrap(err)
+	}
+
+	page, err := h.Service.ListDeliveries(ctx.Request().Context(), filter)
+	if err != nil {
+		return fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	response := ListWebhookDeliveriesResponse{
+		Deliveries: make([]WebhookDeliveryResponse, 0, len(page.Deliveries)),
+		NextCursor: page.NextCursor,
+	}
+	for _, delivery := range page.Deliveries {
+		response.Deliveries = append(response.Deliveries, newWebhookDeliveryResponse(delivery))
+	}
+
+	return utils.StatusOKResponse(ctx, "Successfully fetched webhook deliveries", response)
+}
+
+func (h *WebhookHandler) Redeliver(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Service.Redeliver(ctx.Request().Context(), id); err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+
+	return utils.NewResponse(http.StatusAccepted, "Webhook delivery has been queued", nil).JSONResponse(ctx)
+}
+
+// pathID reads the numeric :id path parameter.
+func pathID(ctx echo.Context) (uint, error) {
+	return pathUint(ctx, "id")
+}
+
+// pathUint reads a numeric path parameter.
+func pathUint(ctx echo.Context, name string) (uint, error) {
+	var id uint
+	if err := echo.PathParamsBinder(ctx).MustUint(name, &id).BindError(); err != nil {
+		return 0, utils.ErrBadRequest.WithDetail(fmt.Sprintf("The %s is invalid.", name)).Wrap(err)
+	}
+
+	return id, nil
+}
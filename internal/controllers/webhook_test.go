@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockWebhookService struct {
+	mock.Mock
+}
+
+func (m *MockWebhookService) CreateSubscription(ctx context.Context, url string, eventTypes []string) (*models.WebhookSubscription, error) {
+	args := m.Called(url, eventTypes)
+	return args.Get(0).(*models.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookService) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	args := m.Called()
+	return args.Get(0).([]models.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookService) DeleteSubscription(ctx context.Context, id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookService) ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (usecase.WebhookDeliveryPage, error) {
+	args := m.Called(filter)
+	return args.Get(0).(usecase.WebhookDeliveryPage), args.Error(1)
+}
+
+func (m *MockWebhookService) Redeliver(ctx context.Context, id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func TestCreateWebhookSubscription(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		body     string
+		mock     func(mockWebhookService *MockWebhookService)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "success",
+			body: `{"url":"https://example.com/hook","events":["user.created"]}`,
+			mock: func(mockWebhookService *MockWebhookService) {
+				mockWebhookService.On("CreateSubscription", "https://example.com/hook", []string{"user.created"}).Return(&models.WebhookSubscription{
+					Model:      gorm.Model{ID: 1, CreatedAt: createdAt},
+					URL:        "https://example.com/hook",
+					Secret:     "whsec_secret",
+					EventTypes: "user.created",
+				}, nil)
+			},
+			wantCode: http.StatusCreated,
+			wantBody: "{\"data\":{\"id\":1,\"url\":\"https://example.com/hook\",\"events\":[\"user.created\"],\"secret\":\"whsec_secret\",\"created_at\":\"2024-01-02T03:04:05Z\"},\"message\":\"Successfully created webhook subscription\"}\n",
+		},
+		{
+			name:     "invalid url",
+			body:     `{"url":"example.com","events":["user.created"]}`,
+			mock:     func(mockWebhookService *MockWebhookService) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "no events",
+			body:     `{"url":"https://example.com/hook","events":[]}`,
+			mock:     func(mockWebhookService *MockWebhookService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockWebhookService MockWebhookService
+			test.mock(&mockWebhookService)
+			h := NewWebhookHandler(&mockWebhookService)
+
+			e := echo.New()
+			e.Validator = utils.NewCustomValidator()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhooks", strings.NewReader(test.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			if err := h.CreateSubscription(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, rec.Body.String())
+			}
+			mockWebhookService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		mock     func(mockWebhookService *MockWebhookService)
+		wantCode int
+	}{
+		{
+			name: "queued",
+			id:   "3",
+			mock: func(mockWebhookService *MockWebhookService) {
+				mockWebhookService.On("Redeliver", uint(3)).Return(nil)
+			},
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name: "not found",
+			id:   "4",
+			mock: func(mockWebhookService *MockWebhookService) {
+				mockWebhookService.On("Redeliver", uint(4)).Return(utils.ErrNotFound)
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name: "invitation event",
+			id:   "5",
+			mock: func(mockWebhookService *MockWebhookService) {
+				mockWebhookService.On("Redeliver", uint(5)).Return(utils.ErrConflict)
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "invalid id",
+			id:       "abc",
+			mock:     func(mockWebhookService *MockWebhookService) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockWebhookService MockWebhookService
+			test.mock(&mockWebhookService)
+			h := NewWebhookHandler(&mockWebhookService)
+
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetPath("/admin/webhook-deliveries/:id/redeliver")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(test.id)
+
+			if err := h.Redeliver(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			mockWebhookService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	var mockWebhookService MockWebhookService
+	mockWebhookService.On("ListDeliveries", models.WebhookDeliveryFilter{SubscriptionID: 1, Status: models.DeliveryDead, Cursor: 9, Limit: 1}).
+		Return(usecase.WebhookDeliveryPage{
+			Deliveries: []models.WebhookDelivery{{ID: 8, EventID: "evt_1", Status: models.DeliveryDead, Attempts: 8}},
+			NextCursor: 8,
+		}, nil)
+	h := NewWebhookHandler(&mockWebhookService)
+
+	e := echo.New()
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+	req := httptest.NewRequest(http.MethodGet, "/?status=dead&cursor=9&limit=1", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues("1")
+
+	assert.NoError(t, h.ListDeliveries(ctx))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "\"next_cursor\":8")
+	mockWebhookService.AssertExpectations(t)
+}
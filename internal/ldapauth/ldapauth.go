@@ -0,0 +1,233 @@
+// Package ldapauth checks passwords against an LDAP directory such as Active
+// Directory. Users bind with their password, either as a DN built from a
+// template or as the DN a search for their email finds.
+package ldapauth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrInvalidCredentials = errors.New("invalid directory credentials")
+
+// Config describes a directory. Users bind as the first of UserDNTemplates
+// that accepts their password; without templates they are searched for
+// under BaseDN with UserFilter, as BindDN when set and anonymously
+// otherwise. In templates and UserFilter, {email} is replaced by the email
+// signed in with and {username} by the part of it before the @.
+type Config struct {
+	// URL is the server, as in ldaps://ldap.example.com.
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS.
+	StartTLS  bool
+	TLSConfig *tls.Config
+	// Timeout bounds connecting and each request.
+	Timeout         time.Duration
+	BindDN          string
+	BindPassword    string
+	UserDNTemplates []string
+	// BaseDN and UserFilter also find the entry of users bound with a
+	// template, for templates that are not DNs such as {email} for Active
+	// Directory. The entry is read at the bound DN when BaseDN is empty.
+	BaseDN     string
+	UserFilter string
+	// EmailAttribute and GroupAttribute are read from the entry of the user.
+	EmailAttribute string
+	GroupAttribute string
+}
+
+// Entry is the directory entry of a signed in user.
+type Entry struct {
+	DN string
+	// Email falls back to the email signed in with when the entry has none.
+	Email  string
+	Groups []string
+}
+
+type Directory struct {
+	config Config
+}
+
+func NewDirectory(config Config) *Directory {
+	return &Directory{
+		config: config,
+	}
+}
+
+// Authenticate checks the password of the user with the email and returns
+// their entry. It returns ErrInvalidCredentials when the directory does not
+// know the user or rejects the password.
+func (d *Directory) Authenticate(ctx context.Context, email, password string) (*Entry, error) {
+	// Servers accept binds without a password as anonymous
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// go-ldap has no context support, so cancellation closes the connection
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var entry *ldap.Entry
+	if len(d.config.UserDNTemplates) > 0 {
+		dn, err := d.bindTemplates(conn, email, password)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err = d.lookup(conn, dn, email)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if d.config.BindDN != "" {
+			if err := conn.Bind(d.config.BindDN, d.config.BindPassword); err != nil {
+				return nil, fmt.Errorf("failed to bind to directory as %s: %w", d.config.BindDN, err)
+			}
+		}
+
+		entry, err = d.search(conn, email)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := bind(conn, entry.DN, password); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Entry{
+		DN:     entry.DN,
+		Email:  entry.GetAttributeValue(d.config.EmailAttribute),
+		Groups: entry.GetAttributeValues(d.config.GroupAttribute),
+	}
+	if result.Email == "" {
+		result.Email = email
+	}
+
+	return result, nil
+}
+
+func (d *Directory) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: d.config.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	tlsConfig := d.config.TLSConfig
+	if tlsConfig == nil {
+		// StartTLS, unlike ldaps://, needs to be told the name of the server
+		u, err := url.Parse(d.config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse directory URL: %w", err)
+		}
+		tlsConfig = &tls.Config{ServerName: u.Hostname()}
+	}
+
+	conn, err := ldap.DialURL(d.config.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to directory: %w", err)
+	}
+	conn.SetTimeout(d.config.Timeout)
+
+	if d.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS with directory: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// bindTemplates binds as the first template DN that accepts the password.
+func (d *Directory) bindTemplates(conn *ldap.Conn, email, password string) (string, error) {
+	for _, template := range d.config.UserDNTemplates {
+		dn := expand(template, email, ldap.EscapeDN)
+		err := bind(conn, dn, password)
+		if errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		return dn, nil
+	}
+
+	return "", ErrInvalidCredentials
+}
+
+// lookup reads the entry of the user bound as dn.
+func (d *Directory) lookup(conn *ldap.Conn, dn, email string) (*ldap.Entry, error) {
+	if d.config.BaseDN != "" {
+		return d.search(conn, email)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", d.attributes(), nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory entry %s: %w", dn, err)
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("failed to read directory entry %s: %d entries found", dn, len(result.Entries))
+	}
+
+	return result.Entries[0], nil
+}
+
+// search finds the entry of the user with UserFilter. Users matching no or
+// several entries cannot sign in.
+func (d *Directory) search(conn *ldap.Conn, email string) (*ldap.Entry, error) {
+	filter := expand(d.config.UserFilter, email, ldap.EscapeFilter)
+	result, err := conn.Search(ldap.NewSearchRequest(d.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, d.attributes(), nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search directory: %w", err)
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
+
+func (d *Directory) attributes() []string {
+	return []string{d.config.EmailAttribute, d.config.GroupAttribute}
+}
+
+func bind(conn *ldap.Conn, dn, password string) error {
+	err := conn.Bind(dn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to bind to directory: %w", err)
+	}
+
+	return nil
+}
+
+// expand replaces {email} and {username} in s with the escaped email and
+// its part before the @.
+func expand(s, email string, escape func(string) string) string {
+	username, _, _ := strings.Cut(email, "@")
+	return strings.NewReplacer("{email}", escape(email), "{username}", escape(username)).Replace(s)
+}
@@ -0,0 +1,139 @@
+package ldapauth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/ldapauth"
+	"github.com/soicchi/auth_api/internal/ldapauth/ldaptest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+	serviceDN = "cn=auth,ou=services,dc=example,dc=com"
+	adminsDN  = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+func newTestDirectory() *ldaptest.Server {
+	return ldaptest.New(
+		ldaptest.Entry{
+			DN:       aliceDN,
+			Password: "alice-password",
+			Attributes: map[string][]string{
+				"uid":               {"alice"},
+				"mail":              {"alice@example.com"},
+				"userPrincipalName": {"alice@corp.example.com"},
+				"memberOf":          {adminsDN},
+			},
+		},
+		ldaptest.Entry{
+			DN:         "uid=bob,ou=people,dc=example,dc=com",
+			Password:   "bob-password",
+			Attributes: map[string][]string{"uid": {"bob"}},
+		},
+		ldaptest.Entry{
+			DN:       serviceDN,
+			Password: "service-password",
+		},
+	)
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := newTestDirectory()
+	defer server.Close()
+
+	templates := ldapauth.Config{
+		UserDNTemplates: []string{"uid={username},ou=staff,dc=example,dc=com", "uid={username},ou=people,dc=example,dc=com"},
+	}
+	search := ldapauth.Config{
+		BindDN:       serviceDN,
+		BindPassword: "service-password",
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(&(uid=*)(mail={email}))",
+	}
+	activeDirectory := ldapauth.Config{
+		UserDNTemplates: []string{"{email}"},
+		BaseDN:          "dc=example,dc=com",
+		UserFilter:      "(userPrincipalName={email})",
+	}
+	wrongService := search
+	wrongService.BindPassword = "wrong"
+
+	alice := &ldapauth.Entry{DN: aliceDN, Email: "alice@example.com", Groups: []string{adminsDN}}
+
+	tests := []struct {
+		name     string
+		config   ldapauth.Config
+		email    string
+		password string
+		want     *ldapauth.Entry
+		wantErr  error
+		wantAny  bool
+	}{
+		{name: "binds with the second template", config: templates, email: "alice@example.com", password: "alice-password", want: alice},
+		{name: "template with a wrong password", config: templates, email: "alice@example.com", password: "wrong", wantErr: ldapauth.ErrInvalidCredentials},
+		{name: "template of an unknown user", config: templates, email: "carol@example.com", password: "alice-password", wantErr: ldapauth.ErrInvalidCredentials},
+		{
+			name:     "entry without email",
+			config:   templates,
+			email:    "bob@example.com",
+			password: "bob-password",
+			want:     &ldapauth.Entry{DN: "uid=bob,ou=people,dc=example,dc=com", Email: "bob@example.com", Groups: []string{}},
+		},
+		{name: "searches as the service account", config: search, email: "alice@example.com", password: "alice-password", want: alice},
+		{name: "search with a wrong password", config: search, email: "alice@example.com", password: "wrong", wantErr: ldapauth.ErrInvalidCredentials},
+		{name: "search of an unknown user", config: search, email: "carol@example.com", password: "alice-password", wantErr: ldapauth.ErrInvalidCredentials},
+		{name: "filter injection", config: search, email: "*", password: "alice-password", wantErr: ldapauth.ErrInvalidCredentials},
+		{name: "service account rejected", config: wrongService, email: "alice@example.com", password: "alice-password", wantAny: true},
+		{name: "principal name bind looks the entry up", config: activeDirectory, email: "alice@corp.example.com", password: "alice-password", want: alice},
+		{name: "empty password", config: search, email: "alice@example.com", password: "", wantErr: ldapauth.ErrInvalidCredentials},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.URL = server.URL()
+			config.Timeout = 5 * time.Second
+			config.EmailAttribute = "mail"
+			config.GroupAttribute = "memberOf"
+			directory := ldapauth.NewDirectory(config)
+
+			entry, err := directory.Authenticate(context.Background(), test.email, test.password)
+			switch {
+			case test.wantAny:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ldapauth.ErrInvalidCredentials)
+			case test.wantErr != nil:
+				assert.ErrorIs(t, err, test.wantErr)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, entry)
+			}
+		})
+	}
+}
+
+func TestAuthenticateEmptyPassword(t *testing.T) {
+	server := newTestDirectory()
+	defer server.Close()
+
+	// Binding without a password would sign in anonymously
+	directory := ldapauth.NewDirectory(ldapauth.Config{URL: server.URL(), UserDNTemplates: []string{"uid={username},ou=people,dc=example,dc=com"}})
+	_, err := directory.Authenticate(context.Background(), "alice@example.com", "")
+	assert.ErrorIs(t, err, ldapauth.ErrInvalidCredentials)
+	assert.Empty(t, server.Binds())
+}
+
+func TestAuthenticateUnreachable(t *testing.T) {
+	server := newTestDirectory()
+	url := server.URL()
+	server.Close()
+
+	directory := ldapauth.NewDirectory(ldapauth.Config{URL: url, Timeout: time.Second, UserDNTemplates: []string{"uid={username},ou=people,dc=example,dc=com"}})
+	_, err := directory.Authenticate(context.Background(), "alice@example.com", "alice-password")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ldapauth.ErrInvalidCredentials)
+}
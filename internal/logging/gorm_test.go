@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGormLoggerTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		err     error
+		want    string
+	}{
+		{
+			name: "failed query",
+			err:  errors.New("connection reset"),
+			want: `"msg":"query failed"`,
+		},
+		{
+			name:    "slow query",
+			elapsed: time.Second,
+			want:    `"msg":"slow query"`,
+		},
+		{
+			name: "fast query at debug level",
+			want: `"msg":"query"`,
+		},
+		{
+			name: "record not found is not a failure",
+			err:  gorm.ErrRecordNotFound,
+			want: `"msg":"query"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			ctx := WithContext(context.Background(), logger.With("request_id", "req-1"))
+
+			l := NewGormLogger(100 * time.Millisecond)
+			l.Trace(ctx, time.Now().Add(-test.elapsed), func() (string, int64) {
+				return `SELECT * FROM "users" WHERE email = $1`, 1
+			}, test.err)
+
+			assert.Contains(t, buf.String(), test.want)
+			assert.Contains(t, buf.String(), `"request_id":"req-1"`)
+			assert.Contains(t, buf.String(), `email = $1`)
+		})
+	}
+}
+
+func TestGormLoggerTraceInfoLevel(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithContext(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	NewGormLogger(time.Second).Trace(ctx, time.Now(), func() (string, int64) {
+		return "SELECT 1", 1
+	}, nil)
+
+	assert.Empty(t, buf.String())
+}
+
+func TestGormLoggerParamsFilter(t *testing.T) {
+	sql, params := NewGormLogger(time.Second).ParamsFilter(context.Background(), "UPDATE users SET password = $1", "hash")
+	assert.Equal(t, "UPDATE users SET password = $1", sql)
+	assert.Nil(t, params)
+}
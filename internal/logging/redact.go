@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched as substrings of lower-cased attribute keys, so
+// "refresh_token" and "Authorization" are covered as well.
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"cookie",
+	"authorization",
+	"api_key",
+	"api-key",
+	"apikey",
+}
+
+// sensitiveValues catch credentials embedded in messages and errors, such as
+// a header echoed back by a parse error.
+var sensitiveValues = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[^\s"',;]+`), "$1 " + redacted},
+	{regexp.MustCompile(`\bak_[0-9a-f]+`), "ak_" + redacted},
+	{regexp.MustCompile(`\beyJ[\w-]*\.[\w-]*\.[\w-]*`), redacted},
+}
+
+// Redact is a slog ReplaceAttr function. It hides the values of sensitive
+// keys and scrubs credentials out of string and error values.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 || !isBuiltinKey(a.Key) {
+		if isSensitiveKey(a.Key) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+
+	return a
+}
+
+// RedactString replaces credentials found in s.
+func RedactString(s string) string {
+	for _, v := range sensitiveValues {
+		s = v.pattern.ReplaceAllString(s, v.replacement)
+	}
+
+	return s
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isBuiltinKey(key string) bool {
+	switch key {
+	case slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		attr slog.Attr
+		want string
+	}{
+		{
+			name: "password key",
+			attr: slog.String("password", "hunter22"),
+			want: redacted,
+		},
+		{
+			name: "token suffix",
+			attr: slog.String("refresh_token", "abc"),
+			want: redacted,
+		},
+		{
+			name: "authorization header in any case",
+			attr: slog.String("Authorization", "Bearer abc"),
+			want: redacted,
+		},
+		{
+			name: "bearer credentials in value",
+			attr: slog.String("detail", "header was Bearer abc.def"),
+			want: "header was Bearer " + redacted,
+		},
+		{
+			name: "api key in error",
+			attr: slog.Any("error", errors.New("unknown key ak_0123abcd")),
+			want: "unknown key ak_" + redacted,
+		},
+		{
+			name: "jwt in value",
+			attr: slog.String("detail", "got eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln"),
+			want: "got " + redacted,
+		},
+		{
+			name: "harmless value",
+			attr: slog.String("email_domain", "example.com"),
+			want: "example.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Redact(nil, test.attr)
+			assert.Equal(t, test.attr.Key, got.Key)
+			assert.Equal(t, test.want, got.Value.String())
+		})
+	}
+}
+
+func TestRedactKeepsBuiltinKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: Redact}))
+
+	logger.Info("refresh token rejected", slog.Group("request", slog.String("cookie", "refresh_token=abc")))
+
+	assert.Contains(t, buf.String(), `"msg":"refresh token rejected"`)
+	assert.Contains(t, buf.String(), `"cookie":"`+redacted+`"`)
+	assert.NotContains(t, buf.String(), "abc")
+}
@@ -0,0 +1,165 @@
+// Package metrics defines the Prometheus metrics exposed on /metrics. Metric
+// names and label values are part of the service's interface: label values
+// come from fixed sets so that cardinality stays bounded.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth"
+
+// ResultSuccess is the result label of successful events. Failures use the
+// error code of the failure, or ResultError for unexpected errors.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Registry holds every metric of the service. It is separate from the
+// default registry so that only metrics defined here are exposed.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	signups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signups_total",
+		Help:      "Signups by result.",
+	}, []string{"result"})
+
+	signIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signins_total",
+		Help:      "Sign-in attempts by result.",
+	}, []string{"result"})
+
+	tokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Access token refreshes by result.",
+	}, []string{"result"})
+
+	sessionRevocations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_revocations_total",
+		Help:      "Refresh tokens revoked by password resets and session revocation.",
+	})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result: delivered, retry or dead.",
+	}, []string{"result"})
+
+	janitorRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "janitor_runs_total",
+		Help:      "Janitor job runs by job and result: success, error or skipped when another replica held the job.",
+	}, []string{"job", "result"})
+
+	janitorPurged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "janitor_purged_total",
+		Help:      "Rows removed by janitor jobs by job.",
+	}, []string{"job"})
+
+	janitorRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "janitor_run_duration_seconds",
+		Help:      "Time spent in janitor job runs by job.",
+		Buckets:   []float64{.01, .1, .5, 1, 5, 15, 60, 300},
+	}, []string{"job"})
+
+	passwordHashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time spent hashing and verifying passwords by algorithm and operation.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"algorithm", "operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		signups,
+		signIns,
+		tokenRefreshes,
+		sessionRevocations,
+		webhookDeliveries,
+		janitorRuns,
+		janitorPurged,
+		janitorRunDuration,
+		passwordHashDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDBStats exposes the statistics of the database pool as the
+// go_sql_* metrics labelled with dbName.
+func RegisterDBStats(db *sql.DB, dbName string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+func ObserveHTTPRequest(method, route, status string, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, status).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+func RecordSignup(result string) {
+	signups.WithLabelValues(result).Inc()
+}
+
+func RecordSignIn(result string) {
+	signIns.WithLabelValues(result).Inc()
+}
+
+func RecordTokenRefresh(result string) {
+	tokenRefreshes.WithLabelValues(result).Inc()
+}
+
+func RecordSessionRevocations(count int64) {
+	sessionRevocations.Add(float64(count))
+}
+
+func RecordWebhookDelivery(result string) {
+	webhookDeliveries.WithLabelValues(result).Inc()
+}
+
+// ObserveJanitorRun records a run of job that removed purged rows.
+func ObserveJanitorRun(job, result string, purged int64, duration time.Duration) {
+	janitorRuns.WithLabelValues(job, result).Inc()
+	janitorPurged.WithLabelValues(job).Add(float64(purged))
+	janitorRunDuration.WithLabelValues(job).Observe(duration.Seconds())
+}
+
+// ObservePasswordHash records the time since start for a hash or verify
+// operation.
+func ObservePasswordHash(algorithm, operation string, start time.Time) {
+	passwordHashDuration.WithLabelValues(algorithm, operation).Observe(time.Since(start).Seconds())
+}
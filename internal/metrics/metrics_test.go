@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordEvents(t *testing.T) {
+	before := testutil.ToFloat64(signIns.WithLabelValues("invalid_credentials"))
+	RecordSignIn("invalid_credentials")
+	assert.Equal(t, before+1, testutil.ToFloat64(signIns.WithLabelValues("invalid_credentials")))
+
+	before = testutil.ToFloat64(sessionRevocations)
+	RecordSessionRevocations(3)
+	assert.Equal(t, before+3, testutil.ToFloat64(sessionRevocations))
+
+	before = testutil.ToFloat64(webhookDeliveries.WithLabelValues("dead"))
+	RecordWebhookDelivery("dead")
+	assert.Equal(t, before+1, testutil.ToFloat64(webhookDeliveries.WithLabelValues("dead")))
+
+	before = testutil.ToFloat64(janitorPurged.WithLabelValues("expired_tokens"))
+	ObserveJanitorRun("expired_tokens", ResultSuccess, 5, time.Second)
+	assert.Equal(t, before+5, testutil.ToFloat64(janitorPurged.WithLabelValues("expired_tokens")))
+}
+
+func TestHandler(t *testing.T) {
+	RecordSignup(ResultSuccess)
+	ObserveHTTPRequest(http.MethodPost, "/api/v1/key/signup", "200", 10*time.Millisecond)
+	ObservePasswordHash("bcrypt", "hash", time.Now())
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	for _, want := range []string{
+		`auth_signups_total{result="success"}`,
+		`auth_http_requests_total{method="POST",route="/api/v1/key/signup",status="200"}`,
+		`auth_http_request_duration_seconds_bucket{method="POST",route="/api/v1/key/signup",le="0.01"}`,
+		`auth_password_hash_duration_seconds_count{algorithm="bcrypt",operation="hash"}`,
+	} {
+		assert.True(t, strings.Contains(body, want), "missing %s", want)
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
+	"github.com/soicchi/auth_api/internal/utils"
+
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -38,13 +39,9 @@ func TestCheckBasicAuth(t *testing.T) {
 		},
 	}
 
-	// Set environment variables
-	os.Setenv("BASIC_AUTH_USER", "test")
-	os.Setenv("BASIC_AUTH_PASSWORD", "password")
-
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			ok := checkCredentials(test.inputUsername, test.inputPassword)
+			ok := checkCredentials(test.inputUsername, test.inputPassword, "test", "password")
 			assert.Equal(t, test.want, ok)
 		})
 	}
@@ -72,7 +69,7 @@ func TestBasicAuth(t *testing.T) {
 			inputUsername: "test",
 			inputPassword: "password",
 			wantCode:      http.StatusUnauthorized,
-			wantBody:      "{\"data\":null,\"message\":\"Not found Authorization header\"}\n",
+			wantBody:      "{\"type\":\"/problems/unauthorized\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Not found Authorization header\",\"instance\":\"/basic/users\",\"code\":\"unauthorized\"}",
 			isSetHeader:   false,
 		},
 		{
@@ -80,7 +77,7 @@ func TestBasicAuth(t *testing.T) {
 			inputUsername: "invalid",
 			inputPassword: "password",
 			wantCode:      http.StatusUnauthorized,
-			wantBody:      "{\"data\":null,\"message\":\"Invalid username or password\"}\n",
+			wantBody:      "{\"type\":\"/problems/invalid_credentials\",\"title\":\"Invalid credentials\",\"status\":401,\"detail\":\"Invalid username or password\",\"instance\":\"/basic/users\",\"code\":\"invalid_credentials\"}",
 			isSetHeader:   true,
 		},
 		{
@@ -88,17 +85,15 @@ func TestBasicAuth(t *testing.T) {
 			inputUsername: "test",
 			inputPassword: "invalid",
 			wantCode:      http.StatusUnauthorized,
-			wantBody:      "{\"data\":null,\"message\":\"Invalid username or password\"}\n",
+			wantBody:      "{\"type\":\"/problems/invalid_credentials\",\"title\":\"Invalid credentials\",\"status\":401,\"detail\":\"Invalid username or password\",\"instance\":\"/basic/users\",\"code\":\"invalid_credentials\"}",
 			isSetHeader:   true,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			os.Setenv("BASIC_AUTH_USER", "test")
-			os.Setenv("BASIC_AUTH_PASSWORD", "password")
-
 			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
 			req := httptest.NewRequest(http.MethodGet, "/basic/users", nil)
 			if test.isSetHeader {
 				req.Header.Set(echo.HeaderAuthorization, basicAuthHeader(test.inputUsername, test.inputPassword))
@@ -108,11 +103,13 @@ func TestBasicAuth(t *testing.T) {
 			c := e.NewContext(req, rec)
 
 			// Assume Basic authentication returns status 200 on success
-			middleware := BasicAuth(func(c echo.Context) error {
+			middleware := NewBasicAuth("test", "password")(func(c echo.Context) error {
 				return c.String(http.StatusOK, "test")
 			})
 
-			middleware(c)
+			if err := middleware(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
 			assert.Equal(t, test.wantCode, rec.Code)
 			assert.Equal(t, test.wantBody, rec.Body.String())
 		})
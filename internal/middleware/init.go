@@ -1,16 +1,28 @@
 package middleware
 
 import (
+	"log/slog"
+
+	"github.com/soicchi/auth_api/internal/logging"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func InitializeMiddleware(e *echo.Echo) {
+func InitializeMiddleware(e *echo.Echo, logger *slog.Logger) {
 	// Remove trailing slash
 	e.Pre(middleware.RemoveTrailingSlash())
 
 	// Initialize base middleware
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
+	e.Use(NewMetrics())
 	e.Use(middleware.RequestID())
+	e.Use(NewRequestInfo())
+	e.Use(NewTracing())
+	e.Use(NewRequestLogger(logger))
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			logging.FromContext(c.Request().Context()).Error("recovered from panic", "error", err, "stack", string(stack))
+			return err
+		},
+	}))
 }
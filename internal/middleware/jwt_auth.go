@@ -1,77 +1,172 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strconv"
 	"time"
 
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/tenant"
 	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func JWTAuth(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(ctx echo.Context) error {
-		authHeader := ctx.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			log.Printf("Authorization header is empty")
-			return utils.UnauthorizedResponse(ctx, "invalid access token")
-		}
+// JWTAuthConfig lists what an access token must carry to be accepted.
+type JWTAuthConfig struct {
+	Keys      *utils.Keyring
+	Issuer    string
+	Audiences []string
+}
 
-		tokenString, err := utils.ExtractBearerToken(authHeader)
-		if err != nil {
-			log.Printf("Failed to extract token from header: %v", err)
-			return utils.UnauthorizedResponse(ctx, "invalid access token")
-		}
+func NewJWTAuth(cfg JWTAuthConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			authHeader := ctx.Request().Header.Get("Authorization")
+			if authHeader == "" {
+				return utils.ErrTokenMissing.WithDetail("The Authorization header is empty.")
+			}
 
-		if err := validateJWT(tokenString); err != nil {
-			log.Printf("Failed to validate token: %v", err)
-			return utils.UnauthorizedResponse(ctx, "invalid access token")
-		}
+			tokenString, err := utils.ExtractBearerToken(authHeader)
+			if err != nil {
+				return utils.ErrTokenInvalid.Wrap(err)
+			}
+
+			claims, err := validateJWT(cfg, tokenString)
+			if err != nil {
+				return err
+			}
 
-		return next(ctx)
+			if err := checkTokenTenant(ctx.Request().Context(), claims); err != nil {
+				return err
+			}
+
+			// Attach the user to logs and traces of the rest of the request
+			if userID, err := claims.GetSubject(); err == nil && userID != "" {
+				ctx.Set(utils.ContextKeyUserID, userID)
+				req := ctx.Request()
+				reqCtx := logging.WithContext(req.Context(), logging.FromContext(req.Context()).With(slog.String("user_id", userID)))
+				if id, err := strconv.ParseUint(userID, 10, 64); err == nil {
+					info := utils.RequestInfoFromContext(reqCtx)
+					info.UserID = uint(id)
+					if authTime, ok := claims[utils.ClaimAuthTime].(float64); ok {
+						info.AuthTime = time.Unix(int64(authTime), 0)
+					}
+					reqCtx = utils.WithRequestInfo(reqCtx, info)
+				}
+				ctx.SetRequest(req.WithContext(reqCtx))
+				trace.SpanFromContext(req.Context()).SetAttributes(semconv.EnduserID(userID))
+			}
+
+			return next(ctx)
+		}
 	}
 }
 
-func validateJWT(tokenString string) error {
-	token, err := parseJWT(tokenString)
+func validateJWT(cfg JWTAuthConfig, tokenString string) (jwt.MapClaims, error) {
+	token, err := parseJWT(cfg.Keys, tokenString, jwt.WithIssuer(cfg.Issuer), jwt.WithIssuedAt())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, utils.ErrTokenExpired.Wrap(err)
+	}
+
 	if err != nil {
-		return fmt.Errorf("error parsing token %v", err)
+		return nil, utils.ErrTokenInvalid.Wrap(err)
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return fmt.Errorf("invalid token")
+		return nil, utils.ErrTokenInvalid
 	}
 
 	// check token expiration
 	if err := checkTokenExpiration(claims); err != nil {
-		return fmt.Errorf("error checking token expiration %v", err)
+		return nil, err
 	}
 
-	return nil
+	if err := checkTokenAudience(claims, cfg.Audiences); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
-func parseJWT(tokenString string) (*jwt.Token, error) {
+func parseJWT(keys *utils.Keyring, tokenString string, opts ...jwt.ParserOption) (*jwt.Token, error) {
 	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+
+		if kid, ok := token.Header["kid"].(string); ok {
+			secret, found := keys.Lookup(kid)
+			if !found {
+				return nil, fmt.Errorf("unknown signing key %s", kid)
+			}
+			return secret, nil
+		}
+
+		// The fallback secret is never retired, so it only verifies tokens
+		// until keys have been rotated in
+		if !keys.AcceptsFallback() {
+			return nil, fmt.Errorf("token has no signing key ID")
+		}
+
+		return keys.Fallback(), nil
+	}, opts...)
 }
 
 func checkTokenExpiration(claims jwt.MapClaims) error {
 	exp, ok := claims["exp"].(float64)
 	if !ok {
-		return fmt.Errorf("error getting token expiration")
+		return utils.ErrTokenInvalid.WithDetail("The token has no expiration.")
 	}
 
 	if time.Now().Unix() > int64(exp) {
-		return fmt.Errorf("token expired")
+		return utils.ErrTokenExpired
 	}
 
 	return nil
 }
+
+// checkTokenTenant rejects tokens issued to users of another tenant than the
+// one of the request.
+func checkTokenTenant(ctx context.Context, claims jwt.MapClaims) error {
+	want, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	got := tenant.Default
+	if claim, ok := claims[utils.ClaimTenant]; ok {
+		got, _ = claim.(string)
+	}
+
+	if got != want {
+		return utils.ErrTokenInvalid.WithDetail("The token belongs to another tenant.")
+	}
+
+	return nil
+}
+
+// checkTokenAudience accepts a token when any of its audiences is accepted.
+func checkTokenAudience(claims jwt.MapClaims, accepted []string) error {
+	audiences, err := claims.GetAudience()
+	if err != nil {
+		return utils.ErrTokenInvalid.Wrap(err)
+	}
+
+	for _, aud := range audiences {
+		for _, want := range accepted {
+			if aud == want {
+				return nil
+			}
+		}
+	}
+
+	return utils.ErrTokenInvalid.WithDetail("The token is not intended for this audience.")
+}
@@ -3,10 +3,10 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
+	"github.com/soicchi/auth_api/internal/tenant"
 	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,9 +14,24 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+var testTokenSettings = utils.TokenSettings{
+	Issuer:         "auth_api",
+	Audience:       "auth_api",
+	AccessTokenTTL: time.Hour,
+}
+
+func testJWTAuthConfig(keys *utils.Keyring) JWTAuthConfig {
+	return JWTAuthConfig{
+		Keys:      keys,
+		Issuer:    "auth_api",
+		Audiences: []string{"auth_api", "mobile"},
+	}
+}
+
 func TestJWTAuth(t *testing.T) {
+	keys := utils.NewKeyring("test_secret")
 	userID := uint(1)
-	tokenString, _ := utils.GenerateJWT(userID)
+	tokenString, _ := utils.GenerateJWT(keys, testTokenSettings, userID)
 
 	tests := []struct {
 		name       string
@@ -48,24 +63,145 @@ func TestJWTAuth(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
 			req := httptest.NewRequest(http.MethodGet, "/jwt/users", nil)
 			req.Header.Set("Authorization", test.in)
 			rec := httptest.NewRecorder()
 			ctx := e.NewContext(req, rec)
 
-			middleware := JWTAuth(func(c echo.Context) error {
+			middleware := NewJWTAuth(testJWTAuthConfig(keys))(func(c echo.Context) error {
 				return c.String(http.StatusOK, "test")
 			})
 
-			middleware(ctx)
+			if err := middleware(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
 			assert.Equal(t, test.wantStatus, rec.Code)
 		})
 	}
 }
 
+func TestJWTAuthTenant(t *testing.T) {
+	keys := utils.NewKeyring("test_secret")
+	acme := testTokenSettings
+	acme.Tenant = "acme"
+	acmeTokenString, _ := utils.GenerateJWT(keys, acme, 1)
+	legacyTokenString, _ := utils.GenerateJWT(keys, testTokenSettings, 1)
+
+	tests := []struct {
+		name       string
+		in         string
+		tenant     string
+		wantStatus int
+	}{
+		{
+			name:       "token of the request tenant",
+			in:         acmeTokenString,
+			tenant:     "acme",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token of another tenant",
+			in:         acmeTokenString,
+			tenant:     "globex",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token without a tenant belongs to the default tenant",
+			in:         legacyTokenString,
+			tenant:     tenant.Default,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "token without a tenant in another tenant",
+			in:         legacyTokenString,
+			tenant:     "acme",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/jwt/users", nil)
+			req = req.WithContext(tenant.WithContext(req.Context(), test.tenant))
+			req.Header.Set("Authorization", "Bearer "+test.in)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			middleware := NewJWTAuth(testJWTAuthConfig(keys))(func(c echo.Context) error {
+				return c.String(http.StatusOK, "test")
+			})
+
+			if err := middleware(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+			assert.Equal(t, test.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestJWTAuthRequestInfo(t *testing.T) {
+	keys := utils.NewKeyring("test_secret")
+	signedIn := testTokenSettings
+	signedIn.AuthTime = time.Now().Add(-time.Minute)
+	signedInTokenString, _ := utils.GenerateJWT(keys, signedIn, 1)
+	refreshedTokenString, _ := utils.GenerateJWT(keys, testTokenSettings, 1)
+
+	tests := []struct {
+		name         string
+		in           string
+		wantAuthTime time.Time
+	}{
+		{
+			name:         "token issued at sign-in",
+			in:           signedInTokenString,
+			wantAuthTime: time.Unix(signedIn.AuthTime.Unix(), 0),
+		},
+		{
+			name: "token without a sign-in time",
+			in:   refreshedTokenString,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/jwt/users", nil)
+			req.Header.Set("Authorization", "Bearer "+test.in)
+			ctx := e.NewContext(req, httptest.NewRecorder())
+
+			var info utils.RequestInfo
+			middleware := NewJWTAuth(testJWTAuthConfig(keys))(func(c echo.Context) error {
+				info = utils.RequestInfoFromContext(c.Request().Context())
+				return nil
+			})
+
+			assert.NoError(t, middleware(ctx))
+			assert.Equal(t, uint(1), info.UserID)
+			assert.True(t, test.wantAuthTime.Equal(info.AuthTime))
+		})
+	}
+}
+
 func TestValidateJWT(t *testing.T) {
+	keys := utils.NewKeyring("test_secret")
 	userID := uint(1)
-	tokenString, _ := utils.GenerateJWT(userID)
+	tokenString, _ := utils.GenerateJWT(keys, testTokenSettings, userID)
+
+	mobile := testTokenSettings
+	mobile.Audience = "mobile"
+	mobileTokenString, _ := utils.GenerateJWT(keys, mobile, userID)
+
+	otherIssuer := testTokenSettings
+	otherIssuer.Issuer = "other"
+	otherIssuerTokenString, _ := utils.GenerateJWT(keys, otherIssuer, userID)
+
+	otherAudience := testTokenSettings
+	otherAudience.Audience = "other"
+	otherAudienceTokenString, _ := utils.GenerateJWT(keys, otherAudience, userID)
+
 	tests := []struct {
 		name    string
 		in      string
@@ -76,17 +212,32 @@ func TestValidateJWT(t *testing.T) {
 			in:      tokenString,
 			wantErr: false,
 		},
+		{
+			name:    "accepted client audience",
+			in:      mobileTokenString,
+			wantErr: false,
+		},
 		{
 			name:    "invalid token",
 			in:      "invalid_token",
 			wantErr: true,
 		},
+		{
+			name:    "unexpected issuer",
+			in:      otherIssuerTokenString,
+			wantErr: true,
+		},
+		{
+			name:    "unexpected audience",
+			in:      otherAudienceTokenString,
+			wantErr: true,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			err := validateJWT(test.in)
-			if test.wantErr && err != nil {
+			_, err := validateJWT(testJWTAuthConfig(keys), test.in)
+			if test.wantErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
@@ -96,29 +247,64 @@ func TestValidateJWT(t *testing.T) {
 }
 
 func TestParseJWT(t *testing.T) {
-	os.Setenv("JWT_SECRET", "test_secret")
+	keys := utils.NewKeyring("test_secret")
 	userID := uint(1)
-	tokenString, _ := utils.GenerateJWT(userID)
+	tokenString, _ := utils.GenerateJWT(keys, testTokenSettings, userID)
+
+	rotated := utils.NewKeyring("test_secret")
+	rotated.SetKeys(utils.SigningKey{ID: "kid", Secret: []byte("key_secret")}, nil, time.Time{})
+	keyTokenString, _ := utils.GenerateJWT(rotated, testTokenSettings, userID)
+
+	migrating := utils.NewKeyring("test_secret")
+	migrating.SetKeys(utils.SigningKey{ID: "kid", Secret: []byte("key_secret")}, nil, time.Now().Add(time.Hour))
+
 	tests := []struct {
 		name    string
+		keys    *utils.Keyring
 		jwt     string
 		wantErr bool
 	}{
 		{
 			name:    "valid token",
+			keys:    keys,
 			jwt:     tokenString,
 			wantErr: false,
 		},
 		{
 			name:    "invalid token",
+			keys:    keys,
 			jwt:     "invalid_token",
 			wantErr: true,
 		},
+		{
+			name:    "valid token signed with key id",
+			keys:    rotated,
+			jwt:     keyTokenString,
+			wantErr: false,
+		},
+		{
+			name:    "unknown key id",
+			keys:    keys,
+			jwt:     keyTokenString,
+			wantErr: true,
+		},
+		{
+			name:    "token without key id after rotation",
+			keys:    rotated,
+			jwt:     tokenString,
+			wantErr: true,
+		},
+		{
+			name:    "token without key id within the grace period",
+			keys:    migrating,
+			jwt:     tokenString,
+			wantErr: false,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := parseJWT(test.jwt)
+			_, err := parseJWT(test.keys, test.jwt)
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
 			} else {
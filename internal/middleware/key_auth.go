@@ -1,24 +1,47 @@
 package middleware
 
 import (
-	"os"
+	"context"
+	"crypto/subtle"
+	"fmt"
 
 	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/labstack/echo/v4"
 )
 
-func KeyAuth(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		key := c.Request().Header.Get("API-KEY")
-		if key == "" {
-			return utils.UnauthorizedResponse(c, "Not found API-KEY value")
-		}
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*utils.TokenOverrides, error)
+}
 
-		if key != os.Getenv("API_KEY") {
-			return utils.UnauthorizedResponse(c, "Invalid API-KEY value")
-		}
+// NewKeyAuth accepts the configured static API key, if any, and, when verifier
+// is set, any key minted with authctl. The token overrides of a minted key are
+// stored in the context for the handlers issuing tokens.
+func NewKeyAuth(staticKey string, verifier APIKeyVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get("API-KEY")
+			if key == "" {
+				return utils.ErrInvalidAPIKey.WithDetail("Not found API-KEY value")
+			}
+
+			if staticKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(staticKey)) == 1 {
+				return next(c)
+			}
 
-		return next(c)
+			if verifier != nil {
+				overrides, err := verifier.VerifyAPIKey(c.Request().Context(), key)
+				if err != nil {
+					return fmt.Errorf("failed to verify api key: %w", err)
+				}
+
+				if overrides != nil {
+					c.Set(utils.ContextKeyTokenOverrides, *overrides)
+					return next(c)
+				}
+			}
+
+			return utils.ErrInvalidAPIKey.WithDetail("Invalid API-KEY value")
+		}
 	}
 }
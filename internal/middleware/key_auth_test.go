@@ -1,15 +1,28 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
+	"github.com/soicchi/auth_api/internal/utils"
+
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
+type MockAPIKeyVerifier struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyVerifier) VerifyAPIKey(ctx context.Context, key string) (*utils.TokenOverrides, error) {
+	args := m.Called(key)
+	return args.Get(0).(*utils.TokenOverrides), args.Error(1)
+}
+
 func TestKeyAuth(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -27,28 +40,98 @@ func TestKeyAuth(t *testing.T) {
 			name:     "Invalid key auth",
 			inputKey: "invalid",
 			wantCode: http.StatusUnauthorized,
-			wantBody: "{\"data\":null,\"message\":\"Invalid API-KEY value\"}\n",
+			wantBody: "{\"type\":\"/problems/invalid_api_key\",\"title\":\"Invalid API key\",\"status\":401,\"detail\":\"Invalid API-KEY value\",\"instance\":\"/\",\"code\":\"invalid_api_key\"}",
 		},
 	}
 
-	os.Setenv("API_KEY", "testkey")
-
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
 			req := httptest.NewRequest(http.MethodGet, "/", nil)
 			req.Header.Set("API-KEY", test.inputKey)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
 			// Assume Basic authentication returns status 200 on success
-			middleware := KeyAuth(func(c echo.Context) error {
+			middleware := NewKeyAuth("testkey", nil)(func(c echo.Context) error {
 				return c.String(http.StatusOK, "test")
 			})
 
-			middleware(c)
+			if err := middleware(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
 			assert.Equal(t, test.wantCode, rec.Code)
 			assert.Equal(t, test.wantBody, rec.Body.String())
 		})
 	}
 }
+
+func TestNewKeyAuth(t *testing.T) {
+	tests := []struct {
+		name         string
+		inputKey     string
+		mock         func(mockVerifier *MockAPIKeyVerifier)
+		wantCode     int
+		wantAudience string
+	}{
+		{
+			name:     "Environment key",
+			inputKey: "testkey",
+			mock:     func(mockVerifier *MockAPIKeyVerifier) {},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Minted key",
+			inputKey: "ak_minted",
+			mock: func(mockVerifier *MockAPIKeyVerifier) {
+				mockVerifier.On("VerifyAPIKey", "ak_minted").Return(&utils.TokenOverrides{Audience: "mobile"}, nil)
+			},
+			wantCode:     http.StatusOK,
+			wantAudience: "mobile",
+		},
+		{
+			name:     "Unknown key",
+			inputKey: "ak_unknown",
+			mock: func(mockVerifier *MockAPIKeyVerifier) {
+				mockVerifier.On("VerifyAPIKey", "ak_unknown").Return((*utils.TokenOverrides)(nil), nil)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Verifier error",
+			inputKey: "ak_error",
+			mock: func(mockVerifier *MockAPIKeyVerifier) {
+				mockVerifier.On("VerifyAPIKey", "ak_error").Return((*utils.TokenOverrides)(nil), fmt.Errorf("db error"))
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockVerifier MockAPIKeyVerifier
+			test.mock(&mockVerifier)
+
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("API-KEY", test.inputKey)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			middleware := NewKeyAuth("testkey", &mockVerifier)(func(c echo.Context) error {
+				return c.String(http.StatusOK, utils.TokenOverridesFromContext(c).Audience)
+			})
+
+			if err := middleware(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantCode == http.StatusOK {
+				assert.Equal(t, test.wantAudience, rec.Body.String())
+			}
+			mockVerifier.AssertExpectations(t)
+		})
+	}
+}
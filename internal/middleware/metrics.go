@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// unmatchedRoute labels requests that matched no route, so that scanning
+// arbitrary paths cannot grow the number of series.
+const unmatchedRoute = "unmatched"
+
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// NewMetrics records a counter and latency histogram per route template.
+func NewMetrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			method := c.Request().Method
+			if !knownMethods[method] {
+				method = "OTHER"
+			}
+
+			// echo leaves the path empty when no route template matched
+			route := c.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			metrics.ObserveHTTPRequest(method, route, strconv.Itoa(responseStatus(c, err)), time.Since(start))
+			return err
+		}
+	}
+}
+
+// responseStatus is the status the error handler will write for err, since
+// it runs only after the middleware chain returns.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil {
+		return c.Response().Status
+	}
+
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Status
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return http.StatusInternalServerError
+}
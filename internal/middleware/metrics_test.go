@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+	e.Use(NewMetrics())
+	e.GET("/metrics_test/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "test")
+	})
+	e.POST("/metrics_test/signin", func(c echo.Context) error {
+		return utils.ErrInvalidCredentials
+	})
+	e.GET("/metrics_test/panic", func(c echo.Context) error {
+		return fmt.Errorf("unexpected")
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/metrics_test/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/metrics_test/users/2", nil),
+		httptest.NewRequest(http.MethodPost, "/metrics_test/signin", nil),
+		httptest.NewRequest(http.MethodGet, "/metrics_test/panic", nil),
+		httptest.NewRequest(http.MethodGet, "/metrics_test/unknown/path", nil),
+		httptest.NewRequest("PROPFIND", "/metrics_test/users/1", nil),
+	} {
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`auth_http_requests_total{method="GET",route="/metrics_test/users/:id",status="200"} 2`,
+		`auth_http_requests_total{method="POST",route="/metrics_test/signin",status="401"} 1`,
+		`auth_http_requests_total{method="GET",route="/metrics_test/panic",status="500"} 1`,
+		`auth_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`auth_http_requests_total{method="OTHER",route="/metrics_test/users/:id",status="405"} 1`,
+	} {
+		assert.True(t, strings.Contains(body, want), "missing %s", want)
+	}
+	assert.False(t, strings.Contains(body, "/metrics_test/users/1"))
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewRequestInfo stores the request ID, client IP and user agent in the
+// request context for the audit trail. It must run after RequestID.
+func NewRequestInfo() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			info := utils.RequestInfo{
+				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+				IP:        c.RealIP(),
+				UserAgent: req.UserAgent(),
+			}
+			c.SetRequest(req.WithContext(utils.WithRequestInfo(req.Context(), info)))
+
+			return next(c)
+		}
+	}
+}
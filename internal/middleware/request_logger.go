@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewRequestLogger stores a logger carrying the request ID, client IP and
+// trace ID in the request context and logs one line per request. It must run
+// after RequestID and tracing. The path is logged without its query string,
+// which may carry credentials.
+func NewRequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+
+			attrs := []any{
+				slog.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+				slog.String("client_ip", c.RealIP()),
+			}
+			if span := trace.SpanContextFromContext(req.Context()); span.IsValid() {
+				attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+			}
+			requestLogger := logger.With(attrs...)
+			c.SetRequest(req.WithContext(logging.WithContext(req.Context(), requestLogger)))
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+			fields := []any{
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.String("route", c.Path()),
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("user_agent", req.UserAgent()),
+			}
+			if err != nil {
+				fields = append(fields, slog.Any("error", err))
+			}
+
+			// Handlers may have added the user ID to the context logger
+			requestLogger = logging.FromContext(c.Request().Context())
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			requestLogger.Log(c.Request().Context(), level, "request", fields...)
+
+			return err
+		}
+	}
+}
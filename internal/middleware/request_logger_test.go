@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogger(t *testing.T) {
+	keys := utils.NewKeyring("secret")
+	tokenString, _ := utils.GenerateJWT(keys, testTokenSettings, 7)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: logging.Redact}))
+
+	e := echo.New()
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+	e.Use(echomiddleware.RequestIDWithConfig(echomiddleware.RequestIDConfig{
+		Generator: func() string { return "request-1" },
+	}))
+	e.Use(NewRequestLogger(logger))
+	e.GET("/users/:id", func(c echo.Context) error {
+		logging.FromContext(c.Request().Context()).Info("handler", "password", "hunter22")
+		return utils.ErrInternal
+	}, NewJWTAuth(testJWTAuthConfig(keys)))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/7?refresh_token=abc", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+tokenString)
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+
+	var handler, request map[string]any
+	assert.NoError(t, json.Unmarshal(lines[0], &handler))
+	assert.NoError(t, json.Unmarshal(lines[1], &request))
+
+	assert.Equal(t, "[REDACTED]", handler["password"])
+	assert.Equal(t, "7", handler["user_id"])
+
+	assert.Equal(t, "request", request["msg"])
+	assert.Equal(t, "ERROR", request["level"])
+	assert.Equal(t, "request-1", request["request_id"])
+	assert.Equal(t, "7", request["user_id"])
+	assert.Equal(t, "203.0.113.7", request["client_ip"])
+	assert.Equal(t, "/users/7", request["path"])
+	assert.Equal(t, "/users/:id", request["route"])
+	assert.Equal(t, float64(http.StatusInternalServerError), request["status"])
+	assert.NotContains(t, buf.String(), tokenString)
+}
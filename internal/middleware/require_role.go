@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RoleLookup interface {
+	FetchUserRole(ctx context.Context, userID uint) (string, error)
+}
+
+// NewRequireRole only lets users with the given role through. It must run
+// after JWT authentication; the role is read from the database so that a
+// demoted user loses access before their token expires.
+func NewRequireRole(lookup RoleLookup, role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := utils.RequestInfoFromContext(c.Request().Context()).UserID
+			if userID == 0 {
+				return utils.ErrUnauthorized
+			}
+
+			userRole, err := lookup.FetchUserRole(c.Request().Context(), userID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch user role: %w", err)
+			}
+
+			if userRole != role {
+				return utils.ErrForbidden
+			}
+
+			return next(c)
+		}
+	}
+}
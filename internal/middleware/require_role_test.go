@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRoleLookup struct {
+	mock.Mock
+}
+
+func (m *MockRoleLookup) FetchUserRole(ctx context.Context, userID uint) (string, error) {
+	args := m.Called(userID)
+	return args.String(0), args.Error(1)
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		mock     func(mockLookup *MockRoleLookup)
+		wantCode int
+	}{
+		{
+			name:   "admin",
+			userID: 1,
+			mock: func(mockLookup *MockRoleLookup) {
+				mockLookup.On("FetchUserRole", uint(1)).Return("admin", nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "other role",
+			userID: 2,
+			mock: func(mockLookup *MockRoleLookup) {
+				mockLookup.On("FetchUserRole", uint(2)).Return("user", nil)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:   "deleted user",
+			userID: 3,
+			mock: func(mockLookup *MockRoleLookup) {
+				mockLookup.On("FetchUserRole", uint(3)).Return("", nil)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:   "lookup error",
+			userID: 4,
+			mock: func(mockLookup *MockRoleLookup) {
+				mockLookup.On("FetchUserRole", uint(4)).Return("", fmt.Errorf("db error"))
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "unauthenticated",
+			mock:     func(mockLookup *MockRoleLookup) {},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockLookup MockRoleLookup
+			test.mock(&mockLookup)
+
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req = req.WithContext(utils.WithRequestInfo(req.Context(), utils.RequestInfo{UserID: test.userID}))
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			middleware := NewRequireRole(&mockLookup, "admin")(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := middleware(ctx); err != nil {
+				e.HTTPErrorHandler(err, ctx)
+			}
+
+			assert.Equal(t, test.wantCode, rec.Code)
+			mockLookup.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SCIMTokenVerifier interface {
+	VerifySCIMToken(ctx context.Context, token string) (*scim.Client, error)
+}
+
+// NewSCIMErrors renders the errors of the SCIM routes as SCIM errors. The
+// error is still returned so that the request logger sees it;
+// HTTPErrorHandler leaves the committed response alone.
+func NewSCIMErrors() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				utils.SCIMErrorHandler(err, c)
+			}
+
+			return err
+		}
+	}
+}
+
+// NewSCIMAuth accepts the bearer tokens minted for SCIM clients. The tenant
+// of the token becomes the tenant of the request, so the SCIM routes need no
+// tenant middleware, and the token is the audit actor.
+func NewSCIMAuth(verifier SCIMTokenVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, err := utils.ExtractBearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+			if err != nil {
+				return utils.ErrUnauthorized.WithDetail("A SCIM bearer token is required.")
+			}
+
+			req := c.Request()
+			client, err := verifier.VerifySCIMToken(req.Context(), token)
+			if err != nil {
+				return fmt.Errorf("failed to verify scim token: %w", err)
+			}
+
+			if client == nil {
+				return utils.ErrUnauthorized.WithDetail("The SCIM bearer token is invalid.")
+			}
+
+			ctx := tenant.WithContext(req.Context(), client.TenantID)
+			info := utils.RequestInfoFromContext(ctx)
+			info.Client = client.Actor
+			c.SetRequest(req.WithContext(utils.WithRequestInfo(ctx, info)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSCIMTokenVerifier struct {
+	mock.Mock
+}
+
+func (m *MockSCIMTokenVerifier) VerifySCIMToken(ctx context.Context, token string) (*scim.Client, error) {
+	args := m.Called(token)
+	return args.Get(0).(*scim.Client), args.Error(1)
+}
+
+func TestSCIMAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		mock       func(mockVerifier *MockSCIMTokenVerifier)
+		wantCode   int
+		wantTenant string
+		wantActor  string
+	}{
+		{
+			name:   "valid token",
+			header: "Bearer scim_token",
+			mock: func(mockVerifier *MockSCIMTokenVerifier) {
+				mockVerifier.On("VerifySCIMToken", "scim_token").Return(&scim.Client{TenantID: "acme", Actor: "scim_token:3"}, nil)
+			},
+			wantCode:   http.StatusOK,
+			wantTenant: "acme",
+			wantActor:  "scim_token:3",
+		},
+		{
+			name:   "unknown token",
+			header: "Bearer unknown",
+			mock: func(mockVerifier *MockSCIMTokenVerifier) {
+				mockVerifier.On("VerifySCIMToken", "unknown").Return((*scim.Client)(nil), nil)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "missing token",
+			mock:     func(mockVerifier *MockSCIMTokenVerifier) {},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "verifier error",
+			header: "Bearer scim_token",
+			mock: func(mockVerifier *MockSCIMTokenVerifier) {
+				mockVerifier.On("VerifySCIMToken", "scim_token").Return((*scim.Client)(nil), fmt.Errorf("db error"))
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockVerifier MockSCIMTokenVerifier
+			test.mock(&mockVerifier)
+
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+			if test.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, test.header)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			var gotTenant, gotActor string
+			handler := NewSCIMErrors()(NewSCIMAuth(&mockVerifier)(func(c echo.Context) error {
+				gotTenant, _ = tenant.FromContext(c.Request().Context())
+				gotActor = utils.RequestInfoFromContext(c.Request().Context()).Client
+				return c.NoContent(http.StatusOK)
+			}))
+
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, test.wantTenant, gotTenant)
+			assert.Equal(t, test.wantActor, gotActor)
+			if test.wantCode != http.StatusOK {
+				assert.Equal(t, scim.MIMEApplicationSCIMJSON, rec.Header().Get(echo.HeaderContentType))
+			}
+			mockVerifier.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TenantParam is the path parameter of the tenant when tenants are resolved
+// from the path.
+const TenantParam = "tenant"
+
+// NewTenant resolves the tenant of the request as configured and stores it in
+// the request context, where the repositories pick it up. It must run before
+// anything that reads users, clients or tokens.
+func NewTenant(cfg config.TenancyConfig) echo.MiddlewareFunc {
+	known := make(map[string]bool, len(cfg.Tenants))
+	for _, id := range cfg.Tenants {
+		known[id] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			var id string
+			switch cfg.Resolver {
+			case "host":
+				host := req.Host
+				if h, _, err := net.SplitHostPort(host); err == nil {
+					host = h
+				}
+				id, _, _ = strings.Cut(host, ".")
+			case "path":
+				id = c.Param(TenantParam)
+			case "header":
+				id = req.Header.Get(cfg.Header)
+			default:
+				id = tenant.Default
+			}
+
+			if cfg.Resolver != "none" && !known[id] {
+				return utils.ErrNotFound.WithDetail("The tenant was not found.")
+			}
+
+			c.SetRequest(req.WithContext(tenant.WithContext(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant(t *testing.T) {
+	tenants := []string{"acme", "globex"}
+
+	tests := []struct {
+		name       string
+		cfg        config.TenancyConfig
+		target     string
+		host       string
+		header     string
+		wantStatus int
+		wantTenant string
+	}{
+		{
+			name:       "no resolver",
+			cfg:        config.TenancyConfig{Resolver: "none"},
+			target:     "/api/v1/key/signin",
+			wantStatus: http.StatusOK,
+			wantTenant: tenant.Default,
+		},
+		{
+			name:       "host",
+			cfg:        config.TenancyConfig{Resolver: "host", Tenants: tenants},
+			target:     "/api/v1/key/signin",
+			host:       "acme.auth.example.com:8080",
+			wantStatus: http.StatusOK,
+			wantTenant: "acme",
+		},
+		{
+			name:       "path",
+			cfg:        config.TenancyConfig{Resolver: "path", Tenants: tenants},
+			target:     "/t/globex/api/v1/key/signin",
+			wantStatus: http.StatusOK,
+			wantTenant: "globex",
+		},
+		{
+			name:       "header",
+			cfg:        config.TenancyConfig{Resolver: "header", Header: "X-Tenant-ID", Tenants: tenants},
+			target:     "/api/v1/key/signin",
+			header:     "acme",
+			wantStatus: http.StatusOK,
+			wantTenant: "acme",
+		},
+		{
+			name:       "missing header",
+			cfg:        config.TenancyConfig{Resolver: "header", Header: "X-Tenant-ID", Tenants: tenants},
+			target:     "/api/v1/key/signin",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown tenant",
+			cfg:        config.TenancyConfig{Resolver: "path", Tenants: tenants},
+			target:     "/t/initech/api/v1/key/signin",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = utils.HTTPErrorHandler
+			prefix := "/api/v1"
+			if test.cfg.Resolver == "path" {
+				prefix = "/t/:" + TenantParam + "/api/v1"
+			}
+
+			var gotTenant string
+			e.Group(prefix, NewTenant(test.cfg)).POST("/key/signin", func(c echo.Context) error {
+				gotTenant, _ = tenant.FromContext(c.Request().Context())
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, test.target, nil)
+			if test.host != "" {
+				req.Host = test.host
+			}
+			req.Header.Set("X-Tenant-ID", test.header)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantStatus, rec.Code)
+			assert.Equal(t, test.wantTenant, gotTenant)
+		})
+	}
+}
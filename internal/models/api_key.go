@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey is a credential for the key-authenticated routes. Only the SHA-256
+// hash of the key is stored; the prefix identifies it to operators. Audience
+// and the TTLs override the configured token settings for tokens issued
+// through this key; empty or zero keeps the defaults.
+type APIKey struct {
+	gorm.Model
+	// TenantID is the tenant whose users the key can sign up and in.
+	TenantID               string `gorm:"not null;size:63;default:default;index"`
+	Name                   string `gorm:"not null;size:255"`
+	Prefix                 string `gorm:"not null;size:16;index"`
+	KeyHash                string `gorm:"unique;not null;size:64"`
+	Audience               string `gorm:"not null;size:255;default:''"`
+	AccessTokenTTLSeconds  int64  `gorm:"not null;default:0"`
+	RefreshTokenTTLSeconds int64  `gorm:"not null;default:0"`
+	RevokedAt              *time.Time
+}
+
+type APIKeyPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewAPIKey(name, prefix, keyHash string) *APIKey {
+	return &APIKey{
+		Name:    name,
+		Prefix:  prefix,
+		KeyHash: keyHash,
+	}
+}
+
+func NewAPIKeyPostgresRepository(db *gorm.DB) *APIKeyPostgresRepository {
+	return &APIKeyPostgresRepository{
+		DB: db,
+	}
+}
+
+func (r *APIKeyPostgresRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if err := r.DB.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// FetchByHash returns nil when no unrevoked key has the given hash.
+func (r *APIKeyPostgresRepository) FetchByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	var key APIKey
+	result := r.DB.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", keyHash).First(&key)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch api key: %w", result.Error)
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key := NewAPIKey("name", "prefix", "hash")
+	assert.Equal(t, "name", key.Name)
+	assert.Equal(t, "prefix", key.Prefix)
+	assert.Equal(t, "hash", key.KeyHash)
+}
+
+func TestNewAPIKeyRepository(t *testing.T) {
+	var db *gorm.DB
+	repo := NewAPIKeyPostgresRepository(db)
+	assert.Equal(t, db, repo.DB)
+}
+
+func TestFetchByHash(t *testing.T) {
+	revokedAt := time.Now()
+	tests := []struct {
+		name     string
+		in       string
+		wantName string
+		wantNil  bool
+	}{
+		{
+			name:     "success fetching api key",
+			in:       "hash",
+			wantName: "backend",
+			wantNil:  false,
+		},
+		{
+			name:    "revoked api key",
+			in:      "revoked_hash",
+			wantNil: true,
+		},
+		{
+			name:    "api key not found",
+			in:      "unknown",
+			wantNil: true,
+		},
+	}
+
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &APIKeyPostgresRepository{
+		DB: tx,
+	}
+
+	assert.NoError(t, repo.CreateAPIKey(context.Background(), NewAPIKey("backend", "ak_1", "hash")))
+	revoked := NewAPIKey("revoked", "ak_2", "revoked_hash")
+	revoked.RevokedAt = &revokedAt
+	assert.NoError(t, repo.CreateAPIKey(context.Background(), revoked))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := repo.FetchByHash(context.Background(), test.in)
+			assert.NoError(t, err)
+			if test.wantNil {
+				assert.Nil(t, got)
+			} else {
+				assert.Equal(t, test.wantName, got.Name)
+			}
+		})
+	}
+}
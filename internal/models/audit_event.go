@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"gorm.io/gorm"
+)
+
+// auditChainLockID is the Postgres advisory lock key held while appending an
+// audit event so that concurrent writers extend the hash chain one at a time.
+const auditChainLockID int64 = 7248356191
+
+// Audit event types.
+const (
+	AuditSignup          = "user.signup"
+	AuditSignIn          = "user.signin"
+	AuditTokenRefresh    = "token.refresh"
+	AuditSessionsRevoke  = "sessions.revoke"
+	AuditPasswordReset   = "password.reset"
+	AuditAdminCreate     = "admin.create"
+	AuditAPIKeyCreate    = "api_key.create"
+	AuditUserDisable     = "user.disable"
+	AuditUserEnable      = "user.enable"
+	AuditUserDelete      = "user.delete"
+	AuditUserRestore     = "user.restore"
+	AuditPasswordForce   = "password.force_reset"
+	AuditOrgCreate       = "org.create"
+	AuditOrgSwitch       = "org.switch"
+	AuditMemberRole      = "member.role_change"
+	AuditMemberRemove    = "member.remove"
+	AuditInviteCreate    = "invitation.create"
+	AuditInviteRevoke    = "invitation.revoke"
+	AuditInviteAccept    = "invitation.accept"
+	AuditSCIMTokenCreate = "scim_token.create"
+	AuditSCIMTokenRevoke = "scim_token.revoke"
+	AuditSCIMUserCreate  = "scim.user.create"
+	AuditSCIMUserUpdate  = "scim.user.update"
+	AuditSCIMUserDelete  = "scim.user.delete"
+	AuditSCIMGroupCreate = "scim.group.create"
+	AuditSCIMGroupUpdate = "scim.group.update"
+	AuditSCIMGroupDelete = "scim.group.delete"
+	AuditFederatedSignIn = "user.federated_signin"
+	AuditIdentityLink    = "identity.link"
+	AuditIdentityUnlink  = "identity.unlink"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent is a security relevant action. Events are chained: Hash covers
+// the event and the Hash of the event appended before it, so that editing or
+// removing a row breaks every later link. The chain spans every tenant.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+	TenantID  string    `gorm:"not null;size:63;default:default;index" json:"tenant_id"`
+	Type      string    `gorm:"not null;size:64;index" json:"type"`
+	Outcome   string    `gorm:"not null;size:16" json:"outcome"`
+	Reason    string    `gorm:"not null;size:64;default:''" json:"reason,omitempty"`
+	Actor     string    `gorm:"not null;size:255;default:'';index" json:"actor,omitempty"`
+	Target    string    `gorm:"not null;size:255;default:'';index" json:"target,omitempty"`
+	IP        string    `gorm:"not null;size:64;default:''" json:"ip,omitempty"`
+	UserAgent string    `gorm:"not null;size:512;default:''" json:"user_agent,omitempty"`
+	RequestID string    `gorm:"not null;size:64;default:''" json:"request_id,omitempty"`
+	PrevHash  string    `gorm:"not null;size:64;default:''" json:"prev_hash"`
+	Hash      string    `gorm:"unique;not null;size:64" json:"hash"`
+}
+
+// AuditFilter selects audit events. Cursor is the ID of the last event of the
+// previous page; events are returned newest first unless Ascending is set.
+type AuditFilter struct {
+	Type      string
+	Outcome   string
+	Actor     string
+	Target    string
+	Since     time.Time
+	Until     time.Time
+	Cursor    uint
+	Limit     int
+	Ascending bool
+}
+
+type AuditEventPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewAuditEvent(eventType, outcome string) *AuditEvent {
+	return &AuditEvent{
+		Type:    eventType,
+		Outcome: outcome,
+	}
+}
+
+func NewAuditEventPostgresRepository(db *gorm.DB) *AuditEventPostgresRepository {
+	return &AuditEventPostgresRepository{
+		DB: db,
+	}
+}
+
+// AuditUser, AuditAPIKey and AuditOrganization name the subject of an event
+// in Actor and Target.
+func AuditUser(id uint) string {
+	return "user:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func AuditAPIKey(id uint) string {
+	return "api_key:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func AuditOrganization(id uint) string {
+	return "org:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// Seal links the event to prevHash and computes its hash. CreatedAt is
+// rounded to the precision Postgres stores so that the hash can be verified
+// after a round trip.
+func (e *AuditEvent) Seal(prevHash string) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prevHash
+	e.Hash = e.ComputeHash()
+}
+
+// ComputeHash returns the hex SHA-256 of PrevHash and the recorded fields.
+// TenantID is left out for the default tenant, so that events recorded
+// before audit events had a tenant still verify.
+func (e *AuditEvent) ComputeHash() string {
+	// Fields are encoded in a fixed order, so the encoding is stable
+	fields := []string{
+		e.PrevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Type,
+		e.Outcome,
+		e.Reason,
+		e.Actor,
+		e.Target,
+		e.IP,
+		e.UserAgent,
+		e.RequestID,
+	}
+	if e.TenantID != "" && e.TenantID != tenant.Default {
+		fields = append(fields, e.TenantID)
+	}
+	body, _ := json.Marshal(fields)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAuditEvent seals event onto the end of the chain and stores it in the
+// tenant of ctx.
+func (r *AuditEventPostgresRepository) AppendAuditEvent(ctx context.Context, event *AuditEvent) error {
+	if event.TenantID == "" {
+		event.TenantID = tenant.OfContext(ctx)
+	}
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SQLite runs on a single connection, which already serializes writers
+		if !isSQLite(tx) {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		// Raw SQL is not scoped to the tenant, so the chain stays global
+		var prevHash string
+		if err := tx.Raw("SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prevHash).Error; err != nil {
+			return err
+		}
+
+		event.Seal(prevHash)
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append audit event: %w", err)
+	}
+
+	return nil
+}
+
+func (r *AuditEventPostgresRepository) FetchAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	events := make([]AuditEvent, 0)
+	query := r.DB.WithContext(ctx)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Target != "" {
+		query = query.Where("target = ?", filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	if filter.Ascending {
+		if filter.Cursor > 0 {
+			query = query.Where("id > ?", filter.Cursor)
+		}
+		query = query.Order("id ASC")
+	} else {
+		if filter.Cursor > 0 {
+			query = query.Where("id < ?", filter.Cursor)
+		}
+		query = query.Order("id DESC")
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if err := query.Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+func AuditSCIMToken(id uint) string {
+	return "scim_token:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func AuditIdentity(id uint) string {
+	return "identity:" + strconv.FormatUint(uint64(id), 10)
+}
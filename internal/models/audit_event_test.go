@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewAuditEventRepository(t *testing.T) {
+	var db *gorm.DB
+	repo := NewAuditEventPostgresRepository(db)
+	assert.Equal(t, db, repo.DB)
+}
+
+func TestAuditEventSeal(t *testing.T) {
+	event := NewAuditEvent(AuditSignIn, AuditOutcomeSuccess)
+	event.Actor = AuditUser(1)
+	event.CreatedAt = time.Date(2024, 1, 2, 3, 4, 5, 6789, time.FixedZone("JST", 9*60*60))
+	event.Seal("prev")
+
+	assert.Equal(t, "prev", event.PrevHash)
+	assert.Len(t, event.Hash, 64)
+	assert.Equal(t, time.UTC, event.CreatedAt.Location())
+	assert.Equal(t, 6000, event.CreatedAt.Nanosecond())
+	assert.Equal(t, event.Hash, event.ComputeHash())
+
+	tampered := *event
+	tampered.Outcome = AuditOutcomeFailure
+	assert.NotEqual(t, event.Hash, tampered.ComputeHash())
+
+	relinked := *event
+	relinked.PrevHash = "other"
+	assert.NotEqual(t, event.Hash, relinked.ComputeHash())
+}
+
+func TestAppendAuditEvent(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &AuditEventPostgresRepository{
+		DB: tx,
+	}
+
+	ctx := context.Background()
+	first := NewAuditEvent(AuditSignup, AuditOutcomeSuccess)
+	first.Actor = AuditUser(1)
+	first.Target = AuditUser(1)
+	assert.NoError(t, repo.AppendAuditEvent(ctx, first))
+
+	second := NewAuditEvent(AuditSignIn, AuditOutcomeFailure)
+	second.Reason = "invalid_credentials"
+	assert.NoError(t, repo.AppendAuditEvent(ctx, second))
+	assert.Equal(t, first.Hash, second.PrevHash)
+
+	events, err := repo.FetchAuditEvents(ctx, AuditFilter{Ascending: true})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, first.Hash, events[0].ComputeHash())
+		assert.Equal(t, second.Hash, events[1].ComputeHash())
+	}
+
+	// Rows cannot be changed once written
+	err = tx.Exec("SAVEPOINT tamper").Error
+	assert.NoError(t, err)
+	assert.Error(t, tx.Model(&AuditEvent{}).Where("id = ?", first.ID).Update("outcome", AuditOutcomeFailure).Error)
+	assert.NoError(t, tx.Exec("ROLLBACK TO SAVEPOINT tamper").Error)
+}
+
+func TestFetchAuditEvents(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &AuditEventPostgresRepository{
+		DB: tx,
+	}
+
+	ctx := context.Background()
+	for _, outcome := range []string{AuditOutcomeSuccess, AuditOutcomeFailure, AuditOutcomeSuccess} {
+		event := NewAuditEvent(AuditSignIn, outcome)
+		event.Actor = AuditUser(1)
+		assert.NoError(t, repo.AppendAuditEvent(ctx, event))
+	}
+
+	tests := []struct {
+		name      string
+		in        AuditFilter
+		wantCount int
+	}{
+		{
+			name:      "all events",
+			in:        AuditFilter{},
+			wantCount: 3,
+		},
+		{
+			name:      "filtered by outcome",
+			in:        AuditFilter{Outcome: AuditOutcomeSuccess},
+			wantCount: 2,
+		},
+		{
+			name:      "limited",
+			in:        AuditFilter{Limit: 1},
+			wantCount: 1,
+		},
+		{
+			name:      "unknown actor",
+			in:        AuditFilter{Actor: AuditUser(2)},
+			wantCount: 0,
+		},
+		{
+			name:      "in the future",
+			in:        AuditFilter{Since: time.Now().Add(time.Hour)},
+			wantCount: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := repo.FetchAuditEvents(ctx, test.in)
+			assert.NoError(t, err)
+			assert.Len(t, events, test.wantCount)
+		})
+	}
+
+	newest, err := repo.FetchAuditEvents(ctx, AuditFilter{Limit: 2})
+	assert.NoError(t, err)
+	older, err := repo.FetchAuditEvents(ctx, AuditFilter{Cursor: newest[1].ID})
+	assert.NoError(t, err)
+	if assert.Len(t, older, 1) {
+		assert.Less(t, older[0].ID, newest[1].ID)
+	}
+}
@@ -0,0 +1,18 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/models/modeltest"
+)
+
+func TestPostgresConformance(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) modeltest.Repositories {
+		// transaction
+		tx := models.SharedTestDB().Begin()
+		t.Cleanup(func() { tx.Rollback() })
+
+		return modeltest.GormRepositories(tx)
+	})
+}
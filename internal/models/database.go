@@ -2,10 +2,14 @@ package models
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/tracing"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -18,43 +22,99 @@ type dbConfig struct {
 	SSLMode    string
 }
 
-func SetupDB() (*gorm.DB, error) {
+func SetupDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	// Connect database
-	db, err := ConnectDB()
+	db, err := ConnectDB(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database: %w", err)
 	}
 
-	log.Println("Successfully connected to database")
+	slog.Info("connected to database", "driver", cfg.Driver, "host", cfg.Host, "name", cfg.Name)
 
-	// Migrate database
-	if err := migrate(db); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
-	}
+	// Migrations normally run through the migrate subcommand
+	if cfg.MigrateOnStart {
+		if err := MigrateUp(db); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
 
-	log.Println("Successfully migrated database")
+		slog.Info("migrated database")
+	}
 
 	return db, nil
 }
 
-func ConnectDB() (*gorm.DB, error) {
-	dbConfig := newDBConfig()
-	dsn := dbConfig.createDSN()
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func ConnectDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(openDialector(cfg), &gorm.Config{
+		TranslateError: true,
+		Logger:         logging.NewGormLogger(cfg.SlowQueryThreshold),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database: %w", err)
 	}
+
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to register tracing plugin: %w", err)
+	}
+
+	if err := db.Use(TenantPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to register tenant plugin: %w", err)
+	}
+
+	if err := db.Use(QueryTimeoutPlugin{Timeout: cfg.QueryTimeout}); err != nil {
+		return nil, fmt.Errorf("failed to register query timeout plugin: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database pool: %w", err)
+	}
+
+	if isSQLite(db) {
+		// One connection serializes writers, which SQLite needs anyway, and
+		// keeps an in-memory database alive for as long as the pool.
+		sqlDB.SetMaxOpenConns(1)
+		return db, nil
+	}
+
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
 	return db, nil
 }
 
-func newDBConfig() *dbConfig {
+func openDialector(cfg config.DatabaseConfig) gorm.Dialector {
+	if cfg.Driver == "sqlite" {
+		// Enforce foreign keys and make LIKE case-sensitive as in Postgres
+		return sqlite.Open(cfg.Path + "?_foreign_keys=on&_cslike=on")
+	}
+
+	return postgres.Open(newDBConfig(cfg).createDSN())
+}
+
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// CloseDB closes the connection pool once the server has stopped.
+func CloseDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database pool: %w", err)
+	}
+
+	return sqlDB.Close()
+}
+
+func newDBConfig(cfg config.DatabaseConfig) *dbConfig {
 	return &dbConfig{
-		Host:       os.Getenv("DB_HOST"),
-		Port:       os.Getenv("DB_PORT"),
-		DBUser:     os.Getenv("DB_USER"),
-		DBName:     os.Getenv("DB_NAME"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		SSLMode:    os.Getenv("DB_SSL_MODE"),
+		Host:       cfg.Host,
+		Port:       cfg.Port,
+		DBUser:     cfg.User,
+		DBName:     cfg.Name,
+		DBPassword: cfg.Password,
+		SSLMode:    cfg.SSLMode,
 	}
 }
 
@@ -64,10 +124,3 @@ func (dbConfig *dbConfig) createDSN() string {
 		dbConfig.Host, dbConfig.Port, dbConfig.DBUser, dbConfig.DBName, dbConfig.DBPassword, dbConfig.SSLMode,
 	)
 }
-
-func migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&User{},
-		&RefreshToken{},
-	)
-}
@@ -3,6 +3,8 @@ package models
 import (
 	"testing"
 
+	"github.com/soicchi/auth_api/internal/config"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +20,23 @@ func TestCreateDSN(t *testing.T) {
 	dsn := dbConfig.createDSN()
 	assert.Equal(t, "host=host port=port user=user dbname=database password=password sslmode=disable", dsn)
 }
+
+func TestNewDBConfig(t *testing.T) {
+	cfg := config.DatabaseConfig{
+		Host:     "host",
+		Port:     "port",
+		User:     "user",
+		Name:     "database",
+		Password: "password",
+		SSLMode:  "disable",
+	}
+	got := newDBConfig(cfg)
+	assert.Equal(t, &dbConfig{
+		Host:       "host",
+		Port:       "port",
+		DBUser:     "user",
+		DBName:     "database",
+		DBPassword: "password",
+		SSLMode:    "disable",
+	}, got)
+}
@@ -0,0 +1,8 @@
+package models
+
+import "gorm.io/gorm"
+
+// SharedTestDB exposes the test database to the external test package.
+func SharedTestDB() *gorm.DB {
+	return testDB
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type HealthPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewHealthPostgresRepository(db *gorm.DB) *HealthPostgresRepository {
+	return &HealthPostgresRepository{
+		DB: db,
+	}
+}
+
+func (r *HealthPostgresRepository) Ping(ctx context.Context) error {
+	sqlDB, err := r.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database pool: %w", err)
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return nil
+}
+
+// MigrationStatus reads the schema version for readiness probes. Unlike
+// GetMigrationStatus it only reads, and leaves Pending empty.
+func (r *HealthPostgresRepository) MigrationStatus(ctx context.Context) (MigrationStatus, error) {
+	var status MigrationStatus
+	latest, err := latestMigration()
+	if err != nil {
+		return status, err
+	}
+
+	var current sql.NullInt64
+	if err := r.DB.WithContext(ctx).Raw("SELECT MAX(version) FROM schema_migrations").Row().Scan(&current); err != nil {
+		return status, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	status.Current = int(current.Int64)
+	status.Latest = latest
+	return status, nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewHealthPostgresRepository(t *testing.T) {
+	var db *gorm.DB
+	repo := NewHealthPostgresRepository(db)
+	assert.Equal(t, db, repo.DB)
+}
+
+func TestHealthPing(t *testing.T) {
+	repo := NewHealthPostgresRepository(testDB)
+	assert.NoError(t, repo.Ping(context.Background()))
+}
+
+func TestHealthMigrationStatus(t *testing.T) {
+	repo := NewHealthPostgresRepository(testDB)
+
+	status, err := repo.MigrationStatus(context.Background())
+	assert.NoError(t, err)
+	assert.NotZero(t, status.Latest)
+	assert.Equal(t, status.Latest, status.Current)
+}
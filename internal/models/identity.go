@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrDuplicateIdentity = errors.New("identity already exists")
+
+// Identity links a user to an account at an external identity provider. The
+// account is named by the issuer of the provider and the subject it gave the
+// account, which unlike the email never changes.
+type Identity struct {
+	gorm.Model
+	TenantID string `gorm:"not null;size:63;default:default;uniqueIndex:idx_identities_tenant_issuer_subject,priority:1"`
+	UserID   uint   `gorm:"not null;index"`
+	// Provider is the configured name of the provider, such as google.
+	Provider string `gorm:"not null;size:64"`
+	Issuer   string `gorm:"not null;size:255;uniqueIndex:idx_identities_tenant_issuer_subject,priority:2"`
+	Subject  string `gorm:"not null;size:255;uniqueIndex:idx_identities_tenant_issuer_subject,priority:3"`
+	// Email is the email the provider last reported for the account.
+	Email         string `gorm:"not null;size:255;default:''"`
+	EmailVerified bool   `gorm:"not null;default:false"`
+	User          User   `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type IdentityPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewIdentity(userID uint, provider, issuer, subject string) *Identity {
+	return &Identity{
+		UserID:   userID,
+		Provider: provider,
+		Issuer:   issuer,
+		Subject:  subject,
+	}
+}
+
+func NewIdentityPostgresRepository(db *gorm.DB) *IdentityPostgresRepository {
+	return &IdentityPostgresRepository{
+		DB: db,
+	}
+}
+
+// CreateIdentity stores the identity. It returns ErrDuplicateIdentity when
+// the account is already linked to a user.
+func (r *IdentityPostgresRepository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	err := r.DB.WithContext(ctx).Omit("User").Create(identity).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateIdentity
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// FetchIdentity returns nil when no user is linked to the account.
+func (r *IdentityPostgresRepository) FetchIdentity(ctx context.Context, issuer, subject string) (*Identity, error) {
+	var identity Identity
+	result := r.DB.WithContext(ctx).Where("issuer = ? AND subject = ?", issuer, subject).First(&identity)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch identity: %w", result.Error)
+	}
+
+	return &identity, nil
+}
+
+// UpdateIdentityEmail records the email the provider reported at sign-in.
+func (r *IdentityPostgresRepository) UpdateIdentityEmail(ctx context.Context, identityID uint, email string, verified bool) error {
+	result := r.DB.WithContext(ctx).Model(&Identity{}).Where("id = ?", identityID).
+		Updates(map[string]interface{}{"email": email, "email_verified": verified})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update identity: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to update identity: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// FetchIdentities returns the identities linked to the user, oldest first.
+func (r *IdentityPostgresRepository) FetchIdentities(ctx context.Context, userID uint) ([]Identity, error) {
+	var identities []Identity
+	result := r.DB.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&identities)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch identities: %w", result.Error)
+	}
+
+	return identities, nil
+}
+
+// DeleteIdentity unlinks the identity from the user. The row is removed for
+// good so that the account can be linked again.
+func (r *IdentityPostgresRepository) DeleteIdentity(ctx context.Context, userID, identityID uint) error {
+	result := r.DB.WithContext(ctx).Unscoped().Where("id = ? AND user_id = ?", identityID, userID).Delete(&Identity{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete identity: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
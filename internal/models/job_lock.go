@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// jobLockClass keys the advisory locks of background jobs, which are taken
+// with the hash of the job name as the second key.
+const jobLockClass int32 = 724835
+
+type JobLockPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewJobLockPostgresRepository(db *gorm.DB) *JobLockPostgresRepository {
+	return &JobLockPostgresRepository{
+		DB: db,
+	}
+}
+
+// TryWithLock runs fn while holding the advisory lock of the job and reports
+// whether it ran: when another replica holds the lock fn is skipped. A SQLite
+// database belongs to one process, so there fn always runs.
+func (r *JobLockPostgresRepository) TryWithLock(ctx context.Context, job string, fn func() error) (bool, error) {
+	if isSQLite(r.DB) {
+		return true, fn()
+	}
+
+	ran := false
+	// Advisory locks belong to a session, so pin a single connection.
+	err := r.DB.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?, hashtext(?))", jobLockClass, job).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("failed to acquire job lock: %w", err)
+		}
+
+		if !locked {
+			return nil
+		}
+
+		// The connection goes back to the pool holding the lock unless it is
+		// released, even after ctx is done.
+		defer conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?, hashtext(?))", jobLockClass, job)
+
+		ran = true
+		return fn()
+	})
+
+	return ran, err
+}
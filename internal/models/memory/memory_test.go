@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/models/modeltest"
+	"github.com/soicchi/auth_api/internal/usecase"
+
+	"gorm.io/gorm"
+)
+
+func TestConformance(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) modeltest.Repositories {
+		store := NewStore()
+		return modeltest.Repositories{
+			Users:  NewUserRepository(store),
+			Tokens: NewRefreshTokenRepository(store),
+			SoftDeleteUser: func(ctx context.Context, userID uint) error {
+				store.mu.Lock()
+				defer store.mu.Unlock()
+
+				user := store.users[userID]
+				user.DeletedAt = gorm.DeletedAt{Time: store.now(), Valid: true}
+				store.users[userID] = user
+				return nil
+			},
+			Tx: NewTxManager(store, func(store *Store) usecase.TxRepositories {
+				return usecase.TxRepositories{
+					Users:  NewUserRepository(store),
+					Tokens: NewRefreshTokenRepository(store),
+				}
+			}),
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository struct {
+	store *Store
+}
+
+func NewRefreshTokenRepository(store *Store) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		store: store,
+	}
+}
+
+func (r *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The foreign key of Postgres
+	if _, ok := s.users[token.UserID]; !ok {
+		return fmt.Errorf("failed to create refresh token: %w", gorm.ErrForeignKeyViolated)
+	}
+
+	if err := assignTenant(ctx, &token.TenantID); err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	now := s.now()
+	s.nextTokenID++
+	token.ID = s.nextTokenID
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	s.tokens[token.ID] = *token
+	return nil
+}
+
+// FetchByToken returns the zero RefreshToken when the token is unknown.
+func (r *RefreshTokenRepository) FetchByToken(ctx context.Context, token string) (models.RefreshToken, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Postgres returns the first match by primary key
+	var found models.RefreshToken
+	for _, refreshToken := range s.tokens {
+		if refreshToken.Token == token && inTenant(ctx, refreshToken.TenantID) && (found.ID == 0 || refreshToken.ID < found.ID) {
+			found = refreshToken
+		}
+	}
+
+	return found, nil
+}
+
+func (r *RefreshTokenRepository) DeleteByUserID(ctx context.Context, userID uint) (int64, error) {
+	return r.deleteWhere(func(token models.RefreshToken) bool {
+		return token.UserID == userID && inTenant(ctx, token.TenantID)
+	}), nil
+}
+
+func (r *RefreshTokenRepository) DeleteByOrganization(ctx context.Context, userID, orgID uint) (int64, error) {
+	return r.deleteWhere(func(token models.RefreshToken) bool {
+		return token.UserID == userID && token.OrganizationID == orgID && inTenant(ctx, token.TenantID)
+	}), nil
+}
+
+func (r *RefreshTokenRepository) FetchExpired(ctx context.Context, before time.Time) ([]models.RefreshToken, error) {
+	s := r.store
+	s.mu.Lock()
+	tokens := make([]models.RefreshToken, 0)
+	for _, token := range s.tokens {
+		if token.ExpiredAt.Before(before) && inTenant(ctx, token.TenantID) {
+			tokens = append(tokens, token)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(tokens, compareExpiry)
+	return tokens, nil
+}
+
+// DeleteExpired removes at most limit tokens that expired before the given
+// time, oldest first.
+func (r *RefreshTokenRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := make([]models.RefreshToken, 0)
+	for _, token := range s.tokens {
+		if token.ExpiredAt.Before(before) && inTenant(ctx, token.TenantID) {
+			expired = append(expired, token)
+		}
+	}
+
+	slices.SortFunc(expired, compareExpiry)
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	for _, token := range expired {
+		delete(s.tokens, token.ID)
+	}
+
+	return int64(len(expired)), nil
+}
+
+func compareExpiry(a, b models.RefreshToken) int {
+	if c := a.ExpiredAt.Compare(b.ExpiredAt); c != 0 {
+		return c
+	}
+	return compareIDs(a.ID, b.ID)
+}
+
+func (r *RefreshTokenRepository) deleteWhere(match func(token models.RefreshToken) bool) int64 {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, token := range s.tokens {
+		if match(token) {
+			delete(s.tokens, id)
+			deleted++
+		}
+	}
+
+	return deleted
+}
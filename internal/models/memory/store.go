@@ -0,0 +1,78 @@
+// Package memory implements the user and refresh token repositories in
+// memory for tests and local development. They follow the Postgres
+// repositories: the same uniqueness rules, tenant scoping, not-found errors
+// and ordering.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tenant"
+)
+
+// Store holds the rows of the in-memory repositories. Repositories created
+// from the same store see each other's rows like tables of one database,
+// so deleting a user also deletes its refresh tokens.
+type Store struct {
+	// txMu runs transactions one at a time
+	txMu        sync.Mutex
+	mu          sync.Mutex
+	users       map[uint]models.User
+	tokens      map[uint]models.RefreshToken
+	nextUserID  uint
+	nextTokenID uint
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:  make(map[uint]models.User),
+		tokens: make(map[uint]models.RefreshToken),
+		now:    time.Now,
+	}
+}
+
+// inTenant reports whether ctx sees rows of the given tenant, as the tenant
+// plugin of the Postgres repositories decides.
+func inTenant(ctx context.Context, rowTenant string) bool {
+	id, ok := tenant.FromContext(ctx)
+	return !ok || id == rowTenant
+}
+
+// assignTenant sets the tenant of a row created with ctx.
+func assignTenant(ctx context.Context, rowTenant *string) error {
+	id := tenant.OfContext(ctx)
+	if *rowTenant != "" && *rowTenant != id {
+		return fmt.Errorf("cannot create a row of tenant %s in tenant %s", *rowTenant, id)
+	}
+
+	*rowTenant = id
+	return nil
+}
+
+// deleteUser removes the user and its refresh tokens. The caller holds s.mu.
+func (s *Store) deleteUser(userID uint) {
+	delete(s.users, userID)
+	for id, token := range s.tokens {
+		if token.UserID == userID {
+			delete(s.tokens, id)
+		}
+	}
+}
+
+// copyUser returns user without storage shared with the stored row.
+func copyUser(user models.User) models.User {
+	if user.DisabledAt != nil {
+		disabledAt := *user.DisabledAt
+		user.DisabledAt = &disabledAt
+	}
+
+	// The association is not loaded by the Postgres repository either
+	user.RefreshToken = models.RefreshToken{}
+	return user
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"maps"
+)
+
+// TxManager runs functions in memory transactions over a store. Bind builds
+// the repositories a function gets; they write to the store directly and
+// the rows are put back when the function fails.
+type TxManager[R any] struct {
+	store *Store
+	bind  func(store *Store) R
+}
+
+func NewTxManager[R any](store *Store, bind func(store *Store) R) *TxManager[R] {
+	return &TxManager[R]{
+		store: store,
+		bind:  bind,
+	}
+}
+
+// WithinTx commits when fn returns nil and rolls back otherwise, returning
+// the error of fn as is. Transactions of a store run one at a time, but
+// repository calls outside of one are not isolated from them. As with
+// Postgres sequences, IDs taken by a rolled back transaction are not reused.
+func (m *TxManager[R]) WithinTx(ctx context.Context, fn func(repos R) error) error {
+	s := m.store
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	// Rows are stored by value, so copying the maps keeps them
+	s.mu.Lock()
+	users := maps.Clone(s.users)
+	tokens := maps.Clone(s.tokens)
+	s.mu.Unlock()
+
+	if err := fn(m.bind(s)); err != nil {
+		s.mu.Lock()
+		s.users = users
+		s.tokens = tokens
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
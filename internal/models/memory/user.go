@@ -0,0 +1,347 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{
+		store: store,
+	}
+}
+
+// CreateUser stores the user and its refresh token, if it has one.
+func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) (uint, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := assignTenant(ctx, &user.TenantID); err != nil {
+		return user.ID, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	for _, existing := range s.users {
+		if existing.Email == user.Email && existing.TenantID == user.TenantID {
+			return user.ID, models.ErrDuplicateEmail
+		}
+	}
+
+	// Timestamps set by the caller are kept, as gorm does
+	now := s.now()
+	s.nextUserID++
+	user.ID = s.nextUserID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	if user.RefreshToken.Token != "" {
+		s.nextTokenID++
+		user.RefreshToken.ID = s.nextTokenID
+		user.RefreshToken.UserID = user.ID
+		user.RefreshToken.TenantID = user.TenantID
+		user.RefreshToken.CreatedAt = now
+		user.RefreshToken.UpdatedAt = now
+		s.tokens[user.RefreshToken.ID] = user.RefreshToken
+	}
+
+	s.users[user.ID] = copyUser(*user)
+	return user.ID, nil
+}
+
+func (r *UserRepository) FetchUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email && !user.DeletedAt.Valid && inTenant(ctx, user.TenantID) {
+			user = copyUser(user)
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *UserRepository) FetchUserByID(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := r.FetchAnyUserByID(ctx, userID)
+	if user == nil || user.DeletedAt.Valid {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FetchAnyUserByID is FetchUserByID including soft-deleted users.
+func (r *UserRepository) FetchAnyUserByID(ctx context.Context, userID uint) (*models.User, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || !inTenant(ctx, user.TenantID) {
+		return nil, nil
+	}
+
+	user = copyUser(user)
+	return &user, nil
+}
+
+// FetchUsers returns a page of users ordered by filter.Sort and then by ID.
+func (r *UserRepository) FetchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	if filter.Sort == "" {
+		filter.Sort = models.UserSortCreatedAsc
+	}
+
+	column := strings.TrimPrefix(filter.Sort, "-")
+	if column != models.UserSortCreatedAsc && column != models.UserSortEmailAsc {
+		return nil, fmt.Errorf("failed to fetch users: unknown sort %q", filter.Sort)
+	}
+	descending := strings.HasPrefix(filter.Sort, "-")
+
+	// compare orders a before b by the sort column and then by ID
+	compare := func(a, b models.User) int {
+		c := a.CreatedAt.Compare(b.CreatedAt)
+		if column == models.UserSortEmailAsc {
+			c = strings.Compare(a.Email, b.Email)
+		}
+		if c == 0 {
+			c = compareIDs(a.ID, b.ID)
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}
+
+	var after *models.User
+	if filter.Cursor != "" {
+		cursor, err := models.ParseUserCursor(filter.Sort, filter.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch users: %w", err)
+		}
+		after = &cursor
+	}
+
+	s := r.store
+	s.mu.Lock()
+	users := make([]models.User, 0)
+	for _, user := range s.users {
+		if !inTenant(ctx, user.TenantID) || !matchesUserFilter(user, filter) || (after != nil && compare(user, *after) <= 0) {
+			continue
+		}
+		users = append(users, copyUser(user))
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(users, compare)
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+
+	return users, nil
+}
+
+func matchesUserFilter(user models.User, filter models.UserFilter) bool {
+	switch filter.State {
+	case models.UserStateDeleted:
+		if !user.DeletedAt.Valid {
+			return false
+		}
+	case models.UserStateAll:
+	default:
+		if user.DeletedAt.Valid {
+			return false
+		}
+	}
+
+	if !strings.HasPrefix(user.Email, filter.EmailPrefix) {
+		return false
+	}
+	if !filter.CreatedSince.IsZero() && user.CreatedAt.Before(filter.CreatedSince) {
+		return false
+	}
+	if !filter.CreatedUntil.IsZero() && !user.CreatedAt.Before(filter.CreatedUntil) {
+		return false
+	}
+
+	return true
+}
+
+func compareIDs(a, b uint) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// UpdatePassword also clears a required password reset.
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID uint, hashedPassword string) error {
+	err := r.update(ctx, userID, func(user *models.User) {
+		user.Password = hashedPassword
+		user.PasswordResetRequired = false
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+// SetDisabledAt disables the user at disabledAt, or enables it when
+// disabledAt is nil.
+func (r *UserRepository) SetDisabledAt(ctx context.Context, userID uint, disabledAt *time.Time) error {
+	err := r.update(ctx, userID, func(user *models.User) {
+		user.DisabledAt = nil
+		if disabledAt != nil {
+			t := *disabledAt
+			user.DisabledAt = &t
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user state: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) RequirePasswordReset(ctx context.Context, userID uint) error {
+	err := r.update(ctx, userID, func(user *models.User) {
+		user.PasswordResetRequired = true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateUser saves the email, external ID, role and disabled state of the
+// user and sets its UpdatedAt.
+func (r *UserRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[user.ID]
+	if !ok || stored.DeletedAt.Valid || !inTenant(ctx, stored.TenantID) {
+		return fmt.Errorf("failed to update user: %w", gorm.ErrRecordNotFound)
+	}
+
+	for _, existing := range s.users {
+		if existing.ID != user.ID && existing.Email == user.Email && existing.TenantID == stored.TenantID {
+			return models.ErrDuplicateEmail
+		}
+	}
+
+	updated := copyUser(*user)
+	stored.Email = updated.Email
+	stored.ExternalID = updated.ExternalID
+	stored.Role = updated.Role
+	stored.DisabledAt = updated.DisabledAt
+	stored.UpdatedAt = s.now()
+	s.users[user.ID] = stored
+	user.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// update applies fn to the user unless it does not exist or is soft-deleted.
+func (r *UserRepository) update(ctx context.Context, userID uint, fn func(user *models.User)) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.TenantID) {
+		return gorm.ErrRecordNotFound
+	}
+
+	fn(&user)
+	user.UpdatedAt = s.now()
+	s.users[userID] = user
+	return nil
+}
+
+// DeleteUser removes the user for good, soft-deleted or not. Refresh tokens
+// go with it.
+func (r *UserRepository) DeleteUser(ctx context.Context, userID uint) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userID]; !ok || !inTenant(ctx, user.TenantID) {
+		return fmt.Errorf("failed to delete user: %w", gorm.ErrRecordNotFound)
+	}
+
+	s.deleteUser(userID)
+	return nil
+}
+
+// PurgeDeletedUsers removes at most limit users soft-deleted before
+// deletedBefore, oldest first. Refresh tokens go with them.
+func (r *UserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := make([]models.User, 0)
+	for _, user := range s.users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(deletedBefore) && inTenant(ctx, user.TenantID) {
+			deleted = append(deleted, user)
+		}
+	}
+
+	slices.SortFunc(deleted, func(a, b models.User) int {
+		if c := a.DeletedAt.Time.Compare(b.DeletedAt.Time); c != 0 {
+			return c
+		}
+		return compareIDs(a.ID, b.ID)
+	})
+	if len(deleted) > limit {
+		deleted = deleted[:limit]
+	}
+
+	for _, user := range deleted {
+		s.deleteUser(user.ID)
+	}
+
+	return int64(len(deleted)), nil
+}
+
+// RestoreUser undoes the soft deletion of the user.
+func (r *UserRepository) RestoreUser(ctx context.Context, userID uint) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || !user.DeletedAt.Valid || !inTenant(ctx, user.TenantID) {
+		return fmt.Errorf("failed to restore user: %w", gorm.ErrRecordNotFound)
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	s.users[userID] = user
+	return nil
+}
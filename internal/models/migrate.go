@@ -0,0 +1,329 @@
+package models
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockID is the Postgres advisory lock key held while migrating so
+// that replicas starting together do not apply the same migration twice.
+const migrationLockID int64 = 7248356190
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+type MigrationStatus struct {
+	Current int
+	Latest  int
+	Pending []Migration
+}
+
+// LoadMigrations reads the embedded NNNNNN_name.(up|down).sql files ordered by
+// version.
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		version, name, direction, err := parseMigrationFilename(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := migrationFS.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %06d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func parseMigrationFilename(filename string) (int, string, string, error) {
+	base := strings.TrimSuffix(filename, ".sql")
+	direction := path.Ext(base)
+	if direction != ".up" && direction != ".down" {
+		return 0, "", "", fmt.Errorf("invalid migration filename %s", filename)
+	}
+	base = strings.TrimSuffix(base, direction)
+
+	versionPart, name, ok := strings.Cut(base, "_")
+	if !ok {
+		return 0, "", "", fmt.Errorf("invalid migration filename %s", filename)
+	}
+
+	version, err := strconv.Atoi(versionPart)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("invalid migration version in %s: %w", filename, err)
+	}
+
+	return version, name, strings.TrimPrefix(direction, "."), nil
+}
+
+// MigrateUp applies every pending migration. The SQL migrations are written
+// for Postgres, so SQLite databases get their schema from the models instead.
+func MigrateUp(db *gorm.DB) error {
+	db = withoutQueryTimeout(db)
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+
+	if isSQLite(db) {
+		return autoMigrateSQLite(db, migrations)
+	}
+
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(m.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %06d_%s: %w", m.Version, m.Name, err)
+			}
+
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back the given number of applied migrations, newest first.
+func MigrateDown(db *gorm.DB, steps int) error {
+	if isSQLite(db) {
+		return fmt.Errorf("rolling back migrations is not supported on sqlite")
+	}
+	db = withoutQueryTimeout(db)
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if !applied[m.Version] {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(m.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, "version = ?", m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("failed to roll back migration %06d_%s: %w", m.Version, m.Name, err)
+			}
+
+			slog.Info("rolled back migration", "version", m.Version, "name", m.Name)
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// latestMigration reads the embedded migrations once for their newest version.
+var latestMigration = sync.OnceValues(func() (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+})
+
+// GetMigrationStatus reports the newest applied version and what is pending.
+func GetMigrationStatus(db *gorm.DB) (MigrationStatus, error) {
+	var status MigrationStatus
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return status, err
+	}
+
+	if err := ensureSchemaMigrations(db); err != nil {
+		return status, err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return status, err
+	}
+
+	for _, m := range migrations {
+		status.Latest = m.Version
+		if applied[m.Version] {
+			status.Current = m.Version
+		} else {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+
+	return status, nil
+}
+
+// autoMigrateSQLite creates the tables from the models and records every
+// migration as applied so that the migration status reads as up to date.
+// Postgres-only features such as the append-only audit trigger are left out.
+func autoMigrateSQLite(db *gorm.DB, migrations []Migration) error {
+	err := db.AutoMigrate(
+		&User{},
+		&RefreshToken{},
+		&SigningKey{},
+		&APIKey{},
+		&AuditEvent{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&Organization{},
+		&Membership{},
+		&Invitation{},
+		&SCIMToken{},
+		&Identity{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to migrate sqlite database: %w", err)
+	}
+
+	if err := ensureSchemaMigrations(db); err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		if err := db.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error; err != nil {
+			return fmt.Errorf("failed to record migration %06d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	// Advisory locks belong to a session, so pin a single connection.
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+
+		if err := ensureSchemaMigrations(conn); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+func ensureSchemaMigrations(db *gorm.DB) error {
+	// SQLite drivers only scan timestamps from columns they recognize
+	if isSQLite(db) {
+		if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("failed to create schema_migrations table: %w", err)
+		}
+		return nil
+	}
+
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`).Error
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func appliedVersions(db *gorm.DB) (map[int]bool, error) {
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch applied migrations: %w", err)
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestParseMigrationFilename(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		wantVersion   int
+		wantName      string
+		wantDirection string
+		wantErr       bool
+	}{
+		{
+			name:          "up migration",
+			in:            "000001_create_users.up.sql",
+			wantVersion:   1,
+			wantName:      "create_users",
+			wantDirection: "up",
+			wantErr:       false,
+		},
+		{
+			name:          "down migration",
+			in:            "000012_add_index.down.sql",
+			wantVersion:   12,
+			wantName:      "add_index",
+			wantDirection: "down",
+			wantErr:       false,
+		},
+		{
+			name:    "missing direction",
+			in:      "000001_create_users.sql",
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			in:      "first_create_users.up.sql",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, name, direction, err := parseMigrationFilename(test.in)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.wantVersion, version)
+				assert.Equal(t, test.wantName, name)
+				assert.Equal(t, test.wantDirection, direction)
+			}
+		})
+	}
+}
+
+func TestGetMigrationStatus(t *testing.T) {
+	migrations, err := LoadMigrations()
+	assert.NoError(t, err)
+
+	status, err := GetMigrationStatus(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, migrations[len(migrations)-1].Version, status.Current)
+	assert.Equal(t, status.Latest, status.Current)
+	assert.Empty(t, status.Pending)
+}
+
+func TestMigrateUpIsIdempotent(t *testing.T) {
+	assert.NoError(t, MigrateUp(testDB))
+}
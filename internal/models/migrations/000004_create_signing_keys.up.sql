@@ -0,0 +1,14 @@
+CREATE TABLE signing_keys (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    kid        VARCHAR(64) NOT NULL UNIQUE,
+    secret     TEXT NOT NULL,
+    active     BOOLEAN NOT NULL DEFAULT FALSE,
+    retired_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_signing_keys_deleted_at ON signing_keys (deleted_at);
+-- At most one key signs new tokens at a time.
+CREATE UNIQUE INDEX idx_signing_keys_active ON signing_keys (active) WHERE active;
@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       VARCHAR(255) NOT NULL,
+    prefix     VARCHAR(16) NOT NULL,
+    key_hash   VARCHAR(64) NOT NULL UNIQUE,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at);
+CREATE INDEX idx_api_keys_prefix ON api_keys (prefix);
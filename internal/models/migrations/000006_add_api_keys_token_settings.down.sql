@@ -0,0 +1,4 @@
+ALTER TABLE api_keys
+    DROP COLUMN IF EXISTS audience,
+    DROP COLUMN IF EXISTS access_token_ttl_seconds,
+    DROP COLUMN IF EXISTS refresh_token_ttl_seconds;
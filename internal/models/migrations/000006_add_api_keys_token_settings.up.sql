@@ -0,0 +1,4 @@
+ALTER TABLE api_keys
+    ADD COLUMN audience VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN access_token_ttl_seconds BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN refresh_token_ttl_seconds BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,30 @@
+CREATE TABLE audit_events (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    type       VARCHAR(64) NOT NULL,
+    outcome    VARCHAR(16) NOT NULL,
+    reason     VARCHAR(64) NOT NULL DEFAULT '',
+    actor      VARCHAR(255) NOT NULL DEFAULT '',
+    target     VARCHAR(255) NOT NULL DEFAULT '',
+    ip         VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    prev_hash  VARCHAR(64) NOT NULL DEFAULT '',
+    hash       VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX idx_audit_events_type ON audit_events (type);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor);
+CREATE INDEX idx_audit_events_target ON audit_events (target);
+
+-- Audit events are append-only; rows can neither be changed nor removed.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_email_pattern;
+DROP INDEX IF EXISTS idx_users_created_at_id;
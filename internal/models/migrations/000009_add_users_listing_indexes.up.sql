@@ -0,0 +1,5 @@
+-- Keyset pagination orders by (created_at, id) or (email, id).
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id);
+
+-- The unique index on email cannot serve LIKE 'prefix%' under a non-C collation.
+CREATE INDEX IF NOT EXISTS idx_users_email_pattern ON users (email varchar_pattern_ops);
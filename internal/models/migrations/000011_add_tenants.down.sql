@@ -0,0 +1,9 @@
+-- Fails while an email is registered in more than one tenant.
+DROP INDEX IF EXISTS idx_api_keys_tenant_id;
+DROP INDEX IF EXISTS idx_refresh_tokens_tenant_id;
+DROP INDEX IF EXISTS idx_users_tenant_email;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,46 @@
+CREATE TABLE organizations (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    tenant_id  VARCHAR(63) NOT NULL DEFAULT 'default',
+    name       VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX idx_organizations_deleted_at ON organizations (deleted_at);
+CREATE INDEX idx_organizations_tenant_id ON organizations (tenant_id);
+
+CREATE TABLE memberships (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    tenant_id       VARCHAR(63) NOT NULL DEFAULT 'default',
+    organization_id BIGINT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id         BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role            VARCHAR(16) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_memberships_org_user ON memberships (organization_id, user_id);
+CREATE INDEX idx_memberships_user_id ON memberships (user_id);
+CREATE INDEX idx_memberships_tenant_id ON memberships (tenant_id);
+
+-- Only the SHA-256 hash of an invitation token is stored.
+CREATE TABLE invitations (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    tenant_id       VARCHAR(63) NOT NULL DEFAULT 'default',
+    organization_id BIGINT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email           VARCHAR(255) NOT NULL,
+    role            VARCHAR(16) NOT NULL,
+    token_hash      VARCHAR(64) NOT NULL UNIQUE,
+    invited_by      BIGINT NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    accepted_at     TIMESTAMPTZ
+);
+
+CREATE INDEX idx_invitations_organization_id ON invitations (organization_id);
+CREATE INDEX idx_invitations_tenant_id ON invitations (tenant_id);
+
+-- The active organization of a session, 0 for none.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_organizations_external_id;
+DROP INDEX IF EXISTS idx_users_external_id;
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
+
+DROP TABLE IF EXISTS scim_tokens;
@@ -0,0 +1,23 @@
+-- Only the SHA-256 hash of a SCIM token is stored.
+CREATE TABLE scim_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    tenant_id  VARCHAR(63) NOT NULL DEFAULT 'default',
+    name       VARCHAR(255) NOT NULL,
+    prefix     VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_scim_tokens_deleted_at ON scim_tokens (deleted_at);
+CREATE INDEX idx_scim_tokens_tenant_id ON scim_tokens (tenant_id);
+CREATE INDEX idx_scim_tokens_prefix ON scim_tokens (prefix);
+
+-- The identifiers SCIM clients give users and groups.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS external_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_users_external_id ON users (external_id);
+CREATE INDEX IF NOT EXISTS idx_organizations_external_id ON organizations (external_id);
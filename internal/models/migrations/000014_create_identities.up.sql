@@ -0,0 +1,18 @@
+-- Accounts at external identity providers that users sign in with.
+CREATE TABLE identities (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    tenant_id      VARCHAR(63) NOT NULL DEFAULT 'default',
+    user_id        BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider       VARCHAR(64) NOT NULL,
+    issuer         VARCHAR(255) NOT NULL,
+    subject        VARCHAR(255) NOT NULL,
+    email          VARCHAR(255) NOT NULL DEFAULT '',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE UNIQUE INDEX idx_identities_tenant_issuer_subject ON identities (tenant_id, issuer, subject);
+CREATE INDEX idx_identities_user_id ON identities (user_id);
+CREATE INDEX idx_identities_deleted_at ON identities (deleted_at);
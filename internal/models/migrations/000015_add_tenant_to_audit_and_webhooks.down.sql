@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_tenant_id;
+DROP INDEX IF EXISTS idx_webhook_subscriptions_tenant_id;
+DROP INDEX IF EXISTS idx_audit_events_tenant_id;
+
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE webhook_subscriptions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,556 @@
+package modeltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	Run(t, func(t *testing.T) Repositories {
+		db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		t.Cleanup(func() { models.CloseDB(db) })
+
+		if !assert.NoError(t, models.MigrateUp(db)) {
+			t.FailNow()
+		}
+
+		return GormRepositories(db)
+	})
+}
+
+func TestSQLiteMigrationStatus(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+
+	// Readiness probes only read, so they fail before schema_migrations exists
+	health := models.NewHealthPostgresRepository(db)
+	_, err = health.MigrationStatus(context.Background())
+	assert.Error(t, err)
+
+	status, err := models.GetMigrationStatus(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, status.Current)
+	assert.NotEmpty(t, status.Pending)
+
+	assert.NoError(t, models.MigrateUp(db))
+	assert.NoError(t, models.MigrateUp(db))
+
+	status, err = models.GetMigrationStatus(db)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Latest, status.Current)
+	assert.Empty(t, status.Pending)
+	assert.Error(t, models.MigrateDown(db, 1))
+
+	readiness, err := health.MigrationStatus(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, status.Latest, readiness.Current)
+	assert.Equal(t, status.Latest, readiness.Latest)
+}
+
+func TestSQLiteQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "within timeout", timeout: time.Minute},
+		{name: "past timeout", timeout: time.Nanosecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:", QueryTimeout: test.timeout})
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer models.CloseDB(db)
+
+			// Migrations are not bounded by the query timeout
+			if !assert.NoError(t, models.MigrateUp(db)) {
+				return
+			}
+
+			users := models.NewUserPostgresRepository(db.WithContext(context.Background()))
+			_, err = users.CreateUser(context.Background(), &models.User{Email: "timeout@example.com", Password: "hashed"})
+			assert.ErrorIs(t, err, test.wantErr)
+
+			// Each statement gets its own deadline
+			_, err = users.FetchUserByEmail(context.Background(), "timeout@example.com")
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTxPostgresManagerRetries(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, wantCalls: 3, wantErr: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, wantCalls: 3, wantErr: true},
+		{name: "other error", err: errors.New("db error"), wantCalls: 1, wantErr: true},
+		{name: "success", wantCalls: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			manager := models.NewTxPostgresManager(db, func(tx *gorm.DB) *gorm.DB { return tx })
+			err := manager.WithinTx(context.Background(), func(tx *gorm.DB) error {
+				calls++
+				return test.err
+			})
+
+			assert.Equal(t, test.wantCalls, calls)
+			assert.Equal(t, test.wantErr, err != nil)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestSQLiteOrganizations(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+	if !assert.NoError(t, models.MigrateUp(db)) {
+		return
+	}
+
+	ctx := tenant.WithContext(context.Background(), "acme")
+	users := models.NewUserPostgresRepository(db)
+	ownerID, err := users.CreateUser(ctx, models.NewUser("owner@test.com", "hashed"))
+	assert.NoError(t, err)
+	memberID, err := users.CreateUser(ctx, models.NewUser("member@test.com", "hashed"))
+	assert.NoError(t, err)
+
+	repo := models.NewOrganizationPostgresRepository(db)
+	org := models.NewOrganization("Acme")
+	assert.NoError(t, repo.CreateOrganization(ctx, org, ownerID))
+	assert.Equal(t, "acme", org.TenantID)
+
+	memberships, err := repo.FetchMemberships(ctx, ownerID)
+	assert.NoError(t, err)
+	if assert.Len(t, memberships, 1) {
+		assert.Equal(t, models.OrgRoleOwner, memberships[0].Role)
+		assert.Equal(t, "Acme", memberships[0].Organization.Name)
+	}
+
+	// Invitations are accepted once and only listed while pending
+	now := time.Now()
+	invitation := models.NewInvitation(org.ID, "member@test.com", models.OrgRoleAdmin, "hash", ownerID, now.Add(time.Hour))
+	assert.NoError(t, repo.CreateInvitation(ctx, invitation, "token"))
+	found, err := repo.FetchInvitationByHash(ctx, "hash")
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "Acme", found.Organization.Name)
+	}
+	assert.NoError(t, repo.AcceptInvitation(ctx, invitation.ID, now))
+	assert.ErrorIs(t, repo.AcceptInvitation(ctx, invitation.ID, now), gorm.ErrRecordNotFound)
+	invitations, err := repo.FetchInvitations(ctx, org.ID, now)
+	assert.NoError(t, err)
+	assert.Empty(t, invitations)
+
+	assert.NoError(t, repo.CreateMembership(ctx, models.NewMembership(org.ID, memberID, models.OrgRoleAdmin)))
+	assert.ErrorIs(t, repo.CreateMembership(ctx, models.NewMembership(org.ID, memberID, models.OrgRoleMember)), models.ErrAlreadyMember)
+	assert.NoError(t, repo.UpdateMemberRole(ctx, org.ID, memberID, models.OrgRoleOwner))
+	owners, err := repo.CountOwners(ctx, org.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), owners)
+
+	members, err := repo.FetchMembers(ctx, org.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, "member@test.com", members[1].User.Email)
+	}
+
+	// Other tenants do not see the organization
+	other := tenant.WithContext(context.Background(), "globex")
+	membership, err := repo.FetchMembership(other, org.ID, ownerID)
+	assert.NoError(t, err)
+	assert.Nil(t, membership)
+
+	assert.NoError(t, repo.DeleteMembership(ctx, org.ID, memberID))
+	assert.ErrorIs(t, repo.DeleteMembership(ctx, org.ID, memberID), gorm.ErrRecordNotFound)
+}
+
+func TestSQLiteSCIM(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+	if !assert.NoError(t, models.MigrateUp(db)) {
+		return
+	}
+
+	ctx := tenant.WithContext(context.Background(), "acme")
+	users := models.NewUserPostgresRepository(db)
+	var ids []uint
+	for _, email := range []string{"ada@test.com", "Alan@test.com", "grace_h@test.com"} {
+		id, err := users.CreateUser(ctx, models.NewUser(email, "hashed"))
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	disabled, err := users.FetchUserByID(ctx, ids[2])
+	assert.NoError(t, err)
+	now := time.Now()
+	disabled.DisabledAt = &now
+	disabled.ExternalID = "ext-3"
+	assert.NoError(t, users.UpdateUser(ctx, disabled))
+
+	tests := []struct {
+		name       string
+		conditions []models.Condition
+		wantEmails []string
+		wantErr    error
+	}{
+		{
+			name:       "email folds case",
+			conditions: []models.Condition{{Field: "email", Op: models.CondEqual, Value: "alan@TEST.com"}},
+			wantEmails: []string{"Alan@test.com"},
+		},
+		{
+			name: "starts with and active",
+			conditions: []models.Condition{
+				{Field: "email", Op: models.CondStartsWith, Value: "a"},
+				{Field: "active", Op: models.CondEqual, Value: true},
+			},
+			wantEmails: []string{"ada@test.com", "Alan@test.com"},
+		},
+		{
+			name:       "wildcards are literal",
+			conditions: []models.Condition{{Field: "email", Op: models.CondContains, Value: "_h@"}},
+			wantEmails: []string{"grace_h@test.com"},
+		},
+		{
+			name:       "inactive",
+			conditions: []models.Condition{{Field: "active", Op: models.CondEqual, Value: false}},
+			wantEmails: []string{"grace_h@test.com"},
+		},
+		{
+			name:       "external id present",
+			conditions: []models.Condition{{Field: "external_id", Op: models.CondPresent}},
+			wantEmails: []string{"grace_h@test.com"},
+		},
+		{
+			name:       "id that is no number",
+			conditions: []models.Condition{{Field: "id", Op: models.CondEqual, Value: "abc"}},
+			wantEmails: []string{},
+		},
+		{
+			name:       "unknown field",
+			conditions: []models.Condition{{Field: "password", Op: models.CondEqual, Value: "x"}},
+			wantErr:    models.ErrUnsupportedCondition,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, total, err := users.QueryUsers(ctx, models.Query{Conditions: test.conditions, Limit: 10})
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				emails := make([]string, 0, len(found))
+				for _, user := range found {
+					emails = append(emails, user.Email)
+				}
+				assert.Equal(t, test.wantEmails, emails)
+				assert.Equal(t, int64(len(test.wantEmails)), total)
+			}
+		})
+	}
+
+	// Pages count every match
+	page, total, err := users.QueryUsers(ctx, models.Query{Offset: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, ids[1], page[0].ID)
+	}
+
+	// Groups are organizations without owners
+	orgs := models.NewOrganizationPostgresRepository(db)
+	org := models.NewOrganization("Engineering")
+	org.ExternalID = "eng"
+	assert.NoError(t, orgs.CreateOrganization(ctx, org, 0))
+	assert.NoError(t, orgs.AddMembers(ctx, org.ID, ids, models.OrgRoleMember))
+	assert.NoError(t, orgs.AddMembers(ctx, org.ID, ids[:1], models.OrgRoleMember))
+	assert.NoError(t, orgs.RemoveMembers(ctx, org.ID, ids[1:2]))
+	members, err := orgs.FetchMembers(ctx, org.ID)
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	found, total, err := orgs.QueryOrganizations(ctx, models.Query{
+		Conditions: []models.Condition{{Field: "name", Op: models.CondEqual, Value: "engineering"}},
+		Limit:      10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "eng", found[0].ExternalID)
+	}
+
+	// Other tenants see neither the users nor the group
+	other := tenant.WithContext(context.Background(), "globex")
+	_, total, err = users.QueryUsers(other, models.Query{})
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+	fetched, err := orgs.FetchOrganization(other, org.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, fetched)
+
+	assert.NoError(t, orgs.DeleteOrganization(ctx, org.ID))
+	assert.ErrorIs(t, orgs.DeleteOrganization(ctx, org.ID), gorm.ErrRecordNotFound)
+	members, err = orgs.FetchMembers(ctx, org.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	// Tokens are found without a tenant, which they carry instead
+	tokens := models.NewSCIMTokenPostgresRepository(db)
+	assert.NoError(t, tokens.CreateSCIMToken(ctx, models.NewSCIMToken("okta", "scim_abcdefgh", "token-hash")))
+	token, err := tokens.FetchByHash(context.Background(), "token-hash")
+	assert.NoError(t, err)
+	if assert.NotNil(t, token) {
+		assert.Equal(t, "acme", token.TenantID)
+	}
+	token, err = tokens.FetchByHash(context.Background(), "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+
+	// Revoked tokens are no longer found, and only their tenant revokes them
+	created := models.NewSCIMToken("okta", "scim_ijklmnop", "revoked-hash")
+	assert.NoError(t, tokens.CreateSCIMToken(ctx, created))
+	assert.ErrorIs(t, tokens.RevokeSCIMToken(other, created.ID, time.Now()), gorm.ErrRecordNotFound)
+	assert.NoError(t, tokens.RevokeSCIMToken(ctx, created.ID, time.Now()))
+	assert.ErrorIs(t, tokens.RevokeSCIMToken(ctx, created.ID, time.Now()), gorm.ErrRecordNotFound)
+	token, err = tokens.FetchByHash(context.Background(), "revoked-hash")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+}
+
+func TestSQLiteIdentities(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+	if !assert.NoError(t, models.MigrateUp(db)) {
+		return
+	}
+
+	acme := tenant.WithContext(context.Background(), "acme")
+	globex := tenant.WithContext(context.Background(), "globex")
+	users := models.NewUserPostgresRepository(db)
+	identities := models.NewIdentityPostgresRepository(db)
+
+	userID, err := users.CreateUser(acme, models.NewUser("ada@test.com", ""))
+	assert.NoError(t, err)
+
+	identity := models.NewIdentity(userID, "google", "https://accounts.google.com", "1234")
+	assert.NoError(t, identities.CreateIdentity(acme, identity))
+	err = identities.CreateIdentity(acme, models.NewIdentity(userID, "google", "https://accounts.google.com", "1234"))
+	assert.ErrorIs(t, err, models.ErrDuplicateIdentity)
+
+	// The same account may sign in to each tenant
+	otherID, err := users.CreateUser(globex, models.NewUser("ada@test.com", ""))
+	assert.NoError(t, err)
+	assert.NoError(t, identities.CreateIdentity(globex, models.NewIdentity(otherID, "google", "https://accounts.google.com", "1234")))
+
+	fetched, err := identities.FetchIdentity(acme, "https://accounts.google.com", "1234")
+	assert.NoError(t, err)
+	if assert.NotNil(t, fetched) {
+		assert.Equal(t, userID, fetched.UserID)
+		assert.Equal(t, "acme", fetched.TenantID)
+	}
+
+	fetched, err = identities.FetchIdentity(acme, "https://accounts.google.com", "5678")
+	assert.NoError(t, err)
+	assert.Nil(t, fetched)
+
+	assert.NoError(t, identities.UpdateIdentityEmail(acme, identity.ID, "ada@example.com", true))
+	fetched, err = identities.FetchIdentity(acme, "https://accounts.google.com", "1234")
+	assert.NoError(t, err)
+	if assert.NotNil(t, fetched) {
+		assert.Equal(t, "ada@example.com", fetched.Email)
+		assert.True(t, fetched.EmailVerified)
+	}
+
+	// Identities of other tenants are out of reach
+	err = identities.UpdateIdentityEmail(globex, identity.ID, "eve@example.com", true)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, identities.DeleteIdentity(globex, userID, identity.ID), gorm.ErrRecordNotFound)
+
+	github := models.NewIdentity(userID, "github", "https://github.com", "42")
+	assert.NoError(t, identities.CreateIdentity(acme, github))
+	linked, err := identities.FetchIdentities(acme, userID)
+	assert.NoError(t, err)
+	if assert.Len(t, linked, 2) {
+		assert.Equal(t, "google", linked[0].Provider)
+		assert.Equal(t, "github", linked[1].Provider)
+	}
+
+	// Unlinked accounts can be linked again
+	assert.ErrorIs(t, identities.DeleteIdentity(acme, otherID, identity.ID), gorm.ErrRecordNotFound)
+	assert.NoError(t, identities.DeleteIdentity(acme, userID, identity.ID))
+	assert.NoError(t, identities.CreateIdentity(acme, models.NewIdentity(userID, "google", "https://accounts.google.com", "1234")))
+}
+
+func TestSQLiteTenantWebhooksAndAudit(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+	if !assert.NoError(t, models.MigrateUp(db)) {
+		return
+	}
+
+	acme := tenant.WithContext(context.Background(), "acme")
+	globex := tenant.WithContext(context.Background(), "globex")
+	webhooks := models.NewWebhookPostgresRepository(db)
+	acmeHook := models.NewWebhookSubscription("https://acme.example.com/hook", "secret", []string{models.WebhookUserCreated})
+	globexHook := models.NewWebhookSubscription("https://globex.example.com/hook", "secret", []string{models.WebhookUserCreated})
+	assert.NoError(t, webhooks.CreateSubscription(acme, acmeHook))
+	assert.NoError(t, webhooks.CreateSubscription(globex, globexHook))
+
+	subscriptions, err := webhooks.FetchSubscriptions(acme)
+	assert.NoError(t, err)
+	if assert.Len(t, subscriptions, 1) {
+		assert.Equal(t, acmeHook.ID, subscriptions[0].ID)
+	}
+
+	// Events only reach the subscriptions of their tenant
+	_, err = models.NewUserPostgresRepository(db).CreateUser(acme, models.NewUser("user@test.com", "hashed"))
+	assert.NoError(t, err)
+
+	deliveries, err := webhooks.FetchDeliveries(acme, models.WebhookDeliveryFilter{SubscriptionID: acmeHook.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, "acme", deliveries[0].TenantID)
+		assert.NoError(t, webhooks.RequeueDelivery(acme, deliveries[0].ID, time.Now()))
+		assert.ErrorIs(t, webhooks.RequeueDelivery(globex, deliveries[0].ID, time.Now()), gorm.ErrRecordNotFound)
+	}
+
+	deliveries, err = webhooks.FetchDeliveries(context.Background(), models.WebhookDeliveryFilter{SubscriptionID: globexHook.ID})
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	// Audit events are listed per tenant but chained across tenants
+	audit := models.NewAuditEventPostgresRepository(db)
+	first := models.NewAuditEvent(models.AuditSignIn, models.AuditOutcomeSuccess)
+	second := models.NewAuditEvent(models.AuditSignIn, models.AuditOutcomeSuccess)
+	assert.NoError(t, audit.AppendAuditEvent(acme, first))
+	assert.NoError(t, audit.AppendAuditEvent(globex, second))
+	assert.Equal(t, first.Hash, second.PrevHash)
+
+	events, err := audit.FetchAuditEvents(globex, models.AuditFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "globex", events[0].TenantID)
+		assert.Equal(t, events[0].Hash, events[0].ComputeHash())
+	}
+
+	events, err = audit.FetchAuditEvents(context.Background(), models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestSQLiteInvitationTokenPurged(t *testing.T) {
+	db, err := models.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer models.CloseDB(db)
+	if !assert.NoError(t, models.MigrateUp(db)) {
+		return
+	}
+
+	ctx := tenant.WithContext(context.Background(), "acme")
+	webhooks := models.NewWebhookPostgresRepository(db)
+	subscription := models.NewWebhookSubscription("https://example.com/hook", "secret", []string{models.WebhookInvitationCreated})
+	assert.NoError(t, webhooks.CreateSubscription(ctx, subscription))
+
+	ownerID, err := models.NewUserPostgresRepository(db).CreateUser(ctx, models.NewUser("owner@test.com", "hashed"))
+	assert.NoError(t, err)
+	orgs := models.NewOrganizationPostgresRepository(db)
+	org := models.NewOrganization("Acme")
+	assert.NoError(t, orgs.CreateOrganization(ctx, org, ownerID))
+	invitation := models.NewInvitation(org.ID, "member@test.com", models.OrgRoleMember, "hash", ownerID, time.Now().Add(time.Hour))
+	assert.NoError(t, orgs.CreateInvitation(ctx, invitation, "inv_secret"))
+
+	deliveries, err := webhooks.ClaimDueDeliveries(context.Background(), time.Now().Add(time.Second), time.Minute, 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, deliveries, 1) {
+		return
+	}
+	assert.Contains(t, deliveries[0].Payload, "inv_secret")
+
+	// Retried deliveries still need the token
+	delivery := deliveries[0]
+	delivery.Attempts = 1
+	delivery.LastError = "unexpected status 500"
+	assert.NoError(t, webhooks.UpdateDeliveryResult(context.Background(), &delivery))
+	assert.Contains(t, delivery.Payload, "inv_secret")
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status string
+	}{
+		{name: "delivered", status: models.DeliveryDelivered},
+		{name: "dead-lettered", status: models.DeliveryDead},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delivery.Status = test.status
+			delivery.DeliveredAt = nil
+			if test.status == models.DeliveryDelivered {
+				delivery.DeliveredAt = &now
+			}
+			assert.NoError(t, webhooks.UpdateDeliveryResult(context.Background(), &delivery))
+
+			deliveries, err := webhooks.FetchDeliveries(ctx, models.WebhookDeliveryFilter{SubscriptionID: subscription.ID})
+			assert.NoError(t, err)
+			if assert.Len(t, deliveries, 1) {
+				assert.NotContains(t, deliveries[0].Payload, "inv_secret")
+				assert.Contains(t, deliveries[0].Payload, "member@test.com")
+			}
+
+			// Without its token the event cannot be sent again
+			err = webhooks.RequeueDelivery(ctx, delivery.ID, now)
+			assert.ErrorIs(t, err, models.ErrNotRedeliverable)
+		})
+	}
+}
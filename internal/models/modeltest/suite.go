@@ -0,0 +1,562 @@
+// Package modeltest is the conformance suite for the repository backends.
+// Every backend, Postgres included, runs it from its own tests so that the
+// services can rely on the same semantics whichever one they are given.
+package modeltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/usecase"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Repositories are the repositories of one backend over one database and
+// the transaction manager binding them to transactions.
+type Repositories struct {
+	Users  usecase.UserRepository
+	Tokens usecase.RefreshTokenRepository
+	Tx     usecase.TxManager
+	// SoftDeleteUser marks an existing user deleted. The services never do
+	// this themselves; such rows come from deletions made in the database.
+	SoftDeleteUser func(ctx context.Context, userID uint) error
+}
+
+// GormRepositories returns the GORM repositories over db, which may be a
+// Postgres or a SQLite database.
+func GormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:  models.NewUserPostgresRepository(db),
+		Tokens: models.NewRefreshTokenPostgresRepository(db),
+		SoftDeleteUser: func(ctx context.Context, userID uint) error {
+			return db.WithContext(ctx).Delete(&models.User{}, userID).Error
+		},
+		Tx: models.NewTxPostgresManager(db, func(tx *gorm.DB) usecase.TxRepositories {
+			return usecase.TxRepositories{
+				Users:         models.NewUserPostgresRepository(tx),
+				Tokens:        models.NewRefreshTokenPostgresRepository(tx),
+				Organizations: models.NewOrganizationPostgresRepository(tx),
+				Identities:    models.NewIdentityPostgresRepository(tx),
+			}
+		}),
+	}
+}
+
+// Run runs the suite. newRepositories is called for every subtest and must
+// return repositories over a database without users or refresh tokens.
+func Run(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repos Repositories)
+	}{
+		{name: "create and fetch user", run: testCreateAndFetchUser},
+		{name: "duplicate email", run: testDuplicateEmail},
+		{name: "unknown rows", run: testUnknownRows},
+		{name: "update user", run: testUpdateUser},
+		{name: "soft delete and restore", run: testSoftDeleteAndRestore},
+		{name: "hard delete", run: testHardDelete},
+		{name: "purge deleted users", run: testPurgeDeletedUsers},
+		{name: "list users", run: testListUsers},
+		{name: "expired tokens", run: testExpiredTokens},
+		{name: "organization tokens", run: testOrganizationTokens},
+		{name: "transactions", run: testTransactions},
+		{name: "tenants", run: testTenants},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepositories(t))
+		})
+	}
+}
+
+// base is the creation time of users created with createUser. Whole seconds
+// survive every backend's timestamp precision.
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// createUser creates a user the given number of days after base with a
+// refresh token expiring at expiredAt, or without one when it is zero.
+func createUser(t *testing.T, repos Repositories, email string, days int, expiredAt time.Time) models.User {
+	t.Helper()
+
+	ctx := context.Background()
+	user := models.NewUser(email, "hashed")
+	user.CreatedAt = base.AddDate(0, 0, days)
+	id, err := repos.Users.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	assert.NotZero(t, id)
+	assert.Equal(t, id, user.ID)
+
+	if !expiredAt.IsZero() {
+		token := models.NewRefreshToken("token-"+email, expiredAt)
+		token.UserID = id
+		assert.NoError(t, repos.Tokens.CreateRefreshToken(ctx, &token))
+		assert.NotZero(t, token.ID)
+	}
+
+	return *user
+}
+
+func testCreateAndFetchUser(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	expiredAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	created := createUser(t, repos, "create@test.com", 0, expiredAt)
+
+	byEmail, err := repos.Users.FetchUserByEmail(ctx, "create@test.com")
+	if !assert.NoError(t, err) || !assert.NotNil(t, byEmail) {
+		return
+	}
+	assert.Equal(t, created.ID, byEmail.ID)
+	assert.Equal(t, "hashed", byEmail.Password)
+	assert.Equal(t, models.RoleUser, byEmail.Role)
+	assert.True(t, base.Equal(byEmail.CreatedAt))
+	assert.Nil(t, byEmail.DisabledAt)
+	assert.False(t, byEmail.PasswordResetRequired)
+
+	byID, err := repos.Users.FetchUserByID(ctx, created.ID)
+	if assert.NoError(t, err) && assert.NotNil(t, byID) {
+		assert.Equal(t, "create@test.com", byID.Email)
+	}
+
+	token, err := repos.Tokens.FetchByToken(ctx, "token-create@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, token.UserID)
+	assert.True(t, expiredAt.Equal(token.ExpiredAt))
+}
+
+func testDuplicateEmail(t *testing.T, repos Repositories) {
+	createUser(t, repos, "duplicate@test.com", 0, time.Time{})
+
+	_, err := repos.Users.CreateUser(context.Background(), models.NewUser("duplicate@test.com", "hashed"))
+	assert.ErrorIs(t, err, models.ErrDuplicateEmail)
+}
+
+func testUnknownRows(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	user, err := repos.Users.FetchUserByEmail(ctx, "unknown@test.com")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	user, err = repos.Users.FetchUserByID(ctx, 4242)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	user, err = repos.Users.FetchAnyUserByID(ctx, 4242)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	token, err := repos.Tokens.FetchByToken(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Empty(t, token.Token)
+
+	assert.ErrorIs(t, repos.Users.UpdatePassword(ctx, 4242, "hashed"), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Users.SetDisabledAt(ctx, 4242, nil), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Users.RequirePasswordReset(ctx, 4242), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Users.UpdateUser(ctx, &models.User{Model: gorm.Model{ID: 4242}, Email: "unknown@test.com"}), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Users.DeleteUser(ctx, 4242), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Users.RestoreUser(ctx, 4242), gorm.ErrRecordNotFound)
+}
+
+func testUpdateUser(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	created := createUser(t, repos, "update@test.com", 0, time.Time{})
+
+	disabledAt := base.Add(time.Hour)
+	assert.NoError(t, repos.Users.SetDisabledAt(ctx, created.ID, &disabledAt))
+	assert.NoError(t, repos.Users.RequirePasswordReset(ctx, created.ID))
+	user, err := repos.Users.FetchUserByID(ctx, created.ID)
+	if !assert.NoError(t, err) || !assert.NotNil(t, user) {
+		return
+	}
+	if assert.NotNil(t, user.DisabledAt) {
+		assert.True(t, disabledAt.Equal(*user.DisabledAt))
+	}
+	assert.True(t, user.PasswordResetRequired)
+
+	// A new password clears the required reset
+	assert.NoError(t, repos.Users.SetDisabledAt(ctx, created.ID, nil))
+	assert.NoError(t, repos.Users.UpdatePassword(ctx, created.ID, "rehashed"))
+	user, err = repos.Users.FetchUserByID(ctx, created.ID)
+	if !assert.NoError(t, err) || !assert.NotNil(t, user) {
+		return
+	}
+	assert.Nil(t, user.DisabledAt)
+	assert.False(t, user.PasswordResetRequired)
+	assert.Equal(t, "rehashed", user.Password)
+
+	// UpdateUser saves the profile and moves UpdatedAt forward
+	updatedAt := user.UpdatedAt
+	user.Email = "updated@test.com"
+	user.ExternalID = "ext-1"
+	user.Role = models.RoleAdmin
+	user.DisabledAt = &disabledAt
+	assert.NoError(t, repos.Users.UpdateUser(ctx, user))
+	assert.False(t, user.UpdatedAt.Before(updatedAt))
+	updated, err := repos.Users.FetchUserByEmail(ctx, "updated@test.com")
+	if !assert.NoError(t, err) || !assert.NotNil(t, updated) {
+		return
+	}
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Equal(t, "ext-1", updated.ExternalID)
+	assert.Equal(t, models.RoleAdmin, updated.Role)
+	assert.NotNil(t, updated.DisabledAt)
+	assert.Equal(t, "rehashed", updated.Password)
+
+	other := createUser(t, repos, "other@test.com", 0, time.Time{})
+	other.Email = "updated@test.com"
+	assert.ErrorIs(t, repos.Users.UpdateUser(ctx, &other), models.ErrDuplicateEmail)
+}
+
+func testSoftDeleteAndRestore(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	created := createUser(t, repos, "soft@test.com", 0, time.Time{})
+
+	assert.ErrorIs(t, repos.Users.RestoreUser(ctx, created.ID), gorm.ErrRecordNotFound)
+	assert.NoError(t, repos.SoftDeleteUser(ctx, created.ID))
+
+	// Soft-deleted users are hidden from everything but FetchAnyUserByID
+	user, err := repos.Users.FetchUserByEmail(ctx, "soft@test.com")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+	user, err = repos.Users.FetchUserByID(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+	user, err = repos.Users.FetchAnyUserByID(ctx, created.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, user) {
+		assert.True(t, user.DeletedAt.Valid)
+	}
+	assert.ErrorIs(t, repos.Users.UpdatePassword(ctx, created.ID, "rehashed"), gorm.ErrRecordNotFound)
+
+	// The email stays taken
+	_, err = repos.Users.CreateUser(ctx, models.NewUser("soft@test.com", "hashed"))
+	assert.ErrorIs(t, err, models.ErrDuplicateEmail)
+
+	assert.NoError(t, repos.Users.RestoreUser(ctx, created.ID))
+	user, err = repos.Users.FetchUserByID(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+func testHardDelete(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	created := createUser(t, repos, "hard@test.com", 0, time.Now().Add(time.Hour))
+	assert.NoError(t, repos.SoftDeleteUser(ctx, created.ID))
+
+	// Soft-deleted users can be deleted for good, with their tokens
+	assert.NoError(t, repos.Users.DeleteUser(ctx, created.ID))
+	user, err := repos.Users.FetchAnyUserByID(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+	token, err := repos.Tokens.FetchByToken(ctx, "token-hard@test.com")
+	assert.NoError(t, err)
+	assert.Empty(t, token.Token)
+	assert.ErrorIs(t, repos.Users.DeleteUser(ctx, created.ID), gorm.ErrRecordNotFound)
+
+	// The email is free again
+	createUser(t, repos, "hard@test.com", 0, time.Time{})
+}
+
+func testPurgeDeletedUsers(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	first := createUser(t, repos, "purged-1@test.com", 0, time.Now().Add(time.Hour))
+	second := createUser(t, repos, "purged-2@test.com", 0, time.Time{})
+	live := createUser(t, repos, "live@test.com", 0, time.Time{})
+	assert.NoError(t, repos.SoftDeleteUser(ctx, first.ID))
+	assert.NoError(t, repos.SoftDeleteUser(ctx, second.ID))
+
+	// Users deleted after the cutoff are kept
+	purged, err := repos.Users.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	purged, err = repos.Users.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	for _, id := range []uint{first.ID, second.ID} {
+		user, err := repos.Users.FetchAnyUserByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Nil(t, user)
+	}
+	token, err := repos.Tokens.FetchByToken(ctx, "token-purged-1@test.com")
+	assert.NoError(t, err)
+	assert.Empty(t, token.Token)
+
+	user, err := repos.Users.FetchUserByID(ctx, live.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+func testListUsers(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	users := []models.User{
+		createUser(t, repos, "list-c@test.com", 0, time.Time{}),
+		createUser(t, repos, "list-a_1@test.com", 1, time.Time{}),
+		createUser(t, repos, "list-ab@test.com", 1, time.Time{}),
+		createUser(t, repos, "list-b@test.com", 2, time.Time{}),
+	}
+	assert.NoError(t, repos.SoftDeleteUser(ctx, users[3].ID))
+
+	tests := []struct {
+		name       string
+		in         models.UserFilter
+		wantEmails []string
+		wantErr    error
+	}{
+		{
+			name:       "active users by creation and then ID",
+			in:         models.UserFilter{EmailPrefix: "list-"},
+			wantEmails: []string{"list-c@test.com", "list-a_1@test.com", "list-ab@test.com"},
+		},
+		{
+			name:       "newest first",
+			in:         models.UserFilter{EmailPrefix: "list-", Sort: models.UserSortCreatedDesc, Limit: 2},
+			wantEmails: []string{"list-ab@test.com", "list-a_1@test.com"},
+		},
+		{
+			name:       "after a cursor with the same creation time",
+			in:         models.UserFilter{EmailPrefix: "list-", Cursor: models.UserCursor(models.UserSortCreatedAsc, users[1])},
+			wantEmails: []string{"list-ab@test.com"},
+		},
+		{
+			name:       "by email after a cursor",
+			in:         models.UserFilter{EmailPrefix: "list-", Sort: models.UserSortEmailAsc, Cursor: models.UserCursor(models.UserSortEmailAsc, users[1])},
+			wantEmails: []string{"list-ab@test.com", "list-c@test.com"},
+		},
+		{
+			name:       "by email descending",
+			in:         models.UserFilter{EmailPrefix: "list-", Sort: models.UserSortEmailDesc, State: models.UserStateAll},
+			wantEmails: []string{"list-c@test.com", "list-b@test.com", "list-ab@test.com", "list-a_1@test.com"},
+		},
+		{
+			name:       "email prefix wildcards are literal",
+			in:         models.UserFilter{EmailPrefix: "list-a_"},
+			wantEmails: []string{"list-a_1@test.com"},
+		},
+		{
+			name:       "email prefix is case-sensitive",
+			in:         models.UserFilter{EmailPrefix: "LIST-"},
+			wantEmails: []string{},
+		},
+		{
+			name:       "created range",
+			in:         models.UserFilter{EmailPrefix: "list-", CreatedSince: base.AddDate(0, 0, 1), CreatedUntil: base.AddDate(0, 0, 2)},
+			wantEmails: []string{"list-a_1@test.com", "list-ab@test.com"},
+		},
+		{
+			name:       "deleted users",
+			in:         models.UserFilter{EmailPrefix: "list-", State: models.UserStateDeleted},
+			wantEmails: []string{"list-b@test.com"},
+		},
+		{
+			name:    "cursor of another sort",
+			in:      models.UserFilter{Sort: models.UserSortEmailAsc, Cursor: models.UserCursor(models.UserSortCreatedAsc, users[0])},
+			wantErr: models.ErrInvalidCursor,
+		},
+		{
+			name:    "malformed cursor",
+			in:      models.UserFilter{Cursor: "not a cursor"},
+			wantErr: models.ErrInvalidCursor,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := repos.Users.FetchUsers(ctx, test.in)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			gotEmails := make([]string, 0, len(got))
+			for _, user := range got {
+				gotEmails = append(gotEmails, user.Email)
+			}
+			assert.Equal(t, test.wantEmails, gotEmails)
+		})
+	}
+}
+
+func testExpiredTokens(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	first := createUser(t, repos, "expired-1@test.com", 0, now.Add(-2*time.Hour))
+	createUser(t, repos, "expired-2@test.com", 0, now.Add(-time.Hour))
+	live := createUser(t, repos, "live@test.com", 0, now.Add(time.Hour))
+
+	expired, err := repos.Tokens.FetchExpired(ctx, now)
+	assert.NoError(t, err)
+	if assert.Len(t, expired, 2) {
+		assert.Equal(t, first.ID, expired[0].UserID)
+	}
+
+	// Oldest first, at most limit at a time
+	deleted, err := repos.Tokens.DeleteExpired(ctx, now, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	expired, err = repos.Tokens.FetchExpired(ctx, now)
+	assert.NoError(t, err)
+	if assert.Len(t, expired, 1) {
+		assert.NotEqual(t, first.ID, expired[0].UserID)
+	}
+
+	deleted, err = repos.Tokens.DeleteExpired(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = repos.Tokens.DeleteByUserID(ctx, live.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = repos.Tokens.DeleteByUserID(ctx, live.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func testOrganizationTokens(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, "org@test.com", 0, time.Now().Add(time.Hour))
+	for _, orgID := range []uint{5, 5, 6} {
+		token := models.NewRefreshToken("token", time.Now().Add(time.Hour))
+		token.UserID = user.ID
+		token.OrganizationID = orgID
+		assert.NoError(t, repos.Tokens.CreateRefreshToken(ctx, &token))
+	}
+
+	deleted, err := repos.Tokens.DeleteByOrganization(ctx, user.ID, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	// Sessions outside the organization are kept
+	deleted, err = repos.Tokens.DeleteByUserID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func testTransactions(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	expiredAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	var committed uint
+	err := repos.Tx.WithinTx(ctx, func(tx usecase.TxRepositories) error {
+		id, err := tx.Users.CreateUser(ctx, models.NewUser("commit@test.com", "hashed"))
+		if err != nil {
+			return err
+		}
+
+		committed = id
+		token := models.NewRefreshToken("token-commit", expiredAt)
+		token.UserID = id
+		return tx.Tokens.CreateRefreshToken(ctx, &token)
+	})
+	assert.NoError(t, err)
+
+	token, err := repos.Tokens.FetchByToken(ctx, "token-commit")
+	assert.NoError(t, err)
+	assert.Equal(t, committed, token.UserID)
+
+	// An error of the function rolls back what it wrote
+	errRollback := errors.New("rollback")
+	err = repos.Tx.WithinTx(ctx, func(tx usecase.TxRepositories) error {
+		if _, err := tx.Users.CreateUser(ctx, models.NewUser("rollback@test.com", "hashed")); err != nil {
+			return err
+		}
+
+		if _, err := tx.Tokens.DeleteByUserID(ctx, committed); err != nil {
+			return err
+		}
+
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	user, err := repos.Users.FetchUserByEmail(ctx, "rollback@test.com")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	token, err = repos.Tokens.FetchByToken(ctx, "token-commit")
+	assert.NoError(t, err)
+	assert.Equal(t, committed, token.UserID)
+
+	// So does a failing repository call, here a token of an unknown user
+	err = repos.Tx.WithinTx(ctx, func(tx usecase.TxRepositories) error {
+		if err := tx.Users.UpdatePassword(ctx, committed, "rehashed"); err != nil {
+			return err
+		}
+
+		orphan := models.NewRefreshToken("token-orphan", expiredAt)
+		orphan.UserID = 4242
+		return tx.Tokens.CreateRefreshToken(ctx, &orphan)
+	})
+	assert.Error(t, err)
+
+	user, err = repos.Users.FetchUserByID(ctx, committed)
+	if assert.NoError(t, err) && assert.NotNil(t, user) {
+		assert.Equal(t, "hashed", user.Password)
+	}
+}
+
+func testTenants(t *testing.T, repos Repositories) {
+	acme := tenant.WithContext(context.Background(), "acme")
+	globex := tenant.WithContext(context.Background(), "globex")
+	expiredAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// Emails are unique per tenant
+	acmeID, err := repos.Users.CreateUser(acme, models.NewUser("same@test.com", "hashed"))
+	assert.NoError(t, err)
+	globexID, err := repos.Users.CreateUser(globex, models.NewUser("same@test.com", "hashed"))
+	assert.NoError(t, err)
+	_, err = repos.Users.CreateUser(acme, models.NewUser("same@test.com", "hashed"))
+	assert.ErrorIs(t, err, models.ErrDuplicateEmail)
+
+	token := models.NewRefreshToken("token-acme", expiredAt)
+	token.UserID = acmeID
+	assert.NoError(t, repos.Tokens.CreateRefreshToken(acme, &token))
+	assert.Equal(t, "acme", token.TenantID)
+
+	// Each tenant sees only its own rows
+	user, err := repos.Users.FetchUserByEmail(globex, "same@test.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, globexID, user.ID)
+		assert.Equal(t, "globex", user.TenantID)
+	}
+	user, err = repos.Users.FetchUserByID(globex, acmeID)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+	users, err := repos.Users.FetchUsers(acme, models.UserFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, acmeID, users[0].ID)
+	}
+	found, err := repos.Tokens.FetchByToken(globex, "token-acme")
+	assert.NoError(t, err)
+	assert.Empty(t, found.Token)
+	assert.ErrorIs(t, repos.Users.UpdatePassword(globex, acmeID, "rehashed"), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Users.DeleteUser(globex, acmeID), gorm.ErrRecordNotFound)
+	deleted, err := repos.Tokens.DeleteExpired(globex, time.Now(), 10)
+	assert.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	// Rows cannot be created in another tenant
+	other := models.NewUser("other@test.com", "hashed")
+	other.TenantID = "globex"
+	_, err = repos.Users.CreateUser(acme, other)
+	assert.Error(t, err)
+
+	// Without a tenant, as in background jobs, every tenant is seen
+	deleted, err = repos.Tokens.DeleteExpired(context.Background(), time.Now(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	user, err = repos.Users.FetchUserByID(context.Background(), acmeID)
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+}
@@ -0,0 +1,429 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrAlreadyMember = errors.New("user is already a member")
+
+// Organization roles. Owners manage the organization and its owners, admins
+// manage the other members and invitations.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles lists the organization roles.
+var OrgRoles = []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleMember}
+
+type Organization struct {
+	gorm.Model
+	TenantID string `gorm:"not null;size:63;default:default;index"`
+	Name     string `gorm:"not null;size:255"`
+	// ExternalID is the identifier a SCIM client gave the organization, if
+	// any.
+	ExternalID string `gorm:"not null;size:255;default:'';index"`
+}
+
+// Membership gives a user a role in an organization.
+type Membership struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	TenantID       string       `gorm:"not null;size:63;default:default;index"`
+	OrganizationID uint         `gorm:"not null;uniqueIndex:idx_memberships_org_user,priority:1"`
+	UserID         uint         `gorm:"not null;uniqueIndex:idx_memberships_org_user,priority:2;index"`
+	Role           string       `gorm:"not null;size:16"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE"`
+	User           User         `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// Invitation asks the owner of Email to join an organization. Only the
+// SHA-256 hash of its token is stored; the token itself is handed out once
+// through the invitation.created webhook.
+type Invitation struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	TenantID       string    `gorm:"not null;size:63;default:default;index"`
+	OrganizationID uint      `gorm:"not null;index"`
+	Email          string    `gorm:"not null;size:255"`
+	Role           string    `gorm:"not null;size:16"`
+	TokenHash      string    `gorm:"unique;not null;size:64"`
+	InvitedBy      uint      `gorm:"not null"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	AcceptedAt     *time.Time
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type OrganizationPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewOrganization(name string) *Organization {
+	return &Organization{
+		Name: name,
+	}
+}
+
+func NewMembership(orgID, userID uint, role string) *Membership {
+	return &Membership{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Role:           role,
+	}
+}
+
+func NewInvitation(orgID uint, email, role, tokenHash string, invitedBy uint, expiresAt time.Time) *Invitation {
+	return &Invitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      tokenHash,
+		InvitedBy:      invitedBy,
+		ExpiresAt:      expiresAt,
+	}
+}
+
+func NewOrganizationPostgresRepository(db *gorm.DB) *OrganizationPostgresRepository {
+	return &OrganizationPostgresRepository{
+		DB: db,
+	}
+}
+
+// Pending reports whether the invitation can still be accepted at now.
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// CreateOrganization stores the organization and makes ownerID its owner.
+// An ownerID of zero creates an organization without members.
+func (r *OrganizationPostgresRepository) CreateOrganization(ctx context.Context, org *Organization, ownerID uint) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+
+		if ownerID == 0 {
+			return nil
+		}
+
+		return tx.Omit("Organization", "User").Create(NewMembership(org.ID, ownerID, OrgRoleOwner)).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return nil
+}
+
+// FetchOrganization returns nil when the organization does not exist.
+func (r *OrganizationPostgresRepository) FetchOrganization(ctx context.Context, orgID uint) (*Organization, error) {
+	var org Organization
+	result := r.DB.WithContext(ctx).First(&org, orgID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch organization: %w", result.Error)
+	}
+
+	return &org, nil
+}
+
+var organizationQueryFields = map[string]queryField{
+	"id":          {column: "id", kind: fieldNumber},
+	"name":        {column: "name", kind: fieldTextFold},
+	"external_id": {column: "external_id", kind: fieldText},
+}
+
+// QueryOrganizations returns the organizations matching query in ID order
+// and how many match in total. Conditions can use the fields id, name and
+// external_id.
+func (r *OrganizationPostgresRepository) QueryOrganizations(ctx context.Context, query Query) ([]Organization, int64, error) {
+	orgs := make([]Organization, 0)
+	total, err := runQuery(r.DB.WithContext(ctx), organizationQueryFields, query, &orgs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query organizations: %w", err)
+	}
+
+	return orgs, total, nil
+}
+
+// UpdateOrganization saves the name and external ID of the organization and
+// sets its UpdatedAt.
+func (r *OrganizationPostgresRepository) UpdateOrganization(ctx context.Context, org *Organization) error {
+	now := time.Now()
+	result := r.DB.WithContext(ctx).Model(&Organization{}).Where("id = ?", org.ID).Updates(map[string]interface{}{
+		"name":        org.Name,
+		"external_id": org.ExternalID,
+		"updated_at":  now,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update organization: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to update organization: %w", gorm.ErrRecordNotFound)
+	}
+
+	org.UpdatedAt = now
+	return nil
+}
+
+// DeleteOrganization removes the organization for good with its memberships
+// and invitations.
+func (r *OrganizationPostgresRepository) DeleteOrganization(ctx context.Context, orgID uint) error {
+	result := r.DB.WithContext(ctx).Unscoped().Delete(&Organization{}, orgID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete organization: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to delete organization: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// AddMembers gives the users the role in the organization, keeping the role
+// of those who are members already, and touches the organization's
+// UpdatedAt.
+func (r *OrganizationPostgresRepository) AddMembers(ctx context.Context, orgID uint, userIDs []uint, role string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	memberships := make([]Membership, 0, len(userIDs))
+	for _, userID := range userIDs {
+		memberships = append(memberships, *NewMembership(orgID, userID, role))
+	}
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Organization", "User").Clauses(clause.OnConflict{DoNothing: true}).Create(&memberships).Error; err != nil {
+			return err
+		}
+
+		return touchOrganization(tx, orgID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add members: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveMembers removes the users from the organization, ignoring those who
+// are no members, and touches the organization's UpdatedAt.
+func (r *OrganizationPostgresRepository) RemoveMembers(ctx context.Context, orgID uint, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND user_id IN ?", orgID, userIDs).Delete(&Membership{}).Error; err != nil {
+			return err
+		}
+
+		return touchOrganization(tx, orgID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove members: %w", err)
+	}
+
+	return nil
+}
+
+// touchOrganization sets the UpdatedAt of the organization after a change
+// of its members, which changes its SCIM version.
+func touchOrganization(tx *gorm.DB, orgID uint) error {
+	return tx.Model(&Organization{}).Where("id = ?", orgID).Update("updated_at", time.Now()).Error
+}
+
+// FetchMemberships returns the memberships of the user with their
+// organizations, oldest organization first.
+func (r *OrganizationPostgresRepository) FetchMemberships(ctx context.Context, userID uint) ([]Membership, error) {
+	memberships := make([]Membership, 0)
+	result := r.DB.WithContext(ctx).Preload("Organization").Where("user_id = ?", userID).Order("organization_id").Find(&memberships)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch memberships: %w", result.Error)
+	}
+
+	return memberships, nil
+}
+
+// FetchMembership returns nil when the user is not a member of the
+// organization.
+func (r *OrganizationPostgresRepository) FetchMembership(ctx context.Context, orgID, userID uint) (*Membership, error) {
+	var membership Membership
+	result := r.DB.WithContext(ctx).Preload("Organization").Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch membership: %w", result.Error)
+	}
+
+	return &membership, nil
+}
+
+// FetchMembers returns the memberships of the organization with their
+// users, in the order they joined.
+func (r *OrganizationPostgresRepository) FetchMembers(ctx context.Context, orgID uint) ([]Membership, error) {
+	members := make([]Membership, 0)
+	result := r.DB.WithContext(ctx).Preload("User").Where("organization_id = ?", orgID).Order("id").Find(&members)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch members: %w", result.Error)
+	}
+
+	return members, nil
+}
+
+func (r *OrganizationPostgresRepository) CreateMembership(ctx context.Context, membership *Membership) error {
+	err := r.DB.WithContext(ctx).Omit("Organization", "User").Create(membership).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAlreadyMember
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to create membership: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMemberRole returns gorm.ErrRecordNotFound when the user is not a
+// member of the organization.
+func (r *OrganizationPostgresRepository) UpdateMemberRole(ctx context.Context, orgID, userID uint, role string) error {
+	result := r.DB.WithContext(ctx).Model(&Membership{}).Where("organization_id = ? AND user_id = ?", orgID, userID).Update("role", role)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update member role: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteMembership returns gorm.ErrRecordNotFound when the user is not a
+// member of the organization.
+func (r *OrganizationPostgresRepository) DeleteMembership(ctx context.Context, orgID, userID uint) error {
+	result := r.DB.WithContext(ctx).Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&Membership{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete membership: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *OrganizationPostgresRepository) CountOwners(ctx context.Context, orgID uint) (int64, error) {
+	var count int64
+	result := r.DB.WithContext(ctx).Model(&Membership{}).Where("organization_id = ? AND role = ?", orgID, OrgRoleOwner).Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count owners: %w", result.Error)
+	}
+
+	return count, nil
+}
+
+// CreateInvitation stores the invitation and queues the invitation.created
+// webhook, which carries token to whoever delivers the invitation email.
+func (r *OrganizationPostgresRepository) CreateInvitation(ctx context.Context, invitation *Invitation, token string) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Organization").Create(invitation).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&invitation.Organization, invitation.OrganizationID).Error; err != nil {
+			return err
+		}
+
+		return enqueueWebhookEvent(tx, invitation.TenantID, WebhookInvitationCreated, NewWebhookInvitation(invitation, token))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// FetchInvitations returns the invitations of the organization that can
+// still be accepted at now, newest first.
+func (r *OrganizationPostgresRepository) FetchInvitations(ctx context.Context, orgID uint, now time.Time) ([]Invitation, error) {
+	invitations := make([]Invitation, 0)
+	result := r.DB.WithContext(ctx).
+		Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", orgID, now).
+		Order("id DESC").
+		Find(&invitations)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch invitations: %w", result.Error)
+	}
+
+	return invitations, nil
+}
+
+// FetchInvitationByHash returns nil when no invitation has the given token
+// hash.
+func (r *OrganizationPostgresRepository) FetchInvitationByHash(ctx context.Context, tokenHash string) (*Invitation, error) {
+	var invitation Invitation
+	result := r.DB.WithContext(ctx).Preload("Organization").Where("token_hash = ?", tokenHash).First(&invitation)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch invitation: %w", result.Error)
+	}
+
+	return &invitation, nil
+}
+
+// AcceptInvitation marks the invitation as accepted. It returns
+// gorm.ErrRecordNotFound when the invitation does not exist or was already
+// accepted, so that concurrent accepts cannot both succeed.
+func (r *OrganizationPostgresRepository) AcceptInvitation(ctx context.Context, invitationID uint, acceptedAt time.Time) error {
+	result := r.DB.WithContext(ctx).Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL", invitationID).
+		Update("accepted_at", acceptedAt)
+	if result.Error != nil {
+		return fmt.Errorf("failed to accept invitation: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteInvitation returns gorm.ErrRecordNotFound when the organization has
+// no pending invitation with the ID.
+func (r *OrganizationPostgresRepository) DeleteInvitation(ctx context.Context, orgID, invitationID uint) error {
+	result := r.DB.WithContext(ctx).
+		Where("id = ? AND organization_id = ? AND accepted_at IS NULL", invitationID, orgID).
+		Delete(&Invitation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete invitation: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
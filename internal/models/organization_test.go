@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewOrganizationRepository(t *testing.T) {
+	var db *gorm.DB
+	repo := NewOrganizationPostgresRepository(db)
+	assert.Equal(t, db, repo.DB)
+}
+
+func TestInvitationPending(t *testing.T) {
+	now := time.Now()
+	acceptedAt := now.Add(-time.Minute)
+	tests := []struct {
+		name       string
+		invitation Invitation
+		want       bool
+	}{
+		{name: "pending", invitation: Invitation{ExpiresAt: now.Add(time.Hour)}, want: true},
+		{name: "expired", invitation: Invitation{ExpiresAt: now}, want: false},
+		{name: "accepted", invitation: Invitation{ExpiresAt: now.Add(time.Hour), AcceptedAt: &acceptedAt}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, test.invitation.Pending(now))
+		})
+	}
+}
+
+func TestOrganizationMembers(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	ownerID, err := NewUserPostgresRepository(tx).CreateUser(ctx, NewUser("org-owner@test.com", "hashed"))
+	assert.NoError(t, err)
+	memberID, err := NewUserPostgresRepository(tx).CreateUser(ctx, NewUser("org-member@test.com", "hashed"))
+	assert.NoError(t, err)
+
+	repo := &OrganizationPostgresRepository{
+		DB: tx,
+	}
+	org := NewOrganization("Acme")
+	assert.NoError(t, repo.CreateOrganization(ctx, org, ownerID))
+	assert.NoError(t, repo.CreateMembership(ctx, NewMembership(org.ID, memberID, OrgRoleMember)))
+	assert.ErrorIs(t, repo.CreateMembership(ctx, NewMembership(org.ID, memberID, OrgRoleAdmin)), ErrAlreadyMember)
+
+	members, err := repo.FetchMembers(ctx, org.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, OrgRoleOwner, members[0].Role)
+		assert.Equal(t, "org-member@test.com", members[1].User.Email)
+	}
+
+	owners, err := repo.CountOwners(ctx, org.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), owners)
+	assert.ErrorIs(t, repo.UpdateMemberRole(ctx, org.ID, 0, OrgRoleAdmin), gorm.ErrRecordNotFound)
+}
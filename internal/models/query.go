@@ -0,0 +1,179 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnsupportedCondition = errors.New("unsupported condition")
+
+// Condition operators, named after the SCIM comparison operators. Present
+// ignores the value.
+const (
+	CondEqual      = "eq"
+	CondNotEqual   = "ne"
+	CondContains   = "co"
+	CondStartsWith = "sw"
+	CondEndsWith   = "ew"
+	CondPresent    = "pr"
+)
+
+// Condition compares a field with Value, a string, bool, number or nil.
+type Condition struct {
+	Field string
+	Op    string
+	Value any
+}
+
+// Query selects the rows matching every condition. Offset rows are skipped
+// and at most Limit returned; with a Limit of zero only the total is counted.
+type Query struct {
+	Conditions []Condition
+	Offset     int
+	Limit      int
+}
+
+type fieldKind int
+
+const (
+	fieldText fieldKind = iota
+	// fieldTextFold compares case-insensitively.
+	fieldTextFold
+	fieldNumber
+	// fieldNullFlag is a boolean that is true while the column is NULL.
+	fieldNullFlag
+)
+
+// queryField is the column a field of a query compares.
+type queryField struct {
+	column string
+	kind   fieldKind
+}
+
+// runQuery counts the rows matching query and loads a page of them into
+// dest in ID order.
+func runQuery(db *gorm.DB, fields map[string]queryField, query Query, dest interface{}) (int64, error) {
+	scopes := make([]func(*gorm.DB) *gorm.DB, 0, len(query.Conditions))
+	for _, condition := range query.Conditions {
+		scope, err := conditionScope(fields, condition)
+		if err != nil {
+			return 0, err
+		}
+		scopes = append(scopes, scope)
+	}
+
+	var total int64
+	if err := db.Model(dest).Scopes(scopes...).Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	if query.Limit <= 0 || total == 0 {
+		return total, nil
+	}
+
+	if err := db.Scopes(scopes...).Order("id").Offset(query.Offset).Limit(query.Limit).Find(dest).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func conditionScope(fields map[string]queryField, condition Condition) (func(*gorm.DB) *gorm.DB, error) {
+	field, ok := fields[condition.Field]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrUnsupportedCondition, condition.Field)
+	}
+
+	where := func(query string, args ...interface{}) func(*gorm.DB) *gorm.DB {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(query, args...)
+		}
+	}
+	column := field.column
+	value := condition.Value
+
+	switch field.kind {
+	case fieldNullFlag:
+		b, ok := value.(bool)
+		switch {
+		case condition.Op == CondPresent:
+			return where("1 = 1"), nil
+		case !ok || (condition.Op != CondEqual && condition.Op != CondNotEqual):
+			return nil, fmt.Errorf("%w: %s %s %v", ErrUnsupportedCondition, condition.Field, condition.Op, value)
+		case b == (condition.Op == CondEqual):
+			return where(column + " IS NULL"), nil
+		default:
+			return where(column + " IS NOT NULL"), nil
+		}
+	case fieldNumber:
+		if condition.Op == CondPresent {
+			return where("1 = 1"), nil
+		}
+		if condition.Op != CondEqual && condition.Op != CondNotEqual {
+			return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedCondition, condition.Field, condition.Op)
+		}
+
+		// Values that are no ID match nothing rather than failing the query
+		var id uint64
+		var err error
+		switch v := value.(type) {
+		case string:
+			id, err = strconv.ParseUint(v, 10, 64)
+		case float64:
+			id = uint64(v)
+			if float64(id) != v {
+				err = strconv.ErrSyntax
+			}
+		default:
+			err = strconv.ErrSyntax
+		}
+		if err != nil {
+			if condition.Op == CondEqual {
+				return where("1 = 0"), nil
+			}
+			return where("1 = 1"), nil
+		}
+		value = id
+	case fieldTextFold:
+		if s, ok := value.(string); ok {
+			column = "LOWER(" + column + ")"
+			value = strings.ToLower(s)
+		}
+	}
+
+	switch condition.Op {
+	case CondPresent:
+		return where(column + " IS NOT NULL AND " + column + " <> ''"), nil
+	case CondEqual, CondNotEqual:
+		op := "="
+		if condition.Op == CondNotEqual {
+			op = "<>"
+		}
+		if value == nil {
+			return nil, fmt.Errorf("%w: %s compared with null", ErrUnsupportedCondition, condition.Field)
+		}
+		return where(column+" "+op+" ?", value), nil
+	case CondContains, CondStartsWith, CondEndsWith:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %s needs a string", ErrUnsupportedCondition, condition.Field, condition.Op)
+		}
+
+		pattern := escapeLike(s)
+		switch condition.Op {
+		case CondContains:
+			pattern = "%" + pattern + "%"
+		case CondStartsWith:
+			pattern += "%"
+		default:
+			pattern = "%" + pattern
+		}
+		return where(column+` LIKE ? ESCAPE '\'`, pattern), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrUnsupportedCondition, condition.Op)
+	}
+}
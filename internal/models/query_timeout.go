@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const queryTimeoutKey = "query_timeout:statement"
+
+// noQueryTimeoutKey marks contexts whose statements may run for as long as
+// the context allows.
+type noQueryTimeoutKey struct{}
+
+// QueryTimeoutPlugin gives every statement at most Timeout to run, on top of
+// the deadline and cancellation of the context passed with db.WithContext.
+// Only the database call is bounded, so a request may still spend longer
+// on identity providers or directories. Row statements are left alone
+// because their result is scanned after the callbacks have returned, and
+// migrations because they wait for the migration lock and may rewrite large
+// tables.
+type QueryTimeoutPlugin struct {
+	Timeout time.Duration
+}
+
+// queryTimeout is the context a statement had before its deadline was set,
+// and the function releasing the deadline.
+type queryTimeout struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+func (QueryTimeoutPlugin) Name() string {
+	return "query_timeout"
+}
+
+func (p QueryTimeoutPlugin) Initialize(db *gorm.DB) error {
+	if p.Timeout <= 0 {
+		return nil
+	}
+
+	cb := db.Callback()
+	hooks := []struct {
+		name   string
+		before func(name string, fn func(*gorm.DB)) error
+		after  func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, h := range hooks {
+		if err := h.before("query_timeout:before_"+h.name, p.setDeadline); err != nil {
+			return err
+		}
+		if err := h.after("query_timeout:after_"+h.name, releaseDeadline); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withoutQueryTimeout returns db with statements that are not bounded by
+// QueryTimeoutPlugin.
+func withoutQueryTimeout(db *gorm.DB) *gorm.DB {
+	return db.WithContext(context.WithValue(db.Statement.Context, noQueryTimeoutKey{}, true))
+}
+
+func (p QueryTimeoutPlugin) setDeadline(db *gorm.DB) {
+	parent := db.Statement.Context
+	if parent.Value(noQueryTimeoutKey{}) != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(parent, p.Timeout)
+	db.Statement.Context = ctx
+	db.InstanceSet(queryTimeoutKey, queryTimeout{parent: parent, cancel: cancel})
+}
+
+// releaseDeadline restores the context of the statement, so that a chain
+// reused for another statement does not run with an expired deadline.
+func releaseDeadline(db *gorm.DB) {
+	v, ok := db.InstanceGet(queryTimeoutKey)
+	if !ok {
+		return
+	}
+
+	timeout := v.(queryTimeout)
+	timeout.cancel()
+	db.Statement.Context = timeout.parent
+}
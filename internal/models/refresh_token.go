@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -10,9 +11,13 @@ import (
 
 type RefreshToken struct {
 	gorm.Model
+	TenantID  string    `gorm:"not null;size:63;default:default;index"`
 	UserID    uint      `gorm:"not null"`
 	Token     string    `gorm:"not null"`
 	ExpiredAt time.Time `gorm:"not null"`
+	// OrganizationID is the active organization of the session, zero for
+	// none. Access tokens refreshed with it carry it in their org_id claim.
+	OrganizationID uint `gorm:"not null;default:0"`
 }
 
 type RefreshTokenPostgresRepository struct {
@@ -25,16 +30,24 @@ func NewRefreshTokenPostgresRepository(db *gorm.DB) *RefreshTokenPostgresReposit
 	}
 }
 
-func NewRefreshToken(token string) RefreshToken {
+func NewRefreshToken(token string, expiredAt time.Time) RefreshToken {
 	return RefreshToken{
 		Token:     token,
-		ExpiredAt: time.Now().Add(time.Hour * 24 * 7),
+		ExpiredAt: expiredAt,
 	}
 }
 
-func (r *RefreshTokenPostgresRepository) FetchByToken(token string) (RefreshToken, error) {
+func (r *RefreshTokenPostgresRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	if err := r.DB.WithContext(ctx).Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RefreshTokenPostgresRepository) FetchByToken(ctx context.Context, token string) (RefreshToken, error) {
 	var refreshToken RefreshToken
-	result := r.DB.Where("token = ?", token).First(&refreshToken)
+	result := r.DB.WithContext(ctx).Where("token = ?", token).First(&refreshToken)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return refreshToken, nil
 	}
@@ -45,3 +58,45 @@ func (r *RefreshTokenPostgresRepository) FetchByToken(token string) (RefreshToke
 
 	return refreshToken, nil
 }
+
+func (r *RefreshTokenPostgresRepository) DeleteByUserID(ctx context.Context, userID uint) (int64, error) {
+	result := r.DB.WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&RefreshToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete refresh tokens: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// DeleteByOrganization removes the sessions of the user that are active in
+// the organization.
+func (r *RefreshTokenPostgresRepository) DeleteByOrganization(ctx context.Context, userID, orgID uint) (int64, error) {
+	result := r.DB.WithContext(ctx).Unscoped().Where("user_id = ? AND organization_id = ?", userID, orgID).Delete(&RefreshToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete organization refresh tokens: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+func (r *RefreshTokenPostgresRepository) FetchExpired(ctx context.Context, before time.Time) ([]RefreshToken, error) {
+	tokens := make([]RefreshToken, 0)
+	result := r.DB.WithContext(ctx).Where("expired_at < ?", before).Order("expired_at").Find(&tokens)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch expired refresh tokens: %w", result.Error)
+	}
+
+	return tokens, nil
+}
+
+// DeleteExpired removes at most limit tokens that expired before the given
+// time, oldest first, and returns how many were removed.
+func (r *RefreshTokenPostgresRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	batch := r.DB.Model(&RefreshToken{}).Select("id").Where("expired_at < ?", before).Order("expired_at, id").Limit(limit)
+	result := r.DB.WithContext(ctx).Unscoped().Where("id IN (?)", batch).Delete(&RefreshToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
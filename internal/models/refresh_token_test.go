@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -9,9 +10,11 @@ import (
 )
 
 func TestNewRefreshToken(t *testing.T) {
-	refreshToken := NewRefreshToken("token")
+	expiredAt := time.Now().Add(time.Hour)
+	refreshToken := NewRefreshToken("token", expiredAt)
 	assert.Equal(t, uint(0), refreshToken.UserID)
 	assert.Equal(t, "token", refreshToken.Token)
+	assert.Equal(t, expiredAt, refreshToken.ExpiredAt)
 }
 
 func TestNewRefreshTokenRepository(t *testing.T) {
@@ -60,7 +63,7 @@ func TestFetchByToken(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := repo.FetchByToken(test.want)
+			got, err := repo.FetchByToken(context.Background(), test.want)
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
 			} else {
@@ -70,3 +73,45 @@ func TestFetchByToken(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteExpired(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := RefreshTokenPostgresRepository{
+		DB: tx,
+	}
+
+	expired := &User{
+		Email:    "expired@test.com",
+		Password: "password",
+		RefreshToken: RefreshToken{
+			Token:     "expired",
+			ExpiredAt: time.Now().Add(-time.Hour),
+		},
+	}
+	valid := &User{
+		Email:    "valid@test.com",
+		Password: "password",
+		RefreshToken: RefreshToken{
+			Token:     "valid",
+			ExpiredAt: time.Now().Add(time.Hour),
+		},
+	}
+	repo.DB.Create(expired)
+	repo.DB.Create(valid)
+
+	tokens, err := repo.FetchExpired(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	assert.Equal(t, "expired", tokens[0].Token)
+
+	deleted, err := repo.DeleteExpired(context.Background(), time.Now(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = repo.DeleteByUserID(context.Background(), valid.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
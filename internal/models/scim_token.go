@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SCIMToken is the bearer credential of a SCIM client. Each one provisions
+// the users and groups of its tenant. Only the SHA-256 hash of the token is
+// stored; the prefix identifies it to operators.
+type SCIMToken struct {
+	gorm.Model
+	TenantID  string `gorm:"not null;size:63;default:default;index"`
+	Name      string `gorm:"not null;size:255"`
+	Prefix    string `gorm:"not null;size:16;index"`
+	TokenHash string `gorm:"unique;not null;size:64"`
+	RevokedAt *time.Time
+}
+
+type SCIMTokenPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewSCIMToken(name, prefix, tokenHash string) *SCIMToken {
+	return &SCIMToken{
+		Name:      name,
+		Prefix:    prefix,
+		TokenHash: tokenHash,
+	}
+}
+
+func NewSCIMTokenPostgresRepository(db *gorm.DB) *SCIMTokenPostgresRepository {
+	return &SCIMTokenPostgresRepository{
+		DB: db,
+	}
+}
+
+func (r *SCIMTokenPostgresRepository) CreateSCIMToken(ctx context.Context, token *SCIMToken) error {
+	if err := r.DB.WithContext(ctx).Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create scim token: %w", err)
+	}
+
+	return nil
+}
+
+// FetchByHash returns nil when no unrevoked token has the given hash. It is
+// called before the tenant is known, so ctx should carry none.
+func (r *SCIMTokenPostgresRepository) FetchByHash(ctx context.Context, tokenHash string) (*SCIMToken, error) {
+	var token SCIMToken
+	result := r.DB.WithContext(ctx).Where("token_hash = ? AND revoked_at IS NULL", tokenHash).First(&token)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch scim token: %w", result.Error)
+	}
+
+	return &token, nil
+}
+
+// RevokeSCIMToken revokes the token of the tenant in ctx. Requests made with
+// it are rejected from then on.
+func (r *SCIMTokenPostgresRepository) RevokeSCIMToken(ctx context.Context, id uint, now time.Time) error {
+	result := r.DB.WithContext(ctx).Model(&SCIMToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke scim token: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to revoke scim token: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
@@ -29,20 +29,23 @@ func setupDB() {
 		os.Getenv("TEST_DB_HOST"), os.Getenv("TEST_DB_USER"), os.Getenv("TEST_DB_PASSWORD"), os.Getenv("TEST_DB_NAME"), os.Getenv("DB_PORT"), os.Getenv("DB_SSLMODE"),
 	)
 	var err error
-	testDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	testDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic(err)
 	}
 
-	testDB.AutoMigrate(
-		&User{},
-		&RefreshToken{},
-	)
+	if err := MigrateUp(testDB); err != nil {
+		panic(err)
+	}
 }
 
 func teardown() {
-	testDB.Migrator().DropTable(
-		&User{},
-		&RefreshToken{},
-	)
+	migrations, err := LoadMigrations()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := MigrateDown(testDB, len(migrations)); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey is an HMAC key used to sign access tokens. Only one key is active
+// at a time; retired keys stay available for verification until tokens signed
+// with them have expired.
+type SigningKey struct {
+	gorm.Model
+	KID       string `gorm:"unique;not null;size:64"`
+	Secret    string `gorm:"not null"`
+	Active    bool   `gorm:"not null;default:false"`
+	RetiredAt *time.Time
+}
+
+type SigningKeyPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewSigningKey(kid, secret string) *SigningKey {
+	return &SigningKey{
+		KID:    kid,
+		Secret: secret,
+		Active: true,
+	}
+}
+
+func NewSigningKeyPostgresRepository(db *gorm.DB) *SigningKeyPostgresRepository {
+	return &SigningKeyPostgresRepository{
+		DB: db,
+	}
+}
+
+// RotateKey retires the current active key and makes key the active one.
+func (r *SigningKeyPostgresRepository) RotateKey(ctx context.Context, key *SigningKey) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&SigningKey{}).Where("active = ?", true).Updates(map[string]interface{}{
+			"active":     false,
+			"retired_at": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		key.Active = true
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rotate signing key: %w", err)
+	}
+
+	return nil
+}
+
+// FetchVerificationKeys returns the active key and keys retired after the
+// given time.
+func (r *SigningKeyPostgresRepository) FetchVerificationKeys(ctx context.Context, retiredAfter time.Time) ([]SigningKey, error) {
+	keys := make([]SigningKey, 0)
+	result := r.DB.WithContext(ctx).Where("active = ? OR retired_at > ?", true, retiredAfter).Order("created_at DESC").Find(&keys)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", result.Error)
+	}
+
+	return keys, nil
+}
+
+// FetchFirstKeyCreatedAt returns when the first key was rotated in, replacing
+// the fallback secret, or the zero time without keys.
+func (r *SigningKeyPostgresRepository) FetchFirstKeyCreatedAt(ctx context.Context) (time.Time, error) {
+	var createdAt sql.NullTime
+	err := r.DB.WithContext(ctx).Model(&SigningKey{}).Select("MIN(created_at)").Row().Scan(&createdAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch first signing key: %w", err)
+	}
+
+	return createdAt.Time, nil
+}
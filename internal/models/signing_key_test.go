@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewSigningKey(t *testing.T) {
+	key := NewSigningKey("kid", "secret")
+	assert.Equal(t, "kid", key.KID)
+	assert.Equal(t, "secret", key.Secret)
+	assert.True(t, key.Active)
+}
+
+func TestNewSigningKeyRepository(t *testing.T) {
+	var db *gorm.DB
+	repo := NewSigningKeyPostgresRepository(db)
+	assert.Equal(t, db, repo.DB)
+}
+
+func TestRotateKey(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &SigningKeyPostgresRepository{
+		DB: tx,
+	}
+
+	assert.NoError(t, repo.RotateKey(context.Background(), NewSigningKey("first", "secret1")))
+	assert.NoError(t, repo.RotateKey(context.Background(), NewSigningKey("second", "secret2")))
+
+	keys, err := repo.FetchVerificationKeys(context.Background(), time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "second", keys[0].KID)
+	assert.True(t, keys[0].Active)
+	assert.False(t, keys[1].Active)
+	assert.NotNil(t, keys[1].RetiredAt)
+
+	keys, err = repo.FetchVerificationKeys(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "second", keys[0].KID)
+
+	firstCreatedAt, err := repo.FetchFirstKeyCreatedAt(context.Background())
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), firstCreatedAt, time.Minute)
+}
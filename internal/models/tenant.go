@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TenantPlugin scopes the rows of models with a TenantID field to the tenant
+// in the statement context: queries, updates and deletes are filtered by it
+// and created rows are assigned to it. Statements whose context has no
+// tenant, and raw SQL, are left alone.
+type TenantPlugin struct{}
+
+func (TenantPlugin) Name() string {
+	return "tenant"
+}
+
+func (TenantPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("tenant:assign", assignTenant); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("tenant:scope", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:scope", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:scope", scopeTenant); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("tenant:scope", scopeTenant)
+}
+
+// tenantField returns the TenantID field of the statement's model and the
+// tenant of its context, or nil when either is missing.
+func tenantField(db *gorm.DB) (*schema.Field, string) {
+	if db.Statement.Schema == nil {
+		return nil, ""
+	}
+
+	field := db.Statement.Schema.LookUpField("TenantID")
+	if field == nil {
+		return nil, ""
+	}
+
+	id, ok := tenant.FromContext(db.Statement.Context)
+	if !ok {
+		return nil, ""
+	}
+
+	return field, id
+}
+
+func scopeTenant(db *gorm.DB) {
+	field, id := tenantField(db)
+	if field == nil {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+}
+
+func assignTenant(db *gorm.DB) {
+	field, id := tenantField(db)
+	if field == nil {
+		return
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			setTenant(db, field, reflect.Indirect(rv.Index(i)), id)
+		}
+	case reflect.Struct:
+		setTenant(db, field, rv, id)
+	}
+}
+
+func setTenant(db *gorm.DB, field *schema.Field, row reflect.Value, id string) {
+	ctx := db.Statement.Context
+	value, zero := field.ValueOf(ctx, row)
+	if !zero && value != id {
+		db.AddError(fmt.Errorf("cannot create a row of tenant %v in tenant %s", value, id))
+		return
+	}
+
+	if err := field.Set(ctx, row, id); err != nil {
+		db.AddError(err)
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/soicchi/auth_api/internal/logging"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// txMaxAttempts bounds how often a transaction is run when Postgres aborts it
+// with a serialization failure or a deadlock.
+const txMaxAttempts = 3
+
+// SQLSTATE codes of aborted transactions that succeed when run again.
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// TxPostgresManager runs functions in Postgres transactions. Bind builds the
+// repositories a function gets from the transaction, so that every query
+// they run is part of it.
+type TxPostgresManager[R any] struct {
+	DB   *gorm.DB
+	Bind func(tx *gorm.DB) R
+}
+
+func NewTxPostgresManager[R any](db *gorm.DB, bind func(tx *gorm.DB) R) *TxPostgresManager[R] {
+	return &TxPostgresManager[R]{
+		DB:   db,
+		Bind: bind,
+	}
+}
+
+// WithinTx commits when fn returns nil and rolls back otherwise, returning
+// the error of fn as is. Transactions are serializable, so checks such as
+// "not the last owner" hold when they commit. Transactions aborted by
+// Postgres are run again, so fn must not have effects outside the
+// repositories it is given.
+func (m *TxPostgresManager[R]) WithinTx(ctx context.Context, fn func(repos R) error) error {
+	var err error
+	for attempt := 1; attempt <= txMaxAttempts; attempt++ {
+		err = m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(m.Bind(tx))
+		}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if !isRetryableTxError(err) {
+			return err
+		}
+
+		logging.FromContext(ctx).Warn("retrying transaction", "attempt", attempt, "error", err)
+	}
+
+	return fmt.Errorf("failed to commit transaction after %d attempts: %w", txMaxAttempts, err)
+}
+
+func isRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+}
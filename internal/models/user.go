@@ -1,27 +1,96 @@
 package models
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+var (
+	ErrDuplicateEmail = errors.New("email already exists")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles lists the user roles.
+var Roles = []string{RoleUser, RoleAdmin}
+
 type User struct {
 	gorm.Model
-	Email        string       `gorm:"unique;not null;size:255"`
+	// TenantID is the user pool of the user. Emails are unique per tenant.
+	TenantID     string       `gorm:"not null;size:63;default:default;uniqueIndex:idx_users_tenant_email,priority:1"`
+	Email        string       `gorm:"not null;size:255;uniqueIndex:idx_users_tenant_email,priority:2"`
 	Password     string       `gorm:"not null;size:255"`
+	Role         string       `gorm:"not null;size:32;default:user"`
 	RefreshToken RefreshToken `gorm:"constraint:OnDelete:CASCADE"`
+	// DisabledAt is set while an admin has disabled the account.
+	DisabledAt *time.Time
+	// PasswordResetRequired blocks sign-in until the password is reset.
+	PasswordResetRequired bool `gorm:"not null;default:false"`
+	// ExternalID is the identifier a SCIM client gave the user, if any.
+	ExternalID string `gorm:"not null;size:255;default:'';index"`
+}
+
+// User list sort orders. A leading "-" sorts descending.
+const (
+	UserSortCreatedAsc  = "created_at"
+	UserSortCreatedDesc = "-created_at"
+	UserSortEmailAsc    = "email"
+	UserSortEmailDesc   = "-email"
+)
+
+// UserSorts lists the accepted UserFilter sort orders.
+var UserSorts = []string{UserSortCreatedAsc, UserSortCreatedDesc, UserSortEmailAsc, UserSortEmailDesc}
+
+// User list states, based on soft deletion.
+const (
+	UserStateActive  = "active"
+	UserStateDeleted = "deleted"
+	UserStateAll     = "all"
+)
+
+// UserStates lists the accepted UserFilter states.
+var UserStates = []string{UserStateActive, UserStateDeleted, UserStateAll}
+
+// UserFilter selects a page of users. Cursor is the opaque position returned
+// by UserCursor for the last user of the previous page and is only valid
+// with the same Sort. Zero values select active users by creation time.
+type UserFilter struct {
+	EmailPrefix  string
+	CreatedSince time.Time
+	CreatedUntil time.Time
+	State        string
+	Sort         string
+	Cursor       string
+	Limit        int
+}
+
+// userCursor is the keyset position after a user: its sort column value and
+// ID as a tiebreaker.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
 }
 
 type UserPostgresRepository struct {
 	DB *gorm.DB
 }
 
-func NewUser(email, password string, token RefreshToken) *User {
+func NewUser(email, password string) *User {
 	return &User{
-		Email:        email,
-		Password:     password,
-		RefreshToken: token,
+		Email:    email,
+		Password: password,
 	}
 }
 
@@ -31,18 +100,30 @@ func NewUserPostgresRepository(db *gorm.DB) *UserPostgresRepository {
 	}
 }
 
-func (r *UserPostgresRepository) CreateUser(user *User) (uint, error) {
-	result := r.DB.Create(user)
-	if result.Error != nil {
-		return user.ID, fmt.Errorf("failed to create user: %w", result.Error)
+// CreateUser stores the user and queues the user.created webhook in the
+// same transaction.
+func (r *UserPostgresRepository) CreateUser(ctx context.Context, user *User) (uint, error) {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return enqueueWebhookEvent(tx, user.TenantID, WebhookUserCreated, NewWebhookUser(user))
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return user.ID, ErrDuplicateEmail
+	}
+
+	if err != nil {
+		return user.ID, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return user.ID, nil
 }
 
-func (r *UserPostgresRepository) FetchUserByEmail(email string) (*User, error) {
+func (r *UserPostgresRepository) FetchUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
-	result := r.DB.Where("email = ?", email).First(&user)
+	result := r.DB.WithContext(ctx).Where("email = ?", email).First(&user)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -54,16 +135,308 @@ func (r *UserPostgresRepository) FetchUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (r *UserPostgresRepository) FetchUsers() ([]User, error) {
-	users := make([]User, 0)
-	result := r.DB.Find(&users)
+func (r *UserPostgresRepository) FetchUserByID(ctx context.Context, userID uint) (*User, error) {
+	var user User
+	result := r.DB.WithContext(ctx).First(&user, userID)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return users, nil
+		return nil, nil
 	}
 
 	if result.Error != nil {
-		return nil, fmt.Errorf("failed to fetch users: %w", result.Error)
+		return nil, fmt.Errorf("failed to fetch user: %w", result.Error)
+	}
+
+	return &user, nil
+}
+
+// UserCursor returns the cursor of the page that starts after user.
+func UserCursor(sort string, user User) string {
+	cursor := userCursor{Sort: sort, ID: user.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case UserSortEmailAsc:
+		cursor.Value = user.Email
+	default:
+		cursor.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// ParseUserCursor returns the position encoded in cursor as a user with the
+// ID and the field sort orders by set.
+func ParseUserCursor(sort, cursor string) (User, error) {
+	var user User
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return user, ErrInvalidCursor
+	}
+
+	var c userCursor
+	if err := json.Unmarshal(decoded, &c); err != nil || c.Sort != sort {
+		return user, ErrInvalidCursor
+	}
+
+	user.ID = c.ID
+	if strings.TrimPrefix(sort, "-") == UserSortEmailAsc {
+		user.Email = c.Value
+		return user, nil
+	}
+
+	user.CreatedAt, err = time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return user, ErrInvalidCursor
+	}
+
+	return user, nil
+}
+
+// FetchUsers returns a page of users ordered by filter.Sort and then by ID.
+func (r *UserPostgresRepository) FetchUsers(ctx context.Context, filter UserFilter) ([]User, error) {
+	if filter.Sort == "" {
+		filter.Sort = UserSortCreatedAsc
+	}
+
+	// The column is interpolated, so only known sorts are accepted
+	column := strings.TrimPrefix(filter.Sort, "-")
+	if column != UserSortCreatedAsc && column != UserSortEmailAsc {
+		return nil, fmt.Errorf("failed to fetch users: unknown sort %q", filter.Sort)
+	}
+
+	direction, op := "ASC", ">"
+	if strings.HasPrefix(filter.Sort, "-") {
+		direction, op = "DESC", "<"
+	}
+
+	query := r.DB.WithContext(ctx)
+	switch filter.State {
+	case UserStateDeleted:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	case UserStateAll:
+		query = query.Unscoped()
+	}
+
+	if filter.EmailPrefix != "" {
+		query = query.Where(`email LIKE ? ESCAPE '\'`, escapeLike(filter.EmailPrefix)+"%")
+	}
+	if !filter.CreatedSince.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedSince)
+	}
+	if !filter.CreatedUntil.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedUntil)
+	}
+	if filter.Cursor != "" {
+		after, err := ParseUserCursor(filter.Sort, filter.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch users: %w", err)
+		}
+
+		var value any = after.CreatedAt
+		if column == UserSortEmailAsc {
+			value = after.Email
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, op), value, after.ID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	users := make([]User, 0)
+	if err := query.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
 	}
 
 	return users, nil
 }
+
+var userQueryFields = map[string]queryField{
+	"id":          {column: "id", kind: fieldNumber},
+	"email":       {column: "email", kind: fieldTextFold},
+	"external_id": {column: "external_id", kind: fieldText},
+	"role":        {column: "role", kind: fieldText},
+	"active":      {column: "disabled_at", kind: fieldNullFlag},
+}
+
+// QueryUsers returns the users matching query in ID order and how many match
+// in total. Conditions can use the fields id, email, external_id, role and
+// active.
+func (r *UserPostgresRepository) QueryUsers(ctx context.Context, query Query) ([]User, int64, error) {
+	users := make([]User, 0)
+	total, err := runQuery(r.DB.WithContext(ctx), userQueryFields, query, &users)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// UpdateUser saves the email, external ID, role and disabled state of the
+// user and sets its UpdatedAt. Disabling or enabling the user queues the
+// user.disabled or user.enabled webhook in the same transaction.
+func (r *UserPostgresRepository) UpdateUser(ctx context.Context, user *User) error {
+	now := time.Now()
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current User
+		if err := tx.Select("id", "disabled_at").First(&current, user.ID).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"email":       user.Email,
+			"external_id": user.ExternalID,
+			"role":        user.Role,
+			"disabled_at": user.DisabledAt,
+			"updated_at":  now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if event := userStateEvent(current.DisabledAt, user.DisabledAt); event != "" {
+			return enqueueWebhookEvent(tx, user.TenantID, event, NewWebhookUser(user))
+		}
+
+		return nil
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateEmail
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	user.UpdatedAt = now
+	return nil
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// FetchAnyUserByID is FetchUserByID including soft-deleted users.
+func (r *UserPostgresRepository) FetchAnyUserByID(ctx context.Context, userID uint) (*User, error) {
+	var user User
+	result := r.DB.WithContext(ctx).Unscoped().First(&user, userID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", result.Error)
+	}
+
+	return &user, nil
+}
+
+// UpdatePassword also clears a required password reset.
+func (r *UserPostgresRepository) UpdatePassword(ctx context.Context, userID uint, hashedPassword string) error {
+	result := r.DB.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":                hashedPassword,
+		"password_reset_required": false,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update password: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to update password: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// SetDisabledAt disables the user at disabledAt, or enables it when
+// disabledAt is nil, and queues the user.disabled or user.enabled webhook in
+// the same transaction if that changes its state.
+func (r *UserPostgresRepository) SetDisabledAt(ctx context.Context, userID uint, disabledAt *time.Time) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&User{}).Where("id = ?", userID).Update("disabled_at", disabledAt).Error; err != nil {
+			return err
+		}
+
+		event := userStateEvent(user.DisabledAt, disabledAt)
+		if event == "" {
+			return nil
+		}
+
+		user.DisabledAt = disabledAt
+		return enqueueWebhookEvent(tx, user.TenantID, event, NewWebhookUser(&user))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user state: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserPostgresRepository) RequirePasswordReset(ctx context.Context, userID uint) error {
+	result := r.DB.WithContext(ctx).Model(&User{}).Where("id = ?", userID).Update("password_reset_required", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to require password reset: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to require password reset: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// DeleteUser removes the user for good, soft-deleted or not, and queues the
+// user.deleted webhook in the same transaction. Refresh tokens go with it.
+func (r *UserPostgresRepository) DeleteUser(ctx context.Context, userID uint) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Unscoped().First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(&user).Error; err != nil {
+			return err
+		}
+
+		return enqueueWebhookEvent(tx, user.TenantID, WebhookUserDeleted, NewWebhookUser(&user))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers removes at most limit users soft-deleted before
+// deletedBefore, oldest first, and returns how many were removed. Refresh
+// tokens go with them.
+func (r *UserPostgresRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	db := r.DB.WithContext(ctx)
+	batch := db.Unscoped().Model(&User{}).Select("id").Where("deleted_at < ?", deletedBefore).Order("deleted_at, id").Limit(limit)
+	result := db.Unscoped().Where("id IN (?)", batch).Delete(&User{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// RestoreUser undoes the soft deletion of the user.
+func (r *UserPostgresRepository) RestoreUser(ctx context.Context, userID uint) error {
+	result := r.DB.WithContext(ctx).Unscoped().Model(&User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", userID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore user: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to restore user: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -9,15 +10,10 @@ import (
 )
 
 func TestNewUser(t *testing.T) {
-	refreshToken := RefreshToken{
-		UserID:    0,
-		Token:     "token",
-		ExpiredAt: time.Now().Add(time.Hour * 24 * 7),
-	}
-	user := NewUser("email", "password", refreshToken)
+	user := NewUser("email", "password")
 	assert.Equal(t, "email", user.Email)
 	assert.Equal(t, "password", user.Password)
-	assert.Equal(t, refreshToken, user.RefreshToken)
+	assert.Zero(t, user.RefreshToken)
 }
 
 func TestNewUserRepository(t *testing.T) {
@@ -79,9 +75,9 @@ func TestCreateUser(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			userID, err := repo.CreateUser(test.in)
+			userID, err := repo.CreateUser(context.Background(), test.in)
 			if test.wantErr && err != nil {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrDuplicateEmail)
 			} else {
 				assert.NoError(t, err)
 				var createdUser User
@@ -141,7 +137,7 @@ func TestFetUserByEmail(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := repo.FetchUserByEmail(test.input)
+			got, err := repo.FetchUserByEmail(context.Background(), test.input)
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
 			} else if test.want != nil {
@@ -156,29 +152,127 @@ func TestFetUserByEmail(t *testing.T) {
 	}
 }
 
-func TestGetUsers(t *testing.T) {
+func TestFetchUserByID(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &UserPostgresRepository{
+		DB: tx,
+	}
+
+	user := &User{
+		Email:    "test@test.com",
+		Password: "password",
+		Role:     RoleAdmin,
+	}
+	assert.NoError(t, repo.DB.Create(user).Error)
+
+	got, err := repo.FetchUserByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "test@test.com", got.Email)
+		assert.Equal(t, RoleAdmin, got.Role)
+	}
+
+	got, err = repo.FetchUserByID(context.Background(), user.ID+1)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestFetchUsers(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &UserPostgresRepository{
+		DB: tx,
+	}
+
+	// create users a day apart, the last one deleted
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emails := []string{"a@test.com", "b_1@test.com", "bx@example.com", "c@test.com"}
+	users := make([]User, 0, len(emails))
+	for i, email := range emails {
+		user := User{Email: email, Password: "password"}
+		user.CreatedAt = base.AddDate(0, 0, i)
+		assert.NoError(t, repo.DB.Create(&user).Error)
+		users = append(users, user)
+	}
+	assert.NoError(t, repo.DB.Delete(&users[3]).Error)
+
 	tests := []struct {
-		name      string
-		wantUsers int
-		wantErr   bool
+		name       string
+		in         UserFilter
+		wantEmails []string
+		wantErr    error
 	}{
 		{
-			name:      "success getting users",
-			wantUsers: 1,
-			wantErr:   false,
+			name:       "active users by creation",
+			in:         UserFilter{},
+			wantEmails: []string{"a@test.com", "b_1@test.com", "bx@example.com"},
+		},
+		{
+			name:       "newest first",
+			in:         UserFilter{Sort: UserSortCreatedDesc, Limit: 2},
+			wantEmails: []string{"bx@example.com", "b_1@test.com"},
+		},
+		{
+			name:       "after a cursor",
+			in:         UserFilter{Sort: UserSortCreatedDesc, Cursor: UserCursor(UserSortCreatedDesc, users[1])},
+			wantEmails: []string{"a@test.com"},
+		},
+		{
+			name:       "by email after a cursor",
+			in:         UserFilter{Sort: UserSortEmailAsc, Cursor: UserCursor(UserSortEmailAsc, users[0])},
+			wantEmails: []string{"b_1@test.com", "bx@example.com"},
+		},
+		{
+			name:       "email prefix wildcards are literal",
+			in:         UserFilter{EmailPrefix: "b_"},
+			wantEmails: []string{"b_1@test.com"},
+		},
+		{
+			name:       "created range",
+			in:         UserFilter{CreatedSince: base.AddDate(0, 0, 1), CreatedUntil: base.AddDate(0, 0, 2)},
+			wantEmails: []string{"b_1@test.com"},
+		},
+		{
+			name:       "deleted users",
+			in:         UserFilter{State: UserStateDeleted},
+			wantEmails: []string{"c@test.com"},
 		},
 		{
-			name:      "no users",
-			wantUsers: 0,
-			wantErr:   false,
+			name:       "all users",
+			in:         UserFilter{State: UserStateAll, Sort: UserSortEmailDesc, Limit: 1},
+			wantEmails: []string{"c@test.com"},
 		},
 		{
-			name:      "error getting users",
-			wantUsers: 0,
-			wantErr:   true,
+			name:    "cursor of another sort",
+			in:      UserFilter{Sort: UserSortEmailAsc, Cursor: UserCursor(UserSortCreatedAsc, users[0])},
+			wantErr: ErrInvalidCursor,
 		},
 	}
 
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := repo.FetchUsers(context.Background(), test.in)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			gotEmails := make([]string, 0, len(got))
+			for _, user := range got {
+				gotEmails = append(gotEmails, user.Email)
+			}
+			assert.Equal(t, test.wantEmails, gotEmails)
+		})
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
 	// transaction
 	tx := testDB.Begin()
 	defer tx.Rollback()
@@ -187,30 +281,76 @@ func TestGetUsers(t *testing.T) {
 		DB: tx,
 	}
 
-	// create user
 	user := &User{
 		Email:    "test@test.com",
 		Password: "password",
-		RefreshToken: RefreshToken{
-			UserID:    0,
-			Token:     "token",
-			ExpiredAt: time.Now().Add(time.Hour * 24 * 7),
-		},
 	}
 	repo.DB.Create(user)
 
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			got, err := repo.FetchUsers()
-			if test.wantErr && err != nil {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, test.wantUsers, len(got))
-			}
-			if got != nil {
-				tx.Delete(got)
-			}
-		})
+	assert.NoError(t, repo.UpdatePassword(context.Background(), user.ID, "new_password"))
+
+	var updated User
+	tx.First(&updated, user.ID)
+	assert.Equal(t, "new_password", updated.Password)
+	assert.Equal(t, RoleUser, updated.Role)
+
+	assert.Error(t, repo.UpdatePassword(context.Background(), user.ID+1, "new_password"))
+}
+
+func TestUserAdminState(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	repo := &UserPostgresRepository{
+		DB: tx,
 	}
+
+	ctx := context.Background()
+	user := &User{Email: "admin-state@test.com", Password: "password"}
+	assert.NoError(t, repo.DB.Create(user).Error)
+
+	// disable and enable
+	disabledAt := time.Now()
+	assert.NoError(t, repo.SetDisabledAt(ctx, user.ID, &disabledAt))
+	got, err := repo.FetchUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got.DisabledAt)
+	assert.NoError(t, repo.SetDisabledAt(ctx, user.ID, nil))
+	got, err = repo.FetchUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got.DisabledAt)
+
+	// a required reset is cleared by the new password
+	assert.NoError(t, repo.RequirePasswordReset(ctx, user.ID))
+	got, err = repo.FetchUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.PasswordResetRequired)
+	assert.NoError(t, repo.UpdatePassword(ctx, user.ID, "new password"))
+	got, err = repo.FetchUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.PasswordResetRequired)
+
+	// soft delete and restore
+	assert.ErrorIs(t, repo.RestoreUser(ctx, user.ID), gorm.ErrRecordNotFound)
+	assert.NoError(t, repo.DB.Delete(user).Error)
+	got, err = repo.FetchUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+	got, err = repo.FetchAnyUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+	assert.NoError(t, repo.RestoreUser(ctx, user.ID))
+	got, err = repo.FetchUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+
+	// hard delete
+	assert.NoError(t, repo.DeleteUser(ctx, user.ID))
+	got, err = repo.FetchAnyUserByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+	assert.ErrorIs(t, repo.DeleteUser(ctx, user.ID), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repo.SetDisabledAt(ctx, user.ID, nil), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repo.RequirePasswordReset(ctx, user.ID), gorm.ErrRecordNotFound)
 }
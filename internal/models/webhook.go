@@ -0,0 +1,424 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotRedeliverable is returned when requeueing a delivery whose payload
+// no longer holds everything the event carried.
+var ErrNotRedeliverable = errors.New("webhook delivery cannot be redelivered")
+
+// Webhook event types.
+const (
+	WebhookUserCreated       = "user.created"
+	WebhookUserDeleted       = "user.deleted"
+	WebhookUserDisabled      = "user.disabled"
+	WebhookUserEnabled       = "user.enabled"
+	WebhookInvitationCreated = "invitation.created"
+)
+
+// WebhookEventTypes lists the event types subscriptions may ask for.
+var WebhookEventTypes = []string{
+	WebhookUserCreated,
+	WebhookUserDeleted,
+	WebhookUserDisabled,
+	WebhookUserEnabled,
+	WebhookInvitationCreated,
+}
+
+// Delivery states. A pending delivery is retried until it is delivered or
+// has failed too often and is dead-lettered.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookSubscription sends the listed event types of its tenant, separated
+// by commas, to URL. Payloads are signed with Secret.
+type WebhookSubscription struct {
+	gorm.Model
+	TenantID   string `gorm:"not null;size:63;default:default;index"`
+	URL        string `gorm:"not null;size:2048"`
+	Secret     string `gorm:"not null;size:128"`
+	EventTypes string `gorm:"not null;size:1024"`
+}
+
+// WebhookDelivery is an outbox row: one event for one subscription.
+type WebhookDelivery struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	TenantID       string `gorm:"not null;size:63;default:default;index"`
+	SubscriptionID uint   `gorm:"not null;index"`
+	EventID        string `gorm:"not null;size:64"`
+	EventType      string `gorm:"not null;size:64"`
+	Payload        string `gorm:"not null"`
+	Status         string `gorm:"not null;size:16;default:pending"`
+	Attempts       int    `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time
+	LastStatusCode int    `gorm:"not null;default:0"`
+	LastError      string `gorm:"not null;default:''"`
+	DeliveredAt    *time.Time
+	Subscription   WebhookSubscription
+}
+
+// WebhookEvent is the JSON body sent to subscribers.
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// WebhookUser is the data of user events.
+type WebhookUser struct {
+	ID        uint      `json:"id"`
+	TenantID  string    `json:"tenant_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookInvitation is the data of invitation events. Token is only ever
+// sent here: subscribers deliver it to Email, who accepts the invitation
+// with it. It is removed from the stored payload once delivered.
+type WebhookInvitation struct {
+	ID               uint      `json:"id"`
+	TenantID         string    `json:"tenant_id"`
+	OrganizationID   uint      `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// WebhookDeliveryFilter selects deliveries newest first. Cursor is the ID of
+// the last delivery of the previous page.
+type WebhookDeliveryFilter struct {
+	SubscriptionID uint
+	Status         string
+	Cursor         uint
+	Limit          int
+}
+
+type WebhookPostgresRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebhookSubscription(url, secret string, eventTypes []string) *WebhookSubscription {
+	return &WebhookSubscription{
+		URL:        url,
+		Secret:     secret,
+		EventTypes: strings.Join(eventTypes, ","),
+	}
+}
+
+func NewWebhookPostgresRepository(db *gorm.DB) *WebhookPostgresRepository {
+	return &WebhookPostgresRepository{
+		DB: db,
+	}
+}
+
+func NewWebhookEvent(eventType string, data any) (WebhookEvent, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return WebhookEvent{}, fmt.Errorf("failed to generate event id: %w", err)
+	}
+
+	return WebhookEvent{
+		ID:        "evt_" + hex.EncodeToString(id),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}, nil
+}
+
+// userStateEvent is the event for a change of the disabled state from before
+// to after, or "" if the state did not change.
+func userStateEvent(before, after *time.Time) string {
+	switch {
+	case before == nil && after != nil:
+		return WebhookUserDisabled
+	case before != nil && after == nil:
+		return WebhookUserEnabled
+	default:
+		return ""
+	}
+}
+
+func NewWebhookUser(user *User) WebhookUser {
+	return WebhookUser{
+		ID:        user.ID,
+		TenantID:  user.TenantID,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt.UTC(),
+	}
+}
+
+func NewWebhookInvitation(invitation *Invitation, token string) WebhookInvitation {
+	return WebhookInvitation{
+		ID:               invitation.ID,
+		TenantID:         invitation.TenantID,
+		OrganizationID:   invitation.OrganizationID,
+		OrganizationName: invitation.Organization.Name,
+		Email:            invitation.Email,
+		Role:             invitation.Role,
+		Token:            token,
+		ExpiresAt:        invitation.ExpiresAt.UTC(),
+	}
+}
+
+func (s *WebhookSubscription) EventTypeList() []string {
+	return strings.Split(s.EventTypes, ",")
+}
+
+func (s *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, t := range s.EventTypeList() {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enqueueWebhookEvent writes a delivery of event for every subscription of
+// tenantID to its type. Callers pass the transaction that produced the event so that
+// deliveries exist exactly when the change is committed.
+func enqueueWebhookEvent(tx *gorm.DB, tenantID, eventType string, data any) error {
+	if tenantID == "" {
+		tenantID = tenant.Default
+	}
+
+	var subscriptions []WebhookSubscription
+	if err := tx.Where("tenant_id = ?", tenantID).Find(&subscriptions).Error; err != nil {
+		return fmt.Errorf("failed to fetch webhook subscriptions: %w", err)
+	}
+
+	event, err := NewWebhookEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	deliveries := make([]WebhookDelivery, 0)
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(eventType) {
+			continue
+		}
+
+		deliveries = append(deliveries, WebhookDelivery{
+			TenantID:       tenantID,
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  event.CreatedAt,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := tx.Omit(clause.Associations).Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func (r *WebhookPostgresRepository) CreateSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	if err := r.DB.WithContext(ctx).Create(subscription).Error; err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+func (r *WebhookPostgresRepository) FetchSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	subscriptions := make([]WebhookSubscription, 0)
+	if err := r.DB.WithContext(ctx).Order("id").Find(&subscriptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes the subscription and dead-letters its pending
+// deliveries.
+func (r *WebhookPostgresRepository) DeleteSubscription(ctx context.Context, id uint) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&WebhookSubscription{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&WebhookDelivery{}).
+			Where("subscription_id = ? AND status = ?", id, DeliveryPending).
+			Updates(map[string]interface{}{"status": DeliveryDead, "last_error": "subscription deleted"}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries due at now with
+// their subscription, and postpones them by lease so that other dispatchers
+// skip them while they are being sent.
+func (r *WebhookPostgresRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	deliveries := make([]WebhookDelivery, 0)
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries)
+		if result.Error != nil || len(deliveries) == 0 {
+			return result.Error
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+
+		if err := tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error; err != nil {
+			return err
+		}
+
+		// Preloading after locking keeps FOR UPDATE off the subscriptions
+		return tx.Preload("Subscription").Where("id IN ?", ids).Order("id").Find(&deliveries).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDeliveryResult stores the outcome of a delivery attempt. Delivered
+// and dead-lettered payloads are stored without the invitation token.
+func (r *WebhookPostgresRepository) UpdateDeliveryResult(ctx context.Context, delivery *WebhookDelivery) error {
+	if delivery.Status != DeliveryPending {
+		payload, err := purgeInvitationToken(delivery.EventType, delivery.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to update webhook delivery: %w", err)
+		}
+		delivery.Payload = payload
+	}
+
+	result := r.DB.WithContext(ctx).Model(delivery).Select(
+		"status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at", "payload",
+	).Updates(delivery)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", result.Error)
+	}
+
+	return nil
+}
+
+func (r *WebhookPostgresRepository) FetchDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	deliveries := make([]WebhookDelivery, 0)
+	query := r.DB.WithContext(ctx).Where("subscription_id = ?", filter.SubscriptionID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Cursor > 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if err := query.Order("id DESC").Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RequeueDelivery makes a delivery pending again with a fresh set of
+// attempts, whatever its state. Invitation events are not requeued because
+// their token is purged once they are delivered or dead-lettered, and a new
+// token can only come from inviting again.
+func (r *WebhookPostgresRepository) RequeueDelivery(ctx context.Context, id uint, now time.Time) error {
+	db := r.DB.WithContext(ctx)
+	var delivery WebhookDelivery
+	err := db.Select("event_type").
+		Where("id = ? AND subscription_id IN (?)", id, db.Model(&WebhookSubscription{}).Select("id")).
+		First(&delivery).Error
+	if err != nil {
+		return fmt.Errorf("failed to requeue webhook delivery: %w", err)
+	}
+
+	if delivery.EventType == WebhookInvitationCreated {
+		return fmt.Errorf("failed to requeue webhook delivery: %w", ErrNotRedeliverable)
+	}
+
+	result := db.Model(&WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"last_error":      "",
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to requeue webhook delivery: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to requeue webhook delivery: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// purgeInvitationToken returns the payload of an invitation.created event
+// with its token cleared, and any other payload as is.
+func purgeInvitationToken(eventType, payload string) (string, error) {
+	if eventType != WebhookInvitationCreated {
+		return payload, nil
+	}
+
+	var invitation WebhookInvitation
+	event := WebhookEvent{Data: &invitation}
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return "", fmt.Errorf("failed to decode webhook event: %w", err)
+	}
+
+	invitation.Token = ""
+	purged, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	return string(purged), nil
+}
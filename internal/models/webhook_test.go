@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewWebhookRepository(t *testing.T) {
+	var db *gorm.DB
+	repo := NewWebhookPostgresRepository(db)
+	assert.Equal(t, db, repo.DB)
+}
+
+func TestWebhookSubscriptionSubscribes(t *testing.T) {
+	subscription := NewWebhookSubscription("https://example.com/hook", "secret", []string{"user.deleted", WebhookUserCreated})
+	assert.Equal(t, []string{"user.deleted", WebhookUserCreated}, subscription.EventTypeList())
+	assert.True(t, subscription.Subscribes(WebhookUserCreated))
+	assert.False(t, subscription.Subscribes("user.locked"))
+}
+
+func TestCreateUserEnqueuesWebhook(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	webhookRepo := &WebhookPostgresRepository{DB: tx}
+	subscribed := NewWebhookSubscription("https://example.com/a", "secret", []string{WebhookUserCreated})
+	other := NewWebhookSubscription("https://example.com/b", "secret", []string{"user.deleted"})
+	assert.NoError(t, webhookRepo.CreateSubscription(ctx, subscribed))
+	assert.NoError(t, webhookRepo.CreateSubscription(ctx, other))
+
+	userRepo := &UserPostgresRepository{DB: tx}
+	user := NewUser("webhook@test.com", "password")
+	userID, err := userRepo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+
+	deliveries, err := webhookRepo.FetchDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: subscribed.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, DeliveryPending, deliveries[0].Status)
+
+		var event struct {
+			Type string      `json:"type"`
+			Data WebhookUser `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), &event))
+		assert.Equal(t, WebhookUserCreated, event.Type)
+		assert.Equal(t, userID, event.Data.ID)
+		assert.Equal(t, "webhook@test.com", event.Data.Email)
+	}
+
+	deliveries, err = webhookRepo.FetchDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: other.ID})
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestUserStateChangesEnqueueWebhooks(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	webhookRepo := &WebhookPostgresRepository{DB: tx}
+	subscription := NewWebhookSubscription("https://example.com/hook", "secret", []string{WebhookUserDeleted, WebhookUserDisabled, WebhookUserEnabled})
+	assert.NoError(t, webhookRepo.CreateSubscription(ctx, subscription))
+
+	userRepo := &UserPostgresRepository{DB: tx}
+	user := NewUser("state@test.com", "password")
+	userID, err := userRepo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+
+	disabledAt := time.Now()
+	assert.NoError(t, userRepo.SetDisabledAt(ctx, userID, &disabledAt))
+	// Disabling a disabled user changes nothing
+	assert.NoError(t, userRepo.SetDisabledAt(ctx, userID, &disabledAt))
+	assert.NoError(t, userRepo.SetDisabledAt(ctx, userID, nil))
+
+	user.DisabledAt = &disabledAt
+	assert.NoError(t, userRepo.UpdateUser(ctx, user))
+	assert.NoError(t, userRepo.DeleteUser(ctx, userID))
+
+	deliveries, err := webhookRepo.FetchDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: subscription.ID})
+	assert.NoError(t, err)
+
+	// Deliveries are listed newest first
+	want := []string{WebhookUserDeleted, WebhookUserDisabled, WebhookUserEnabled, WebhookUserDisabled}
+	if assert.Len(t, deliveries, len(want)) {
+		for i, delivery := range deliveries {
+			assert.Equal(t, want[i], delivery.EventType)
+
+			var event struct {
+				Data WebhookUser `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal([]byte(delivery.Payload), &event))
+			assert.Equal(t, userID, event.Data.ID)
+		}
+	}
+}
+
+func TestClaimDueDeliveries(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	repo := &WebhookPostgresRepository{DB: tx}
+	subscription := NewWebhookSubscription("https://example.com/hook", "secret", []string{WebhookUserCreated})
+	assert.NoError(t, repo.CreateSubscription(ctx, subscription))
+	assert.NoError(t, enqueueWebhookEvent(tx, tenant.Default, WebhookUserCreated, WebhookUser{ID: 1}))
+
+	now := time.Now().Add(time.Second)
+	deliveries, err := repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, subscription.URL, deliveries[0].Subscription.URL)
+	}
+
+	// Claimed deliveries are not due again until the lease ends
+	deliveries, err = repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	deliveries, err = repo.ClaimDueDeliveries(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+}
+
+func TestRequeueAndDeleteSubscription(t *testing.T) {
+	// transaction
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	repo := &WebhookPostgresRepository{DB: tx}
+	subscription := NewWebhookSubscription("https://example.com/hook", "secret", []string{WebhookUserCreated})
+	assert.NoError(t, repo.CreateSubscription(ctx, subscription))
+	assert.NoError(t, enqueueWebhookEvent(tx, tenant.Default, WebhookUserCreated, WebhookUser{ID: 1}))
+
+	deliveries, err := repo.FetchDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: subscription.ID})
+	assert.NoError(t, err)
+	if !assert.Len(t, deliveries, 1) {
+		return
+	}
+
+	delivery := deliveries[0]
+	delivery.Status = DeliveryDead
+	delivery.Attempts = 8
+	delivery.LastError = "timeout"
+	assert.NoError(t, repo.UpdateDeliveryResult(ctx, &delivery))
+	assert.NoError(t, repo.RequeueDelivery(ctx, delivery.ID, time.Now()))
+
+	deliveries, err = repo.FetchDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: subscription.ID, Status: DeliveryPending})
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, 0, deliveries[0].Attempts)
+		assert.Empty(t, deliveries[0].LastError)
+	}
+
+	assert.NoError(t, repo.DeleteSubscription(ctx, subscription.ID))
+	deliveries, err = repo.FetchDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: subscription.ID, Status: DeliveryDead})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+
+	assert.ErrorIs(t, repo.DeleteSubscription(ctx, subscription.ID), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repo.RequeueDelivery(ctx, delivery.ID, time.Now()), gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,226 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingMethods are the ID token algorithms accepted. HMAC is left out: it
+// would verify tokens with the client secret, which the provider is not the
+// only one to know.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// keyRefreshInterval limits how often tokens signed by unknown keys make the
+// key set be fetched again.
+const keyRefreshInterval = time.Minute
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// keySet caches the signing keys a provider publishes at its JWKS endpoint.
+// Keys are fetched again when a token names one that is not cached, so that
+// key rotations are picked up.
+type keySet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func newKeySet(url string, client *http.Client) *keySet {
+	return &keySet{
+		url:    url,
+		client: client,
+	}
+}
+
+// key returns the public key with the given ID for method. Tokens without a
+// key ID are accepted when the set has a single key of the right type.
+func (s *keySet) key(ctx context.Context, kid string, method jwt.SigningMethod) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.lookup(kid, method)
+	if !errors.Is(err, errUnknownKey) || time.Since(s.fetchedAt) < keyRefreshInterval {
+		return key, err
+	}
+
+	if err := s.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.lookup(kid, method)
+}
+
+func (s *keySet) lookup(kid string, method jwt.SigningMethod) (interface{}, error) {
+	var key interface{}
+	if kid != "" {
+		key = s.keys[kid]
+	} else {
+		for _, candidate := range s.keys {
+			if matchesMethod(candidate, method) {
+				if key != nil {
+					return nil, fmt.Errorf("%w: the token names no key and several match", errUnknownKey)
+				}
+				key = candidate
+			}
+		}
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+
+	if !matchesMethod(key, method) {
+		return nil, fmt.Errorf("key %q cannot verify %s", kid, method.Alg())
+	}
+
+	return key, nil
+}
+
+func (s *keySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := doJSON(s.client, req, &set); err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// One malformed key does not prevent using the others
+			continue
+		}
+
+		kid := jwk.KeyID
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var checked ecdh.Curve
+		switch k.Curve {
+		case "P-256":
+			curve, checked = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, checked = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, checked = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parsing the uncompressed point rejects points off the curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid %s coordinates", k.Curve)
+		}
+		if _, err := checked.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func matchesMethod(key interface{}, method jwt.SigningMethod) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+		return ok
+	}
+
+	return false
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,453 @@
+// Package oidc is a client of the identity providers users sign in with:
+// OpenID Connect providers, whose ID tokens are validated against their
+// JWKS, and plain OAuth 2.0 providers such as GitHub, whose accounts are read
+// from a userinfo endpoint.
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDiscovery      = errors.New("provider discovery failed")
+	ErrExchange       = errors.New("code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUserInfo       = errors.New("userinfo request failed")
+)
+
+// maxResponseSize bounds the responses read from providers.
+const maxResponseSize = 1 << 20
+
+// idTokenLeeway is the clock skew tolerated on ID token times.
+const idTokenLeeway = time.Minute
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// Config describes a provider. The endpoints left empty are discovered from
+// Issuer, which also names the accounts of the provider. Providers with a
+// JWKS endpoint sign users in with ID tokens; the others must have a
+// userinfo endpoint, whose SubjectClaim and EmailClaim fields name the
+// account.
+type Config struct {
+	// Name identifies the provider in URLs and identities, such as google.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes default to openid, email and profile.
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	JWKSURL      string
+	SubjectClaim string
+	EmailClaim   string
+}
+
+// Identity is the account at a provider a user signed in with.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider signs users in with one identity provider. It discovers the
+// endpoints of the provider on first use and caches its signing keys.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints *endpoints
+	keys      *keySet
+}
+
+// endpoints are the configured endpoints completed by discovery.
+type endpoints struct {
+	AuthURL     string   `json:"authorization_endpoint"`
+	TokenURL    string   `json:"token_endpoint"`
+	UserInfoURL string   `json:"userinfo_endpoint"`
+	JWKSURL     string   `json:"jwks_uri"`
+	AuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+}
+
+// flexBool is a boolean claim that some providers send as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = flexBool(strings.EqualFold(s, "true"))
+		return nil
+	}
+
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = flexBool(v)
+	return nil
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Provider{
+		config: config,
+		client: client,
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL is where the user is sent to sign in. The provider redirects
+// back with a code for Identify and the state, and puts the nonce in the ID
+// token. verifier is the PKCE code verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(endpoints.AuthURL, "?") {
+		separator = "&"
+	}
+
+	return endpoints.AuthURL + separator + query.Encode(), nil
+}
+
+// Identify exchanges the code the provider redirected back with for the
+// account that signed in. The ID token, if the provider issues them, must
+// carry nonce.
+func (p *Provider) Identify(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := p.exchange(ctx, endpoints, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoints.JWKSURL == "" {
+		return p.userInfoIdentity(ctx, endpoints, tokens.AccessToken)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: the token response has no id token", ErrInvalidIDToken)
+	}
+
+	claims, err := p.verifyIDToken(ctx, endpoints, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Issuer:        p.config.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+	}
+
+	// Some providers only put the email in the userinfo response
+	if identity.Email == "" && endpoints.UserInfoURL != "" && tokens.AccessToken != "" {
+		info, err := p.userInfoIdentity(ctx, endpoints, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Subject != identity.Subject {
+			return nil, fmt.Errorf("%w: the userinfo subject does not match the id token", ErrUserInfo)
+		}
+		identity.Email = info.Email
+		identity.EmailVerified = info.EmailVerified
+	}
+
+	return identity, nil
+}
+
+// discover completes the configured endpoints from the discovery document of
+// the issuer, once it has been read successfully.
+func (p *Provider) discover(ctx context.Context) (*endpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	discovered := endpoints{
+		AuthURL:     p.config.AuthURL,
+		TokenURL:    p.config.TokenURL,
+		UserInfoURL: p.config.UserInfoURL,
+		JWKSURL:     p.config.JWKSURL,
+	}
+	manual := discovered.AuthURL != "" && discovered.TokenURL != "" && (discovered.JWKSURL != "" || discovered.UserInfoURL != "")
+	if !manual {
+		document, err := p.fetchDiscovery(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		discovered.AuthURL = firstNonEmpty(discovered.AuthURL, document.AuthURL)
+		discovered.TokenURL = firstNonEmpty(discovered.TokenURL, document.TokenURL)
+		discovered.UserInfoURL = firstNonEmpty(discovered.UserInfoURL, document.UserInfoURL)
+		discovered.JWKSURL = firstNonEmpty(discovered.JWKSURL, document.JWKSURL)
+		discovered.AuthMethods = document.AuthMethods
+	}
+
+	if discovered.AuthURL == "" || discovered.TokenURL == "" {
+		return nil, fmt.Errorf("%w: %s has no authorization or token endpoint", ErrDiscovery, p.config.Name)
+	}
+
+	if discovered.JWKSURL == "" && discovered.UserInfoURL == "" {
+		return nil, fmt.Errorf("%w: %s has neither a jwks nor a userinfo endpoint", ErrDiscovery, p.config.Name)
+	}
+
+	if discovered.JWKSURL != "" {
+		p.keys = newKeySet(discovered.JWKSURL, p.client)
+	}
+	p.endpoints = &discovered
+	return p.endpoints, nil
+}
+
+func (p *Provider) fetchDiscovery(ctx context.Context) (*endpoints, error) {
+	if p.config.Issuer == "" {
+		return nil, fmt.Errorf("%w: %s has no issuer to discover endpoints from", ErrDiscovery, p.config.Name)
+	}
+
+	var document struct {
+		endpoints
+		Issuer string `json:"issuer"`
+	}
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, "", &document); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+
+	// A document naming another issuer could vouch for its tokens
+	if document.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: the document is for issuer %q", ErrDiscovery, document.Issuer)
+	}
+
+	return &document.endpoints, nil
+}
+
+func (p *Provider) exchange(ctx context.Context, endpoints *endpoints, code, verifier string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.config.ClientID},
+	}
+
+	// Providers must accept HTTP Basic client authentication unless their
+	// metadata says otherwise; plain OAuth 2.0 providers often only take
+	// the secret in the form.
+	basic := slices.Contains(endpoints.AuthMethods, "client_secret_basic") ||
+		(len(endpoints.AuthMethods) == 0 && endpoints.JWKSURL != "")
+	if !basic {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens tokenResponse
+	if err := doJSON(p.client, req, &tokens); err != nil && tokens.Error == "" {
+		return nil, fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, tokens.Error, tokens.ErrorDescription)
+	}
+
+	if tokens.AccessToken == "" {
+		return nil, fmt.Errorf("%w: the token response has no access token", ErrExchange)
+	}
+
+	return &tokens, nil
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, endpoints *endpoints, raw, nonce string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid, token.Method)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: the token has no expiration", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: the token has no subject", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: the nonce does not match", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: the token was issued to %s", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+
+	return &claims, nil
+}
+
+// userInfoIdentity reads the account from the userinfo endpoint.
+func (p *Provider) userInfoIdentity(ctx context.Context, endpoints *endpoints, accessToken string) (*Identity, error) {
+	if endpoints.UserInfoURL == "" {
+		return nil, fmt.Errorf("%w: %s has no userinfo endpoint", ErrUserInfo, p.config.Name)
+	}
+
+	var info map[string]interface{}
+	if err := p.getJSON(ctx, endpoints.UserInfoURL, accessToken, &info); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserInfo, err)
+	}
+
+	subject := claimString(info, firstNonEmpty(p.config.SubjectClaim, "sub"))
+	if subject == "" {
+		return nil, fmt.Errorf("%w: the response has no subject", ErrUserInfo)
+	}
+
+	var verified flexBool
+	if raw, err := json.Marshal(info["email_verified"]); err == nil {
+		_ = verified.UnmarshalJSON(raw)
+	}
+
+	return &Identity{
+		Issuer:        p.config.Issuer,
+		Subject:       subject,
+		Email:         claimString(info, firstNonEmpty(p.config.EmailClaim, "email")),
+		EmailVerified: bool(verified),
+	}, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url, accessToken string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	return doJSON(p.client, req, dest)
+}
+
+// doJSON decodes the response into dest, also when it is an error response,
+// since token endpoints describe their errors in JSON.
+func doJSON(client *http.Client, req *http.Request, dest interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	decodeErr := decoder.Decode(dest)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", req.URL.Redacted(), resp.StatusCode)
+	}
+
+	if decodeErr != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", req.URL.Redacted(), decodeErr)
+	}
+
+	return nil
+}
+
+// claimString returns a string or numeric claim, such as the numeric user
+// IDs of GitHub, as a string.
+func claimString(claims map[string]interface{}, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,202 @@
+package oidc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/oidc"
+	"github.com/soicchi/auth_api/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRedirectURL = "https://auth.example.com/api/v1/oidc/test/callback"
+
+func TestProviderIdentify(t *testing.T) {
+	account := oidctest.Account{Subject: "alice", Email: "alice@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name   string
+		plain  bool
+		mutate func(claims jwt.MapClaims)
+		// nonce is the nonce expected in the ID token, when it differs from
+		// the one sent to the provider
+		nonce   string
+		account oidctest.Account
+		want    *oidc.Identity
+		wantErr error
+	}{
+		{
+			name:    "openid connect provider",
+			account: account,
+			want:    &oidc.Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name:    "plain oauth2 provider with numeric ids",
+			plain:   true,
+			account: oidctest.Account{Subject: "583231", Email: "octocat@example.com", EmailVerified: true},
+			want:    &oidc.Identity{Subject: "583231", Email: "octocat@example.com"},
+		},
+		{
+			name:    "email only in userinfo",
+			mutate:  func(claims jwt.MapClaims) { delete(claims, "email"); delete(claims, "email_verified") },
+			account: account,
+			want:    &oidc.Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name:    "email verified sent as a string",
+			mutate:  func(claims jwt.MapClaims) { claims["email_verified"] = "true" },
+			account: account,
+			want:    &oidc.Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name:    "nonce mismatch",
+			nonce:   "another-nonce",
+			account: account,
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "token for another client",
+			mutate:  func(claims jwt.MapClaims) { claims["aud"] = "another-client" },
+			account: account,
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "token from another issuer",
+			mutate:  func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+			account: account,
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "expired token",
+			mutate:  func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			account: account,
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "token without expiration",
+			mutate:  func(claims jwt.MapClaims) { delete(claims, "exp") },
+			account: account,
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newIdP := oidctest.New
+			if test.plain {
+				newIdP = oidctest.NewPlain
+			}
+			idp := newIdP()
+			defer idp.Close()
+			idp.Mutate = test.mutate
+
+			provider := oidc.NewProvider(idp.Config("test", testRedirectURL), nil)
+			state, err := oidc.NewLoginState("test", "")
+			assert.NoError(t, err)
+
+			authURL, err := provider.AuthCodeURL(context.Background(), state.State, state.Nonce, state.Verifier)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(authURL, idp.Issuer()+"/authorize?"))
+
+			callback, err := idp.Approve(authURL, test.account)
+			assert.NoError(t, err)
+			assert.Equal(t, state.State, callback.Query().Get("state"))
+
+			nonce := state.Nonce
+			if test.nonce != "" {
+				nonce = test.nonce
+			}
+			got, err := provider.Identify(context.Background(), callback.Query().Get("code"), state.Verifier, nonce)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			test.want.Issuer = idp.Issuer()
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestProviderIdentifyCode(t *testing.T) {
+	idp := oidctest.New()
+	defer idp.Close()
+
+	provider := oidc.NewProvider(idp.Config("test", testRedirectURL), nil)
+	state, err := oidc.NewLoginState("test", "")
+	assert.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state.State, state.Nonce, state.Verifier)
+	assert.NoError(t, err)
+	callback, err := idp.Approve(authURL, oidctest.Account{Subject: "alice"})
+	assert.NoError(t, err)
+	code := callback.Query().Get("code")
+
+	// A wrong verifier burns the code, like an intercepted code would
+	_, err = provider.Identify(context.Background(), code, "wrong-verifier", state.Nonce)
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+
+	_, err = provider.Identify(context.Background(), code, state.Verifier, state.Nonce)
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestProviderDiscovery(t *testing.T) {
+	idp := oidctest.New()
+	defer idp.Close()
+
+	config := idp.Config("test", testRedirectURL)
+	config.Issuer = idp.Issuer() + "/other"
+	provider := oidc.NewProvider(config, nil)
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.ErrorIs(t, err, oidc.ErrDiscovery)
+}
+
+func TestLoginState(t *testing.T) {
+	key := oidc.StateKey("test_secret")
+	state, err := oidc.NewLoginState("google", "acme")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, state.State)
+	assert.NotEqual(t, state.State, state.Nonce)
+	assert.NotEqual(t, state.Nonce, state.Verifier)
+
+	sealed, err := state.Seal(key, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	expired, err := state.Seal(key, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	// Tokens signed with the secret itself are not login states
+	unsealed, err := state.Seal([]byte("test_secret"), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		sealed  string
+		want    oidc.LoginState
+		wantErr bool
+	}{
+		{name: "sealed state", sealed: sealed, want: state},
+		{name: "expired state", sealed: expired, wantErr: true},
+		{name: "tampered state", sealed: sealed[:len(sealed)-2] + "xx", wantErr: true},
+		{name: "state sealed with another key", sealed: unsealed, wantErr: true},
+		{name: "not a state", sealed: "garbage", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := oidc.OpenLoginState(key, test.sealed)
+			if test.wantErr {
+				assert.ErrorIs(t, err, oidc.ErrInvalidState)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -0,0 +1,326 @@
+// Package oidctest is an in-process identity provider for tests. It speaks
+// enough OpenID Connect, or plain OAuth 2.0 in the style of GitHub, for the
+// sign-in flow of package oidc: discovery, the code grant with PKCE, signed
+// ID tokens, the JWKS and userinfo.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+)
+
+// Account is a user of the provider.
+type Account struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// IdP is a running provider. Its issuer is the URL of its server.
+type IdP struct {
+	Server *httptest.Server
+	// Plain makes it an OAuth 2.0 provider without discovery or ID tokens,
+	// whose userinfo names accounts by a numeric id field.
+	Plain bool
+	// Mutate, when set, changes the claims of the ID tokens issued, so that
+	// tests can check how bad tokens are rejected.
+	Mutate func(claims jwt.MapClaims)
+
+	mu           sync.Mutex
+	key          *rsa.PrivateKey
+	keyID        string
+	grants       map[string]grant
+	accessTokens map[string]Account
+}
+
+type grant struct {
+	account     Account
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// New starts an OpenID Connect provider. Close stops it.
+func New() *IdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate key: %v", err))
+	}
+
+	idp := &IdP{
+		key:          key,
+		keyID:        "key-1",
+		grants:       make(map[string]grant),
+		accessTokens: make(map[string]Account),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", idp.userInfo)
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+// NewPlain starts a plain OAuth 2.0 provider.
+func NewPlain() *IdP {
+	idp := New()
+	idp.Plain = true
+	return idp
+}
+
+func (i *IdP) Close() {
+	i.Server.Close()
+}
+
+func (i *IdP) Issuer() string {
+	return i.Server.URL
+}
+
+// Config is the configuration of a client of the provider redirected back to
+// redirectURL.
+func (i *IdP) Config(name, redirectURL string) oidc.Config {
+	config := oidc.Config{
+		Name:         name,
+		Issuer:       i.Issuer(),
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+	if i.Plain {
+		config.AuthURL = i.Issuer() + "/authorize"
+		config.TokenURL = i.Issuer() + "/token"
+		config.UserInfoURL = i.Issuer() + "/userinfo"
+		config.SubjectClaim = "id"
+		config.Scopes = []string{"user:email"}
+	}
+
+	return config
+}
+
+// Approve signs account in at the authorization URL a client sent the user
+// to, and returns the URL the provider redirects the user back to.
+func (i *IdP) Approve(authURL string, account Account) (*url.URL, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	switch {
+	case query.Get("client_id") != ClientID:
+		return nil, fmt.Errorf("unknown client %q", query.Get("client_id"))
+	case query.Get("response_type") != "code":
+		return nil, fmt.Errorf("unsupported response type %q", query.Get("response_type"))
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return nil, fmt.Errorf("missing S256 code challenge")
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		return nil, fmt.Errorf("invalid redirect uri %q", query.Get("redirect_uri"))
+	}
+
+	code := randomString()
+	i.mu.Lock()
+	i.grants[code] = grant{
+		account:     account,
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	callback := redirect.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirect.RawQuery = callback.Encode()
+	return redirect, nil
+}
+
+func (i *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	if i.Plain {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.Issuer(),
+		"authorization_endpoint":                i.Issuer() + "/authorize",
+		"token_endpoint":                        i.Issuer() + "/token",
+		"userinfo_endpoint":                     i.Issuer() + "/userinfo",
+		"jwks_uri":                              i.Issuer() + "/jwks",
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	key, keyID := i.key.PublicKey, i.keyID
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != ClientID || secret != ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	// Codes are used once, whether the exchange succeeds or not
+	i.mu.Lock()
+	code := r.PostForm.Get("code")
+	grant, found := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type")
+		return
+	case !found || grant.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	accessToken := randomString()
+	i.mu.Lock()
+	i.accessTokens[accessToken] = grant.account
+	i.mu.Unlock()
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if !i.Plain {
+		idToken, err := i.idToken(grant)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (i *IdP) idToken(grant grant) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            i.Issuer(),
+		"aud":            ClientID,
+		"sub":            grant.account.Subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.account.Email,
+		"email_verified": grant.account.EmailVerified,
+	}
+	if i.Mutate != nil {
+		i.Mutate(claims)
+	}
+
+	i.mu.Lock()
+	key, keyID := i.key, i.keyID
+	i.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(key)
+}
+
+func (i *IdP) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	i.mu.Lock()
+	account, found := i.accessTokens[accessToken]
+	i.mu.Unlock()
+	if !ok || !found {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if i.Plain {
+		// GitHub names accounts by number and leaves out email_verified
+		var id interface{} = account.Subject
+		if n, err := strconv.ParseInt(account.Subject, 10, 64); err == nil {
+			id = n
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "email": account.Email})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            account.Subject,
+		"email":          account.Email,
+		"email_verified": account.EmailVerified,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate random string: %v", err))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidState = errors.New("invalid login state")
+
+// stateAudience keeps sealed login states from being mistaken for other
+// tokens signed with the same key.
+const stateAudience = "oidc-login-state"
+
+// LoginState is what a sign-in remembers while the user is at the provider:
+// the state the provider must hand back, the nonce it must put in the ID
+// token and the PKCE code verifier. It is kept in the browser, sealed.
+type LoginState struct {
+	Provider string `json:"provider"`
+	Tenant   string `json:"tid,omitempty"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// Link is the user the account is being linked to, zero when signing in.
+	Link uint `json:"link,omitempty"`
+}
+
+type loginStateClaims struct {
+	jwt.RegisteredClaims
+	LoginState
+}
+
+// NewLoginState starts a sign-in with provider for a user of tenant.
+func NewLoginState(provider, tenant string) (LoginState, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return LoginState{}, fmt.Errorf("failed to generate login state: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return LoginState{
+		Provider: provider,
+		Tenant:   tenant,
+		State:    values[0],
+		Nonce:    values[1],
+		Verifier: values[2],
+	}, nil
+}
+
+// StateKey derives the key login states are sealed with from a server
+// secret, so that sealed states cannot pass for tokens signed with it.
+func StateKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stateAudience))
+	return mac.Sum(nil)
+}
+
+// Seal signs the state so that it can be handed to the browser until
+// expiresAt.
+func (s LoginState) Seal(key []byte, expiresAt time.Time) (string, error) {
+	claims := loginStateClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{stateAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		LoginState: s,
+	}
+
+	sealed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal login state: %w", err)
+	}
+
+	return sealed, nil
+}
+
+// OpenLoginState returns the state sealed with key, unless it was tampered
+// with or has expired.
+func OpenLoginState(key []byte, sealed string) (LoginState, error) {
+	var claims loginStateClaims
+	_, err := jwt.ParseWithClaims(sealed, &claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(stateAudience))
+	if err != nil {
+		return LoginState{}, fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+
+	if claims.ExpiresAt == nil || claims.State == "" {
+		return LoginState{}, fmt.Errorf("%w: incomplete state", ErrInvalidState)
+	}
+
+	return claims.LoginState, nil
+}
+
+// codeChallenge is the S256 PKCE challenge of verifier.
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -1,21 +1,50 @@
 package routes
 
 import (
+	"log/slog"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/controllers"
 	"github.com/soicchi/auth_api/internal/middleware"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(db *gorm.DB) *echo.Echo {
+func SetupRoutes(db *gorm.DB, cfg *config.Config, keys *utils.Keyring, logger *slog.Logger) (*echo.Echo, error) {
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = utils.HTTPErrorHandler
+
+	validator := utils.NewCustomValidator()
+	validator.AllowedEmailDomains = cfg.Signup.AllowedEmailDomains
+	e.Validator = validator
 
 	// Initialize base middleware
-	middleware.InitializeMiddleware(e)
+	middleware.InitializeMiddleware(e, logger)
+
+	// Probes stay outside the versioned API and need no credentials
+	healthService := usecase.NewHealthServiceImpl(models.NewHealthPostgresRepository(db), keys)
+	healthHandler := controllers.NewHealthHandler(healthService)
+	e.GET("/healthz", healthHandler.Healthz)
+	e.GET("/readyz", healthHandler.Readyz)
+
+	// Setup v1 routes, scoped to the tenant of the request
+	prefix := "/api/v1"
+	if cfg.Tenancy.Resolver == "path" {
+		prefix = "/t/:" + middleware.TenantParam + prefix
+	}
+	v1 := e.Group(prefix, middleware.NewTenant(cfg.Tenancy))
+	if err := setupV1Routes(v1, db, cfg, keys); err != nil {
+		return nil, err
+	}
 
-	// Setup v1 routes
-	v1 := e.Group("/api/v1")
-	setupV1Routes(v1, db)
+	// SCIM clients are bound to a tenant by their token
+	setupSCIMRoutes(e, db)
 
-	return e
+	return e, nil
 }
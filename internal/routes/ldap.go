@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/ldapauth"
+	"github.com/soicchi/auth_api/internal/usecase"
+)
+
+// newCredentialVerifier checks passwords against the directory when one is
+// configured, and against the users table otherwise.
+func newCredentialVerifier(cfg config.LDAPConfig, users usecase.UserRepository, audit usecase.AuditRecorder) usecase.CredentialVerifier {
+	if !cfg.Enabled {
+		return &usecase.PasswordVerifier{Users: users}
+	}
+
+	directory := ldapauth.NewDirectory(ldapauth.Config{
+		URL:             cfg.URL,
+		StartTLS:        cfg.StartTLS,
+		Timeout:         cfg.Timeout,
+		BindDN:          cfg.BindDN,
+		BindPassword:    cfg.BindPassword,
+		UserDNTemplates: cfg.UserDNTemplates,
+		BaseDN:          cfg.BaseDN,
+		UserFilter:      cfg.UserFilter,
+		EmailAttribute:  cfg.EmailAttribute,
+		GroupAttribute:  cfg.GroupAttribute,
+	})
+	return usecase.NewLDAPVerifier(directory, users, audit, cfg.GroupRoles, cfg.DisableSignup)
+}
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/config"
+	"github.com/soicchi/auth_api/internal/oidc"
+	"github.com/soicchi/auth_api/internal/usecase"
+)
+
+// oidcTimeout bounds each request to an identity provider.
+const oidcTimeout = 10 * time.Second
+
+func newFederatedProviders(cfg config.OIDCConfig) []usecase.FederatedProvider {
+	client := &http.Client{Timeout: oidcTimeout}
+	providers := make([]usecase.FederatedProvider, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		providers = append(providers, usecase.FederatedProvider{
+			Name: p.Name,
+			Client: oidc.NewProvider(oidc.Config{
+				Name:         p.Name,
+				Issuer:       p.Issuer,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURL:  p.RedirectURL,
+				Scopes:       p.Scopes,
+				AuthURL:      p.AuthURL,
+				TokenURL:     p.TokenURL,
+				UserInfoURL:  p.UserInfoURL,
+				JWKSURL:      p.JWKSURL,
+				SubjectClaim: p.SubjectClaim,
+				EmailClaim:   p.EmailClaim,
+			}, client),
+			DisableSignup:     p.DisableSignup,
+			LinkVerifiedEmail: p.LinkVerifiedEmail,
+		})
+	}
+
+	return providers
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"github.com/soicchi/auth_api/internal/controllers"
+	"github.com/soicchi/auth_api/internal/middleware"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/usecase"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// setupSCIMRoutes serves SCIM provisioning. The tenant comes from the bearer
+// token rather than the request.
+func setupSCIMRoutes(e *echo.Echo, db *gorm.DB) {
+	auditService := usecase.NewAuditServiceImpl(models.NewAuditEventPostgresRepository(db))
+	scimTokenService := usecase.NewSCIMTokenServiceImpl(models.NewSCIMTokenPostgresRepository(db), auditService)
+
+	tx := models.NewTxPostgresManager(db, func(tx *gorm.DB) usecase.TxRepositories {
+		return usecase.TxRepositories{
+			Users:         models.NewUserPostgresRepository(tx),
+			Tokens:        models.NewRefreshTokenPostgresRepository(tx),
+			Organizations: models.NewOrganizationPostgresRepository(tx),
+			Identities:    models.NewIdentityPostgresRepository(tx),
+		}
+	})
+	scimService := usecase.NewSCIMServiceImpl(models.NewUserPostgresRepository(db), models.NewOrganizationPostgresRepository(db), tx, auditService)
+	scimHandler := controllers.NewSCIMHandler(scimService)
+
+	g := e.Group(controllers.SCIMPrefix, middleware.NewSCIMErrors(), middleware.NewSCIMAuth(scimTokenService))
+	g.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+
+	g.GET("/Users", scimHandler.ListUsers)
+	g.POST("/Users", scimHandler.CreateUser)
+	g.GET("/Users/:id", scimHandler.FetchUser)
+	g.PUT("/Users/:id", scimHandler.ReplaceUser)
+	g.PATCH("/Users/:id", scimHandler.PatchUser)
+	g.DELETE("/Users/:id", scimHandler.DeleteUser)
+
+	g.GET("/Groups", scimHandler.ListGroups)
+	g.POST("/Groups", scimHandler.CreateGroup)
+	g.GET("/Groups/:id", scimHandler.FetchGroup)
+	g.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+	g.PATCH("/Groups/:id", scimHandler.PatchGroup)
+	g.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+}
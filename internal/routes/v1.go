@@ -1,39 +1,133 @@
 package routes
 
 import (
+	"net/http"
+
+	"github.com/soicchi/auth_api/internal/config"
 	"github.com/soicchi/auth_api/internal/controllers"
 	"github.com/soicchi/auth_api/internal/middleware"
 	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/oidc"
 	"github.com/soicchi/auth_api/internal/usecase"
+	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-func setupV1Routes(v1 *echo.Group, db *gorm.DB) {
+func setupV1Routes(v1 *echo.Group, db *gorm.DB, cfg *config.Config, keys *utils.Keyring) error {
+	sameSite, err := cfg.Cookie.SameSiteMode()
+	if err != nil {
+		return err
+	}
+
+	cookie := utils.CookieOptions{
+		Secure:   cfg.Cookie.Secure,
+		SameSite: sameSite,
+		Domain:   cfg.Cookie.Domain,
+	}
+
+	tokens := utils.NewTokenIssuer(keys, utils.TokenSettings{
+		Issuer:          cfg.Auth.Issuer,
+		Audience:        cfg.Auth.Audience,
+		AccessTokenTTL:  cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL: cfg.Auth.RefreshTokenTTL,
+	})
+
+	auditService := usecase.NewAuditServiceImpl(models.NewAuditEventPostgresRepository(db))
+	auditHandler := controllers.NewAuditHandler(auditService)
+
 	// Initialize user handler
 	userRepo := models.NewUserPostgresRepository(db)
 	tokenRepo := models.NewRefreshTokenPostgresRepository(db)
-	userService := usecase.NewUserServiceImpl(userRepo, tokenRepo)
-	userHandler := controllers.NewUserHandler(userService)
+	tx := models.NewTxPostgresManager(db, func(tx *gorm.DB) usecase.TxRepositories {
+		return usecase.TxRepositories{
+			Users:         models.NewUserPostgresRepository(tx),
+			Tokens:        models.NewRefreshTokenPostgresRepository(tx),
+			Organizations: models.NewOrganizationPostgresRepository(tx),
+			Identities:    models.NewIdentityPostgresRepository(tx),
+		}
+	})
+	userService := usecase.NewUserServiceImpl(userRepo, tokenRepo, tx, tokens, auditService)
+	userService.DiscloseEmailTaken = cfg.Signup.DiscloseEmailTaken
+	userService.Verifier = newCredentialVerifier(cfg.LDAP, userRepo, auditService)
+	userHandler := controllers.NewUserHandler(userService, cookie)
+
+	// Federated sign-in is a browser redirect flow and needs no credentials
+	oidcService := usecase.NewOIDCServiceImpl(newFederatedProviders(cfg.OIDC), userRepo, models.NewIdentityPostgresRepository(db), tx, tokens, auditService, oidc.StateKey(cfg.Auth.JWTSecret), cfg.OIDC.StateTTL)
+	oidcService.Verifier = userService.Verifier
+	oidcHandler := controllers.NewOIDCHandler(oidcService, cookie)
+	v1.GET("/oidc/:provider/login", oidcHandler.Login)
+	v1.GET("/oidc/:provider/callback", oidcHandler.Callback)
 
 	// Basic Auth
 	basic := v1.Group("/basic")
-	basic.Use(middleware.BasicAuth)
+	basic.Use(middleware.NewBasicAuth(cfg.Auth.BasicAuthUser, cfg.Auth.BasicAuthPassword))
 	basic.POST("/users", userHandler.ListUsers)
 
 	refreshTokenRepo := models.NewRefreshTokenPostgresRepository(db)
-	refreshTokenService := usecase.NewRefreshTokenServiceImpl(refreshTokenRepo)
+	refreshTokenService := usecase.NewRefreshTokenServiceImpl(refreshTokenRepo, tokens, auditService)
 	refreshTokenHandler := controllers.NewRefreshTokenHandler(refreshTokenService)
+	apiKeyRepo := models.NewAPIKeyPostgresRepository(db)
+	apiKeyService := usecase.NewAPIKeyServiceImpl(apiKeyRepo, auditService, cfg.Auth.MaxAccessTokenTTL)
 	// Key Auth
 	key := v1.Group("/key")
-	key.Use(middleware.KeyAuth)
+	key.Use(middleware.NewKeyAuth(cfg.Auth.APIKey, apiKeyService))
 	key.POST("/signup", userHandler.SignUp)
 	key.POST("/signin", userHandler.SignIn)
 	key.POST("/refresh", refreshTokenHandler.PostRefreshToken)
 
 	// JWT Auth
 	jwt := v1.Group("/jwt")
-	jwt.Use(middleware.JWTAuth)
-	jwt.GET("/users", userHandler.ListUsers)
+	jwt.Use(middleware.NewJWTAuth(middleware.JWTAuthConfig{
+		Keys:      keys,
+		Issuer:    cfg.Auth.Issuer,
+		Audiences: cfg.Auth.Audiences(),
+	}))
+	jwt.GET("/users", userHandler.ListActiveUsers)
+
+	orgService := usecase.NewOrganizationServiceImpl(models.NewOrganizationPostgresRepository(db), userRepo, tokenRepo, tx, tokens, auditService, cfg.Org.InvitationTTL)
+	orgHandler := controllers.NewOrganizationHandler(orgService, cookie)
+	jwt.POST("/orgs", orgHandler.CreateOrganization)
+	jwt.GET("/orgs", orgHandler.ListOrganizations)
+	jwt.POST("/orgs/:id/switch", orgHandler.SwitchOrganization)
+	jwt.GET("/orgs/:id/members", orgHandler.ListMembers)
+	jwt.PATCH("/orgs/:id/members/:user_id", orgHandler.UpdateMemberRole)
+	jwt.DELETE("/orgs/:id/members/:user_id", orgHandler.RemoveMember)
+	jwt.POST("/orgs/:id/invitations", orgHandler.InviteMember)
+	jwt.GET("/orgs/:id/invitations", orgHandler.ListInvitations)
+	jwt.DELETE("/orgs/:id/invitations/:invitation_id", orgHandler.RevokeInvitation)
+	jwt.POST("/invitations/accept", orgHandler.AcceptInvitation)
+
+	jwt.GET("/identities", oidcHandler.ListIdentities)
+	jwt.POST("/identities", oidcHandler.LinkIdentity)
+	jwt.DELETE("/identities/:id", oidcHandler.UnlinkIdentity)
+
+	// Admin only
+	admin := jwt.Group("/admin")
+	admin.Use(middleware.NewRequireRole(userService, models.RoleAdmin))
+	admin.GET("/audit-events", auditHandler.ListAuditEvents)
+
+	adminUserHandler := controllers.NewAdminUserHandler(userService)
+	admin.GET("/users/:id", adminUserHandler.FetchUser)
+	admin.POST("/users/:id/disable", adminUserHandler.DisableUser)
+	admin.POST("/users/:id/enable", adminUserHandler.EnableUser)
+	admin.POST("/users/:id/password-reset", adminUserHandler.ForcePasswordReset)
+	admin.DELETE("/users/:id/sessions", adminUserHandler.RevokeSessions)
+	admin.DELETE("/users/:id", adminUserHandler.DeleteUser)
+	admin.POST("/users/:id/restore", adminUserHandler.RestoreUser)
+
+	webhookService := usecase.NewWebhookServiceImpl(models.NewWebhookPostgresRepository(db), &http.Client{Timeout: cfg.Webhook.Timeout}, usecase.WebhookRetryPolicy{
+		MaxAttempts: cfg.Webhook.MaxAttempts,
+		BaseDelay:   cfg.Webhook.RetryBaseDelay,
+		MaxDelay:    cfg.Webhook.RetryMaxDelay,
+	})
+	webhookHandler := controllers.NewWebhookHandler(webhookService)
+	admin.POST("/webhooks", webhookHandler.CreateSubscription)
+	admin.GET("/webhooks", webhookHandler.ListSubscriptions)
+	admin.DELETE("/webhooks/:id", webhookHandler.DeleteSubscription)
+	admin.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+	admin.POST("/webhook-deliveries/:id/redeliver", webhookHandler.Redeliver)
+
+	return nil
 }
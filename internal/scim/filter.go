@@ -0,0 +1,242 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter")
+	ErrInvalidPath   = errors.New("invalid path")
+)
+
+// Comparison operators. Pr matches attributes that have a value and takes
+// none itself.
+const (
+	OpEqual      = "eq"
+	OpNotEqual   = "ne"
+	OpContains   = "co"
+	OpStartsWith = "sw"
+	OpEndsWith   = "ew"
+	OpPresent    = "pr"
+)
+
+var operators = map[string]bool{
+	OpEqual:      true,
+	OpNotEqual:   true,
+	OpContains:   true,
+	OpStartsWith: true,
+	OpEndsWith:   true,
+	OpPresent:    true,
+}
+
+// Comparison compares the attribute Attr, such as userName or emails.value,
+// with Value: a string, bool, float64 or nil.
+type Comparison struct {
+	Attr  string
+	Op    string
+	Value any
+}
+
+// Filter is a conjunction of comparisons; the empty filter matches
+// everything. Of the RFC 7644 grammar, or, not and grouping are not
+// supported.
+type Filter []Comparison
+
+// Path is the target of a PATCH operation: an attribute, optionally narrowed
+// to the values matching Filter, and a sub-attribute of it.
+type Path struct {
+	Attr    string
+	Filter  Filter
+	SubAttr string
+}
+
+// ParseFilter parses a filter such as
+// `userName eq "bjensen" and active eq true`. Attribute names and operators
+// are case-insensitive, so Attr keeps the case of the filter.
+func ParseFilter(s string) (Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := make(Filter, 0)
+	for len(tokens) > 0 {
+		if len(filter) > 0 {
+			if !strings.EqualFold(tokens[0].text, "and") || tokens[0].quoted {
+				return nil, fmt.Errorf("%w: expected \"and\" but got %q", ErrInvalidFilter, tokens[0].text)
+			}
+			tokens = tokens[1:]
+		}
+
+		if len(tokens) < 2 || tokens[0].quoted || tokens[1].quoted {
+			return nil, fmt.Errorf("%w: expected an attribute and an operator", ErrInvalidFilter)
+		}
+
+		comparison := Comparison{
+			Attr: attrName(tokens[0].text),
+			Op:   strings.ToLower(tokens[1].text),
+		}
+		if !operators[comparison.Op] {
+			return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidFilter, tokens[1].text)
+		}
+		tokens = tokens[2:]
+
+		if comparison.Op != OpPresent {
+			if len(tokens) == 0 {
+				return nil, fmt.Errorf("%w: %s %s has no value", ErrInvalidFilter, comparison.Attr, comparison.Op)
+			}
+
+			comparison.Value, err = tokens[0].value()
+			if err != nil {
+				return nil, err
+			}
+			tokens = tokens[1:]
+		}
+
+		filter = append(filter, comparison)
+	}
+
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("%w: empty filter", ErrInvalidFilter)
+	}
+
+	return filter, nil
+}
+
+// ParsePath parses a PATCH path such as `members[value eq "2"]` or
+// `emails[type eq "work"].value`.
+func ParsePath(s string) (Path, error) {
+	var path Path
+	attr, rest, found := strings.Cut(s, "[")
+	if found {
+		inner, after, ok := strings.Cut(rest, "]")
+		if !ok {
+			return path, fmt.Errorf("%w: unterminated filter in %q", ErrInvalidPath, s)
+		}
+
+		filter, err := ParseFilter(inner)
+		if err != nil {
+			return path, fmt.Errorf("%w: %w", ErrInvalidPath, err)
+		}
+		path.Filter = filter
+
+		if after != "" {
+			if !strings.HasPrefix(after, ".") {
+				return path, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidPath, after, s)
+			}
+			path.SubAttr = after[1:]
+		}
+	} else {
+		attr = attrName(attr)
+		attr, path.SubAttr, _ = strings.Cut(attr, ".")
+	}
+
+	path.Attr = attrName(strings.TrimSpace(attr))
+	if path.Attr == "" || strings.ContainsAny(path.Attr, " \"") {
+		return path, fmt.Errorf("%w: %q", ErrInvalidPath, s)
+	}
+
+	return path, nil
+}
+
+// ParseBool reads a boolean PATCH value. Some clients send booleans as the
+// strings "True" and "False".
+func ParseBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return false, fmt.Errorf("expected a boolean but got %s", raw)
+	}
+
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// attrName strips the schema URN from a fully qualified attribute name such
+// as urn:ietf:params:scim:schemas:core:2.0:User:userName.
+func attrName(s string) string {
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		return s[strings.LastIndex(s, ":")+1:]
+	}
+
+	return s
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// value converts a comparison value token to its Go value.
+func (t token) value() (any, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidFilter, t.text)
+	}
+
+	return n, nil
+}
+
+// tokenize splits s into words and JSON string literals.
+func tokenize(s string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			return nil, fmt.Errorf("%w: grouping is not supported", ErrInvalidFilter)
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+
+			var text string
+			if err := json.Unmarshal([]byte(s[i:end+1]), &text); err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, s[i:end+1])
+			}
+			tokens = append(tokens, token{text: text, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t()[]\"", rune(s[end])) {
+				end++
+			}
+			word := s[i:end]
+			if strings.EqualFold(word, "or") || strings.EqualFold(word, "not") {
+				return nil, fmt.Errorf("%w: %q is not supported", ErrInvalidFilter, word)
+			}
+			tokens = append(tokens, token{text: word})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
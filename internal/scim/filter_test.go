@@ -0,0 +1,143 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    Filter
+		wantErr bool
+	}{
+		{
+			name:   "eq",
+			filter: `userName eq "bjensen@example.com"`,
+			want:   Filter{{Attr: "userName", Op: OpEqual, Value: "bjensen@example.com"}},
+		},
+		{
+			name:   "case-insensitive operators",
+			filter: `externalId EQ "a1" AND userName Sw "b"`,
+			want: Filter{
+				{Attr: "externalId", Op: OpEqual, Value: "a1"},
+				{Attr: "userName", Op: OpStartsWith, Value: "b"},
+			},
+		},
+		{
+			name:   "literals",
+			filter: `active eq false and meta.version pr and x eq 1.5 and y eq null`,
+			want: Filter{
+				{Attr: "active", Op: OpEqual, Value: false},
+				{Attr: "meta.version", Op: OpPresent},
+				{Attr: "x", Op: OpEqual, Value: 1.5},
+				{Attr: "y", Op: OpEqual, Value: nil},
+			},
+		},
+		{
+			name:   "escaped string",
+			filter: `displayName eq "say \"hi\" and bye"`,
+			want:   Filter{{Attr: "displayName", Op: OpEqual, Value: `say "hi" and bye`}},
+		},
+		{
+			name:   "schema URN",
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName eq "a"`,
+			want:   Filter{{Attr: "userName", Op: OpEqual, Value: "a"}},
+		},
+		{name: "empty", filter: " ", wantErr: true},
+		{name: "or", filter: `a eq "1" or b eq "2"`, wantErr: true},
+		{name: "not", filter: `not (a eq "1")`, wantErr: true},
+		{name: "unknown operator", filter: `a gt "1"`, wantErr: true},
+		{name: "missing value", filter: `a eq`, wantErr: true},
+		{name: "missing and", filter: `a eq "1" b eq "2"`, wantErr: true},
+		{name: "unterminated string", filter: `a eq "1`, wantErr: true},
+		{name: "bare word value", filter: `a eq bob`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseFilter(test.filter)
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidFilter)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    Path
+		wantErr bool
+	}{
+		{name: "attribute", path: "active", want: Path{Attr: "active"}},
+		{name: "sub-attribute", path: "name.givenName", want: Path{Attr: "name", SubAttr: "givenName"}},
+		{
+			name: "filter",
+			path: `members[value eq "2"]`,
+			want: Path{Attr: "members", Filter: Filter{{Attr: "value", Op: OpEqual, Value: "2"}}},
+		},
+		{
+			name: "filter and sub-attribute",
+			path: `emails[type eq "work"].value`,
+			want: Path{Attr: "emails", Filter: Filter{{Attr: "type", Op: OpEqual, Value: "work"}}, SubAttr: "value"},
+		},
+		{
+			name: "schema URN",
+			path: "urn:ietf:params:scim:schemas:core:2.0:User:userName",
+			want: Path{Attr: "userName"},
+		},
+		{name: "empty", path: "", wantErr: true},
+		{name: "unterminated filter", path: `members[value eq "2"`, wantErr: true},
+		{name: "invalid filter", path: `members[value]`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParsePath(test.path)
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPath)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    bool
+		wantErr bool
+	}{
+		{raw: `true`, want: true},
+		{raw: `false`, want: false},
+		{raw: `"False"`, want: false},
+		{raw: `"True"`, want: true},
+		{raw: `"maybe"`, wantErr: true},
+		{raw: `1`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := ParseBool(json.RawMessage(test.raw))
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
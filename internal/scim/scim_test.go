@@ -0,0 +1,38 @@
+package scim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC)
+
+	// Precision beyond microseconds is lost by the databases
+	assert.Equal(t, Version(updatedAt), Version(updatedAt.Truncate(time.Microsecond)))
+	assert.NotEqual(t, Version(updatedAt), Version(updatedAt.Add(time.Microsecond)))
+}
+
+func TestMatchesVersion(t *testing.T) {
+	version := Version(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "same", header: version, want: true},
+		{name: "strong form", header: version[2:], want: true},
+		{name: "listed", header: `W/"other", ` + version, want: true},
+		{name: "any", header: "*", want: true},
+		{name: "other", header: `W/"other"`, want: false},
+		{name: "empty", header: "", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, MatchesVersion(test.header, version))
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Package tenant carries the tenant of an operation in its context. Each
+// tenant has its own pool of users: the repositories only see rows of the
+// tenant in the context they are given.
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default is the tenant of rows created without one, including every row
+// that predates multi-tenancy.
+const Default = "default"
+
+type tenantKey struct{}
+
+var idPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Valid reports whether id can name a tenant: a lowercase DNS label, so that
+// it also works as a subdomain.
+func Valid(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant stored by WithContext. Contexts without one,
+// such as those of background jobs, are not limited to a tenant.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok
+}
+
+// OfContext returns the tenant rows created with ctx belong to.
+func OfContext(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id
+	}
+
+	return Default
+}
@@ -0,0 +1,42 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "default", want: true},
+		{id: "acme-2", want: true},
+		{id: "a", want: true},
+		{id: "", want: false},
+		{id: "Acme", want: false},
+		{id: "-acme", want: false},
+		{id: "acme-", want: false},
+		{id: "acme.example", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			assert.Equal(t, test.want, Valid(test.id))
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, Default, OfContext(context.Background()))
+
+	ctx := WithContext(context.Background(), "acme")
+	id, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "acme", id)
+	assert.Equal(t, "acme", OfContext(ctx))
+}
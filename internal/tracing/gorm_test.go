@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type tracedUser struct {
+	ID    uint
+	Email string
+}
+
+func TestGormPlugin(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	// DryRun builds statements and runs callbacks without a database
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Use(GormPlugin{}))
+
+	ctx, parent := Start(context.Background(), "parent")
+	db.WithContext(ctx).Where("email = ?", "secret@test.com").First(&tracedUser{})
+	parent.End()
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	span := spans[0]
+	assert.Equal(t, "gorm.query", span.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Contains(t, span.Attributes(), semconv.DBSystemPostgreSQL)
+	assert.Contains(t, span.Attributes(), semconv.DBSQLTable("traced_users"))
+	for _, attr := range span.Attributes() {
+		assert.NotContains(t, attr.Value.Emit(), "secret@test.com")
+	}
+}
+
+func TestDBSystem(t *testing.T) {
+	tests := []struct {
+		dialector string
+		want      attribute.KeyValue
+	}{
+		{"postgres", semconv.DBSystemPostgreSQL},
+		{"sqlite", semconv.DBSystemSqlite},
+		{"mysql", semconv.DBSystemMySQL},
+		{"sqlserver", semconv.DBSystemKey.String("sqlserver")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dialector, func(t *testing.T) {
+			assert.Equal(t, test.want, dbSystem(test.dialector))
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var errUserNotFound = utils.ErrNotFound.WithDetail("The user was not found.")
+
+// FetchUser returns the user with the ID, including soft-deleted users.
+func (s *UserServiceImpl) FetchUser(ctx context.Context, userID uint) (user *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.FetchUser")
+	defer func() { tracing.End(span, err) }()
+
+	user, err = s.UserRepo.FetchAnyUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errUserNotFound
+	}
+
+	return user, nil
+}
+
+// DisableUser blocks sign-in and revokes every session of the user. Admins
+// cannot disable themselves.
+func (s *UserServiceImpl) DisableUser(ctx context.Context, userID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DisableUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditUserDisable, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	if err := rejectSelf(ctx, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var revoked int64
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		if err := repos.Users.SetDisabledAt(ctx, userID, &now); err != nil {
+			return err
+		}
+
+		deleted, err := repos.Tokens.DeleteByUserID(ctx, userID)
+		revoked = deleted
+		return err
+	})
+	if err != nil {
+		return mapUserNotFound(err)
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("user disabled", "user_id", userID, "revoked_sessions", revoked)
+	return nil
+}
+
+func (s *UserServiceImpl) EnableUser(ctx context.Context, userID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.EnableUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditUserEnable, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	if err := s.UserRepo.SetDisabledAt(ctx, userID, nil); err != nil {
+		return mapUserNotFound(err)
+	}
+
+	logging.FromContext(ctx).Info("user enabled", "user_id", userID)
+	return nil
+}
+
+// ForcePasswordReset blocks sign-in until the password is reset and revokes
+// every session of the user.
+func (s *UserServiceImpl) ForcePasswordReset(ctx context.Context, userID uint) (revoked int64, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ForcePasswordReset")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditPasswordForce, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		if err := repos.Users.RequirePasswordReset(ctx, userID); err != nil {
+			return err
+		}
+
+		deleted, err := repos.Tokens.DeleteByUserID(ctx, userID)
+		revoked = deleted
+		return err
+	})
+	if err != nil {
+		return 0, mapUserNotFound(err)
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("password reset required", "user_id", userID, "revoked_sessions", revoked)
+	return revoked, nil
+}
+
+// RevokeUserSessions is RevokeSessions by user ID.
+func (s *UserServiceImpl) RevokeUserSessions(ctx context.Context, userID uint) (revoked int64, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RevokeUserSessions")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSessionsRevoke, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	user, err := s.UserRepo.FetchUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if user == nil {
+		return 0, errUserNotFound
+	}
+
+	revoked, err = s.TokenRepo.DeleteByUserID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("sessions revoked", "user_id", userID, "revoked_sessions", revoked)
+	return revoked, nil
+}
+
+// DeleteUser removes the user and its sessions for good. Admins cannot
+// delete themselves.
+func (s *UserServiceImpl) DeleteUser(ctx context.Context, userID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditUserDelete, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	if err := rejectSelf(ctx, userID); err != nil {
+		return err
+	}
+
+	var revoked int64
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		deleted, err := repos.Tokens.DeleteByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		revoked = deleted
+		return repos.Users.DeleteUser(ctx, userID)
+	})
+	if err != nil {
+		return mapUserNotFound(err)
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("user deleted", "user_id", userID, "revoked_sessions", revoked)
+	return nil
+}
+
+// RestoreUser undoes a soft deletion.
+func (s *UserServiceImpl) RestoreUser(ctx context.Context, userID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RestoreUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditUserRestore, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	if err := s.UserRepo.RestoreUser(ctx, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrNotFound.WithDetail("No deleted user was found.")
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("user restored", "user_id", userID)
+	return nil
+}
+
+// rejectSelf keeps admins from locking themselves out.
+func rejectSelf(ctx context.Context, userID uint) error {
+	if utils.RequestInfoFromContext(ctx).UserID == userID {
+		return utils.ErrForbidden.WithDetail("You cannot do this to your own account.")
+	}
+
+	return nil
+}
+
+func mapUserNotFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errUserNotFound
+	}
+
+	return err
+}
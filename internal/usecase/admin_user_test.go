@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newTestAdminUserService(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository, audit *fakeAuditRecorder) *UserServiceImpl {
+	return &UserServiceImpl{
+		UserRepo:  mockUserRepo,
+		TokenRepo: mockTokenRepo,
+		Tx:        newFakeTxManager(mockUserRepo, mockTokenRepo),
+		Tokens:    newTestTokenIssuer(),
+		Audit:     audit,
+	}
+}
+
+// adminContext is a request by the admin with ID 1.
+func adminContext() context.Context {
+	return utils.WithRequestInfo(context.Background(), utils.RequestInfo{UserID: 1})
+}
+
+func TestFetchUser(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	mockUserRepo.On("FetchAnyUserByID", uint(2)).Return(&models.User{Model: gorm.Model{ID: 2}}, nil)
+	mockUserRepo.On("FetchAnyUserByID", uint(3)).Return((*models.User)(nil), nil)
+	service := newTestAdminUserService(&mockUserRepo, &MockRefreshTokenRepository{}, &fakeAuditRecorder{})
+
+	user, err := service.FetchUser(adminContext(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), user.ID)
+
+	_, err = service.FetchUser(adminContext(), 3)
+	assert.ErrorIs(t, err, utils.ErrNotFound)
+}
+
+func TestDisableUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		wantMock func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository)
+		wantErr  error
+	}{
+		{
+			name:   "disables and revokes sessions",
+			userID: 2,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("SetDisabledAt", uint(2), true).Return(nil)
+				mockTokenRepo.On("DeleteByUserID", uint(2)).Return(int64(3), nil)
+			},
+		},
+		{
+			name:     "own account",
+			userID:   1,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {},
+			wantErr:  utils.ErrForbidden,
+		},
+		{
+			name:   "unknown user",
+			userID: 3,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("SetDisabledAt", uint(3), true).Return(fmt.Errorf("failed: %w", gorm.ErrRecordNotFound))
+			},
+			wantErr: utils.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockUserRepo MockUserRepository
+			var mockTokenRepo MockRefreshTokenRepository
+			var audit fakeAuditRecorder
+			test.wantMock(&mockUserRepo, &mockTokenRepo)
+			service := newTestAdminUserService(&mockUserRepo, &mockTokenRepo, &audit)
+
+			err := service.DisableUser(adminContext(), test.userID)
+			wantOutcome := models.AuditOutcomeSuccess
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				wantOutcome = models.AuditOutcomeFailure
+			} else {
+				assert.NoError(t, err)
+			}
+			if assert.Len(t, audit.events, 1) {
+				assert.Equal(t, models.AuditUserDisable, audit.events[0].Type)
+				assert.Equal(t, wantOutcome, audit.events[0].Outcome)
+				assert.Equal(t, models.AuditUser(test.userID), audit.events[0].Target)
+			}
+			mockUserRepo.AssertExpectations(t)
+			mockTokenRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEnableUser(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	var audit fakeAuditRecorder
+	mockUserRepo.On("SetDisabledAt", uint(2), false).Return(nil)
+	service := newTestAdminUserService(&mockUserRepo, &MockRefreshTokenRepository{}, &audit)
+
+	assert.NoError(t, service.EnableUser(adminContext(), 2))
+	if assert.Len(t, audit.events, 1) {
+		assert.Equal(t, models.AuditUserEnable, audit.events[0].Type)
+	}
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestForcePasswordReset(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	var mockTokenRepo MockRefreshTokenRepository
+	var audit fakeAuditRecorder
+	mockUserRepo.On("RequirePasswordReset", uint(2)).Return(nil)
+	mockTokenRepo.On("DeleteByUserID", uint(2)).Return(int64(2), nil)
+	service := newTestAdminUserService(&mockUserRepo, &mockTokenRepo, &audit)
+
+	revoked, err := service.ForcePasswordReset(adminContext(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), revoked)
+	if assert.Len(t, audit.events, 1) {
+		assert.Equal(t, models.AuditPasswordForce, audit.events[0].Type)
+	}
+	mockUserRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	var mockTokenRepo MockRefreshTokenRepository
+	var audit fakeAuditRecorder
+	mockUserRepo.On("FetchUserByID", uint(2)).Return(&models.User{Model: gorm.Model{ID: 2}}, nil)
+	mockUserRepo.On("FetchUserByID", uint(3)).Return((*models.User)(nil), nil)
+	mockTokenRepo.On("DeleteByUserID", uint(2)).Return(int64(1), nil)
+	service := newTestAdminUserService(&mockUserRepo, &mockTokenRepo, &audit)
+
+	revoked, err := service.RevokeUserSessions(adminContext(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+
+	_, err = service.RevokeUserSessions(adminContext(), 3)
+	assert.ErrorIs(t, err, utils.ErrNotFound)
+	assert.Len(t, audit.events, 2)
+	mockUserRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func TestDeleteUser(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	var mockTokenRepo MockRefreshTokenRepository
+	var audit fakeAuditRecorder
+	mockTokenRepo.On("DeleteByUserID", uint(2)).Return(int64(1), nil)
+	mockUserRepo.On("DeleteUser", uint(2)).Return(nil)
+	mockTokenRepo.On("DeleteByUserID", uint(3)).Return(int64(0), nil)
+	mockUserRepo.On("DeleteUser", uint(3)).Return(fmt.Errorf("failed: %w", gorm.ErrRecordNotFound))
+	service := newTestAdminUserService(&mockUserRepo, &mockTokenRepo, &audit)
+
+	assert.NoError(t, service.DeleteUser(adminContext(), 2))
+	assert.ErrorIs(t, service.DeleteUser(adminContext(), 3), utils.ErrNotFound)
+	assert.ErrorIs(t, service.DeleteUser(adminContext(), 1), utils.ErrForbidden)
+	if assert.Len(t, audit.events, 3) {
+		assert.Equal(t, models.AuditUserDelete, audit.events[0].Type)
+		assert.Equal(t, models.AuditOutcomeFailure, audit.events[2].Outcome)
+	}
+	mockUserRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func TestRestoreUser(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	var audit fakeAuditRecorder
+	mockUserRepo.On("RestoreUser", uint(2)).Return(nil)
+	mockUserRepo.On("RestoreUser", uint(3)).Return(fmt.Errorf("failed: %w", gorm.ErrRecordNotFound))
+	service := newTestAdminUserService(&mockUserRepo, &MockRefreshTokenRepository{}, &audit)
+
+	assert.NoError(t, service.RestoreUser(adminContext(), 2))
+	assert.ErrorIs(t, service.RestoreUser(adminContext(), 3), utils.ErrNotFound)
+	if assert.Len(t, audit.events, 2) {
+		assert.Equal(t, models.AuditUserRestore, audit.events[0].Type)
+	}
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestFetchUserRoleOfDisabledUser(t *testing.T) {
+	disabledAt := time.Now()
+	var mockUserRepo MockUserRepository
+	mockUserRepo.On("FetchUserByID", uint(2)).Return(&models.User{Role: models.RoleAdmin, DisabledAt: &disabledAt}, nil)
+	service := newTestAdminUserService(&mockUserRepo, &MockRefreshTokenRepository{}, &fakeAuditRecorder{})
+
+	role, err := service.FetchUserRole(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+}
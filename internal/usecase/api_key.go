@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+)
+
+const (
+	apiKeyPrefix       = "ak_"
+	apiKeyPrefixLength = 11
+)
+
+type APIKeyServiceImpl struct {
+	Repo  APIKeyRepository
+	Audit AuditRecorder
+	// MaxAccessTokenTTL bounds the access token lifetime of keys, since
+	// retired signing keys only verify tokens for that long.
+	MaxAccessTokenTTL time.Duration
+}
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	FetchByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+func NewAPIKeyServiceImpl(repo APIKeyRepository, audit AuditRecorder, maxAccessTokenTTL time.Duration) *APIKeyServiceImpl {
+	return &APIKeyServiceImpl{
+		Repo:              repo,
+		Audit:             audit,
+		MaxAccessTokenTTL: maxAccessTokenTTL,
+	}
+}
+
+// MintAPIKey creates a new API key whose tokens use the given overrides. The
+// plain key is only returned here and cannot be recovered later.
+func (s *APIKeyServiceImpl) MintAPIKey(ctx context.Context, name string, overrides utils.TokenOverrides) (key string, apiKey *models.APIKey, err error) {
+	var target string
+	defer func() { recordAudit(ctx, s.Audit, models.AuditAPIKeyCreate, "", target, err) }()
+
+	if overrides.AccessTokenTTL > s.MaxAccessTokenTTL {
+		return "", nil, utils.ErrBadRequest.WithDetail(fmt.Sprintf("The access token lifetime must not exceed %s.", s.MaxAccessTokenTTL))
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key = apiKeyPrefix + token
+	apiKey = models.NewAPIKey(name, key[:apiKeyPrefixLength], utils.HashAPIKey(key))
+	apiKey.Audience = overrides.Audience
+	apiKey.AccessTokenTTLSeconds = int64(overrides.AccessTokenTTL / time.Second)
+	apiKey.RefreshTokenTTLSeconds = int64(overrides.RefreshTokenTTL / time.Second)
+	if err := s.Repo.CreateAPIKey(ctx, apiKey); err != nil {
+		return "", nil, err
+	}
+
+	target = models.AuditAPIKey(apiKey.ID)
+	return key, apiKey, nil
+}
+
+// VerifyAPIKey returns the token overrides of a valid key, or nil when the key
+// is unknown or revoked.
+func (s *APIKeyServiceImpl) VerifyAPIKey(ctx context.Context, key string) (*utils.TokenOverrides, error) {
+	apiKey, err := s.Repo.FetchByHash(ctx, utils.HashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey == nil {
+		return nil, nil
+	}
+
+	// Keys minted before the limit was lowered are held to it too
+	accessTokenTTL := min(time.Duration(apiKey.AccessTokenTTLSeconds)*time.Second, s.MaxAccessTokenTTL)
+	return &utils.TokenOverrides{
+		Audience:        apiKey.Audience,
+		AccessTokenTTL:  accessTokenTTL,
+		RefreshTokenTTL: time.Duration(apiKey.RefreshTokenTTLSeconds) * time.Second,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) FetchByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	args := m.Called(keyHash)
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func TestMintAPIKey(t *testing.T) {
+	var mockRepo MockAPIKeyRepository
+	mockRepo.On("CreateAPIKey", mock.Anything).Return(nil)
+	service := NewAPIKeyServiceImpl(&mockRepo, &fakeAuditRecorder{}, time.Hour)
+
+	key, apiKey, err := service.MintAPIKey(context.Background(), "backend", utils.TokenOverrides{Audience: "mobile", AccessTokenTTL: 5 * time.Minute})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "ak_"))
+	assert.Equal(t, "backend", apiKey.Name)
+	assert.Equal(t, key[:11], apiKey.Prefix)
+	assert.Equal(t, utils.HashAPIKey(key), apiKey.KeyHash)
+	assert.Equal(t, "mobile", apiKey.Audience)
+	assert.Equal(t, int64(300), apiKey.AccessTokenTTLSeconds)
+	assert.Equal(t, int64(0), apiKey.RefreshTokenTTLSeconds)
+	mockRepo.AssertExpectations(t)
+
+	// Retired signing keys would stop verifying longer lived tokens
+	_, _, err = service.MintAPIKey(context.Background(), "backend", utils.TokenOverrides{AccessTokenTTL: 2 * time.Hour})
+	assert.ErrorIs(t, err, utils.ErrBadRequest)
+	mockRepo.AssertNumberOfCalls(t, "CreateAPIKey", 1)
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    func(mockRepo *MockAPIKeyRepository)
+		want    *utils.TokenOverrides
+		wantErr bool
+	}{
+		{
+			name: "valid key",
+			mock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("FetchByHash", utils.HashAPIKey("ak_key")).Return(&models.APIKey{Name: "backend", Audience: "mobile", RefreshTokenTTLSeconds: 3600}, nil)
+			},
+			want:    &utils.TokenOverrides{Audience: "mobile", RefreshTokenTTL: time.Hour},
+			wantErr: false,
+		},
+		{
+			name: "lifetime above the maximum",
+			mock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("FetchByHash", utils.HashAPIKey("ak_key")).Return(&models.APIKey{Name: "backend", AccessTokenTTLSeconds: 86400}, nil)
+			},
+			want:    &utils.TokenOverrides{AccessTokenTTL: time.Hour},
+			wantErr: false,
+		},
+		{
+			name: "unknown key",
+			mock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("FetchByHash", utils.HashAPIKey("ak_key")).Return((*models.APIKey)(nil), nil)
+			},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name: "repository error",
+			mock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("FetchByHash", utils.HashAPIKey("ak_key")).Return((*models.APIKey)(nil), fmt.Errorf("db error"))
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockAPIKeyRepository
+			test.mock(&mockRepo)
+			service := NewAPIKeyServiceImpl(&mockRepo, &fakeAuditRecorder{}, time.Hour)
+
+			overrides, err := service.VerifyAPIKey(context.Background(), "ak_key")
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, overrides)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/utils"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+	auditBatchSize       = 500
+)
+
+var ErrAuditChainBroken = errors.New("audit chain is broken")
+
+type AuditServiceImpl struct {
+	Repo AuditEventRepository
+}
+
+type AuditEventRepository interface {
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	FetchAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+}
+
+// AuditRecorder is how the other services add events to the audit trail.
+type AuditRecorder interface {
+	Record(ctx context.Context, event *models.AuditEvent)
+}
+
+// AuditPage is one page of audit events, newest first. NextCursor is zero on
+// the last page.
+type AuditPage struct {
+	Events     []models.AuditEvent `json:"events"`
+	NextCursor uint                `json:"next_cursor,omitempty"`
+}
+
+func NewAuditServiceImpl(repo AuditEventRepository) *AuditServiceImpl {
+	return &AuditServiceImpl{
+		Repo: repo,
+	}
+}
+
+// Record completes event with the request info in ctx and appends it. A
+// failure is logged rather than returned so that the audited operation keeps
+// its own outcome, and the event is written even when ctx was cancelled.
+func (s *AuditServiceImpl) Record(ctx context.Context, event *models.AuditEvent) {
+	info := utils.RequestInfoFromContext(ctx)
+	event.RequestID = info.RequestID
+	event.IP = info.IP
+	event.UserAgent = info.UserAgent
+	if event.Actor == "" {
+		event.Actor = auditActor(info)
+	}
+
+	if err := s.Repo.AppendAuditEvent(context.WithoutCancel(ctx), event); err != nil {
+		logging.FromContext(ctx).Error("failed to record audit event", "type", event.Type, "error", err)
+	}
+}
+
+// ListAuditEvents returns one page of events matching filter.
+func (s *AuditServiceImpl) ListAuditEvents(ctx context.Context, filter models.AuditFilter) (page AuditPage, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ListAuditEvents")
+	defer func() { tracing.End(span, err) }()
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	filter.Ascending = false
+
+	events, err := s.Repo.FetchAuditEvents(ctx, filter)
+	if err != nil {
+		return page, err
+	}
+
+	page.Events = events
+	if len(events) == filter.Limit {
+		page.NextCursor = events[len(events)-1].ID
+	}
+
+	return page, nil
+}
+
+// ExportAuditEvents writes the events matching filter to w as JSON lines,
+// oldest first, and returns how many were written.
+func (s *AuditServiceImpl) ExportAuditEvents(ctx context.Context, w io.Writer, filter models.AuditFilter) (exported int, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ExportAuditEvents")
+	defer func() { tracing.End(span, err) }()
+
+	enc := json.NewEncoder(w)
+	err = s.scan(ctx, filter, func(event models.AuditEvent) error {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to write audit event: %w", err)
+		}
+		exported++
+		return nil
+	})
+
+	return exported, err
+}
+
+// VerifyAuditChain recomputes every hash and link of the chain and returns
+// how many events were checked. Events removed from the end of the chain
+// cannot be detected here; compare with an earlier export for that.
+func (s *AuditServiceImpl) VerifyAuditChain(ctx context.Context) (checked int, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyAuditChain")
+	defer func() { tracing.End(span, err) }()
+
+	prevHash := ""
+	err = s.scan(ctx, models.AuditFilter{}, func(event models.AuditEvent) error {
+		if event.PrevHash != prevHash || event.ComputeHash() != event.Hash {
+			return fmt.Errorf("%w at event %d", ErrAuditChainBroken, event.ID)
+		}
+
+		prevHash = event.Hash
+		checked++
+		return nil
+	})
+
+	return checked, err
+}
+
+// scan calls fn for every event matching filter in chain order.
+func (s *AuditServiceImpl) scan(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEvent) error) error {
+	filter.Ascending = true
+	filter.Limit = auditBatchSize
+	for {
+		events, err := s.Repo.FetchAuditEvents(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+
+		if len(events) < filter.Limit {
+			return nil
+		}
+		filter.Cursor = events[len(events)-1].ID
+	}
+}
+
+func auditActor(info utils.RequestInfo) string {
+	switch {
+	case info.Operator != "":
+		return "operator:" + info.Operator
+	case info.UserID != 0:
+		return models.AuditUser(info.UserID)
+	case info.Client != "":
+		return info.Client
+	default:
+		return ""
+	}
+}
+
+// recordAudit records the outcome of an operation; a failure carries the same
+// reason as the metrics. It does nothing when recorder is nil.
+func recordAudit(ctx context.Context, recorder AuditRecorder, eventType, actor, target string, err error) {
+	if recorder == nil {
+		return
+	}
+
+	event := models.NewAuditEvent(eventType, models.AuditOutcomeSuccess)
+	if err != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		event.Reason = metricResult(err)
+	}
+	event.Actor = actor
+	event.Target = target
+
+	recorder.Record(ctx, event)
+}
@@ -0,0 +1,239 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAuditEventRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditEventRepository) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockAuditEventRepository) FetchAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+// fakeAuditRecorder keeps recorded events for assertions.
+type fakeAuditRecorder struct {
+	events []models.AuditEvent
+}
+
+func (r *fakeAuditRecorder) Record(ctx context.Context, event *models.AuditEvent) {
+	r.events = append(r.events, *event)
+}
+
+// newTestAuditChain returns n sealed and linked events.
+func newTestAuditChain(n int) []models.AuditEvent {
+	events := make([]models.AuditEvent, 0, n)
+	prevHash := ""
+	for i := 1; i <= n; i++ {
+		event := models.NewAuditEvent(models.AuditSignIn, models.AuditOutcomeSuccess)
+		event.ID = uint(i)
+		event.Actor = models.AuditUser(uint(i))
+		event.Seal(prevHash)
+		prevHash = event.Hash
+		events = append(events, *event)
+	}
+
+	return events
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      utils.RequestInfo
+		actor     string
+		wantActor string
+	}{
+		{
+			name:      "authenticated user",
+			info:      utils.RequestInfo{RequestID: "request-1", IP: "203.0.113.7", UserAgent: "curl", UserID: 7},
+			wantActor: "user:7",
+		},
+		{
+			name:      "operator",
+			info:      utils.RequestInfo{Operator: "alice"},
+			wantActor: "operator:alice",
+		},
+		{
+			name:      "explicit actor wins",
+			info:      utils.RequestInfo{UserID: 7},
+			actor:     "user:8",
+			wantActor: "user:8",
+		},
+		{
+			name:      "anonymous",
+			wantActor: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockAuditEventRepository
+			mockRepo.On("AppendAuditEvent", mock.Anything).Return(nil)
+			service := NewAuditServiceImpl(&mockRepo)
+
+			ctx, cancel := context.WithCancel(utils.WithRequestInfo(context.Background(), test.info))
+			cancel()
+
+			event := models.NewAuditEvent(models.AuditSignup, models.AuditOutcomeSuccess)
+			event.Actor = test.actor
+			service.Record(ctx, event)
+
+			assert.Equal(t, test.wantActor, event.Actor)
+			assert.Equal(t, test.info.RequestID, event.RequestID)
+			assert.Equal(t, test.info.IP, event.IP)
+			assert.Equal(t, test.info.UserAgent, event.UserAgent)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRecordAudit(t *testing.T) {
+	var audit fakeAuditRecorder
+	recordAudit(context.Background(), &audit, models.AuditTokenRefresh, "user:1", "user:1", nil)
+	recordAudit(context.Background(), &audit, models.AuditTokenRefresh, "", "", fmt.Errorf("wrapped: %w", utils.ErrTokenExpired))
+	recordAudit(context.Background(), nil, models.AuditTokenRefresh, "", "", nil)
+
+	if assert.Len(t, audit.events, 2) {
+		assert.Equal(t, models.AuditOutcomeSuccess, audit.events[0].Outcome)
+		assert.Empty(t, audit.events[0].Reason)
+		assert.Equal(t, "user:1", audit.events[0].Target)
+		assert.Equal(t, models.AuditOutcomeFailure, audit.events[1].Outcome)
+		assert.Equal(t, string(utils.CodeTokenExpired), audit.events[1].Reason)
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	tests := []struct {
+		name           string
+		in             models.AuditFilter
+		wantFilter     models.AuditFilter
+		events         []models.AuditEvent
+		wantNextCursor uint
+	}{
+		{
+			name:       "default page size",
+			in:         models.AuditFilter{Type: models.AuditSignIn},
+			wantFilter: models.AuditFilter{Type: models.AuditSignIn, Limit: defaultAuditPageSize},
+			events:     newTestAuditChain(3),
+		},
+		{
+			name:           "full page has a next cursor",
+			in:             models.AuditFilter{Limit: 2},
+			wantFilter:     models.AuditFilter{Limit: 2},
+			events:         []models.AuditEvent{{ID: 9}, {ID: 8}},
+			wantNextCursor: 8,
+		},
+		{
+			name:       "page size is capped",
+			in:         models.AuditFilter{Limit: 10000, Ascending: true},
+			wantFilter: models.AuditFilter{Limit: maxAuditPageSize},
+			events:     []models.AuditEvent{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockAuditEventRepository
+			mockRepo.On("FetchAuditEvents", test.wantFilter).Return(test.events, nil)
+			service := NewAuditServiceImpl(&mockRepo)
+
+			page, err := service.ListAuditEvents(context.Background(), test.in)
+			assert.NoError(t, err)
+			assert.Equal(t, test.events, page.Events)
+			assert.Equal(t, test.wantNextCursor, page.NextCursor)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExportAuditEvents(t *testing.T) {
+	chain := newTestAuditChain(auditBatchSize + 1)
+
+	var mockRepo MockAuditEventRepository
+	mockRepo.On("FetchAuditEvents", models.AuditFilter{Type: models.AuditSignIn, Limit: auditBatchSize, Ascending: true}).Return(chain[:auditBatchSize], nil)
+	mockRepo.On("FetchAuditEvents", models.AuditFilter{Type: models.AuditSignIn, Limit: auditBatchSize, Ascending: true, Cursor: uint(auditBatchSize)}).Return(chain[auditBatchSize:], nil)
+	service := NewAuditServiceImpl(&mockRepo)
+
+	var buf bytes.Buffer
+	exported, err := service.ExportAuditEvents(context.Background(), &buf, models.AuditFilter{Type: models.AuditSignIn})
+	assert.NoError(t, err)
+	assert.Equal(t, len(chain), exported)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, len(chain))
+
+	var last models.AuditEvent
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &last))
+	assert.Equal(t, chain[len(chain)-1].Hash, last.Hash)
+	assert.Equal(t, last.Hash, last.ComputeHash())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	tampered := newTestAuditChain(3)
+	tampered[1].Outcome = models.AuditOutcomeFailure
+
+	tests := []struct {
+		name        string
+		events      []models.AuditEvent
+		wantChecked int
+		wantErr     bool
+	}{
+		{
+			name:        "intact chain",
+			events:      newTestAuditChain(3),
+			wantChecked: 3,
+		},
+		{
+			name:        "empty chain",
+			events:      []models.AuditEvent{},
+			wantChecked: 0,
+		},
+		{
+			name:        "edited event",
+			events:      tampered,
+			wantChecked: 1,
+			wantErr:     true,
+		},
+		{
+			name:        "removed event",
+			events:      append(newTestAuditChain(3)[:1], newTestAuditChain(3)[2]),
+			wantChecked: 1,
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockAuditEventRepository
+			mockRepo.On("FetchAuditEvents", mock.Anything).Return(test.events, nil)
+			service := NewAuditServiceImpl(&mockRepo)
+
+			checked, err := service.VerifyAuditChain(context.Background())
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrAuditChainBroken)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantChecked, checked)
+		})
+	}
+}
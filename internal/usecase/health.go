@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+)
+
+const (
+	CheckStatusOK   = "ok"
+	CheckStatusFail = "fail"
+)
+
+type HealthServiceImpl struct {
+	Repo HealthRepository
+	Keys *utils.Keyring
+}
+
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	MigrationStatus(ctx context.Context) (models.MigrationStatus, error)
+}
+
+// CheckResult is the outcome of a single readiness check. Probes are not
+// authenticated, so Error never carries the underlying error, which is
+// logged instead.
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessReport lists every dependency check. Ready is true only when all
+// of them passed.
+type ReadinessReport struct {
+	Ready  bool                   `json:"-"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func NewHealthServiceImpl(repo HealthRepository, keys *utils.Keyring) *HealthServiceImpl {
+	return &HealthServiceImpl{
+		Repo: repo,
+		Keys: keys,
+	}
+}
+
+// CheckReadiness reports whether the database is reachable and migrated and
+// whether signing keys have been loaded.
+func (s *HealthServiceImpl) CheckReadiness(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{
+		Ready: true,
+		Checks: map[string]CheckResult{
+			"database":     s.checkDatabase(ctx),
+			"migrations":   s.checkMigrations(ctx),
+			"signing_keys": s.checkSigningKeys(),
+		},
+	}
+
+	for _, check := range report.Checks {
+		if check.Status != CheckStatusOK {
+			report.Ready = false
+		}
+	}
+
+	return report
+}
+
+func (s *HealthServiceImpl) checkDatabase(ctx context.Context) CheckResult {
+	if err := s.Repo.Ping(ctx); err != nil {
+		return failedCheck(ctx, "database", "database is unreachable", err)
+	}
+
+	return CheckResult{Status: CheckStatusOK}
+}
+
+func (s *HealthServiceImpl) checkMigrations(ctx context.Context) CheckResult {
+	status, err := s.Repo.MigrationStatus(ctx)
+	if err != nil {
+		return failedCheck(ctx, "migrations", "schema version could not be read", err)
+	}
+
+	if status.Current < status.Latest {
+		return failedCheck(ctx, "migrations", fmt.Sprintf("schema is at version %d of %d", status.Current, status.Latest), nil)
+	}
+
+	return CheckResult{Status: CheckStatusOK}
+}
+
+func (s *HealthServiceImpl) checkSigningKeys() CheckResult {
+	if s.Keys.LoadedAt().IsZero() {
+		return CheckResult{Status: CheckStatusFail, Error: "signing keys have not been loaded"}
+	}
+
+	return CheckResult{Status: CheckStatusOK}
+}
+
+func failedCheck(ctx context.Context, check, message string, err error) CheckResult {
+	if err != nil {
+		logging.FromContext(ctx).Warn("readiness check failed", "check", check, "error", err)
+	}
+
+	return CheckResult{Status: CheckStatusFail, Error: message}
+}
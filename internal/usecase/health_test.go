@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockHealthRepository struct {
+	mock.Mock
+}
+
+func (m *MockHealthRepository) Ping(ctx context.Context) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockHealthRepository) MigrationStatus(ctx context.Context) (models.MigrationStatus, error) {
+	args := m.Called()
+	return args.Get(0).(models.MigrationStatus), args.Error(1)
+}
+
+func TestCheckReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		mock       func(mockRepo *MockHealthRepository)
+		keysLoaded bool
+		wantReady  bool
+		wantFailed []string
+	}{
+		{
+			name: "all checks pass",
+			mock: func(mockRepo *MockHealthRepository) {
+				mockRepo.On("Ping").Return(nil)
+				mockRepo.On("MigrationStatus").Return(models.MigrationStatus{Current: 6, Latest: 6}, nil)
+			},
+			keysLoaded: true,
+			wantReady:  true,
+		},
+		{
+			name: "database unreachable",
+			mock: func(mockRepo *MockHealthRepository) {
+				mockRepo.On("Ping").Return(fmt.Errorf("connection refused"))
+				mockRepo.On("MigrationStatus").Return(models.MigrationStatus{}, fmt.Errorf("connection refused"))
+			},
+			keysLoaded: true,
+			wantReady:  false,
+			wantFailed: []string{"database", "migrations"},
+		},
+		{
+			name: "pending migrations",
+			mock: func(mockRepo *MockHealthRepository) {
+				mockRepo.On("Ping").Return(nil)
+				mockRepo.On("MigrationStatus").Return(models.MigrationStatus{Current: 5, Latest: 6}, nil)
+			},
+			keysLoaded: true,
+			wantReady:  false,
+			wantFailed: []string{"migrations"},
+		},
+		{
+			name: "signing keys not loaded",
+			mock: func(mockRepo *MockHealthRepository) {
+				mockRepo.On("Ping").Return(nil)
+				mockRepo.On("MigrationStatus").Return(models.MigrationStatus{Current: 6, Latest: 6}, nil)
+			},
+			keysLoaded: false,
+			wantReady:  false,
+			wantFailed: []string{"signing_keys"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockHealthRepository
+			test.mock(&mockRepo)
+			keys := utils.NewKeyring("test_secret")
+			if test.keysLoaded {
+				keys.Clear()
+			}
+			service := NewHealthServiceImpl(&mockRepo, keys)
+
+			report := service.CheckReadiness(context.Background())
+			assert.Equal(t, test.wantReady, report.Ready)
+			assert.Len(t, report.Checks, 3)
+			for _, name := range []string{"database", "migrations", "signing_keys"} {
+				if slices.Contains(test.wantFailed, name) {
+					assert.Equal(t, CheckStatusFail, report.Checks[name].Status)
+					assert.NotEmpty(t, report.Checks[name].Error)
+					assert.NotContains(t, report.Checks[name].Error, "connection refused")
+				} else {
+					assert.Equal(t, CheckStatusOK, report.Checks[name].Status)
+				}
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/tracing"
+)
+
+// janitorBatchSize bounds the rows removed by one statement so that a purge
+// never locks large parts of a table at once.
+const janitorBatchSize = 1000
+
+// Janitor jobs, used as metric labels and by authctl janitor run.
+const (
+	JobExpiredTokens = "expired_tokens"
+	JobDeletedUsers  = "deleted_users"
+)
+
+// JanitorJobs lists every janitor job.
+var JanitorJobs = []string{JobExpiredTokens, JobDeletedUsers}
+
+// janitorResultSkipped is the result label of runs left to another replica.
+const janitorResultSkipped = "skipped"
+
+type JanitorServiceImpl struct {
+	Locker    JobLocker
+	UserRepo  UserRepository
+	TokenRepo RefreshTokenRepository
+	Policy    JanitorPolicy
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// JobLocker lets one replica at a time run a job. TryWithLock reports false
+// without calling fn when the job is running elsewhere.
+type JobLocker interface {
+	TryWithLock(ctx context.Context, job string, fn func() error) (bool, error)
+}
+
+// JanitorPolicy sets how often each job runs and how long soft-deleted users
+// can be restored before they are purged.
+type JanitorPolicy struct {
+	ExpiredTokensInterval time.Duration
+	DeletedUsersInterval  time.Duration
+	DeletedUserRetention  time.Duration
+}
+
+func NewJanitorServiceImpl(locker JobLocker, userRepo UserRepository, tokenRepo RefreshTokenRepository, policy JanitorPolicy) *JanitorServiceImpl {
+	return &JanitorServiceImpl{
+		Locker:    locker,
+		UserRepo:  userRepo,
+		TokenRepo: tokenRepo,
+		Policy:    policy,
+		now:       time.Now,
+	}
+}
+
+// Run runs every job on its interval until ctx is done.
+func (s *JanitorServiceImpl) Run(ctx context.Context) {
+	intervals := map[string]time.Duration{
+		JobExpiredTokens: s.Policy.ExpiredTokensInterval,
+		JobDeletedUsers:  s.Policy.DeletedUsersInterval,
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range JanitorJobs {
+		wg.Add(1)
+		go func(job string) {
+			defer wg.Done()
+			s.schedule(ctx, job, intervals[job])
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *JanitorServiceImpl) schedule(ctx context.Context, job string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// A failed run is retried on the next tick
+			if _, _, err := s.RunJob(ctx, job); err != nil {
+				logging.FromContext(ctx).Error("janitor job failed", "job", job, "error", err)
+			}
+		}
+	}
+}
+
+// RunJob runs the job once and returns how many rows it removed. ran is
+// false when another replica was running the job, which is not an error.
+func (s *JanitorServiceImpl) RunJob(ctx context.Context, job string) (purged int64, ran bool, err error) {
+	if !slices.Contains(JanitorJobs, job) {
+		return 0, false, fmt.Errorf("unknown janitor job %q", job)
+	}
+
+	ctx, span := tracing.Start(ctx, "JanitorService.RunJob")
+	start := time.Now()
+	defer func() {
+		result := metricResult(err)
+		if err == nil && !ran {
+			result = janitorResultSkipped
+		}
+		metrics.ObserveJanitorRun(job, result, purged, time.Since(start))
+		tracing.End(span, err)
+	}()
+
+	ran, err = s.Locker.TryWithLock(ctx, job, func() error {
+		var err error
+		purged, err = s.purge(ctx, job)
+		return err
+	})
+	if err != nil {
+		return purged, ran, fmt.Errorf("failed to run janitor job %s: %w", job, err)
+	}
+
+	if ran {
+		logging.FromContext(ctx).Info("janitor job finished", "job", job, "purged", purged)
+	}
+
+	return purged, ran, nil
+}
+
+func (s *JanitorServiceImpl) purge(ctx context.Context, job string) (int64, error) {
+	now := s.now()
+	if job == JobDeletedUsers {
+		deletedBefore := now.Add(-s.Policy.DeletedUserRetention)
+		return purgeInBatches(ctx, func(limit int) (int64, error) {
+			return s.UserRepo.PurgeDeletedUsers(ctx, deletedBefore, limit)
+		})
+	}
+
+	return purgeInBatches(ctx, func(limit int) (int64, error) {
+		return s.TokenRepo.DeleteExpired(ctx, now, limit)
+	})
+}
+
+// purgeInBatches calls purge with janitorBatchSize until a batch comes back
+// short and returns the total removed.
+func purgeInBatches(ctx context.Context, purge func(limit int) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		purged, err := purge(janitorBatchSize)
+		total += purged
+		if err != nil || purged < janitorBatchSize {
+			return total, err
+		}
+	}
+}
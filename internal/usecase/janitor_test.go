@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeJobLocker runs every job unless it is held elsewhere.
+type fakeJobLocker struct {
+	heldElsewhere bool
+}
+
+func (l *fakeJobLocker) TryWithLock(ctx context.Context, job string, fn func() error) (bool, error) {
+	if l.heldElsewhere {
+		return false, nil
+	}
+
+	return true, fn()
+}
+
+func TestRunJob(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := JanitorPolicy{DeletedUserRetention: 30 * 24 * time.Hour}
+
+	tests := []struct {
+		name          string
+		job           string
+		heldElsewhere bool
+		wantMock      func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository)
+		wantPurged    int64
+		wantRan       bool
+		wantErr       bool
+	}{
+		{
+			name: "purges expired tokens in batches",
+			job:  JobExpiredTokens,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockTokenRepo.On("DeleteExpired", now, janitorBatchSize).Return(int64(janitorBatchSize), nil).Once()
+				mockTokenRepo.On("DeleteExpired", now, janitorBatchSize).Return(int64(0), nil).Once()
+			},
+			wantPurged: janitorBatchSize,
+			wantRan:    true,
+		},
+		{
+			name: "purges users deleted before the retention",
+			job:  JobDeletedUsers,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("PurgeDeletedUsers", now.Add(-30*24*time.Hour), janitorBatchSize).Return(int64(2), nil)
+			},
+			wantPurged: 2,
+			wantRan:    true,
+		},
+		{
+			name:          "skips jobs running elsewhere",
+			job:           JobExpiredTokens,
+			heldElsewhere: true,
+			wantMock:      func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {},
+		},
+		{
+			name: "failed to purge",
+			job:  JobDeletedUsers,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("PurgeDeletedUsers", now.Add(-30*24*time.Hour), janitorBatchSize).Return(int64(0), fmt.Errorf("db error"))
+			},
+			wantRan: true,
+			wantErr: true,
+		},
+		{
+			name:     "unknown job",
+			job:      "sessions",
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {},
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockUserRepo MockUserRepository
+			var mockTokenRepo MockRefreshTokenRepository
+			test.wantMock(&mockUserRepo, &mockTokenRepo)
+			service := NewJanitorServiceImpl(&fakeJobLocker{heldElsewhere: test.heldElsewhere}, &mockUserRepo, &mockTokenRepo, policy)
+			service.now = func() time.Time { return now }
+
+			purged, ran, err := service.RunJob(context.Background(), test.job)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantPurged, purged)
+			assert.Equal(t, test.wantRan, ran)
+			mockUserRepo.AssertExpectations(t)
+			mockTokenRepo.AssertExpectations(t)
+		})
+	}
+}
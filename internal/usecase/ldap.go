@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/soicchi/auth_api/internal/ldapauth"
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+)
+
+var errDirectorySignupClosed = utils.ErrForbidden.WithDetail("Signing up with a directory account is disabled.")
+
+// Directory checks passwords against an LDAP directory. *ldapauth.Directory
+// implements it.
+type Directory interface {
+	Authenticate(ctx context.Context, email, password string) (*ldapauth.Entry, error)
+}
+
+// LDAPVerifier checks passwords against a directory instead of the users
+// table. Directory users sign in as the user with their email, which is
+// created without a password on their first sign-in.
+type LDAPVerifier struct {
+	Directory Directory
+	Users     UserRepository
+	Audit     AuditRecorder
+	// GroupRoles maps the lowercased DNs of directory groups to the role of
+	// their members. When set, the role of users follows their groups at
+	// every sign-in, and is models.RoleUser for users in no mapped group.
+	GroupRoles map[string]string
+	// DisableSignup rejects directory users without a user instead of
+	// creating one.
+	DisableSignup bool
+}
+
+func NewLDAPVerifier(directory Directory, users UserRepository, audit AuditRecorder, groupRoles map[string]string, disableSignup bool) *LDAPVerifier {
+	roles := make(map[string]string, len(groupRoles))
+	for group, role := range groupRoles {
+		roles[strings.ToLower(group)] = role
+	}
+
+	return &LDAPVerifier{
+		Directory:     directory,
+		Users:         users,
+		Audit:         audit,
+		GroupRoles:    roles,
+		DisableSignup: disableSignup,
+	}
+}
+
+func (v *LDAPVerifier) VerifyCredentials(ctx context.Context, email, password string) (*models.User, error) {
+	entry, err := v.Directory.Authenticate(ctx, email, password)
+	if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		return nil, utils.ErrInvalidCredentials.Wrap(err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := v.Users.FetchUserByEmail(ctx, entry.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	role := v.role(entry.Groups)
+	switch {
+	case user == nil && v.DisableSignup:
+		return nil, errDirectorySignupClosed
+	case user == nil:
+		return v.createShadowUser(ctx, entry, role)
+	case len(v.GroupRoles) > 0 && user.Role != role:
+		user.Role = role
+		if err := v.Users.UpdateUser(ctx, user); err != nil {
+			return nil, err
+		}
+
+		logging.FromContext(ctx).Info("user role synced from directory", "user_id", user.ID, "role", role)
+	}
+
+	return user, nil
+}
+
+// createShadowUser creates the user a directory user signs in as. It has no
+// password, since the directory keeps it.
+func (v *LDAPVerifier) createShadowUser(ctx context.Context, entry *ldapauth.Entry, role string) (user *models.User, err error) {
+	var subject string
+	defer func() {
+		metrics.RecordSignup(metricResult(err))
+		recordAudit(ctx, v.Audit, models.AuditSignup, subject, subject, err)
+	}()
+
+	user = models.NewUser(entry.Email, "")
+	user.Role = role
+	userID, err := v.Users.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	user.ID = userID
+	subject = models.AuditUser(user.ID)
+	logging.FromContext(ctx).Info("user created from directory", "user_id", user.ID, "dn", entry.DN)
+	return user, nil
+}
+
+// role is the highest role the groups map to.
+func (v *LDAPVerifier) role(groups []string) string {
+	role := models.RoleUser
+	for _, group := range groups {
+		mapped, ok := v.GroupRoles[strings.ToLower(group)]
+		if ok && slices.Index(models.Roles, mapped) > slices.Index(models.Roles, role) {
+			role = mapped
+		}
+	}
+
+	return role
+}
@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/ldapauth"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockDirectory struct {
+	mock.Mock
+}
+
+func (m *MockDirectory) Authenticate(ctx context.Context, email, password string) (*ldapauth.Entry, error) {
+	args := m.Called(email, password)
+	return args.Get(0).(*ldapauth.Entry), args.Error(1)
+}
+
+const testAdminsGroup = "cn=admins,ou=groups,dc=example,dc=com"
+
+func TestLDAPVerifier(t *testing.T) {
+	admin := &ldapauth.Entry{DN: "uid=alice,dc=example,dc=com", Email: "alice@example.com", Groups: []string{"CN=Admins,OU=Groups,DC=example,DC=com"}}
+	member := &ldapauth.Entry{DN: "uid=alice,dc=example,dc=com", Email: "alice@example.com", Groups: []string{"cn=staff,dc=example,dc=com"}}
+	errUnreachable := errors.New("connection refused")
+
+	tests := []struct {
+		name          string
+		groupRoles    map[string]string
+		disableSignup bool
+		mock          func(directory *MockDirectory, users *MockUserRepository)
+		wantRole      string
+		wantAudit     []string
+		wantErr       error
+	}{
+		{
+			name:       "creates a shadow user with the role of its groups",
+			groupRoles: map[string]string{testAdminsGroup: models.RoleAdmin},
+			mock: func(directory *MockDirectory, users *MockUserRepository) {
+				directory.On("Authenticate", "alice@example.com", "password").Return(admin, nil)
+				users.On("FetchUserByEmail", "alice@example.com").Return((*models.User)(nil), nil)
+				users.On("CreateUser", mock.MatchedBy(func(user *models.User) bool {
+					return user.Email == "alice@example.com" && user.Password == "" && user.Role == models.RoleAdmin
+				})).Return(uint(1), nil)
+			},
+			wantRole:  models.RoleAdmin,
+			wantAudit: []string{models.AuditSignup},
+		},
+		{
+			name: "signs in the user with the email",
+			mock: func(directory *MockDirectory, users *MockUserRepository) {
+				directory.On("Authenticate", "alice@example.com", "password").Return(admin, nil)
+				users.On("FetchUserByEmail", "alice@example.com").Return(&models.User{Email: "alice@example.com", Role: models.RoleAdmin}, nil)
+			},
+			wantRole: models.RoleAdmin,
+		},
+		{
+			name:       "demotes users who left the mapped groups",
+			groupRoles: map[string]string{testAdminsGroup: models.RoleAdmin},
+			mock: func(directory *MockDirectory, users *MockUserRepository) {
+				directory.On("Authenticate", "alice@example.com", "password").Return(member, nil)
+				users.On("FetchUserByEmail", "alice@example.com").Return(&models.User{Email: "alice@example.com", Role: models.RoleAdmin}, nil)
+				users.On("UpdateUser", mock.MatchedBy(func(user *models.User) bool {
+					return user.Role == models.RoleUser
+				})).Return(nil)
+			},
+			wantRole: models.RoleUser,
+		},
+		{
+			name:          "signup disabled",
+			disableSignup: true,
+			mock: func(directory *MockDirectory, users *MockUserRepository) {
+				directory.On("Authenticate", "alice@example.com", "password").Return(member, nil)
+				users.On("FetchUserByEmail", "alice@example.com").Return((*models.User)(nil), nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name: "directory rejects the password",
+			mock: func(directory *MockDirectory, users *MockUserRepository) {
+				directory.On("Authenticate", "alice@example.com", "password").Return((*ldapauth.Entry)(nil), ldapauth.ErrInvalidCredentials)
+			},
+			wantErr: utils.ErrInvalidCredentials,
+		},
+		{
+			name: "directory unreachable",
+			mock: func(directory *MockDirectory, users *MockUserRepository) {
+				directory.On("Authenticate", "alice@example.com", "password").Return((*ldapauth.Entry)(nil), errUnreachable)
+			},
+			wantErr: errUnreachable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var directory MockDirectory
+			var users MockUserRepository
+			test.mock(&directory, &users)
+			audit := &fakeAuditRecorder{}
+			verifier := NewLDAPVerifier(&directory, &users, audit, test.groupRoles, test.disableSignup)
+
+			user, err := verifier.VerifyCredentials(context.Background(), "alice@example.com", "password")
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				assert.Nil(t, user)
+			} else {
+				assert.NoError(t, err)
+				if assert.NotNil(t, user) {
+					assert.Equal(t, test.wantRole, user.Role)
+				}
+			}
+
+			var types []string
+			for _, event := range audit.events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(t, test.wantAudit, types)
+			directory.AssertExpectations(t)
+			users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSignInVerifier(t *testing.T) {
+	disabledAt := time.Now()
+	var directory MockDirectory
+	var users MockUserRepository
+	directory.On("Authenticate", "alice@example.com", "password").Return(&ldapauth.Entry{Email: "alice@example.com"}, nil)
+	directory.On("Authenticate", "alice@example.com", "wrong").Return((*ldapauth.Entry)(nil), ldapauth.ErrInvalidCredentials)
+	users.On("FetchUserByEmail", "alice@example.com").Return(&models.User{Email: "alice@example.com", DisabledAt: &disabledAt}, nil)
+
+	service := &UserServiceImpl{
+		UserRepo: &users,
+		Audit:    &fakeAuditRecorder{},
+		Verifier: NewLDAPVerifier(&directory, &users, &fakeAuditRecorder{}, nil, false),
+	}
+
+	// Directory users are subject to the account state of their user
+	_, err := service.SignIn(context.Background(), "alice@example.com", "password", 0, utils.TokenOverrides{})
+	assert.ErrorIs(t, err, utils.ErrAccountDisabled)
+	_, err = service.SignIn(context.Background(), "alice@example.com", "wrong", 0, utils.TokenOverrides{})
+	assert.ErrorIs(t, err, utils.ErrInvalidCredentials)
+}
@@ -0,0 +1,30 @@
+package usecase
+
+import (
+	"errors"
+
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+)
+
+// metricResult maps an outcome to a result label: the error code for known
+// failures and a generic value for everything else, so the label set stays
+// as small as the error catalog. Duplicate emails are counted as such even
+// when the client is not told.
+func metricResult(err error) string {
+	if err == nil {
+		return metrics.ResultSuccess
+	}
+
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		return string(utils.CodeEmailTaken)
+	}
+
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		return string(appErr.Code)
+	}
+
+	return metrics.ResultError
+}
@@ -0,0 +1,46 @@
+package usecase
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricResult(t *testing.T) {
+	tests := []struct {
+		name string
+		in   error
+		want string
+	}{
+		{
+			name: "success",
+			in:   nil,
+			want: "success",
+		},
+		{
+			name: "catalog error",
+			in:   fmt.Errorf("failed to sign in: %w", utils.ErrInvalidCredentials),
+			want: "invalid_credentials",
+		},
+		{
+			name: "undisclosed duplicate email",
+			in:   fmt.Errorf("failed to create user: %w", models.ErrDuplicateEmail),
+			want: "email_taken",
+		},
+		{
+			name: "unexpected error",
+			in:   fmt.Errorf("db error"),
+			want: "error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, metricResult(test.in))
+		})
+	}
+}
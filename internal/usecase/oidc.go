@@ -0,0 +1,473 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/oidc"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errProviderNotFound        = utils.ErrNotFound.WithDetail("The identity provider was not found.")
+	errLoginStateInvalid       = utils.ErrBadRequest.WithDetail("The sign-in has expired or was started in another browser.")
+	errIdentityRejected        = utils.ErrInvalidCredentials.WithDetail("The identity provider did not confirm the sign-in.")
+	errIdentityWithoutEmail    = utils.ErrInvalidCredentials.WithDetail("The identity provider did not share an email address.")
+	errIdentityUserGone        = utils.ErrInvalidCredentials.WithDetail("The account linked to the identity no longer exists.")
+	errIdentityEmailTaken      = utils.ErrEmailTaken.WithDetail("The email is registered to another account.")
+	errFederatedSignupClosed   = utils.ErrForbidden.WithDetail("Signing up with this identity provider is disabled.")
+	errIdentityLinkedElsewhere = utils.ErrConflict.WithDetail("The identity is linked to another account.")
+	errIdentityNotFound        = utils.ErrNotFound.WithDetail("The identity was not found.")
+	errLastCredential          = utils.ErrConflict.WithDetail("The last way to sign in cannot be removed.")
+	errReauthenticationNeeded  = utils.ErrInvalidCredentials.WithDetail("Confirm your password, or sign in again, to change how you sign in.")
+)
+
+// reauthWindow is how long after signing in users may change how they sign
+// in without confirming their password.
+const reauthWindow = 5 * time.Minute
+
+// IdentityProvider signs users in at an external provider. *oidc.Provider
+// implements it.
+type IdentityProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Identify(ctx context.Context, code, verifier, nonce string) (*oidc.Identity, error)
+}
+
+// FederatedProvider is an identity provider users can sign in with.
+type FederatedProvider struct {
+	Name   string
+	Client IdentityProvider
+	// DisableSignup rejects accounts not linked to a user instead of
+	// creating one.
+	DisableSignup bool
+	// LinkVerifiedEmail links accounts to the user with the same email when
+	// the provider verified it.
+	LinkVerifiedEmail bool
+}
+
+type OIDCServiceImpl struct {
+	Providers map[string]FederatedProvider
+	// Users and Identities serve the identities of the signed in user.
+	Users      UserRepository
+	Identities IdentityRepository
+	// Tx runs the sign-in, which may create a user and link the identity.
+	Tx     TxManager
+	Tokens *utils.TokenIssuer
+	Audit  AuditRecorder
+	// Verifier checks the passwords users re-authenticate with, against the
+	// users table when nil. It should be the one UserServiceImpl signs in
+	// with.
+	Verifier CredentialVerifier
+	// StateKey seals the login state kept in the browser for StateTTL.
+	StateKey []byte
+	StateTTL time.Duration
+}
+
+type IdentityRepository interface {
+	CreateIdentity(ctx context.Context, identity *models.Identity) error
+	FetchIdentity(ctx context.Context, issuer, subject string) (*models.Identity, error)
+	UpdateIdentityEmail(ctx context.Context, identityID uint, email string, verified bool) error
+	FetchIdentities(ctx context.Context, userID uint) ([]models.Identity, error)
+	DeleteIdentity(ctx context.Context, userID, identityID uint) error
+}
+
+// Credentials are the ways a user can sign in.
+type Credentials struct {
+	Password   bool
+	Identities []models.Identity
+}
+
+// OIDCLogin is a started sign-in. The user is sent to URL, and State is kept
+// in the browser until ExpiresAt to finish the sign-in with.
+type OIDCLogin struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+func NewOIDCServiceImpl(providers []FederatedProvider, users UserRepository, identities IdentityRepository, tx TxManager, tokens *utils.TokenIssuer, audit AuditRecorder, stateKey []byte, stateTTL time.Duration) *OIDCServiceImpl {
+	byName := make(map[string]FederatedProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name] = provider
+	}
+
+	return &OIDCServiceImpl{
+		Providers:  byName,
+		Users:      users,
+		Identities: identities,
+		Tx:         tx,
+		Tokens:     tokens,
+		Audit:      audit,
+		StateKey:   stateKey,
+		StateTTL:   stateTTL,
+	}
+}
+
+// StartLogin starts a sign-in with the named provider for a user of the
+// tenant in ctx.
+func (s *OIDCServiceImpl) StartLogin(ctx context.Context, providerName string) (login OIDCLogin, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.StartLogin")
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return login, errProviderNotFound
+	}
+
+	return s.startLogin(ctx, provider, 0)
+}
+
+// StartLink starts linking an account at the named provider to the signed in
+// user, who must confirm their password or have signed in recently. The
+// sign-in finishes with FinishLogin like any other.
+func (s *OIDCServiceImpl) StartLink(ctx context.Context, providerName, password string) (login OIDCLogin, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.StartLink")
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return login, errProviderNotFound
+	}
+
+	user, err := s.reauthenticate(ctx, password)
+	if err != nil {
+		return login, err
+	}
+
+	return s.startLogin(ctx, provider, user.ID)
+}
+
+// startLogin seals the state of a sign-in with provider, which links the
+// account to the user link when it is not zero.
+func (s *OIDCServiceImpl) startLogin(ctx context.Context, provider FederatedProvider, link uint) (login OIDCLogin, err error) {
+	state, err := oidc.NewLoginState(provider.Name, tenant.OfContext(ctx))
+	if err != nil {
+		return login, err
+	}
+	state.Link = link
+
+	login.URL, err = provider.Client.AuthCodeURL(ctx, state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		return login, err
+	}
+
+	login.ExpiresAt = time.Now().Add(s.StateTTL)
+	login.State, err = state.Seal(s.StateKey, login.ExpiresAt)
+	if err != nil {
+		return login, err
+	}
+
+	return login, nil
+}
+
+// FinishLogin signs in the user the provider redirected back with code and
+// state. sealedState is the State of the OIDCLogin the sign-in started with.
+// Accounts not yet linked to a user are linked to the user with the same
+// verified email, or to a new user, as the provider allows. Sign-ins started
+// with StartLink link the account to the user who started them instead.
+func (s *OIDCServiceImpl) FinishLogin(ctx context.Context, providerName, sealedState, state, code string, overrides utils.TokenOverrides) (tokens utils.TokenPair, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.FinishLogin")
+	var subject string
+	var linked, created bool
+	defer func() {
+		metrics.RecordSignIn(metricResult(err))
+		if created {
+			metrics.RecordSignup(metricResult(err))
+			recordAudit(ctx, s.Audit, models.AuditSignup, subject, subject, err)
+		}
+		if linked {
+			recordAudit(ctx, s.Audit, models.AuditIdentityLink, subject, subject, err)
+		}
+		recordAudit(ctx, s.Audit, models.AuditFederatedSignIn, subject, subject, err)
+		tracing.End(span, err)
+	}()
+
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return tokens, errProviderNotFound
+	}
+
+	// The state proves the sign-in was started by this browser
+	login, err := oidc.OpenLoginState(s.StateKey, sealedState)
+	if err != nil || login.Provider != provider.Name || login.Tenant != tenant.OfContext(ctx) ||
+		subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1 {
+		logging.FromContext(ctx).Info("federated sign in rejected", "provider", provider.Name, "reason", "invalid_state")
+		return tokens, errLoginStateInvalid
+	}
+
+	identity, err := provider.Client.Identify(ctx, code, login.Verifier, login.Nonce)
+	if errors.Is(err, oidc.ErrExchange) || errors.Is(err, oidc.ErrInvalidIDToken) || errors.Is(err, oidc.ErrUserInfo) {
+		logging.FromContext(ctx).Info("federated sign in rejected", "provider", provider.Name, "reason", err.Error())
+		return tokens, errIdentityRejected.Wrap(err)
+	}
+
+	if err != nil {
+		return tokens, err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return tokens, err
+	}
+
+	var user *models.User
+	refreshToken := models.NewRefreshToken(token, s.Tokens.RefreshTokenExpiry(overrides))
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		var err error
+		if login.Link != 0 {
+			user, linked, err = linkFederatedUser(ctx, repos, provider, identity, login.Link)
+		} else {
+			user, linked, created, err = resolveFederatedUser(ctx, repos, provider, identity)
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.DisabledAt != nil {
+			return utils.ErrAccountDisabled
+		}
+
+		refreshToken.ID = 0
+		refreshToken.UserID = user.ID
+		return repos.Tokens.CreateRefreshToken(ctx, &refreshToken)
+	})
+	if user != nil {
+		subject = models.AuditUser(user.ID)
+	}
+	if err != nil {
+		// Nothing was created or linked when the transaction failed
+		linked, created = false, false
+		logging.FromContext(ctx).Info("federated sign in rejected", "provider", provider.Name, "reason", metricResult(err))
+		return tokens, err
+	}
+
+	logging.FromContext(ctx).Info("user signed in", "user_id", user.ID, "provider", provider.Name, "created", created)
+
+	accessToken, err := s.Tokens.SignInAccessToken(ctx, user.ID, 0, overrides)
+	if err != nil {
+		return tokens, err
+	}
+
+	tokens.AccessToken = accessToken
+	tokens.RefreshToken = refreshToken.Token
+	tokens.RefreshTokenExpiresAt = refreshToken.ExpiredAt
+
+	return tokens, nil
+}
+
+// resolveFederatedUser returns the user identity is linked to, linking it to
+// an existing or new user first when the provider allows. It reports whether
+// the identity was linked and whether the user was created.
+func resolveFederatedUser(ctx context.Context, repos TxRepositories, provider FederatedProvider, identity *oidc.Identity) (user *models.User, linked, created bool, err error) {
+	existing, err := repos.Identities.FetchIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	if existing != nil {
+		if identity.Email != "" && (existing.Email != identity.Email || existing.EmailVerified != identity.EmailVerified) {
+			if err := repos.Identities.UpdateIdentityEmail(ctx, existing.ID, identity.Email, identity.EmailVerified); err != nil {
+				return nil, false, false, err
+			}
+		}
+
+		user, err = repos.Users.FetchUserByID(ctx, existing.UserID)
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		if user == nil {
+			return nil, false, false, errIdentityUserGone
+		}
+
+		return user, false, false, nil
+	}
+
+	if identity.Email == "" {
+		return nil, false, false, errIdentityWithoutEmail
+	}
+
+	user, err = repos.Users.FetchUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	switch {
+	case user != nil && !(provider.LinkVerifiedEmail && identity.EmailVerified):
+		// Only the provider vouching for the email proves the account
+		// belongs to the owner of the user
+		return nil, false, false, errIdentityEmailTaken
+	case user == nil && provider.DisableSignup:
+		return nil, false, false, errFederatedSignupClosed
+	case user == nil:
+		// Users created at federated sign-in have no password
+		user = models.NewUser(identity.Email, "")
+		userID, err := repos.Users.CreateUser(ctx, user)
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			return nil, false, false, errIdentityEmailTaken
+		}
+
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		user.ID = userID
+		created = true
+	}
+
+	link := models.NewIdentity(user.ID, provider.Name, identity.Issuer, identity.Subject)
+	link.Email = identity.Email
+	link.EmailVerified = identity.EmailVerified
+	if err := repos.Identities.CreateIdentity(ctx, link); err != nil {
+		return nil, false, false, err
+	}
+
+	return user, true, created, nil
+}
+
+// linkFederatedUser links identity to the user with userID, unless it is
+// linked to another user. It reports whether the identity was linked.
+func linkFederatedUser(ctx context.Context, repos TxRepositories, provider FederatedProvider, identity *oidc.Identity, userID uint) (*models.User, bool, error) {
+	user, err := repos.Users.FetchUserByID(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if user == nil {
+		return nil, false, errIdentityUserGone
+	}
+
+	existing, err := repos.Identities.FetchIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if existing != nil && existing.UserID != user.ID {
+		return nil, false, errIdentityLinkedElsewhere
+	}
+
+	if existing != nil {
+		return user, false, nil
+	}
+
+	link := models.NewIdentity(user.ID, provider.Name, identity.Issuer, identity.Subject)
+	link.Email = identity.Email
+	link.EmailVerified = identity.EmailVerified
+	err = repos.Identities.CreateIdentity(ctx, link)
+	if errors.Is(err, models.ErrDuplicateIdentity) {
+		return nil, false, errIdentityLinkedElsewhere
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+// ListIdentities returns how the signed in user can sign in.
+func (s *OIDCServiceImpl) ListIdentities(ctx context.Context) (credentials Credentials, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.ListIdentities")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.Users.FetchUserByID(ctx, currentUserID(ctx))
+	if err != nil {
+		return credentials, err
+	}
+
+	if user == nil {
+		return credentials, utils.ErrUnauthorized
+	}
+
+	credentials.Password = user.Password != ""
+	credentials.Identities, err = s.Identities.FetchIdentities(ctx, user.ID)
+	if err != nil {
+		return credentials, err
+	}
+
+	return credentials, nil
+}
+
+// UnlinkIdentity unlinks an identity from the signed in user, who must
+// confirm their password or have signed in recently. Users keep at least one
+// way to sign in.
+func (s *OIDCServiceImpl) UnlinkIdentity(ctx context.Context, identityID uint, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.UnlinkIdentity")
+	var subject string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditIdentityUnlink, subject, models.AuditIdentity(identityID), err)
+		tracing.End(span, err)
+	}()
+
+	user, err := s.reauthenticate(ctx, password)
+	if err != nil {
+		return err
+	}
+	subject = models.AuditUser(user.ID)
+
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		identities, err := repos.Identities.FetchIdentities(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if user.Password == "" && len(identities) == 1 && identities[0].ID == identityID {
+			return errLastCredential
+		}
+
+		err = repos.Identities.DeleteIdentity(ctx, user.ID, identityID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errIdentityNotFound
+		}
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("identity unlinked", "user_id", user.ID, "identity_id", identityID)
+	return nil
+}
+
+// reauthenticate returns the signed in user once they confirmed their
+// password with the credential verifier, or signed in within reauthWindow.
+func (s *OIDCServiceImpl) reauthenticate(ctx context.Context, password string) (*models.User, error) {
+	user, err := s.Users.FetchUserByID(ctx, currentUserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, utils.ErrUnauthorized
+	}
+
+	if password != "" {
+		verified, err := credentialVerifier(s.Verifier, s.Users).VerifyCredentials(ctx, user.Email, password)
+		if errors.Is(err, utils.ErrInvalidCredentials) || (err == nil && verified.ID != user.ID) {
+			return nil, errReauthenticationNeeded
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+
+	authTime := utils.RequestInfoFromContext(ctx).AuthTime
+	if authTime.IsZero() || time.Since(authTime) > reauthWindow {
+		return nil, errReauthenticationNeeded
+	}
+
+	return user, nil
+}
@@ -0,0 +1,631 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/ldapauth"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/oidc"
+	"github.com/soicchi/auth_api/internal/tenant"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockIdentityRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdentityRepository) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	args := m.Called(identity)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) FetchIdentity(ctx context.Context, issuer, subject string) (*models.Identity, error) {
+	args := m.Called(issuer, subject)
+	return args.Get(0).(*models.Identity), args.Error(1)
+}
+
+func (m *MockIdentityRepository) UpdateIdentityEmail(ctx context.Context, identityID uint, email string, verified bool) error {
+	args := m.Called(identityID, email, verified)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) FetchIdentities(ctx context.Context, userID uint) ([]models.Identity, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Identity), args.Error(1)
+}
+
+func (m *MockIdentityRepository) DeleteIdentity(ctx context.Context, userID, identityID uint) error {
+	args := m.Called(userID, identityID)
+	return args.Error(0)
+}
+
+type MockIdentityProvider struct {
+	mock.Mock
+}
+
+func (m *MockIdentityProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	args := m.Called(state, nonce, verifier)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockIdentityProvider) Identify(ctx context.Context, code, verifier, nonce string) (*oidc.Identity, error) {
+	args := m.Called(code, verifier, nonce)
+	return args.Get(0).(*oidc.Identity), args.Error(1)
+}
+
+const testIssuer = "https://idp.example.com"
+
+var testStateKey = oidc.StateKey("test_secret")
+
+type oidcMocks struct {
+	users      MockUserRepository
+	tokens     MockRefreshTokenRepository
+	identities MockIdentityRepository
+	provider   MockIdentityProvider
+}
+
+func newTestOIDCService(m *oidcMocks, provider FederatedProvider) *OIDCServiceImpl {
+	provider.Name = "test"
+	provider.Client = &m.provider
+	tx := &fakeTxManager{repos: TxRepositories{Users: &m.users, Tokens: &m.tokens, Identities: &m.identities}}
+	return NewOIDCServiceImpl([]FederatedProvider{provider}, &m.users, &m.identities, tx, newTestTokenIssuer(), &fakeAuditRecorder{}, testStateKey, 10*time.Minute)
+}
+
+// newTestLoginState seals a sign-in started with the test provider.
+func newTestLoginState(t *testing.T, provider, tenantID string) (oidc.LoginState, string) {
+	return newTestLinkState(t, provider, tenantID, 0)
+}
+
+// newTestLinkState seals a sign-in linking an account to the user link.
+func newTestLinkState(t *testing.T, provider, tenantID string, link uint) (oidc.LoginState, string) {
+	state, err := oidc.NewLoginState(provider, tenantID)
+	assert.NoError(t, err)
+	state.Link = link
+
+	sealed, err := state.Seal(testStateKey, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	return state, sealed
+}
+
+func TestStartLogin(t *testing.T) {
+	var m oidcMocks
+	m.provider.On("AuthCodeURL", mock.Anything, mock.Anything, mock.Anything).Return(testIssuer+"/authorize?state=x", nil)
+	service := newTestOIDCService(&m, FederatedProvider{})
+	ctx := tenant.WithContext(context.Background(), "acme")
+
+	login, err := service.StartLogin(ctx, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, testIssuer+"/authorize?state=x", login.URL)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), login.ExpiresAt, time.Minute)
+
+	state, err := oidc.OpenLoginState(testStateKey, login.State)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", state.Provider)
+	assert.Equal(t, "acme", state.Tenant)
+	m.provider.AssertCalled(t, "AuthCodeURL", state.State, state.Nonce, state.Verifier)
+
+	_, err = service.StartLogin(ctx, "unknown")
+	assert.ErrorIs(t, err, utils.ErrNotFound)
+}
+
+func TestFinishLogin(t *testing.T) {
+	verified := &oidc.Identity{Issuer: testIssuer, Subject: "alice", Email: "alice@example.com", EmailVerified: true}
+	unverified := &oidc.Identity{Issuer: testIssuer, Subject: "alice", Email: "alice@example.com"}
+	linked := &models.Identity{UserID: 1, Issuer: testIssuer, Subject: "alice", Email: "alice@example.com", EmailVerified: true}
+	linked.ID = 3
+	user := &models.User{Email: "alice@example.com", Password: "hashed"}
+	user.ID = 1
+	disabledAt := time.Now()
+	disabled := &models.User{Email: "alice@example.com", DisabledAt: &disabledAt}
+	disabled.ID = 1
+	errUnreachable := errors.New("connection refused")
+
+	createsToken := func(m *oidcMocks) {
+		m.tokens.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+			return token.UserID == 1 && token.Token != ""
+		})).Return(nil)
+	}
+	createsIdentity := func(m *oidcMocks) {
+		m.identities.On("CreateIdentity", mock.MatchedBy(func(identity *models.Identity) bool {
+			return identity.UserID == 1 && identity.Provider == "test" && identity.Issuer == testIssuer &&
+				identity.Subject == "alice" && identity.Email == "alice@example.com"
+		})).Return(nil)
+	}
+
+	tests := []struct {
+		name        string
+		provider    FederatedProvider
+		identity    *oidc.Identity
+		identifyErr error
+		mock        func(m *oidcMocks)
+		wantAudit   []string
+		wantErr     error
+	}{
+		{
+			name:     "linked identity",
+			identity: verified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return(linked, nil)
+				m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+				createsToken(m)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+		},
+		{
+			name:     "linked identity with a new email",
+			identity: &oidc.Identity{Issuer: testIssuer, Subject: "alice", Email: "alice@example.org", EmailVerified: true},
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return(linked, nil)
+				m.identities.On("UpdateIdentityEmail", uint(3), "alice@example.org", true).Return(nil)
+				m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+				createsToken(m)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+		},
+		{
+			name:     "new account creates a user",
+			identity: unverified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+				m.users.On("FetchUserByEmail", "alice@example.com").Return((*models.User)(nil), nil)
+				m.users.On("CreateUser", mock.MatchedBy(func(user *models.User) bool {
+					return user.Email == "alice@example.com" && user.Password == ""
+				})).Return(uint(1), nil)
+				createsIdentity(m)
+				createsToken(m)
+			},
+			wantAudit: []string{models.AuditSignup, models.AuditIdentityLink, models.AuditFederatedSignIn},
+		},
+		{
+			name:     "new account links the user with its verified email",
+			provider: FederatedProvider{LinkVerifiedEmail: true},
+			identity: verified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+				m.users.On("FetchUserByEmail", "alice@example.com").Return(user, nil)
+				createsIdentity(m)
+				createsToken(m)
+			},
+			wantAudit: []string{models.AuditIdentityLink, models.AuditFederatedSignIn},
+		},
+		{
+			name:     "unverified email of a registered user",
+			provider: FederatedProvider{LinkVerifiedEmail: true},
+			identity: unverified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+				m.users.On("FetchUserByEmail", "alice@example.com").Return(user, nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrEmailTaken,
+		},
+		{
+			name:     "verified email of a registered user without linking",
+			identity: verified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+				m.users.On("FetchUserByEmail", "alice@example.com").Return(user, nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrEmailTaken,
+		},
+		{
+			name:     "signup disabled",
+			provider: FederatedProvider{DisableSignup: true},
+			identity: verified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+				m.users.On("FetchUserByEmail", "alice@example.com").Return((*models.User)(nil), nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrForbidden,
+		},
+		{
+			name:     "new account without email",
+			identity: &oidc.Identity{Issuer: testIssuer, Subject: "alice"},
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "disabled user",
+			identity: verified,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return(linked, nil)
+				m.users.On("FetchUserByID", uint(1)).Return(disabled, nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrAccountDisabled,
+		},
+		{
+			name:        "provider rejects the code",
+			identifyErr: oidc.ErrExchange,
+			mock:        func(m *oidcMocks) {},
+			wantAudit:   []string{models.AuditFederatedSignIn},
+			wantErr:     utils.ErrInvalidCredentials,
+		},
+		{
+			name:        "provider unreachable",
+			identifyErr: errUnreachable,
+			mock:        func(m *oidcMocks) {},
+			wantAudit:   []string{models.AuditFederatedSignIn},
+			wantErr:     errUnreachable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m oidcMocks
+			state, sealed := newTestLoginState(t, "test", tenant.Default)
+			m.provider.On("Identify", "code", state.Verifier, state.Nonce).Return(test.identity, test.identifyErr)
+			test.mock(&m)
+			service := newTestOIDCService(&m, test.provider)
+			audit := &fakeAuditRecorder{}
+			service.Audit = audit
+
+			tokens, err := service.FinishLogin(context.Background(), "test", sealed, state.State, "code", utils.TokenOverrides{})
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				assert.Empty(t, tokens.AccessToken)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEmpty(t, tokens.RefreshToken)
+			}
+
+			var types []string
+			for _, event := range audit.events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(t, test.wantAudit, types)
+			m.users.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+			m.identities.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFinishLoginState(t *testing.T) {
+	state, sealed := newTestLoginState(t, "test", tenant.Default)
+	_, otherProvider := newTestLoginState(t, "other", tenant.Default)
+	_, otherTenant := newTestLoginState(t, "test", "acme")
+
+	tests := []struct {
+		name   string
+		sealed string
+		state  string
+	}{
+		{name: "state mismatch", sealed: sealed, state: "another-state"},
+		{name: "missing cookie", sealed: "", state: state.State},
+		{name: "started with another provider", sealed: otherProvider, state: state.State},
+		{name: "started for another tenant", sealed: otherTenant, state: state.State},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m oidcMocks
+			service := newTestOIDCService(&m, FederatedProvider{})
+
+			_, err := service.FinishLogin(context.Background(), "test", test.sealed, test.state, "code", utils.TokenOverrides{})
+			assert.ErrorIs(t, err, utils.ErrBadRequest)
+			m.provider.AssertNotCalled(t, "Identify", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestFinishLoginLink(t *testing.T) {
+	identity := &oidc.Identity{Issuer: testIssuer, Subject: "alice", Email: "alice@example.org"}
+	user := &models.User{Email: "alice@example.com", Password: "hashed"}
+	user.ID = 1
+	linkedHere := &models.Identity{UserID: 1, Issuer: testIssuer, Subject: "alice"}
+	linkedElsewhere := &models.Identity{UserID: 2, Issuer: testIssuer, Subject: "alice"}
+
+	createsToken := func(m *oidcMocks) {
+		m.tokens.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+			return token.UserID == 1
+		})).Return(nil)
+	}
+
+	tests := []struct {
+		name      string
+		mock      func(m *oidcMocks)
+		wantAudit []string
+		wantErr   error
+	}{
+		{
+			name: "links the account whatever its email",
+			mock: func(m *oidcMocks) {
+				m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return((*models.Identity)(nil), nil)
+				m.identities.On("CreateIdentity", mock.MatchedBy(func(identity *models.Identity) bool {
+					return identity.UserID == 1 && identity.Subject == "alice" && identity.Email == "alice@example.org"
+				})).Return(nil)
+				createsToken(m)
+			},
+			wantAudit: []string{models.AuditIdentityLink, models.AuditFederatedSignIn},
+		},
+		{
+			name: "account already linked to the user",
+			mock: func(m *oidcMocks) {
+				m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return(linkedHere, nil)
+				createsToken(m)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+		},
+		{
+			name: "account linked to another user",
+			mock: func(m *oidcMocks) {
+				m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+				m.identities.On("FetchIdentity", testIssuer, "alice").Return(linkedElsewhere, nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrConflict,
+		},
+		{
+			name: "user deleted meanwhile",
+			mock: func(m *oidcMocks) {
+				m.users.On("FetchUserByID", uint(1)).Return((*models.User)(nil), nil)
+			},
+			wantAudit: []string{models.AuditFederatedSignIn},
+			wantErr:   utils.ErrInvalidCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m oidcMocks
+			state, sealed := newTestLinkState(t, "test", tenant.Default, 1)
+			m.provider.On("Identify", "code", state.Verifier, state.Nonce).Return(identity, nil)
+			test.mock(&m)
+			service := newTestOIDCService(&m, FederatedProvider{})
+			audit := &fakeAuditRecorder{}
+			service.Audit = audit
+
+			tokens, err := service.FinishLogin(context.Background(), "test", sealed, state.State, "code", utils.TokenOverrides{})
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tokens.AccessToken)
+			}
+
+			var types []string
+			for _, event := range audit.events {
+				types = append(types, event.Type)
+			}
+			assert.Equal(t, test.wantAudit, types)
+			m.users.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+			m.identities.AssertExpectations(t)
+		})
+	}
+}
+
+// signedIn is a request of user 1 whose access token was issued at authTime.
+func signedIn(authTime time.Time) context.Context {
+	return utils.WithRequestInfo(context.Background(), utils.RequestInfo{UserID: 1, AuthTime: authTime})
+}
+
+func TestStartLink(t *testing.T) {
+	hashedPassword, _ := utils.HashPassword(context.Background(), "password")
+	withPassword := &models.User{Email: "alice@example.com", Password: hashedPassword}
+	withPassword.ID = 1
+	withoutPassword := &models.User{Email: "alice@example.com"}
+	withoutPassword.ID = 1
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		provider string
+		password string
+		user     *models.User
+		wantErr  error
+	}{
+		{
+			name:     "confirmed with the password",
+			ctx:      signedIn(time.Time{}),
+			provider: "test",
+			password: "password",
+			user:     withPassword,
+		},
+		{
+			name:     "wrong password",
+			ctx:      signedIn(time.Now()),
+			provider: "test",
+			password: "wrong",
+			user:     withPassword,
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "recent sign-in",
+			ctx:      signedIn(time.Now().Add(-time.Minute)),
+			provider: "test",
+			user:     withoutPassword,
+		},
+		{
+			name:     "sign-in too long ago",
+			ctx:      signedIn(time.Now().Add(-time.Hour)),
+			provider: "test",
+			user:     withoutPassword,
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "token not issued at sign-in",
+			ctx:      signedIn(time.Time{}),
+			provider: "test",
+			user:     withPassword,
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown provider",
+			ctx:      signedIn(time.Now()),
+			provider: "unknown",
+			wantErr:  utils.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m oidcMocks
+			m.provider.On("AuthCodeURL", mock.Anything, mock.Anything, mock.Anything).Return(testIssuer+"/authorize", nil)
+			if test.user != nil {
+				m.users.On("FetchUserByID", uint(1)).Return(test.user, nil)
+				m.users.On("FetchUserByEmail", test.user.Email).Return(test.user, nil).Maybe()
+			}
+			service := newTestOIDCService(&m, FederatedProvider{})
+
+			login, err := service.StartLink(test.ctx, test.provider, test.password)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				m.provider.AssertNotCalled(t, "AuthCodeURL", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			state, err := oidc.OpenLoginState(testStateKey, login.State)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), state.Link)
+		})
+	}
+}
+
+func TestStartLinkReauthenticatesWithVerifier(t *testing.T) {
+	// Directory users have no password in the users table
+	user := &models.User{Email: "alice@example.com"}
+	user.ID = 1
+	var m oidcMocks
+	var directory MockDirectory
+	m.provider.On("AuthCodeURL", mock.Anything, mock.Anything, mock.Anything).Return(testIssuer+"/authorize", nil)
+	m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+	m.users.On("FetchUserByEmail", "alice@example.com").Return(user, nil)
+	directory.On("Authenticate", "alice@example.com", "password").Return(&ldapauth.Entry{Email: "alice@example.com"}, nil)
+	directory.On("Authenticate", "alice@example.com", "wrong").Return((*ldapauth.Entry)(nil), ldapauth.ErrInvalidCredentials)
+	service := newTestOIDCService(&m, FederatedProvider{})
+	service.Verifier = NewLDAPVerifier(&directory, &m.users, &fakeAuditRecorder{}, nil, false)
+
+	_, err := service.StartLink(signedIn(time.Time{}), "test", "password")
+	assert.NoError(t, err)
+	_, err = service.StartLink(signedIn(time.Now()), "test", "wrong")
+	assert.ErrorIs(t, err, utils.ErrInvalidCredentials)
+	directory.AssertExpectations(t)
+}
+
+func TestListIdentities(t *testing.T) {
+	var m oidcMocks
+	user := &models.User{Email: "alice@example.com"}
+	user.ID = 1
+	identities := []models.Identity{{UserID: 1, Provider: "test", Subject: "alice"}}
+	m.users.On("FetchUserByID", uint(1)).Return(user, nil)
+	m.identities.On("FetchIdentities", uint(1)).Return(identities, nil)
+	service := newTestOIDCService(&m, FederatedProvider{})
+
+	credentials, err := service.ListIdentities(signedIn(time.Time{}))
+	assert.NoError(t, err)
+	assert.False(t, credentials.Password)
+	assert.Equal(t, identities, credentials.Identities)
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	hashedPassword, _ := utils.HashPassword(context.Background(), "password")
+	withPassword := &models.User{Email: "alice@example.com", Password: hashedPassword}
+	withPassword.ID = 1
+	withoutPassword := &models.User{Email: "alice@example.com"}
+	withoutPassword.ID = 1
+	google := models.Identity{UserID: 1, Provider: "google"}
+	google.ID = 3
+	github := models.Identity{UserID: 1, Provider: "github"}
+	github.ID = 4
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		password string
+		user     *models.User
+		mock     func(m *oidcMocks)
+		wantErr  error
+	}{
+		{
+			name:     "last identity of a user with a password",
+			ctx:      signedIn(time.Time{}),
+			password: "password",
+			user:     withPassword,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentities", uint(1)).Return([]models.Identity{google}, nil)
+				m.identities.On("DeleteIdentity", uint(1), uint(3)).Return(nil)
+			},
+		},
+		{
+			name: "one of the identities of a user without a password",
+			ctx:  signedIn(time.Now()),
+			user: withoutPassword,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentities", uint(1)).Return([]models.Identity{google, github}, nil)
+				m.identities.On("DeleteIdentity", uint(1), uint(3)).Return(nil)
+			},
+		},
+		{
+			name: "last identity of a user without a password",
+			ctx:  signedIn(time.Now()),
+			user: withoutPassword,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentities", uint(1)).Return([]models.Identity{google}, nil)
+			},
+			wantErr: utils.ErrConflict,
+		},
+		{
+			name:     "identity of another user",
+			ctx:      signedIn(time.Time{}),
+			password: "password",
+			user:     withPassword,
+			mock: func(m *oidcMocks) {
+				m.identities.On("FetchIdentities", uint(1)).Return([]models.Identity{github}, nil)
+				m.identities.On("DeleteIdentity", uint(1), uint(3)).Return(gorm.ErrRecordNotFound)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+		{
+			name:     "not re-authenticated",
+			ctx:      signedIn(time.Time{}),
+			password: "wrong",
+			user:     withPassword,
+			mock:     func(m *oidcMocks) {},
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m oidcMocks
+			m.users.On("FetchUserByID", uint(1)).Return(test.user, nil)
+			m.users.On("FetchUserByEmail", test.user.Email).Return(test.user, nil).Maybe()
+			test.mock(&m)
+			service := newTestOIDCService(&m, FederatedProvider{})
+			audit := &fakeAuditRecorder{}
+			service.Audit = audit
+
+			err := service.UnlinkIdentity(test.ctx, 3, test.password)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if assert.Len(t, audit.events, 1) {
+				assert.Equal(t, models.AuditIdentityUnlink, audit.events[0].Type)
+				assert.Equal(t, models.AuditIdentity(3), audit.events[0].Target)
+			}
+			m.identities.AssertExpectations(t)
+		})
+	}
+}
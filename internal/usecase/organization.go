@@ -0,0 +1,451 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errOrganizationNotFound = utils.ErrNotFound.WithDetail("The organization was not found.")
+	errMemberNotFound       = utils.ErrNotFound.WithDetail("The member was not found.")
+	errInvitationNotFound   = utils.ErrNotFound.WithDetail("The invitation was not found.")
+	errInvitationInvalid    = utils.ErrNotFound.WithDetail("The invitation was not found, has expired or was already accepted.")
+	errAlreadyMember        = utils.ErrConflict.WithDetail("The user is already a member of the organization.")
+	errLastOwner            = utils.ErrConflict.WithDetail("An organization must keep at least one owner.")
+	errOrgRoleForbidden     = utils.ErrForbidden.WithDetail("Your role in the organization does not allow this.")
+)
+
+type OrganizationServiceImpl struct {
+	Repo      OrganizationRepository
+	UserRepo  UserRepository
+	TokenRepo RefreshTokenRepository
+	// Tx runs changes spanning several repository calls.
+	Tx     TxManager
+	Tokens *utils.TokenIssuer
+	Audit  AuditRecorder
+	// InvitationTTL is how long invitations can be accepted.
+	InvitationTTL time.Duration
+}
+
+type OrganizationRepository interface {
+	CreateOrganization(ctx context.Context, org *models.Organization, ownerID uint) error
+	FetchOrganization(ctx context.Context, orgID uint) (*models.Organization, error)
+	QueryOrganizations(ctx context.Context, query models.Query) ([]models.Organization, int64, error)
+	UpdateOrganization(ctx context.Context, org *models.Organization) error
+	DeleteOrganization(ctx context.Context, orgID uint) error
+	FetchMemberships(ctx context.Context, userID uint) ([]models.Membership, error)
+	FetchMembership(ctx context.Context, orgID, userID uint) (*models.Membership, error)
+	FetchMembers(ctx context.Context, orgID uint) ([]models.Membership, error)
+	CreateMembership(ctx context.Context, membership *models.Membership) error
+	UpdateMemberRole(ctx context.Context, orgID, userID uint, role string) error
+	DeleteMembership(ctx context.Context, orgID, userID uint) error
+	AddMembers(ctx context.Context, orgID uint, userIDs []uint, role string) error
+	RemoveMembers(ctx context.Context, orgID uint, userIDs []uint) error
+	CountOwners(ctx context.Context, orgID uint) (int64, error)
+	CreateInvitation(ctx context.Context, invitation *models.Invitation, token string) error
+	FetchInvitations(ctx context.Context, orgID uint, now time.Time) ([]models.Invitation, error)
+	FetchInvitationByHash(ctx context.Context, tokenHash string) (*models.Invitation, error)
+	AcceptInvitation(ctx context.Context, invitationID uint, acceptedAt time.Time) error
+	DeleteInvitation(ctx context.Context, orgID, invitationID uint) error
+}
+
+func NewOrganizationServiceImpl(repo OrganizationRepository, userRepo UserRepository, tokenRepo RefreshTokenRepository, tx TxManager, tokens *utils.TokenIssuer, audit AuditRecorder, invitationTTL time.Duration) *OrganizationServiceImpl {
+	return &OrganizationServiceImpl{
+		Repo:          repo,
+		UserRepo:      userRepo,
+		TokenRepo:     tokenRepo,
+		Tx:            tx,
+		Tokens:        tokens,
+		Audit:         audit,
+		InvitationTTL: invitationTTL,
+	}
+}
+
+// CreateOrganization creates an organization owned by the calling user.
+func (s *OrganizationServiceImpl) CreateOrganization(ctx context.Context, name string) (org *models.Organization, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.CreateOrganization")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditOrgCreate, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	org = models.NewOrganization(name)
+	if err := s.Repo.CreateOrganization(ctx, org, currentUserID(ctx)); err != nil {
+		return nil, err
+	}
+
+	target = models.AuditOrganization(org.ID)
+	return org, nil
+}
+
+// ListOrganizations returns the memberships of the calling user.
+func (s *OrganizationServiceImpl) ListOrganizations(ctx context.Context) (memberships []models.Membership, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.ListOrganizations")
+	defer func() { tracing.End(span, err) }()
+
+	return s.Repo.FetchMemberships(ctx, currentUserID(ctx))
+}
+
+// SwitchOrganization starts a session of the calling user in the
+// organization: the tokens it issues carry the organization in their org_id
+// claim, and so do the access tokens refreshed from them.
+func (s *OrganizationServiceImpl) SwitchOrganization(ctx context.Context, orgID uint) (tokens utils.TokenPair, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.SwitchOrganization")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditOrgSwitch, "", models.AuditOrganization(orgID), err)
+		tracing.End(span, err)
+	}()
+
+	membership, err := s.fetchActorMembership(ctx, orgID)
+	if err != nil {
+		return tokens, err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return tokens, err
+	}
+
+	refreshToken := models.NewRefreshToken(token, s.Tokens.RefreshTokenExpiry(utils.TokenOverrides{}))
+	refreshToken.UserID = membership.UserID
+	refreshToken.OrganizationID = orgID
+	if err := s.TokenRepo.CreateRefreshToken(ctx, &refreshToken); err != nil {
+		return tokens, err
+	}
+
+	accessToken, err := s.Tokens.OrganizationAccessToken(ctx, membership.UserID, orgID, utils.TokenOverrides{})
+	if err != nil {
+		return tokens, err
+	}
+
+	tokens.AccessToken = accessToken
+	tokens.RefreshToken = refreshToken.Token
+	tokens.RefreshTokenExpiresAt = refreshToken.ExpiredAt
+	return tokens, nil
+}
+
+// ListMembers returns the members of an organization the calling user
+// belongs to.
+func (s *OrganizationServiceImpl) ListMembers(ctx context.Context, orgID uint) (members []models.Membership, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.ListMembers")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := s.fetchActorMembership(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	return s.Repo.FetchMembers(ctx, orgID)
+}
+
+// UpdateMemberRole changes the role of a member. Admins manage admins and
+// members; only owners grant or take away ownership, and the last owner
+// cannot be demoted.
+func (s *OrganizationServiceImpl) UpdateMemberRole(ctx context.Context, orgID, userID uint, role string) (err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.UpdateMemberRole")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditMemberRole, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	if !slices.Contains(models.OrgRoles, role) {
+		return utils.ErrValidationFailed.WithFields([]utils.FieldError{oneOfFieldError("role", role, models.OrgRoles)})
+	}
+
+	actor, err := s.fetchActorMembership(ctx, orgID, models.OrgRoleOwner, models.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		member, err := fetchMember(ctx, repos.Organizations, orgID, userID)
+		if err != nil {
+			return err
+		}
+
+		if (role == models.OrgRoleOwner || member.Role == models.OrgRoleOwner) && actor.Role != models.OrgRoleOwner {
+			return errOrgRoleForbidden
+		}
+
+		if member.Role == models.OrgRoleOwner && role != models.OrgRoleOwner {
+			if err := rejectLastOwner(ctx, repos.Organizations, orgID); err != nil {
+				return err
+			}
+		}
+
+		return repos.Organizations.UpdateMemberRole(ctx, orgID, userID, role)
+	})
+}
+
+// RemoveMember removes a member from an organization and revokes the
+// sessions the member has in it. Members may remove themselves; removing
+// others follows the rules of UpdateMemberRole.
+func (s *OrganizationServiceImpl) RemoveMember(ctx context.Context, orgID, userID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.RemoveMember")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditMemberRemove, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	actor, err := s.fetchActorMembership(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	self := actor.UserID == userID
+	if !self && actor.Role == models.OrgRoleMember {
+		return errOrgRoleForbidden
+	}
+
+	var revoked int64
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		member, err := fetchMember(ctx, repos.Organizations, orgID, userID)
+		if err != nil {
+			return err
+		}
+
+		if member.Role == models.OrgRoleOwner {
+			if !self && actor.Role != models.OrgRoleOwner {
+				return errOrgRoleForbidden
+			}
+
+			if err := rejectLastOwner(ctx, repos.Organizations, orgID); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.Organizations.DeleteMembership(ctx, orgID, userID); err != nil {
+			return err
+		}
+
+		deleted, err := repos.Tokens.DeleteByOrganization(ctx, userID, orgID)
+		revoked = deleted
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("member removed", "organization_id", orgID, "user_id", userID, "revoked_sessions", revoked)
+	return nil
+}
+
+// InviteMember invites email to join an organization with the role. The
+// token is only handed to the invitation.created webhook, whose subscribers
+// send the invitation email.
+func (s *OrganizationServiceImpl) InviteMember(ctx context.Context, orgID uint, email, role string) (invitation *models.Invitation, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.InviteMember")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditInviteCreate, "", models.AuditOrganization(orgID), err)
+		tracing.End(span, err)
+	}()
+
+	if !slices.Contains(models.OrgRoles, role) {
+		return nil, utils.ErrValidationFailed.WithFields([]utils.FieldError{oneOfFieldError("role", role, models.OrgRoles)})
+	}
+
+	actor, err := s.fetchActorMembership(ctx, orgID, models.OrgRoleOwner, models.OrgRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == models.OrgRoleOwner && actor.Role != models.OrgRoleOwner {
+		return nil, errOrgRoleForbidden
+	}
+
+	user, err := s.UserRepo.FetchUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		member, err := s.Repo.FetchMembership(ctx, orgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if member != nil {
+			return nil, errAlreadyMember
+		}
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation = models.NewInvitation(orgID, email, role, utils.HashToken(token), actor.UserID, time.Now().Add(s.InvitationTTL))
+	if err := s.Repo.CreateInvitation(ctx, invitation, token); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("member invited", "organization_id", orgID, "invitation_id", invitation.ID)
+	return invitation, nil
+}
+
+// ListInvitations returns the invitations of an organization that can still
+// be accepted.
+func (s *OrganizationServiceImpl) ListInvitations(ctx context.Context, orgID uint) (invitations []models.Invitation, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.ListInvitations")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := s.fetchActorMembership(ctx, orgID, models.OrgRoleOwner, models.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	return s.Repo.FetchInvitations(ctx, orgID, time.Now())
+}
+
+func (s *OrganizationServiceImpl) RevokeInvitation(ctx context.Context, orgID, invitationID uint) (err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.RevokeInvitation")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditInviteRevoke, "", models.AuditOrganization(orgID), err)
+		tracing.End(span, err)
+	}()
+
+	if _, err := s.fetchActorMembership(ctx, orgID, models.OrgRoleOwner, models.OrgRoleAdmin); err != nil {
+		return err
+	}
+
+	err = s.Repo.DeleteInvitation(ctx, orgID, invitationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errInvitationNotFound
+	}
+
+	return err
+}
+
+// AcceptInvitation makes the calling user a member through the invitation
+// with the token. The invitation must be addressed to the user's email.
+func (s *OrganizationServiceImpl) AcceptInvitation(ctx context.Context, token string) (membership *models.Membership, err error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.AcceptInvitation")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditInviteAccept, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	user, err := s.UserRepo.FetchUserByID(ctx, currentUserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errUserNotFound
+	}
+
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		accepted, err := acceptInvitation(ctx, repos.Organizations, token, user.Email, user.ID, time.Now())
+		membership = accepted
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	target = models.AuditOrganization(membership.OrganizationID)
+	logging.FromContext(ctx).Info("invitation accepted", "organization_id", membership.OrganizationID, "user_id", user.ID)
+	return membership, nil
+}
+
+// fetchActorMembership returns the membership of the calling user in the
+// organization, which must have one of roles unless none are given.
+// Organizations the user does not belong to are reported as not found.
+func (s *OrganizationServiceImpl) fetchActorMembership(ctx context.Context, orgID uint, roles ...string) (*models.Membership, error) {
+	membership, err := s.Repo.FetchMembership(ctx, orgID, currentUserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if membership == nil {
+		return nil, errOrganizationNotFound
+	}
+
+	if len(roles) > 0 && !slices.Contains(roles, membership.Role) {
+		return nil, errOrgRoleForbidden
+	}
+
+	return membership, nil
+}
+
+func fetchMember(ctx context.Context, repo OrganizationRepository, orgID, userID uint) (*models.Membership, error) {
+	member, err := repo.FetchMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if member == nil {
+		return nil, errMemberNotFound
+	}
+
+	return member, nil
+}
+
+func rejectLastOwner(ctx context.Context, repo OrganizationRepository, orgID uint) error {
+	owners, err := repo.CountOwners(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	if owners <= 1 {
+		return errLastOwner
+	}
+
+	return nil
+}
+
+// acceptInvitation makes the user a member through the invitation with the
+// token, which must be pending and addressed to email. The invitation is
+// marked as accepted first so that it cannot be used twice.
+func acceptInvitation(ctx context.Context, repo OrganizationRepository, token, email string, userID uint, now time.Time) (*models.Membership, error) {
+	invitation, err := repo.FetchInvitationByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation == nil || !invitation.Pending(now) {
+		return nil, errInvitationInvalid
+	}
+
+	if !strings.EqualFold(invitation.Email, email) {
+		return nil, utils.ErrForbidden.WithDetail("The invitation was sent to another email.")
+	}
+
+	err = repo.AcceptInvitation(ctx, invitation.ID, now)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvitationInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	membership := models.NewMembership(invitation.OrganizationID, userID, invitation.Role)
+	err = repo.CreateMembership(ctx, membership)
+	if errors.Is(err, models.ErrAlreadyMember) {
+		return nil, errAlreadyMember
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	membership.Organization = invitation.Organization
+	return membership, nil
+}
+
+func currentUserID(ctx context.Context) uint {
+	return utils.RequestInfoFromContext(ctx).UserID
+}
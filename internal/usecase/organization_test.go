@@ -0,0 +1,499 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockOrganizationRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrganizationRepository) CreateOrganization(ctx context.Context, org *models.Organization, ownerID uint) error {
+	args := m.Called(org, ownerID)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) FetchOrganization(ctx context.Context, orgID uint) (*models.Organization, error) {
+	args := m.Called(orgID)
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) QueryOrganizations(ctx context.Context, query models.Query) ([]models.Organization, int64, error) {
+	args := m.Called(query)
+	return args.Get(0).([]models.Organization), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockOrganizationRepository) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	args := m.Called(org)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) DeleteOrganization(ctx context.Context, orgID uint) error {
+	args := m.Called(orgID)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) FetchMemberships(ctx context.Context, userID uint) ([]models.Membership, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Membership), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) FetchMembership(ctx context.Context, orgID, userID uint) (*models.Membership, error) {
+	args := m.Called(orgID, userID)
+	return args.Get(0).(*models.Membership), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) FetchMembers(ctx context.Context, orgID uint) ([]models.Membership, error) {
+	args := m.Called(orgID)
+	return args.Get(0).([]models.Membership), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) CreateMembership(ctx context.Context, membership *models.Membership) error {
+	args := m.Called(membership)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID uint, role string) error {
+	args := m.Called(orgID, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) DeleteMembership(ctx context.Context, orgID, userID uint) error {
+	args := m.Called(orgID, userID)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) AddMembers(ctx context.Context, orgID uint, userIDs []uint, role string) error {
+	args := m.Called(orgID, userIDs, role)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) RemoveMembers(ctx context.Context, orgID uint, userIDs []uint) error {
+	args := m.Called(orgID, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) CountOwners(ctx context.Context, orgID uint) (int64, error) {
+	args := m.Called(orgID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation, token string) error {
+	args := m.Called(invitation, token)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) FetchInvitations(ctx context.Context, orgID uint, now time.Time) ([]models.Invitation, error) {
+	args := m.Called(orgID)
+	return args.Get(0).([]models.Invitation), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) FetchInvitationByHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	args := m.Called(tokenHash)
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) AcceptInvitation(ctx context.Context, invitationID uint, acceptedAt time.Time) error {
+	args := m.Called(invitationID)
+	return args.Error(0)
+}
+
+func (m *MockOrganizationRepository) DeleteInvitation(ctx context.Context, orgID, invitationID uint) error {
+	args := m.Called(orgID, invitationID)
+	return args.Error(0)
+}
+
+type orgMocks struct {
+	orgs   MockOrganizationRepository
+	users  MockUserRepository
+	tokens MockRefreshTokenRepository
+}
+
+func newTestOrganizationService(m *orgMocks) *OrganizationServiceImpl {
+	tx := &fakeTxManager{repos: TxRepositories{Users: &m.users, Tokens: &m.tokens, Organizations: &m.orgs}}
+	return NewOrganizationServiceImpl(&m.orgs, &m.users, &m.tokens, tx, newTestTokenIssuer(), &fakeAuditRecorder{}, 24*time.Hour)
+}
+
+// memberContext is a request by the user with ID 1.
+func memberContext() context.Context {
+	return utils.WithRequestInfo(context.Background(), utils.RequestInfo{UserID: 1})
+}
+
+func newTestMembership(orgID, userID uint, role string) *models.Membership {
+	return &models.Membership{OrganizationID: orgID, UserID: userID, Role: role}
+}
+
+func TestCreateOrganization(t *testing.T) {
+	var m orgMocks
+	m.orgs.On("CreateOrganization", mock.MatchedBy(func(org *models.Organization) bool {
+		return org.Name == "Acme"
+	}), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*models.Organization).ID = 5
+	})
+
+	org, err := newTestOrganizationService(&m).CreateOrganization(memberContext(), "Acme")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), org.ID)
+	m.orgs.AssertExpectations(t)
+}
+
+func TestSwitchOrganization(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantMock func(m *orgMocks)
+		wantErr  error
+	}{
+		{
+			name: "member",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleMember), nil)
+				m.tokens.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+					return token.UserID == 1 && token.OrganizationID == 5 && token.Token != ""
+				})).Return(nil)
+			},
+		},
+		{
+			name: "not a member",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return((*models.Membership)(nil), nil)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m orgMocks
+			test.wantMock(&m)
+
+			tokens, err := newTestOrganizationService(&m).SwitchOrganization(memberContext(), 5)
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				claims := jwt.MapClaims{}
+				_, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte("test_secret"), nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, float64(5), claims[utils.ClaimOrganization])
+				assert.NotEmpty(t, tokens.RefreshToken)
+			}
+			m.orgs.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		wantMock func(m *orgMocks)
+		wantErr  error
+	}{
+		{
+			name: "admin promotes member",
+			role: models.OrgRoleAdmin,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return(newTestMembership(5, 2, models.OrgRoleMember), nil)
+				m.orgs.On("UpdateMemberRole", uint(5), uint(2), models.OrgRoleAdmin).Return(nil)
+			},
+		},
+		{
+			name: "admin grants ownership",
+			role: models.OrgRoleOwner,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return(newTestMembership(5, 2, models.OrgRoleMember), nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name: "member changes roles",
+			role: models.OrgRoleAdmin,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleMember), nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name: "last owner demoted",
+			role: models.OrgRoleMember,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleOwner), nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return(newTestMembership(5, 2, models.OrgRoleOwner), nil)
+				m.orgs.On("CountOwners", uint(5)).Return(int64(1), nil)
+			},
+			wantErr: utils.ErrConflict,
+		},
+		{
+			name: "unknown member",
+			role: models.OrgRoleMember,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleOwner), nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return((*models.Membership)(nil), nil)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+		{
+			name:     "unknown role",
+			role:     "guest",
+			wantMock: func(m *orgMocks) {},
+			wantErr:  utils.ErrValidationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m orgMocks
+			test.wantMock(&m)
+
+			err := newTestOrganizationService(&m).UpdateMemberRole(memberContext(), 5, 2, test.role)
+			assert.ErrorIs(t, err, test.wantErr)
+			m.orgs.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		wantMock func(m *orgMocks)
+		wantErr  error
+	}{
+		{
+			name:   "admin removes member",
+			userID: 2,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return(newTestMembership(5, 2, models.OrgRoleMember), nil)
+				m.orgs.On("DeleteMembership", uint(5), uint(2)).Return(nil)
+				m.tokens.On("DeleteByOrganization", uint(2), uint(5)).Return(int64(1), nil)
+			},
+		},
+		{
+			name:   "member leaves",
+			userID: 1,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleMember), nil)
+				m.orgs.On("DeleteMembership", uint(5), uint(1)).Return(nil)
+				m.tokens.On("DeleteByOrganization", uint(1), uint(5)).Return(int64(0), nil)
+			},
+		},
+		{
+			name:   "member removes another",
+			userID: 2,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleMember), nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:   "admin removes owner",
+			userID: 2,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return(newTestMembership(5, 2, models.OrgRoleOwner), nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:   "last owner leaves",
+			userID: 1,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleOwner), nil)
+				m.orgs.On("CountOwners", uint(5)).Return(int64(1), nil)
+			},
+			wantErr: utils.ErrConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m orgMocks
+			test.wantMock(&m)
+
+			err := newTestOrganizationService(&m).RemoveMember(memberContext(), 5, test.userID)
+			assert.ErrorIs(t, err, test.wantErr)
+			m.orgs.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+		})
+	}
+}
+
+func TestInviteMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		wantMock func(m *orgMocks)
+		wantErr  error
+	}{
+		{
+			name: "new user",
+			role: models.OrgRoleMember,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+				m.users.On("FetchUserByEmail", "new@test.com").Return((*models.User)(nil), nil)
+				m.orgs.On("CreateInvitation", mock.MatchedBy(func(invitation *models.Invitation) bool {
+					return invitation.OrganizationID == 5 && invitation.Email == "new@test.com" && invitation.InvitedBy == 1 &&
+						invitation.Role == models.OrgRoleMember && invitation.TokenHash != ""
+				}), mock.MatchedBy(func(token string) bool {
+					return token != ""
+				})).Return(nil)
+			},
+		},
+		{
+			name: "existing member",
+			role: models.OrgRoleMember,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+				m.users.On("FetchUserByEmail", "new@test.com").Return(&models.User{Model: gorm.Model{ID: 2}}, nil)
+				m.orgs.On("FetchMembership", uint(5), uint(2)).Return(newTestMembership(5, 2, models.OrgRoleMember), nil)
+			},
+			wantErr: utils.ErrConflict,
+		},
+		{
+			name: "admin invites owner",
+			role: models.OrgRoleOwner,
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleAdmin), nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m orgMocks
+			test.wantMock(&m)
+
+			invitation, err := newTestOrganizationService(&m).InviteMember(memberContext(), 5, "new@test.com", test.role)
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				assert.WithinDuration(t, time.Now().Add(24*time.Hour), invitation.ExpiresAt, time.Minute)
+			}
+			m.orgs.AssertExpectations(t)
+			m.users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	pending := func() *models.Invitation {
+		return &models.Invitation{ID: 9, OrganizationID: 5, Email: "User@Test.com", Role: models.OrgRoleAdmin, ExpiresAt: time.Now().Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name     string
+		wantMock func(m *orgMocks)
+		wantErr  error
+	}{
+		{
+			name: "accepted",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return(pending(), nil)
+				m.orgs.On("AcceptInvitation", uint(9)).Return(nil)
+				m.orgs.On("CreateMembership", mock.MatchedBy(func(membership *models.Membership) bool {
+					return membership.OrganizationID == 5 && membership.UserID == 1 && membership.Role == models.OrgRoleAdmin
+				})).Return(nil)
+			},
+		},
+		{
+			name: "unknown token",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return((*models.Invitation)(nil), nil)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+		{
+			name: "expired",
+			wantMock: func(m *orgMocks) {
+				invitation := pending()
+				invitation.ExpiresAt = time.Now().Add(-time.Minute)
+				m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return(invitation, nil)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+		{
+			name: "other email",
+			wantMock: func(m *orgMocks) {
+				invitation := pending()
+				invitation.Email = "other@test.com"
+				m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return(invitation, nil)
+			},
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name: "accepted concurrently",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return(pending(), nil)
+				m.orgs.On("AcceptInvitation", uint(9)).Return(gorm.ErrRecordNotFound)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+		{
+			name: "already a member",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return(pending(), nil)
+				m.orgs.On("AcceptInvitation", uint(9)).Return(nil)
+				m.orgs.On("CreateMembership", mock.Anything).Return(models.ErrAlreadyMember)
+			},
+			wantErr: utils.ErrConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m orgMocks
+			m.users.On("FetchUserByID", uint(1)).Return(&models.User{Model: gorm.Model{ID: 1}, Email: "user@test.com"}, nil)
+			test.wantMock(&m)
+
+			membership, err := newTestOrganizationService(&m).AcceptInvitation(memberContext(), "token")
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				assert.Equal(t, uint(5), membership.OrganizationID)
+			}
+			m.orgs.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreateInvitedUser(t *testing.T) {
+	var m orgMocks
+	m.users.On("CreateUser", mock.Anything).Return(uint(2), nil)
+	m.orgs.On("FetchInvitationByHash", utils.HashToken("token")).Return(&models.Invitation{
+		ID:             9,
+		OrganizationID: 5,
+		Email:          "new@test.com",
+		Role:           models.OrgRoleMember,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}, nil)
+	m.orgs.On("AcceptInvitation", uint(9)).Return(nil)
+	m.orgs.On("CreateMembership", mock.Anything).Return(nil)
+	m.tokens.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+		return token.UserID == 2 && token.OrganizationID == 5
+	})).Return(nil)
+	service := &UserServiceImpl{
+		UserRepo:  &m.users,
+		TokenRepo: &m.tokens,
+		Tx:        &fakeTxManager{repos: TxRepositories{Users: &m.users, Tokens: &m.tokens, Organizations: &m.orgs}},
+		Tokens:    newTestTokenIssuer(),
+	}
+
+	tokens, err := service.CreateInvitedUser(context.Background(), "new@test.com", "password1", "token", utils.TokenOverrides{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	m.orgs.AssertExpectations(t)
+	m.tokens.AssertExpectations(t)
+}
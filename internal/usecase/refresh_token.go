@@ -1,34 +1,58 @@
 package usecase
 
 import (
-	"fmt"
+	"context"
 	"time"
 
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
 	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tracing"
 	"github.com/soicchi/auth_api/internal/utils"
 )
 
 type RefreshTokenServiceImpl struct {
 	TokenRepo RefreshTokenRepository
+	Tokens    *utils.TokenIssuer
+	Audit     AuditRecorder
 }
 
 type RefreshTokenRepository interface {
-	FetchByToken(token string) (models.RefreshToken, error)
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	FetchByToken(ctx context.Context, token string) (models.RefreshToken, error)
+	DeleteByUserID(ctx context.Context, userID uint) (int64, error)
+	DeleteByOrganization(ctx context.Context, userID, orgID uint) (int64, error)
+	FetchExpired(ctx context.Context, before time.Time) ([]models.RefreshToken, error)
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
 }
 
-func NewRefreshTokenServiceImpl(tokenRepo RefreshTokenRepository) *RefreshTokenServiceImpl {
+func NewRefreshTokenServiceImpl(tokenRepo RefreshTokenRepository, tokens *utils.TokenIssuer, audit AuditRecorder) *RefreshTokenServiceImpl {
 	return &RefreshTokenServiceImpl{
 		TokenRepo: tokenRepo,
+		Tokens:    tokens,
+		Audit:     audit,
 	}
 }
 
-func (s *RefreshTokenServiceImpl) RefreshAccessToken(token string) (string, error) {
-	refreshToken, err := verifyRefreshToken(s.TokenRepo, token)
+func (s *RefreshTokenServiceImpl) RefreshAccessToken(ctx context.Context, token string, overrides utils.TokenOverrides) (accessToken string, err error) {
+	ctx, span := tracing.Start(ctx, "RefreshTokenService.RefreshAccessToken")
+	var subject string
+	defer func() {
+		metrics.RecordTokenRefresh(metricResult(err))
+		recordAudit(ctx, s.Audit, models.AuditTokenRefresh, subject, subject, err)
+		tracing.End(span, err)
+	}()
+
+	refreshToken, err := verifyRefreshToken(ctx, s.TokenRepo, token)
+	if refreshToken.UserID != 0 {
+		subject = models.AuditUser(refreshToken.UserID)
+	}
 	if err != nil {
+		logging.FromContext(ctx).Info("refresh rejected", "reason", metricResult(err))
 		return "", err
 	}
 
-	accessToken, err := utils.GenerateJWT(refreshToken.UserID)
+	accessToken, err = s.Tokens.OrganizationAccessToken(ctx, refreshToken.UserID, refreshToken.OrganizationID, overrides)
 	if err != nil {
 		return "", err
 	}
@@ -36,19 +60,36 @@ func (s *RefreshTokenServiceImpl) RefreshAccessToken(token string) (string, erro
 	return accessToken, nil
 }
 
-func verifyRefreshToken(repo RefreshTokenRepository, token string) (models.RefreshToken, error) {
-	refreshToken, err := repo.FetchByToken(token)
+func verifyRefreshToken(ctx context.Context, repo RefreshTokenRepository, token string) (models.RefreshToken, error) {
+	refreshToken, err := repo.FetchByToken(ctx, token)
 	if err != nil {
 		return refreshToken, err
 	}
 
 	if refreshToken.Token == "" {
-		return refreshToken, fmt.Errorf("refresh token not found")
+		return refreshToken, utils.ErrTokenInvalid.WithDetail("The refresh token is invalid.")
 	}
 
 	if refreshToken.ExpiredAt.Before(time.Now()) {
-		return refreshToken, fmt.Errorf("refresh token is expired")
+		return refreshToken, utils.ErrTokenExpired.WithDetail("The refresh token has expired.")
 	}
 
 	return refreshToken, nil
 }
+
+func (s *RefreshTokenServiceImpl) ListExpiredTokens(ctx context.Context) (tokens []models.RefreshToken, err error) {
+	ctx, span := tracing.Start(ctx, "RefreshTokenService.ListExpiredTokens")
+	defer func() { tracing.End(span, err) }()
+
+	return s.TokenRepo.FetchExpired(ctx, time.Now())
+}
+
+func (s *RefreshTokenServiceImpl) PurgeExpiredTokens(ctx context.Context) (purged int64, err error) {
+	ctx, span := tracing.Start(ctx, "RefreshTokenService.PurgeExpiredTokens")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	return purgeInBatches(ctx, func(limit int) (int64, error) {
+		return s.TokenRepo.DeleteExpired(ctx, now, limit)
+	})
+}
@@ -1,11 +1,13 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,11 +17,36 @@ type MockRefreshTokenRepository struct {
 	mock.Mock
 }
 
-func (m *MockRefreshTokenRepository) FetchByToken(token string) (models.RefreshToken, error) {
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) FetchByToken(ctx context.Context, token string) (models.RefreshToken, error) {
 	args := m.Called(token)
 	return args.Get(0).(models.RefreshToken), args.Error(1)
 }
 
+func (m *MockRefreshTokenRepository) DeleteByUserID(ctx context.Context, userID uint) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) DeleteByOrganization(ctx context.Context, userID, orgID uint) (int64, error) {
+	args := m.Called(userID, orgID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) FetchExpired(ctx context.Context, before time.Time) ([]models.RefreshToken, error) {
+	args := m.Called(before)
+	return args.Get(0).([]models.RefreshToken), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	args := m.Called(before, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func TestVerifyRefreshToken(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -69,7 +96,7 @@ func TestVerifyRefreshToken(t *testing.T) {
 			var mockTokenRepo MockRefreshTokenRepository
 			test.mock(&mockTokenRepo)
 
-			refreshToken, err := verifyRefreshToken(&mockTokenRepo, "token")
+			refreshToken, err := verifyRefreshToken(context.Background(), &mockTokenRepo, "token")
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
 			} else {
@@ -107,9 +134,10 @@ func TestRefreshAccessToken(t *testing.T) {
 			test.mockRepo(&mockTokenRepo)
 			tokenService := &RefreshTokenServiceImpl{
 				TokenRepo: &mockTokenRepo,
+				Tokens:    newTestTokenIssuer(),
 			}
 
-			accessToken, err := tokenService.RefreshAccessToken(test.in)
+			accessToken, err := tokenService.RefreshAccessToken(context.Background(), test.in, utils.TokenOverrides{})
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
 			} else {
@@ -119,3 +147,55 @@ func TestRefreshAccessToken(t *testing.T) {
 		})
 	}
 }
+
+func TestPurgeExpiredTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		mockRepo func(mockTokenRepo *MockRefreshTokenRepository)
+		want     int64
+		wantErr  bool
+	}{
+		{
+			name: "success to purge expired tokens",
+			mockRepo: func(mockTokenRepo *MockRefreshTokenRepository) {
+				mockTokenRepo.On("DeleteExpired", mock.AnythingOfType("time.Time"), janitorBatchSize).Return(int64(2), nil)
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name: "purges in batches until one comes back short",
+			mockRepo: func(mockTokenRepo *MockRefreshTokenRepository) {
+				mockTokenRepo.On("DeleteExpired", mock.AnythingOfType("time.Time"), janitorBatchSize).Return(int64(janitorBatchSize), nil).Once()
+				mockTokenRepo.On("DeleteExpired", mock.AnythingOfType("time.Time"), janitorBatchSize).Return(int64(3), nil).Once()
+			},
+			want:    janitorBatchSize + 3,
+			wantErr: false,
+		},
+		{
+			name: "failed to purge expired tokens",
+			mockRepo: func(mockTokenRepo *MockRefreshTokenRepository) {
+				mockTokenRepo.On("DeleteExpired", mock.AnythingOfType("time.Time"), janitorBatchSize).Return(int64(0), fmt.Errorf("db error"))
+			},
+			want:    0,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockTokenRepo MockRefreshTokenRepository
+			test.mockRepo(&mockTokenRepo)
+			tokenService := NewRefreshTokenServiceImpl(&mockTokenRepo, newTestTokenIssuer(), &fakeAuditRecorder{})
+
+			purged, err := tokenService.PurgeExpiredTokens(context.Background())
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, purged)
+			mockTokenRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,975 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultSCIMPageSize = 100
+	maxSCIMPageSize     = 1000
+)
+
+var (
+	errGroupNotFound     = utils.ErrNotFound.WithDetail("The group was not found.")
+	errUserNameTaken     = utils.ErrEmailTaken.WithDetail("A user with the userName already exists.")
+	errVersionMismatch   = utils.ErrPreconditionFailed.WithDetail("The resource has changed since the version in If-Match.")
+	errUnsupportedFilter = utils.ErrInvalidFilter.WithDetail("The filter compares an attribute in a way that is not supported.")
+)
+
+// scimUserFields maps the filterable SCIM user attributes, lowercased, to
+// the fields of user queries.
+var scimUserFields = map[string]string{
+	"id":           "id",
+	"username":     "email",
+	"emails":       "email",
+	"emails.value": "email",
+	"externalid":   "external_id",
+	"active":       "active",
+	"roles":        "role",
+	"roles.value":  "role",
+}
+
+// scimGroupFields maps the filterable SCIM group attributes, lowercased, to
+// the fields of organization queries.
+var scimGroupFields = map[string]string{
+	"id":          "id",
+	"displayname": "name",
+	"externalid":  "external_id",
+}
+
+// SCIMServiceImpl provisions users and groups for SCIM clients. Users are
+// the users of the tenant, with userName as their email and roles as their
+// role; groups are its organizations, whose members join as members.
+type SCIMServiceImpl struct {
+	UserRepo SCIMUserRepository
+	OrgRepo  OrganizationRepository
+	// Tx runs changes spanning several repository calls.
+	Tx    TxManager
+	Audit AuditRecorder
+}
+
+type SCIMUserRepository interface {
+	UserRepository
+	QueryUsers(ctx context.Context, query models.Query) ([]models.User, int64, error)
+}
+
+// SCIMGroup is an organization seen as a SCIM group.
+type SCIMGroup struct {
+	Organization models.Organization
+	Members      []models.Membership
+}
+
+func NewSCIMServiceImpl(userRepo SCIMUserRepository, orgRepo OrganizationRepository, tx TxManager, audit AuditRecorder) *SCIMServiceImpl {
+	return &SCIMServiceImpl{
+		UserRepo: userRepo,
+		OrgRepo:  orgRepo,
+		Tx:       tx,
+		Audit:    audit,
+	}
+}
+
+// ListUsers returns the users matching filter from the 1-based startIndex,
+// at most count of them, and how many match in total.
+func (s *SCIMServiceImpl) ListUsers(ctx context.Context, filter string, startIndex, count int) (users []models.User, total int64, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ListUsers")
+	defer func() { tracing.End(span, err) }()
+
+	query, err := scimQuery(filter, scimUserFields, startIndex, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users, total, err = s.UserRepo.QueryUsers(ctx, query)
+	if errors.Is(err, models.ErrUnsupportedCondition) {
+		return nil, 0, errUnsupportedFilter
+	}
+
+	return users, total, err
+}
+
+func (s *SCIMServiceImpl) FetchUser(ctx context.Context, userID uint) (user *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.FetchUser")
+	defer func() { tracing.End(span, err) }()
+
+	user, err = s.UserRepo.FetchUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errUserNotFound
+	}
+
+	return user, nil
+}
+
+// CreateUser creates a user from a SCIM resource. Users created without a
+// password get a random one and must reset it before signing in with a
+// password.
+func (s *SCIMServiceImpl) CreateUser(ctx context.Context, resource scim.User) (user *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.CreateUser")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMUserCreate, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	user = models.NewUser("", "")
+	user.Role = models.RoleUser
+	password, err := applySCIMUser(user, resource, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if password == "" {
+		password, err = utils.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordResetRequired = true
+	}
+
+	user.Password, err = utils.HashPassword(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.UserRepo.CreateUser(ctx, user)
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		return nil, errUserNameTaken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	target = models.AuditUser(user.ID)
+	logging.FromContext(ctx).Info("scim user created", "user_id", user.ID)
+	return user, nil
+}
+
+// ReplaceUser replaces the attributes of a user with those of a SCIM
+// resource. Roles and active are kept when the resource leaves them out,
+// since many clients never send them. A non-empty ifMatch must list the
+// current version of the user.
+func (s *SCIMServiceImpl) ReplaceUser(ctx context.Context, userID uint, resource scim.User, ifMatch string) (user *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ReplaceUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMUserUpdate, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	return s.updateUser(ctx, userID, ifMatch, func(user *models.User, now time.Time) (string, error) {
+		return applySCIMUser(user, resource, now)
+	})
+}
+
+// PatchUser applies the operations of a SCIM PATCH request to a user.
+// Attributes that are not stored, such as name, are ignored.
+func (s *SCIMServiceImpl) PatchUser(ctx context.Context, userID uint, patch scim.PatchRequest, ifMatch string) (user *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.PatchUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMUserUpdate, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	return s.updateUser(ctx, userID, ifMatch, func(user *models.User, now time.Time) (string, error) {
+		var password string
+		err := eachPatchAttribute(patch.Operations, func(op string, path scim.Path, value json.RawMessage) error {
+			changed, err := patchSCIMUser(user, op, path, value, now)
+			if changed != "" {
+				password = changed
+			}
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if strings.TrimSpace(user.Email) == "" {
+			return "", requiredFieldError("userName")
+		}
+
+		return password, nil
+	})
+}
+
+// DeleteUser removes a user for good, so that the userName can be
+// provisioned again. A non-empty ifMatch must list the current version of
+// the user.
+func (s *SCIMServiceImpl) DeleteUser(ctx context.Context, userID uint, ifMatch string) (err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.DeleteUser")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMUserDelete, "", models.AuditUser(userID), err)
+		tracing.End(span, err)
+	}()
+
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		if _, err := fetchSCIMUser(ctx, repos.Users, userID, ifMatch); err != nil {
+			return err
+		}
+
+		return repos.Users.DeleteUser(ctx, userID)
+	})
+	if err != nil {
+		return mapUserNotFound(err)
+	}
+
+	logging.FromContext(ctx).Info("scim user deleted", "user_id", userID)
+	return nil
+}
+
+// updateUser applies change to a user and saves it. Deactivating the user
+// revokes its sessions.
+func (s *SCIMServiceImpl) updateUser(ctx context.Context, userID uint, ifMatch string, change func(user *models.User, now time.Time) (string, error)) (*models.User, error) {
+	now := time.Now()
+	var user *models.User
+	var revoked int64
+	err := s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		fetched, err := fetchSCIMUser(ctx, repos.Users, userID, ifMatch)
+		if err != nil {
+			return err
+		}
+
+		wasActive := fetched.DisabledAt == nil
+		password, err := change(fetched, now)
+		if err != nil {
+			return err
+		}
+
+		// The password goes first as it also moves UpdatedAt
+		if password != "" {
+			hashed, err := utils.HashPassword(ctx, password)
+			if err != nil {
+				return err
+			}
+
+			if err := repos.Users.UpdatePassword(ctx, userID, hashed); err != nil {
+				return err
+			}
+			fetched.Password = hashed
+			fetched.PasswordResetRequired = false
+		}
+
+		if err := repos.Users.UpdateUser(ctx, fetched); err != nil {
+			return err
+		}
+
+		revoked = 0
+		if wasActive && fetched.DisabledAt != nil {
+			deleted, err := repos.Tokens.DeleteByUserID(ctx, userID)
+			if err != nil {
+				return err
+			}
+			revoked = deleted
+		}
+
+		user = fetched
+		return nil
+	})
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		return nil, errUserNameTaken
+	}
+
+	if err != nil {
+		return nil, mapUserNotFound(err)
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("scim user updated", "user_id", userID, "revoked_sessions", revoked)
+	return user, nil
+}
+
+// ListGroups returns the groups matching filter from the 1-based
+// startIndex, at most count of them, and how many match in total.
+func (s *SCIMServiceImpl) ListGroups(ctx context.Context, filter string, startIndex, count int) (groups []SCIMGroup, total int64, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ListGroups")
+	defer func() { tracing.End(span, err) }()
+
+	query, err := scimQuery(filter, scimGroupFields, startIndex, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orgs, total, err := s.OrgRepo.QueryOrganizations(ctx, query)
+	if errors.Is(err, models.ErrUnsupportedCondition) {
+		return nil, 0, errUnsupportedFilter
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	groups = make([]SCIMGroup, 0, len(orgs))
+	for _, org := range orgs {
+		members, err := s.OrgRepo.FetchMembers(ctx, org.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, SCIMGroup{Organization: org, Members: members})
+	}
+
+	return groups, total, nil
+}
+
+func (s *SCIMServiceImpl) FetchGroup(ctx context.Context, orgID uint) (group *SCIMGroup, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.FetchGroup")
+	defer func() { tracing.End(span, err) }()
+
+	return fetchSCIMGroup(ctx, s.OrgRepo, orgID, "")
+}
+
+// CreateGroup creates an organization without owners from a SCIM resource.
+// Its members must be users of the tenant.
+func (s *SCIMServiceImpl) CreateGroup(ctx context.Context, resource scim.Group) (group *SCIMGroup, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.CreateGroup")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMGroupCreate, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	if strings.TrimSpace(resource.DisplayName) == "" {
+		return nil, requiredFieldError("displayName")
+	}
+
+	memberIDs, err := scimMemberIDs(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		if err := checkSCIMMembers(ctx, repos.Users, memberIDs); err != nil {
+			return err
+		}
+
+		org := models.NewOrganization(resource.DisplayName)
+		org.ExternalID = resource.ExternalID
+		if err := repos.Organizations.CreateOrganization(ctx, org, 0); err != nil {
+			return err
+		}
+
+		if err := repos.Organizations.AddMembers(ctx, org.ID, memberIDs, models.OrgRoleMember); err != nil {
+			return err
+		}
+
+		created, err := fetchSCIMGroup(ctx, repos.Organizations, org.ID, "")
+		group = created
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	target = models.AuditOrganization(group.Organization.ID)
+	logging.FromContext(ctx).Info("scim group created", "organization_id", group.Organization.ID)
+	return group, nil
+}
+
+// ReplaceGroup replaces the name, external ID and members of a group. Members
+// who stay keep their role; removed members lose their sessions in the
+// organization. A non-empty ifMatch must list the current version of the
+// group.
+func (s *SCIMServiceImpl) ReplaceGroup(ctx context.Context, orgID uint, resource scim.Group, ifMatch string) (group *SCIMGroup, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ReplaceGroup")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMGroupUpdate, "", models.AuditOrganization(orgID), err)
+		tracing.End(span, err)
+	}()
+
+	if strings.TrimSpace(resource.DisplayName) == "" {
+		return nil, requiredFieldError("displayName")
+	}
+
+	memberIDs, err := scimMemberIDs(resource.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateGroup(ctx, orgID, ifMatch, func(org *models.Organization, members map[uint]bool) error {
+		org.Name = resource.DisplayName
+		org.ExternalID = resource.ExternalID
+		clear(members)
+		for _, id := range memberIDs {
+			members[id] = true
+		}
+		return nil
+	})
+}
+
+// PatchGroup applies the operations of a SCIM PATCH request to a group.
+func (s *SCIMServiceImpl) PatchGroup(ctx context.Context, orgID uint, patch scim.PatchRequest, ifMatch string) (group *SCIMGroup, err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.PatchGroup")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMGroupUpdate, "", models.AuditOrganization(orgID), err)
+		tracing.End(span, err)
+	}()
+
+	return s.updateGroup(ctx, orgID, ifMatch, func(org *models.Organization, members map[uint]bool) error {
+		err := eachPatchAttribute(patch.Operations, func(op string, path scim.Path, value json.RawMessage) error {
+			return patchSCIMGroup(org, members, op, path, value)
+		})
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(org.Name) == "" {
+			return requiredFieldError("displayName")
+		}
+
+		return nil
+	})
+}
+
+// DeleteGroup removes an organization for good and revokes the sessions its
+// members have in it. A non-empty ifMatch must list the current version of
+// the group.
+func (s *SCIMServiceImpl) DeleteGroup(ctx context.Context, orgID uint, ifMatch string) (err error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.DeleteGroup")
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSCIMGroupDelete, "", models.AuditOrganization(orgID), err)
+		tracing.End(span, err)
+	}()
+
+	var revoked int64
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		group, err := fetchSCIMGroup(ctx, repos.Organizations, orgID, ifMatch)
+		if err != nil {
+			return err
+		}
+
+		revoked = 0
+		for _, member := range group.Members {
+			deleted, err := repos.Tokens.DeleteByOrganization(ctx, member.UserID, orgID)
+			if err != nil {
+				return err
+			}
+			revoked += deleted
+		}
+
+		return repos.Organizations.DeleteOrganization(ctx, orgID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errGroupNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("scim group deleted", "organization_id", orgID, "revoked_sessions", revoked)
+	return nil
+}
+
+// updateGroup applies change to an organization and the set of its member
+// IDs and saves both.
+func (s *SCIMServiceImpl) updateGroup(ctx context.Context, orgID uint, ifMatch string, change func(org *models.Organization, members map[uint]bool) error) (*SCIMGroup, error) {
+	var group *SCIMGroup
+	var revoked int64
+	err := s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		current, err := fetchSCIMGroup(ctx, repos.Organizations, orgID, ifMatch)
+		if err != nil {
+			return err
+		}
+
+		org := current.Organization
+		members := make(map[uint]bool, len(current.Members))
+		for _, member := range current.Members {
+			members[member.UserID] = true
+		}
+
+		if err := change(&org, members); err != nil {
+			return err
+		}
+
+		added, removed := make([]uint, 0), make([]uint, 0)
+		for id := range members {
+			if !slices.ContainsFunc(current.Members, func(m models.Membership) bool { return m.UserID == id }) {
+				added = append(added, id)
+			}
+		}
+		for _, member := range current.Members {
+			if !members[member.UserID] {
+				removed = append(removed, member.UserID)
+			}
+		}
+		slices.Sort(added)
+		slices.Sort(removed)
+
+		if err := checkSCIMMembers(ctx, repos.Users, added); err != nil {
+			return err
+		}
+
+		if err := repos.Organizations.UpdateOrganization(ctx, &org); err != nil {
+			return err
+		}
+
+		if err := repos.Organizations.AddMembers(ctx, orgID, added, models.OrgRoleMember); err != nil {
+			return err
+		}
+
+		if err := repos.Organizations.RemoveMembers(ctx, orgID, removed); err != nil {
+			return err
+		}
+
+		revoked = 0
+		for _, userID := range removed {
+			deleted, err := repos.Tokens.DeleteByOrganization(ctx, userID, orgID)
+			if err != nil {
+				return err
+			}
+			revoked += deleted
+		}
+
+		updated, err := fetchSCIMGroup(ctx, repos.Organizations, orgID, "")
+		group = updated
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errGroupNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("scim group updated", "organization_id", orgID, "revoked_sessions", revoked)
+	return group, nil
+}
+
+// scimQuery translates a SCIM filter and page into a query over fields.
+func scimQuery(filter string, fields map[string]string, startIndex, count int) (models.Query, error) {
+	query := models.Query{
+		Offset: max(startIndex, 1) - 1,
+		Limit:  min(max(count, 0), maxSCIMPageSize),
+	}
+	if filter == "" {
+		return query, nil
+	}
+
+	parsed, err := scim.ParseFilter(filter)
+	if err != nil {
+		return query, utils.ErrInvalidFilter.WithDetail(err.Error())
+	}
+
+	for _, comparison := range parsed {
+		field, ok := fields[strings.ToLower(comparison.Attr)]
+		if !ok {
+			return query, utils.ErrInvalidFilter.WithDetail(fmt.Sprintf("Filtering by %s is not supported.", comparison.Attr))
+		}
+
+		query.Conditions = append(query.Conditions, models.Condition{
+			Field: field,
+			Op:    comparison.Op,
+			Value: comparison.Value,
+		})
+	}
+
+	return query, nil
+}
+
+// fetchSCIMUser returns the user unless it does not exist or ifMatch lists
+// another version.
+func fetchSCIMUser(ctx context.Context, repo UserRepository, userID uint, ifMatch string) (*models.User, error) {
+	user, err := repo.FetchUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errUserNotFound
+	}
+
+	if ifMatch != "" && !scim.MatchesVersion(ifMatch, scim.Version(user.UpdatedAt)) {
+		return nil, errVersionMismatch
+	}
+
+	return user, nil
+}
+
+// fetchSCIMGroup returns the organization with its members unless it does
+// not exist or ifMatch lists another version.
+func fetchSCIMGroup(ctx context.Context, repo OrganizationRepository, orgID uint, ifMatch string) (*SCIMGroup, error) {
+	org, err := repo.FetchOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if org == nil {
+		return nil, errGroupNotFound
+	}
+
+	if ifMatch != "" && !scim.MatchesVersion(ifMatch, scim.Version(org.UpdatedAt)) {
+		return nil, errVersionMismatch
+	}
+
+	members, err := repo.FetchMembers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SCIMGroup{Organization: *org, Members: members}, nil
+}
+
+// applySCIMUser sets the attributes of user from a full SCIM resource and
+// returns its password, if it has one.
+func applySCIMUser(user *models.User, resource scim.User, now time.Time) (string, error) {
+	if strings.TrimSpace(resource.UserName) == "" {
+		return "", requiredFieldError("userName")
+	}
+
+	if err := checkSCIMRoles(resource.Roles); err != nil {
+		return "", err
+	}
+
+	if resource.Active != nil {
+		setActive(user, *resource.Active, now)
+	}
+
+	if resource.Password != "" && !utils.PasswordMeetsPolicy(resource.Password) {
+		return "", passwordPolicyError()
+	}
+
+	user.Email = resource.UserName
+	user.ExternalID = resource.ExternalID
+	return resource.Password, nil
+}
+
+// patchSCIMUser applies one PATCH operation to an attribute of user and
+// returns the new password, if the operation sets one.
+func patchSCIMUser(user *models.User, op string, path scim.Path, value json.RawMessage, now time.Time) (string, error) {
+	switch strings.ToLower(path.Attr) {
+	case "username":
+		if op == "remove" {
+			return "", requiredFieldError("userName")
+		}
+		return "", unmarshalPatchValue("userName", value, &user.Email)
+	case "emails":
+		// The email is the userName, which cannot be removed
+		if op == "remove" {
+			return "", nil
+		}
+		var email string
+		if path.SubAttr != "" {
+			if err := unmarshalPatchValue("emails", value, &email); err != nil {
+				return "", err
+			}
+		} else {
+			values, err := multiValues("emails", value)
+			if err != nil {
+				return "", err
+			}
+			email = primaryValue(values)
+		}
+		if email != "" {
+			user.Email = email
+		}
+		return "", nil
+	case "externalid":
+		if op == "remove" {
+			user.ExternalID = ""
+			return "", nil
+		}
+		return "", unmarshalPatchValue("externalId", value, &user.ExternalID)
+	case "active":
+		if op == "remove" {
+			setActive(user, true, now)
+			return "", nil
+		}
+		active, err := scim.ParseBool(value)
+		if err != nil {
+			return "", invalidPatchValue("active", err)
+		}
+		setActive(user, active, now)
+		return "", nil
+	case "roles":
+		return "", patchSCIMRole(op, value)
+	case "password":
+		var password string
+		if op == "remove" {
+			return "", requiredFieldError("password")
+		}
+		if err := unmarshalPatchValue("password", value, &password); err != nil {
+			return "", err
+		}
+		if !utils.PasswordMeetsPolicy(password) {
+			return "", passwordPolicyError()
+		}
+		return password, nil
+	default:
+		return "", nil
+	}
+}
+
+// patchSCIMRole checks a PATCH operation on roles. Roles are never changed
+// through SCIM, see checkSCIMRoles.
+func patchSCIMRole(op string, value json.RawMessage) error {
+	if op == "remove" || len(value) == 0 {
+		return nil
+	}
+
+	values, err := multiValues("roles", value)
+	if err != nil {
+		return err
+	}
+
+	return checkSCIMRoles(values)
+}
+
+// patchSCIMGroup applies one PATCH operation to an attribute of a group.
+// members is the set of member IDs.
+func patchSCIMGroup(org *models.Organization, members map[uint]bool, op string, path scim.Path, value json.RawMessage) error {
+	switch strings.ToLower(path.Attr) {
+	case "displayname":
+		if op == "remove" {
+			return requiredFieldError("displayName")
+		}
+		return unmarshalPatchValue("displayName", value, &org.Name)
+	case "externalid":
+		if op == "remove" {
+			org.ExternalID = ""
+			return nil
+		}
+		return unmarshalPatchValue("externalId", value, &org.ExternalID)
+	case "members":
+		var ids []uint
+		if len(value) > 0 {
+			values, err := multiValues("members", value)
+			if err != nil {
+				return err
+			}
+
+			ids, err = scimMemberIDs(values)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch op {
+		case "remove":
+			if path.Filter == nil && ids == nil {
+				clear(members)
+				return nil
+			}
+
+			filtered, err := scimMemberIDs(valuesOf(filterValues(path.Filter)))
+			if err != nil {
+				return err
+			}
+			for _, id := range append(ids, filtered...) {
+				delete(members, id)
+			}
+		case "replace":
+			clear(members)
+			fallthrough
+		default:
+			for _, id := range ids {
+				members[id] = true
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// eachPatchAttribute calls fn for every attribute the operations change,
+// with the operation lowercased. Operations without a path change the
+// attributes of their value object, in name order.
+func eachPatchAttribute(operations []scim.PatchOperation, fn func(op string, path scim.Path, value json.RawMessage) error) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return utils.ErrBadRequest.WithDetail(fmt.Sprintf("Unsupported PATCH operation %q.", operation.Op))
+		}
+
+		if operation.Path != "" {
+			path, err := scim.ParsePath(operation.Path)
+			if err != nil {
+				return invalidPatchValue("path", err)
+			}
+
+			if err := fn(op, path, operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if op == "remove" {
+			return requiredFieldError("path")
+		}
+
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return utils.ErrBadRequest.WithDetail("A PATCH operation without a path needs an object value.")
+		}
+
+		names := make([]string, 0, len(attributes))
+		for name := range attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			path, err := scim.ParsePath(name)
+			if err != nil {
+				return invalidPatchValue("path", err)
+			}
+
+			if err := fn(op, path, attributes[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSCIMRoles rejects role values other than user. The admin role is
+// global, so the directory of a tenant can neither grant nor revoke it, and
+// users keep the role they have.
+func checkSCIMRoles(values []scim.MultiValue) error {
+	allowed := []string{models.RoleUser}
+	for _, value := range values {
+		if !slices.Contains(allowed, value.Value) {
+			return utils.ErrValidationFailed.WithFields([]utils.FieldError{oneOfFieldError("roles", value.Value, allowed)})
+		}
+	}
+
+	return nil
+}
+
+func scimMemberIDs(values []scim.MultiValue) ([]uint, error) {
+	ids := make([]uint, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.ParseUint(value.Value, 10, 64)
+		if err != nil || id == 0 {
+			return nil, invalidPatchValue("members", fmt.Errorf("%q is not a user ID", value.Value))
+		}
+		ids = append(ids, uint(id))
+	}
+
+	return ids, nil
+}
+
+// checkSCIMMembers reports users that do not exist in the tenant.
+func checkSCIMMembers(ctx context.Context, repo UserRepository, userIDs []uint) error {
+	for _, id := range userIDs {
+		user, err := repo.FetchUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if user == nil {
+			return invalidPatchValue("members", fmt.Errorf("user %d does not exist", id))
+		}
+	}
+
+	return nil
+}
+
+func setActive(user *models.User, active bool, now time.Time) {
+	switch {
+	case active:
+		user.DisabledAt = nil
+	case user.DisabledAt == nil:
+		user.DisabledAt = &now
+	}
+}
+
+// multiValues reads the values of a multi-valued attribute, accepting a
+// single value or object as well as a list.
+func multiValues(field string, value json.RawMessage) ([]scim.MultiValue, error) {
+	var values []scim.MultiValue
+	if err := json.Unmarshal(value, &values); err == nil {
+		return values, nil
+	}
+
+	var single scim.MultiValue
+	if err := json.Unmarshal(value, &single); err == nil {
+		return []scim.MultiValue{single}, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return nil, invalidPatchValue(field, fmt.Errorf("expected a list of values but got %s", value))
+	}
+
+	return []scim.MultiValue{{Value: s}}, nil
+}
+
+// primaryValue returns the primary value, or else the first.
+func primaryValue(values []scim.MultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+
+	if len(values) > 0 {
+		return values[0].Value
+	}
+
+	return ""
+}
+
+func valuesOf(values []string) []scim.MultiValue {
+	out := make([]scim.MultiValue, 0, len(values))
+	for _, value := range values {
+		out = append(out, scim.MultiValue{Value: value})
+	}
+
+	return out
+}
+
+// filterValues returns the values a PATCH path filter such as
+// members[value eq "2"] selects.
+func filterValues(filter scim.Filter) []string {
+	values := make([]string, 0, len(filter))
+	for _, comparison := range filter {
+		if s, ok := comparison.Value.(string); ok && comparison.Op == scim.OpEqual && strings.EqualFold(comparison.Attr, "value") {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
+
+func unmarshalPatchValue(field string, value json.RawMessage, dest *string) error {
+	if err := json.Unmarshal(value, dest); err != nil {
+		return invalidPatchValue(field, fmt.Errorf("expected a string but got %s", value))
+	}
+
+	return nil
+}
+
+func invalidPatchValue(field string, err error) error {
+	return utils.ErrValidationFailed.WithFields([]utils.FieldError{{Field: field, Rule: "invalid", Message: err.Error()}})
+}
+
+func requiredFieldError(field string) error {
+	return utils.ErrValidationFailed.WithFields([]utils.FieldError{{Field: field, Rule: "required"}})
+}
+
+func passwordPolicyError() error {
+	return utils.ErrValidationFailed.WithFields([]utils.FieldError{{Field: "password", Rule: "password_policy"}})
+}
@@ -0,0 +1,337 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockSCIMUserRepository struct {
+	MockUserRepository
+}
+
+func (m *MockSCIMUserRepository) QueryUsers(ctx context.Context, query models.Query) ([]models.User, int64, error) {
+	args := m.Called(query)
+	return args.Get(0).([]models.User), args.Get(1).(int64), args.Error(2)
+}
+
+type scimMocks struct {
+	users  MockSCIMUserRepository
+	tokens MockRefreshTokenRepository
+	orgs   MockOrganizationRepository
+}
+
+func newTestSCIMService(m *scimMocks) *SCIMServiceImpl {
+	tx := &fakeTxManager{repos: TxRepositories{Users: &m.users, Tokens: &m.tokens, Organizations: &m.orgs}}
+	return NewSCIMServiceImpl(&m.users, &m.orgs, tx, &fakeAuditRecorder{})
+}
+
+var scimUpdatedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestSCIMUser() *models.User {
+	return &models.User{
+		Model: gorm.Model{ID: 2, UpdatedAt: scimUpdatedAt},
+		Email: "user@test.com",
+		Role:  models.RoleUser,
+	}
+}
+
+func newTestSCIMOrganization() *models.Organization {
+	return &models.Organization{
+		Model: gorm.Model{ID: 5, UpdatedAt: scimUpdatedAt},
+		Name:  "Engineering",
+	}
+}
+
+func TestSCIMListUsers(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    string
+		wantQuery models.Query
+		repoErr   error
+		wantErr   error
+	}{
+		{
+			name:      "no filter",
+			wantQuery: models.Query{Offset: 2, Limit: 10},
+		},
+		{
+			name:   "conjunction",
+			filter: `userName eq "User@test.com" and active eq true`,
+			wantQuery: models.Query{
+				Conditions: []models.Condition{
+					{Field: "email", Op: models.CondEqual, Value: "User@test.com"},
+					{Field: "active", Op: models.CondEqual, Value: true},
+				},
+				Offset: 2,
+				Limit:  10,
+			},
+		},
+		{
+			name:    "unknown attribute",
+			filter:  `name.givenName eq "Ada"`,
+			wantErr: utils.ErrInvalidFilter,
+		},
+		{
+			name:    "disjunction",
+			filter:  `userName eq "a" or userName eq "b"`,
+			wantErr: utils.ErrInvalidFilter,
+		},
+		{
+			name:   "unsupported comparison",
+			filter: `active sw "t"`,
+			wantQuery: models.Query{
+				Conditions: []models.Condition{{Field: "active", Op: models.CondStartsWith, Value: "t"}},
+				Offset:     2,
+				Limit:      10,
+			},
+			repoErr: models.ErrUnsupportedCondition,
+			wantErr: utils.ErrInvalidFilter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m scimMocks
+			if test.wantQuery.Limit != 0 {
+				m.users.On("QueryUsers", test.wantQuery).Return([]models.User{*newTestSCIMUser()}, int64(3), test.repoErr)
+			}
+
+			users, total, err := newTestSCIMService(&m).ListUsers(context.Background(), test.filter, 3, 10)
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				assert.Len(t, users, 1)
+				assert.Equal(t, int64(3), total)
+			}
+			m.users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMCreateUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  scim.User
+		wantReset bool
+		wantErr   error
+	}{
+		{
+			name:     "with password",
+			resource: scim.User{UserName: "new@test.com", Password: "password1"},
+		},
+		{
+			name:      "without password",
+			resource:  scim.User{UserName: "new@test.com"},
+			wantReset: true,
+		},
+		{
+			name:     "weak password",
+			resource: scim.User{UserName: "new@test.com", Password: "short"},
+			wantErr:  utils.ErrValidationFailed,
+		},
+		{
+			name:     "unknown role",
+			resource: scim.User{UserName: "new@test.com", Roles: []scim.MultiValue{{Value: "owner"}}},
+			wantErr:  utils.ErrValidationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m scimMocks
+			if test.wantErr == nil {
+				m.users.On("CreateUser", mock.MatchedBy(func(user *models.User) bool {
+					return user.Email == "new@test.com" && user.Role == models.RoleUser && user.PasswordResetRequired == test.wantReset && user.Password != ""
+				})).Return(uint(3), nil)
+			}
+
+			user, err := newTestSCIMService(&m).CreateUser(context.Background(), test.resource)
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				assert.Equal(t, "new@test.com", user.Email)
+			}
+			m.users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMPatchUser(t *testing.T) {
+	version := scim.Version(scimUpdatedAt)
+	tests := []struct {
+		name       string
+		patch      string
+		ifMatch    string
+		wantUser   func(user *models.User) bool
+		wantRevoke bool
+		wantErr    error
+	}{
+		{
+			name:    "deactivate",
+			patch:   `{"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+			ifMatch: version,
+			wantUser: func(user *models.User) bool {
+				return user.DisabledAt != nil
+			},
+			wantRevoke: true,
+		},
+		{
+			name:  "replace attributes without path",
+			patch: `{"Operations":[{"op":"replace","value":{"userName":"renamed@test.com","externalId":"ext-1","name.givenName":"Ada"}}]}`,
+			wantUser: func(user *models.User) bool {
+				return user.Email == "renamed@test.com" && user.ExternalID == "ext-1" && user.DisabledAt == nil
+			},
+		},
+		{
+			name:    "grant admin",
+			patch:   `{"Operations":[{"op":"add","path":"roles","value":[{"value":"admin"}]}]}`,
+			wantErr: utils.ErrValidationFailed,
+		},
+		{
+			name:  "remove roles",
+			patch: `{"Operations":[{"op":"remove","path":"roles"}]}`,
+			wantUser: func(user *models.User) bool {
+				return user.Role == models.RoleUser
+			},
+		},
+		{
+			name:    "stale version",
+			patch:   `{"Operations":[{"op":"replace","path":"active","value":false}]}`,
+			ifMatch: `W/"stale"`,
+			wantErr: utils.ErrPreconditionFailed,
+		},
+		{
+			name:    "remove userName",
+			patch:   `{"Operations":[{"op":"remove","path":"userName"}]}`,
+			wantErr: utils.ErrValidationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m scimMocks
+			m.users.On("FetchUserByID", uint(2)).Return(newTestSCIMUser(), nil)
+			if test.wantUser != nil {
+				m.users.On("UpdateUser", mock.MatchedBy(test.wantUser)).Return(nil)
+			}
+			if test.wantRevoke {
+				m.tokens.On("DeleteByUserID", uint(2)).Return(int64(2), nil)
+			}
+
+			var patch scim.PatchRequest
+			assert.NoError(t, json.Unmarshal([]byte(test.patch), &patch))
+
+			_, err := newTestSCIMService(&m).PatchUser(context.Background(), 2, patch, test.ifMatch)
+			assert.ErrorIs(t, err, test.wantErr)
+			m.users.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMDeleteUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantMock func(m *scimMocks)
+		wantErr  error
+	}{
+		{
+			name: "success",
+			wantMock: func(m *scimMocks) {
+				m.users.On("FetchUserByID", uint(2)).Return(newTestSCIMUser(), nil)
+				m.users.On("DeleteUser", uint(2)).Return(nil)
+			},
+		},
+		{
+			name: "not found",
+			wantMock: func(m *scimMocks) {
+				m.users.On("FetchUserByID", uint(2)).Return((*models.User)(nil), nil)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m scimMocks
+			test.wantMock(&m)
+
+			err := newTestSCIMService(&m).DeleteUser(context.Background(), 2, "")
+			assert.ErrorIs(t, err, test.wantErr)
+			m.users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSCIMPatchGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		patch       string
+		wantMock    func(m *scimMocks)
+		wantName    string
+		wantAdded   []uint
+		wantRemoved []uint
+		wantErr     error
+	}{
+		{
+			name:  "add and remove members",
+			patch: `{"Operations":[{"op":"add","path":"members","value":[{"value":"3"}]},{"op":"remove","path":"members[value eq \"2\"]"}]}`,
+			wantMock: func(m *scimMocks) {
+				m.users.On("FetchUserByID", uint(3)).Return(&models.User{Model: gorm.Model{ID: 3}}, nil)
+				m.tokens.On("DeleteByOrganization", uint(2), uint(5)).Return(int64(1), nil)
+			},
+			wantName:    "Engineering",
+			wantAdded:   []uint{3},
+			wantRemoved: []uint{2},
+		},
+		{
+			name:        "rename",
+			patch:       `{"Operations":[{"op":"replace","value":{"displayName":"Platform"}}]}`,
+			wantMock:    func(m *scimMocks) {},
+			wantName:    "Platform",
+			wantAdded:   []uint{},
+			wantRemoved: []uint{},
+		},
+		{
+			name:  "unknown member",
+			patch: `{"Operations":[{"op":"add","path":"members","value":[{"value":"9"}]}]}`,
+			wantMock: func(m *scimMocks) {
+				m.users.On("FetchUserByID", uint(9)).Return((*models.User)(nil), nil)
+			},
+			wantErr: utils.ErrValidationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m scimMocks
+			m.orgs.On("FetchOrganization", uint(5)).Return(newTestSCIMOrganization(), nil)
+			m.orgs.On("FetchMembers", uint(5)).Return([]models.Membership{*newTestMembership(5, 2, models.OrgRoleMember)}, nil)
+			test.wantMock(&m)
+			if test.wantErr == nil {
+				m.orgs.On("UpdateOrganization", mock.MatchedBy(func(org *models.Organization) bool {
+					return org.Name == test.wantName
+				})).Return(nil)
+				m.orgs.On("AddMembers", uint(5), test.wantAdded, models.OrgRoleMember).Return(nil)
+				m.orgs.On("RemoveMembers", uint(5), test.wantRemoved).Return(nil)
+			}
+
+			var patch scim.PatchRequest
+			assert.NoError(t, json.Unmarshal([]byte(test.patch), &patch))
+
+			_, err := newTestSCIMService(&m).PatchGroup(context.Background(), 5, patch, "")
+			assert.ErrorIs(t, err, test.wantErr)
+			m.orgs.AssertExpectations(t)
+			m.users.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/scim"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	scimTokenPrefix       = "scim_"
+	scimTokenPrefixLength = 13
+)
+
+var errSCIMTokenNotFound = utils.ErrNotFound.WithDetail("No active SCIM token was found.")
+
+type SCIMTokenServiceImpl struct {
+	Repo  SCIMTokenRepository
+	Audit AuditRecorder
+}
+
+type SCIMTokenRepository interface {
+	CreateSCIMToken(ctx context.Context, token *models.SCIMToken) error
+	FetchByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error)
+	RevokeSCIMToken(ctx context.Context, id uint, now time.Time) error
+}
+
+func NewSCIMTokenServiceImpl(repo SCIMTokenRepository, audit AuditRecorder) *SCIMTokenServiceImpl {
+	return &SCIMTokenServiceImpl{
+		Repo:  repo,
+		Audit: audit,
+	}
+}
+
+// MintSCIMToken creates a bearer token for a SCIM client provisioning the
+// tenant in ctx. The plain token is only returned here and cannot be
+// recovered later.
+func (s *SCIMTokenServiceImpl) MintSCIMToken(ctx context.Context, name string) (token string, scimToken *models.SCIMToken, err error) {
+	var target string
+	defer func() { recordAudit(ctx, s.Audit, models.AuditSCIMTokenCreate, "", target, err) }()
+
+	random, err := utils.GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	token = scimTokenPrefix + random
+	scimToken = models.NewSCIMToken(name, token[:scimTokenPrefixLength], utils.HashToken(token))
+	if err := s.Repo.CreateSCIMToken(ctx, scimToken); err != nil {
+		return "", nil, err
+	}
+
+	target = models.AuditSCIMToken(scimToken.ID)
+	return token, scimToken, nil
+}
+
+// RevokeSCIMToken revokes a token of the tenant in ctx, which is rejected by
+// VerifySCIMToken from then on.
+func (s *SCIMTokenServiceImpl) RevokeSCIMToken(ctx context.Context, id uint) (err error) {
+	defer func() { recordAudit(ctx, s.Audit, models.AuditSCIMTokenRevoke, "", models.AuditSCIMToken(id), err) }()
+
+	err = s.Repo.RevokeSCIMToken(ctx, id, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errSCIMTokenNotFound
+	}
+
+	return err
+}
+
+// VerifySCIMToken returns the client of a valid token, or nil when the token
+// is unknown or was revoked with RevokeSCIMToken. Tokens of every tenant are
+// accepted.
+func (s *SCIMTokenServiceImpl) VerifySCIMToken(ctx context.Context, token string) (*scim.Client, error) {
+	scimToken, err := s.Repo.FetchByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if scimToken == nil {
+		return nil, nil
+	}
+
+	return &scim.Client{
+		TenantID: scimToken.TenantID,
+		Actor:    models.AuditSCIMToken(scimToken.ID),
+	}, nil
+}
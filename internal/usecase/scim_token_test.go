@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockSCIMTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockSCIMTokenRepository) CreateSCIMToken(ctx context.Context, token *models.SCIMToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockSCIMTokenRepository) FetchByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error) {
+	args := m.Called(tokenHash)
+	return args.Get(0).(*models.SCIMToken), args.Error(1)
+}
+
+func (m *MockSCIMTokenRepository) RevokeSCIMToken(ctx context.Context, id uint, now time.Time) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func TestRevokeSCIMToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		repoErr     error
+		wantErr     error
+		wantOutcome string
+	}{
+		{
+			name:        "success",
+			wantOutcome: models.AuditOutcomeSuccess,
+		},
+		{
+			name:        "unknown or already revoked",
+			repoErr:     fmt.Errorf("failed to revoke scim token: %w", gorm.ErrRecordNotFound),
+			wantErr:     utils.ErrNotFound,
+			wantOutcome: models.AuditOutcomeFailure,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockSCIMTokenRepository
+			var audit fakeAuditRecorder
+			mockRepo.On("RevokeSCIMToken", uint(3)).Return(test.repoErr)
+			service := NewSCIMTokenServiceImpl(&mockRepo, &audit)
+
+			err := service.RevokeSCIMToken(context.Background(), 3)
+			assert.ErrorIs(t, err, test.wantErr)
+			if assert.Len(t, audit.events, 1) {
+				assert.Equal(t, models.AuditSCIMTokenRevoke, audit.events[0].Type)
+				assert.Equal(t, test.wantOutcome, audit.events[0].Outcome)
+				assert.Equal(t, models.AuditSCIMToken(3), audit.events[0].Target)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
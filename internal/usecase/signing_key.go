@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+)
+
+type SigningKeyServiceImpl struct {
+	Repo SigningKeyRepository
+	Keys *utils.Keyring
+	// GracePeriod keeps retired keys valid for as long as the access tokens
+	// they signed can live, which is the longest allowed access token TTL.
+	GracePeriod time.Duration
+	// FallbackGrace keeps tokens signed with the fallback secret valid for
+	// this long after the first key was rotated in.
+	FallbackGrace time.Duration
+}
+
+type SigningKeyRepository interface {
+	RotateKey(ctx context.Context, key *models.SigningKey) error
+	FetchVerificationKeys(ctx context.Context, retiredAfter time.Time) ([]models.SigningKey, error)
+	FetchFirstKeyCreatedAt(ctx context.Context) (time.Time, error)
+}
+
+func NewSigningKeyServiceImpl(repo SigningKeyRepository, keys *utils.Keyring, gracePeriod time.Duration) *SigningKeyServiceImpl {
+	return &SigningKeyServiceImpl{
+		Repo:        repo,
+		Keys:        keys,
+		GracePeriod: gracePeriod,
+	}
+}
+
+// RotateKey generates a new active signing key and returns its key ID.
+func (s *SigningKeyServiceImpl) RotateKey(ctx context.Context) (string, error) {
+	kid, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Key IDs end up in every token header, so keep them short.
+	key := models.NewSigningKey(kid[:16], secret)
+	if err := s.Repo.RotateKey(ctx, key); err != nil {
+		return "", err
+	}
+
+	return key.KID, nil
+}
+
+// LoadKeys loads the active and recently retired keys into the keyring.
+// Without any keys in the database the fallback secret keeps being used.
+func (s *SigningKeyServiceImpl) LoadKeys(ctx context.Context) error {
+	keys, err := s.Repo.FetchVerificationKeys(ctx, time.Now().Add(-s.GracePeriod))
+	if err != nil {
+		return err
+	}
+
+	var active *utils.SigningKey
+	verification := make([]utils.SigningKey, 0, len(keys))
+	for _, k := range keys {
+		secret, err := hex.DecodeString(k.Secret)
+		if err != nil {
+			return fmt.Errorf("invalid secret for signing key %s: %w", k.KID, err)
+		}
+
+		key := utils.SigningKey{ID: k.KID, Secret: secret}
+		if k.Active {
+			active = &key
+		}
+		verification = append(verification, key)
+	}
+
+	if active == nil {
+		s.Keys.Clear()
+		return nil
+	}
+
+	var fallbackUntil time.Time
+	if s.FallbackGrace > 0 {
+		firstCreatedAt, err := s.Repo.FetchFirstKeyCreatedAt(ctx)
+		if err != nil {
+			return err
+		}
+		fallbackUntil = firstCreatedAt.Add(s.FallbackGrace)
+	}
+
+	s.Keys.SetKeys(*active, verification, fallbackUntil)
+	return nil
+}
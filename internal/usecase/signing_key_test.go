@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSigningKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockSigningKeyRepository) RotateKey(ctx context.Context, key *models.SigningKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockSigningKeyRepository) FetchVerificationKeys(ctx context.Context, retiredAfter time.Time) ([]models.SigningKey, error) {
+	args := m.Called(retiredAfter)
+	return args.Get(0).([]models.SigningKey), args.Error(1)
+}
+
+func (m *MockSigningKeyRepository) FetchFirstKeyCreatedAt(ctx context.Context) (time.Time, error) {
+	args := m.Called()
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func TestRotateKey(t *testing.T) {
+	var mockRepo MockSigningKeyRepository
+	mockRepo.On("RotateKey", mock.MatchedBy(func(key *models.SigningKey) bool {
+		return key.Active && len(key.KID) == 16 && len(key.Secret) == 64
+	})).Return(nil)
+	service := NewSigningKeyServiceImpl(&mockRepo, utils.NewKeyring("test_secret"), time.Hour)
+
+	kid, err := service.RotateKey(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, kid, 16)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLoadKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []models.SigningKey
+		repoErr    error
+		wantActive string
+		wantErr    bool
+	}{
+		{
+			name: "active and retired keys",
+			keys: []models.SigningKey{
+				{KID: "new", Secret: "6e6577", Active: true},
+				{KID: "old", Secret: "6f6c64"},
+			},
+			wantActive: "new",
+			wantErr:    false,
+		},
+		{
+			name:       "no keys",
+			keys:       []models.SigningKey{},
+			wantActive: "",
+			wantErr:    false,
+		},
+		{
+			name:    "invalid secret",
+			keys:    []models.SigningKey{{KID: "bad", Secret: "not hex", Active: true}},
+			wantErr: true,
+		},
+		{
+			name:    "repository error",
+			keys:    []models.SigningKey{},
+			repoErr: fmt.Errorf("db error"),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockSigningKeyRepository
+			// Keys retired within the grace period are still loaded
+			mockRepo.On("FetchVerificationKeys", mock.MatchedBy(func(retiredAfter time.Time) bool {
+				return time.Since(retiredAfter).Round(time.Minute) == time.Hour
+			})).Return(test.keys, test.repoErr)
+			keys := utils.NewKeyring("test_secret")
+			service := NewSigningKeyServiceImpl(&mockRepo, keys, time.Hour)
+
+			err := service.LoadKeys(context.Background())
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			active, ok := keys.Active()
+			assert.Equal(t, test.wantActive != "", ok)
+			assert.Equal(t, test.wantActive, active.ID)
+		})
+	}
+}
+
+func TestLoadKeysFallbackGrace(t *testing.T) {
+	tests := []struct {
+		name         string
+		grace        time.Duration
+		firstCreated time.Time
+		wantFallback bool
+	}{
+		{name: "no grace", wantFallback: false},
+		{name: "within the grace period", grace: time.Hour, firstCreated: time.Now().Add(-time.Minute), wantFallback: true},
+		{name: "after the grace period", grace: time.Hour, firstCreated: time.Now().Add(-2 * time.Hour), wantFallback: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockSigningKeyRepository
+			mockRepo.On("FetchVerificationKeys", mock.AnythingOfType("time.Time")).Return([]models.SigningKey{{KID: "new", Secret: "6e6577", Active: true}}, nil)
+			if test.grace > 0 {
+				mockRepo.On("FetchFirstKeyCreatedAt").Return(test.firstCreated, nil)
+			}
+			keys := utils.NewKeyring("test_secret")
+			service := NewSigningKeyServiceImpl(&mockRepo, keys, time.Hour)
+			service.FallbackGrace = test.grace
+
+			assert.NoError(t, service.LoadKeys(context.Background()))
+			assert.Equal(t, test.wantFallback, keys.AcceptsFallback())
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
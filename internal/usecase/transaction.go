@@ -0,0 +1,20 @@
+package usecase
+
+import "context"
+
+// TxRepositories are the repositories bound to one transaction.
+type TxRepositories struct {
+	Users  UserRepository
+	Tokens RefreshTokenRepository
+	// Organizations is nil for backends without organizations.
+	Organizations OrganizationRepository
+	// Identities is nil for backends without federated sign-in.
+	Identities IdentityRepository
+}
+
+// TxManager runs fn in a transaction that commits when fn returns nil and
+// rolls back otherwise. fn may be run more than once when the database asks
+// for a retry, so it must only change state through repos.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(repos TxRepositories) error) error
+}
@@ -1,21 +1,74 @@
 package usecase
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
 	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tracing"
 	"github.com/soicchi/auth_api/internal/utils"
 )
 
+var errSignupRejected = utils.ErrBadRequest.WithDetail("The account could not be created.")
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
 type UserServiceImpl struct {
 	UserRepo  UserRepository
 	TokenRepo RefreshTokenRepository
+	// Tx runs changes spanning several repository calls.
+	Tx     TxManager
+	Tokens *utils.TokenIssuer
+	Audit  AuditRecorder
+	// Verifier checks the passwords of SignIn and of reauthentication,
+	// against the users table when nil.
+	Verifier CredentialVerifier
+	// DiscloseEmailTaken makes CreateUser report utils.ErrEmailTaken for
+	// registered emails instead of a generic bad request.
+	DiscloseEmailTaken bool
 }
 
 type UserRepository interface {
-	CreateUser(user *models.User) (uint, error)
-	FetchUserByEmail(email string) (*models.User, error)
-	FetchUsers() ([]models.User, error)
+	CreateUser(ctx context.Context, user *models.User) (uint, error)
+	FetchUserByEmail(ctx context.Context, email string) (*models.User, error)
+	FetchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+	FetchUserByID(ctx context.Context, userID uint) (*models.User, error)
+	FetchAnyUserByID(ctx context.Context, userID uint) (*models.User, error)
+	UpdatePassword(ctx context.Context, userID uint, hashedPassword string) error
+	SetDisabledAt(ctx context.Context, userID uint, disabledAt *time.Time) error
+	RequirePasswordReset(ctx context.Context, userID uint) error
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, userID uint) error
+	RestoreUser(ctx context.Context, userID uint) error
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) (int64, error)
+}
+
+// CredentialVerifier checks the password of a sign-in and returns the user
+// it belongs to. Rejected credentials are reported with
+// utils.ErrInvalidCredentials, along with the user when one is known so that
+// the attempt can be attributed to it.
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, email, password string) (*models.User, error)
+}
+
+// PasswordVerifier checks passwords against the hashes of the users table.
+type PasswordVerifier struct {
+	Users UserRepository
+}
+
+// UserPage is one page of users. NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []models.User
+	NextCursor string
 }
 
 type ResponseUser struct {
@@ -23,10 +76,13 @@ type ResponseUser struct {
 	Email string `json:"email"`
 }
 
-func NewUserServiceImpl(userRepo UserRepository, tokenRepo RefreshTokenRepository) *UserServiceImpl {
+func NewUserServiceImpl(userRepo UserRepository, tokenRepo RefreshTokenRepository, tx TxManager, tokens *utils.TokenIssuer, audit AuditRecorder) *UserServiceImpl {
 	return &UserServiceImpl{
 		UserRepo:  userRepo,
 		TokenRepo: tokenRepo,
+		Tx:        tx,
+		Tokens:    tokens,
+		Audit:     audit,
 	}
 }
 
@@ -37,11 +93,35 @@ func newResponseUser(user *models.User) ResponseUser {
 	}
 }
 
-func (s *UserServiceImpl) CreateUser(email string, password string) (map[string]string, error) {
-	tokens := make(map[string]string)
+// CreateUser registers a user and issues its first tokens, applying the
+// overrides of the calling client.
+func (s *UserServiceImpl) CreateUser(ctx context.Context, email string, password string, overrides utils.TokenOverrides) (utils.TokenPair, error) {
+	return s.createUser(ctx, email, password, "", overrides)
+}
+
+// CreateInvitedUser registers a user like CreateUser and accepts the
+// invitation with the token in the same transaction, so that no account is
+// left behind when the invitation cannot be used. The invitation must be
+// addressed to email, and the first tokens are issued in its organization.
+func (s *UserServiceImpl) CreateInvitedUser(ctx context.Context, email, password, invitationToken string, overrides utils.TokenOverrides) (utils.TokenPair, error) {
+	return s.createUser(ctx, email, password, invitationToken, overrides)
+}
+
+func (s *UserServiceImpl) createUser(ctx context.Context, email, password, invitationToken string, overrides utils.TokenOverrides) (tokens utils.TokenPair, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	var subject string
+	var membership *models.Membership
+	defer func() {
+		metrics.RecordSignup(metricResult(err))
+		recordAudit(ctx, s.Audit, models.AuditSignup, subject, subject, err)
+		if membership != nil {
+			recordAudit(ctx, s.Audit, models.AuditInviteAccept, subject, models.AuditOrganization(membership.OrganizationID), err)
+		}
+		tracing.End(span, err)
+	}()
 
 	// hash password
-	hashedPassword, err := utils.HashPassword(password)
+	hashedPassword, err := utils.HashPassword(ctx, password)
 	if err != nil {
 		return tokens, err
 	}
@@ -52,48 +132,355 @@ func (s *UserServiceImpl) CreateUser(email string, password string) (map[string]
 		return tokens, err
 	}
 
-	refreshToken := models.NewRefreshToken(token)
-	user := models.NewUser(email, hashedPassword, refreshToken)
+	var userID uint
+	refreshToken := models.NewRefreshToken(token, s.Tokens.RefreshTokenExpiry(overrides))
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		// Rows are built afresh because a retried attempt starts over
+		user := models.NewUser(email, hashedPassword)
+		id, err := repos.Users.CreateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		userID = id
+		refreshToken.ID = 0
+		refreshToken.UserID = id
+		if invitationToken != "" {
+			membership, err = acceptInvitation(ctx, repos.Organizations, invitationToken, email, id, time.Now())
+			if err != nil {
+				return err
+			}
+			refreshToken.OrganizationID = membership.OrganizationID
+		}
+
+		return repos.Tokens.CreateRefreshToken(ctx, &refreshToken)
+	})
+	if errors.Is(err, models.ErrDuplicateEmail) && s.DiscloseEmailTaken {
+		return tokens, utils.ErrEmailTaken
+	}
+
+	// A generic client error, rather than a 500, keeps registered emails from
+	// standing out
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		logging.FromContext(ctx).Info("signup rejected", "reason", utils.CodeEmailTaken)
+		return tokens, errSignupRejected.Wrap(err)
+	}
 
-	userID, err := s.UserRepo.CreateUser(user)
 	if err != nil {
 		return tokens, err
 	}
 
+	subject = models.AuditUser(userID)
+	logging.FromContext(ctx).Info("user signed up", "user_id", userID)
+
 	// generate access token
-	accessToken, err := utils.GenerateJWT(userID)
+	accessToken, err := s.Tokens.OrganizationAccessToken(ctx, userID, refreshToken.OrganizationID, overrides)
 	if err != nil {
 		return tokens, err
 	}
 
-	tokens["accessToken"] = accessToken
-	tokens["refreshToken"] = refreshToken.Token
+	tokens.AccessToken = accessToken
+	tokens.RefreshToken = refreshToken.Token
+	tokens.RefreshTokenExpiresAt = refreshToken.ExpiredAt
 
 	return tokens, nil
 }
 
-func (s *UserServiceImpl) CheckSignIn(email, password string) error {
-	user, err := s.UserRepo.FetchUserByEmail(email)
+// SignIn checks the credentials and account state and issues tokens whose
+// access token records the time of the sign-in. A non-zero orgID starts the
+// session in that organization, as SwitchOrganization would, and requires
+// the user to be a member.
+func (s *UserServiceImpl) SignIn(ctx context.Context, email, password string, orgID uint, overrides utils.TokenOverrides) (tokens utils.TokenPair, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SignIn")
+	var subject string
+	defer func() {
+		metrics.RecordSignIn(metricResult(err))
+		recordAudit(ctx, s.Audit, models.AuditSignIn, subject, subject, err)
+		tracing.End(span, err)
+	}()
+
+	user, err := s.verifier().VerifyCredentials(ctx, email, password)
+
+	// Failed attempts against a registered account are attributed to it
+	if user != nil {
+		subject = models.AuditUser(user.ID)
+	}
+
+	if errors.Is(err, utils.ErrInvalidCredentials) {
+		logging.FromContext(ctx).Info("sign in rejected", "reason", utils.CodeInvalidCredentials)
+		return tokens, err
+	}
+
+	if err != nil {
+		return tokens, err
+	}
+
+	// Account state is only revealed to callers who know the password
+	if user.DisabledAt != nil {
+		logging.FromContext(ctx).Info("sign in rejected", "reason", utils.CodeAccountDisabled)
+		return tokens, utils.ErrAccountDisabled
+	}
+
+	if user.PasswordResetRequired {
+		logging.FromContext(ctx).Info("sign in rejected", "reason", utils.CodePasswordResetDue)
+		return tokens, utils.ErrPasswordResetDue
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return tokens, err
+	}
+
+	refreshToken := models.NewRefreshToken(token, s.Tokens.RefreshTokenExpiry(overrides))
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		if orgID != 0 {
+			membership, err := repos.Organizations.FetchMembership(ctx, orgID, user.ID)
+			if err != nil {
+				return err
+			}
+
+			if membership == nil {
+				return errOrganizationNotFound
+			}
+		}
+
+		refreshToken.ID = 0
+		refreshToken.UserID = user.ID
+		refreshToken.OrganizationID = orgID
+		return repos.Tokens.CreateRefreshToken(ctx, &refreshToken)
+	})
+	if err != nil {
+		return tokens, err
+	}
+
+	accessToken, err := s.Tokens.SignInAccessToken(ctx, user.ID, orgID, overrides)
+	if err != nil {
+		return tokens, err
+	}
+
+	logging.FromContext(ctx).Info("user signed in", "user_id", user.ID)
+
+	tokens.AccessToken = accessToken
+	tokens.RefreshToken = refreshToken.Token
+	tokens.RefreshTokenExpiresAt = refreshToken.ExpiredAt
+
+	return tokens, nil
+}
+
+func (s *UserServiceImpl) verifier() CredentialVerifier {
+	return credentialVerifier(s.Verifier, s.UserRepo)
+}
+
+// credentialVerifier returns verifier, or one checking the passwords of users
+// when it is nil.
+func credentialVerifier(verifier CredentialVerifier, users UserRepository) CredentialVerifier {
+	if verifier != nil {
+		return verifier
+	}
+
+	return &PasswordVerifier{Users: users}
+}
+
+func (v *PasswordVerifier) VerifyCredentials(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := v.Users.FetchUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify against a dummy hash for unknown users, and users without a
+	// password such as those created at federated sign-in, so that the
+	// response time does not reveal whether the email is registered.
+	hashedPassword := utils.DummyPasswordHash()
+	if user != nil && user.Password != "" {
+		hashedPassword = user.Password
+	}
+
+	if !utils.ValidatePassword(ctx, hashedPassword, password) || user == nil || user.Password == "" {
+		return user, utils.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// ListUsers returns a page of users. Active users are listed oldest first
+// unless filter asks otherwise.
+func (s *UserServiceImpl) ListUsers(ctx context.Context, filter models.UserFilter) (page UserPage, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListUsers")
+	defer func() { tracing.End(span, err) }()
+
+	if filter.Sort == "" {
+		filter.Sort = models.UserSortCreatedAsc
+	}
+	if filter.State == "" {
+		filter.State = models.UserStateActive
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+
+	var fields []utils.FieldError
+	if !slices.Contains(models.UserSorts, filter.Sort) {
+		fields = append(fields, oneOfFieldError("sort", filter.Sort, models.UserSorts))
+	}
+	if !slices.Contains(models.UserStates, filter.State) {
+		fields = append(fields, oneOfFieldError("state", filter.State, models.UserStates))
+	}
+	if len(fields) > 0 {
+		return page, utils.ErrValidationFailed.WithFields(fields)
+	}
+
+	users, err := s.UserRepo.FetchUsers(ctx, filter)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		return page, utils.ErrBadRequest.WithDetail("The cursor is invalid.")
+	}
+	if err != nil {
+		return page, err
+	}
+
+	page.Users = users
+	if len(users) == filter.Limit {
+		page.NextCursor = models.UserCursor(filter.Sort, users[len(users)-1])
+	}
+
+	return page, nil
+}
+
+func oneOfFieldError(field, value string, allowed []string) utils.FieldError {
+	param := strings.Join(allowed, " ")
+	return utils.FieldError{
+		Field:   field,
+		Rule:    "oneof",
+		Param:   param,
+		Message: fmt.Sprintf("%s must be one of [%s]", field, param),
+	}
+}
+
+// CreateAdminUser creates a user with the admin role. It is meant for
+// operators and does not issue tokens.
+func (s *UserServiceImpl) CreateAdminUser(ctx context.Context, email, password string) (userID uint, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateAdminUser")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditAdminCreate, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	hashedPassword, err := utils.HashPassword(ctx, password)
+	if err != nil {
+		return 0, err
+	}
+
+	user := models.NewUser(email, hashedPassword)
+	user.Role = models.RoleAdmin
+
+	userID, err = s.UserRepo.CreateUser(ctx, user)
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		return 0, utils.ErrEmailTaken
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	target = models.AuditUser(userID)
+	return userID, nil
+}
+
+// ResetPassword sets a new password and revokes every session of the user.
+func (s *UserServiceImpl) ResetPassword(ctx context.Context, email, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ResetPassword")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditPasswordReset, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	user, err := s.fetchExistingUser(ctx, email)
+	if err != nil {
+		return err
+	}
+	target = models.AuditUser(user.ID)
+
+	hashedPassword, err := utils.HashPassword(ctx, password)
 	if err != nil {
 		return err
 	}
 
-	if !utils.ValidatePassword(user.Password, password) {
-		return fmt.Errorf("error validating password")
+	var revoked int64
+	err = s.Tx.WithinTx(ctx, func(repos TxRepositories) error {
+		if err := repos.Users.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+
+		deleted, err := repos.Tokens.DeleteByUserID(ctx, user.ID)
+		revoked = deleted
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("password reset", "user_id", user.ID, "revoked_sessions", revoked)
 	return nil
 }
 
-func (s *UserServiceImpl) FetchAllUsers() ([]models.User, error) {
-	users, err := s.UserRepo.FetchUsers()
+// RevokeSessions deletes every refresh token of the user and returns how many
+// were removed.
+func (s *UserServiceImpl) RevokeSessions(ctx context.Context, email string) (revoked int64, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RevokeSessions")
+	var target string
+	defer func() {
+		recordAudit(ctx, s.Audit, models.AuditSessionsRevoke, "", target, err)
+		tracing.End(span, err)
+	}()
+
+	user, err := s.fetchExistingUser(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	target = models.AuditUser(user.ID)
+
+	revoked, err = s.TokenRepo.DeleteByUserID(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.RecordSessionRevocations(revoked)
+	logging.FromContext(ctx).Info("sessions revoked", "user_id", user.ID, "revoked_sessions", revoked)
+	return revoked, nil
+}
+
+// FetchUserRole returns the role of the user, or an empty role when the user
+// no longer exists or is disabled.
+func (s *UserServiceImpl) FetchUserRole(ctx context.Context, userID uint) (role string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.FetchUserRole")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.UserRepo.FetchUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if user == nil || user.DisabledAt != nil {
+		return "", nil
+	}
+
+	return user.Role, nil
+}
+
+func (s *UserServiceImpl) fetchExistingUser(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.UserRepo.FetchUserByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
 
-	if users == nil {
-		return nil, nil
+	if user == nil {
+		return nil, utils.ErrNotFound.WithDetail("The user was not found.")
 	}
 
-	return users, nil
+	return user, nil
 }
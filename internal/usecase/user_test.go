@@ -1,12 +1,16 @@
 package usecase
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/soicchi/auth_api/internal/models"
 	"github.com/soicchi/auth_api/internal/utils"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gorm.io/gorm"
@@ -16,43 +20,166 @@ type MockUserRepository struct {
 	mock.Mock
 }
 
-func (m *MockUserRepository) CreateUser(user *models.User) (uint, error) {
+func (m *MockUserRepository) CreateUser(ctx context.Context, user *models.User) (uint, error) {
 	args := m.Called(user)
 	return args.Get(0).(uint), args.Error(1)
 }
 
-func (m *MockUserRepository) FetchUserByEmail(email string) (*models.User, error) {
+func (m *MockUserRepository) FetchUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	args := m.Called(email)
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockUserRepository) FetchUsers() ([]models.User, error) {
-	args := m.Called()
+func (m *MockUserRepository) FetchUserByID(ctx context.Context, userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) FetchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	args := m.Called(filter)
 	return args.Get(0).([]models.User), args.Error(1)
 }
 
+func (m *MockUserRepository) FetchAnyUserByID(ctx context.Context, userID uint) (*models.User, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, userID uint, hashedPassword string) error {
+	args := m.Called(userID, hashedPassword)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetDisabledAt(ctx context.Context, userID uint, disabledAt *time.Time) error {
+	args := m.Called(userID, disabledAt != nil)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) RequirePasswordReset(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) DeleteUser(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) RestoreUser(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	args := m.Called(deletedBefore, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// fakeTxManager runs functions on the repositories it was given without a
+// transaction, so that mocks see the calls made inside WithinTx.
+type fakeTxManager struct {
+	repos TxRepositories
+}
+
+func newFakeTxManager(userRepo UserRepository, tokenRepo RefreshTokenRepository) *fakeTxManager {
+	return &fakeTxManager{
+		repos: TxRepositories{Users: userRepo, Tokens: tokenRepo},
+	}
+}
+
+func (m *fakeTxManager) WithinTx(ctx context.Context, fn func(repos TxRepositories) error) error {
+	return fn(m.repos)
+}
+
+func newTestTokenIssuer() *utils.TokenIssuer {
+	return utils.NewTokenIssuer(utils.NewKeyring("test_secret"), utils.TokenSettings{
+		Issuer:          "auth_api",
+		Audience:        "auth_api",
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+	})
+}
+
 func TestCreateUser(t *testing.T) {
 	tests := []struct {
-		name          string
-		inputEmail    string
-		inputPassword string
-		wantMock      func(mockUserRepo *MockUserRepository)
-		wantErr       bool
+		name           string
+		inputEmail     string
+		inputPassword  string
+		overrides      utils.TokenOverrides
+		disclose       bool
+		wantMock       func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository)
+		wantRefreshTTL time.Duration
+		wantErr        bool
+		wantErrIs      error
 	}{
 		{
 			name:          "Valid create user",
 			inputEmail:    "test@test.com",
 			inputPassword: "password",
-			wantMock: func(mockUserRepo *MockUserRepository) {
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
 				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(1), nil)
+				mockTokenRepo.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+					return token.UserID == 1 && token.Token != ""
+				})).Return(nil)
 			},
-			wantErr: false,
+			wantRefreshTTL: 24 * time.Hour,
+			wantErr:        false,
+		},
+		{
+			name:          "Valid create user with client overrides",
+			inputEmail:    "test@test.com",
+			inputPassword: "password",
+			overrides:     utils.TokenOverrides{RefreshTokenTTL: time.Hour},
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(1), nil)
+				mockTokenRepo.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+					return token.UserID == 1 && token.Token != ""
+				})).Return(nil)
+			},
+			wantRefreshTTL: time.Hour,
+			wantErr:        false,
+		},
+		{
+			name:          "Create user with duplicate email",
+			inputEmail:    "test@test.com",
+			inputPassword: "password",
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(0), models.ErrDuplicateEmail)
+			},
+			wantErr:   true,
+			wantErrIs: utils.ErrBadRequest,
+		},
+		{
+			name:          "Create user with disclosed duplicate email",
+			inputEmail:    "test@test.com",
+			inputPassword: "password",
+			disclose:      true,
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(0), models.ErrDuplicateEmail)
+			},
+			wantErr:   true,
+			wantErrIs: utils.ErrEmailTaken,
+		},
+		{
+			name:          "Create user with refresh token error",
+			inputEmail:    "test@test.com",
+			inputPassword: "password",
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(1), nil)
+				mockTokenRepo.On("CreateRefreshToken", mock.Anything).Return(fmt.Errorf("db error"))
+			},
+			wantErr: true,
 		},
 		{
 			name:          "Create user with create error",
 			inputEmail:    "test@test.com",
 			inputPassword: "password",
-			wantMock: func(mockUserRepo *MockUserRepository) {
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
 				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(0), fmt.Errorf("db error"))
 			},
 			wantErr: true,
@@ -63,27 +190,37 @@ func TestCreateUser(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			var mockUserRepo MockUserRepository
 			var mockTokenRepo MockRefreshTokenRepository
-			test.wantMock(&mockUserRepo)
+			test.wantMock(&mockUserRepo, &mockTokenRepo)
 			userService := &UserServiceImpl{
-				UserRepo:  &mockUserRepo,
-				TokenRepo: &mockTokenRepo,
+				UserRepo:           &mockUserRepo,
+				TokenRepo:          &mockTokenRepo,
+				Tx:                 newFakeTxManager(&mockUserRepo, &mockTokenRepo),
+				Tokens:             newTestTokenIssuer(),
+				DiscloseEmailTaken: test.disclose,
 			}
 
-			tokens, err := userService.CreateUser(test.inputEmail, test.inputPassword)
+			tokens, err := userService.CreateUser(context.Background(), test.inputEmail, test.inputPassword, test.overrides)
 
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
+				assert.Equal(t, test.disclose, errors.Is(err, utils.ErrEmailTaken))
+				if test.wantErrIs != nil {
+					assert.ErrorIs(t, err, test.wantErrIs)
+				}
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, tokens)
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEmpty(t, tokens.RefreshToken)
+				assert.WithinDuration(t, time.Now().Add(test.wantRefreshTTL), tokens.RefreshTokenExpiresAt, time.Minute)
 			}
 			mockUserRepo.AssertExpectations(t)
+			mockTokenRepo.AssertExpectations(t)
 		})
 	}
 }
 
-func TestCheckSignIn(t *testing.T) {
-	hashedPassword, _ := utils.HashPassword("password")
+func TestSignIn(t *testing.T) {
+	hashedPassword, _ := utils.HashPassword(context.Background(), "password")
 
 	tests := []struct {
 		name          string
@@ -126,7 +263,58 @@ func TestCheckSignIn(t *testing.T) {
 					Password: hashedPassword,
 				}, nil)
 			},
-			ErrMsg:  "error validating password",
+			ErrMsg:  "Invalid email or password.",
+			wantErr: true,
+		},
+		{
+			name:          "Check sign in of a user without password",
+			inputEmail:    "test@test.com",
+			inputPassword: "",
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("FetchUserByEmail", "test@test.com").Return(&models.User{
+					Email: "test@test.com",
+				}, nil)
+			},
+			ErrMsg:  "Invalid email or password.",
+			wantErr: true,
+		},
+		{
+			name:          "Check sign in with disabled account",
+			inputEmail:    "test@test.com",
+			inputPassword: "password",
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				disabledAt := time.Now()
+				mockUserRepo.On("FetchUserByEmail", "test@test.com").Return(&models.User{
+					Email:      "test@test.com",
+					Password:   hashedPassword,
+					DisabledAt: &disabledAt,
+				}, nil)
+			},
+			ErrMsg:  "The account has been disabled.",
+			wantErr: true,
+		},
+		{
+			name:          "Check sign in with password reset required",
+			inputEmail:    "test@test.com",
+			inputPassword: "password",
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("FetchUserByEmail", "test@test.com").Return(&models.User{
+					Email:                 "test@test.com",
+					Password:              hashedPassword,
+					PasswordResetRequired: true,
+				}, nil)
+			},
+			ErrMsg:  "The password must be reset before signing in.",
+			wantErr: true,
+		},
+		{
+			name:          "Check sign in with unknown email",
+			inputEmail:    "unknown@test.com",
+			inputPassword: "password",
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("FetchUserByEmail", "unknown@test.com").Return((*models.User)(nil), nil)
+			},
+			ErrMsg:  "Invalid email or password.",
 			wantErr: true,
 		},
 	}
@@ -136,35 +324,119 @@ func TestCheckSignIn(t *testing.T) {
 			var mockUserRepo MockUserRepository
 			var mockTokenRepo MockRefreshTokenRepository
 			test.wantMock(&mockUserRepo)
+			if !test.wantErr {
+				mockTokenRepo.On("CreateRefreshToken", mock.Anything).Return(nil)
+			}
+			var audit fakeAuditRecorder
 			userService := &UserServiceImpl{
 				UserRepo:  &mockUserRepo,
 				TokenRepo: &mockTokenRepo,
+				Tx:        newFakeTxManager(&mockUserRepo, &mockTokenRepo),
+				Tokens:    newTestTokenIssuer(),
+				Audit:     &audit,
 			}
 
-			err := userService.CheckSignIn(test.inputEmail, test.inputPassword)
+			tokens, err := userService.SignIn(context.Background(), test.inputEmail, test.inputPassword, 0, utils.TokenOverrides{})
 
+			wantOutcome := models.AuditOutcomeSuccess
 			if test.wantErr && err != nil {
 				assert.Error(t, err)
 				assert.Equal(t, test.ErrMsg, err.Error())
+				wantOutcome = models.AuditOutcomeFailure
 			} else {
 				assert.NoError(t, err)
+				assert.NotEmpty(t, tokens.RefreshToken)
+
+				// The access token vouches for the sign-in
+				claims := jwt.MapClaims{}
+				_, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte("test_secret"), nil
+				})
+				assert.NoError(t, err)
+				assert.Contains(t, claims, utils.ClaimAuthTime)
+			}
+			if assert.Len(t, audit.events, 1) {
+				assert.Equal(t, models.AuditSignIn, audit.events[0].Type)
+				assert.Equal(t, wantOutcome, audit.events[0].Outcome)
 			}
 			mockUserRepo.AssertExpectations(t)
+			mockTokenRepo.AssertExpectations(t)
 		})
 	}
 }
 
-func TestFetchAllUsers(t *testing.T) {
+func TestSignInOrganization(t *testing.T) {
+	hashedPassword, _ := utils.HashPassword(context.Background(), "password")
+	user := &models.User{Model: gorm.Model{ID: 1}, Email: "test@test.com", Password: hashedPassword}
+
 	tests := []struct {
 		name     string
-		wantMock func(mockUserRepo *MockUserRepository)
-		ErrMsg   string
-		wantErr  bool
+		wantMock func(m *orgMocks)
+		wantErr  error
 	}{
 		{
-			name: "Valid fetch all users",
+			name: "member",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return(newTestMembership(5, 1, models.OrgRoleMember), nil)
+				m.tokens.On("CreateRefreshToken", mock.MatchedBy(func(token *models.RefreshToken) bool {
+					return token.UserID == 1 && token.OrganizationID == 5
+				})).Return(nil)
+			},
+		},
+		{
+			name: "not a member",
+			wantMock: func(m *orgMocks) {
+				m.orgs.On("FetchMembership", uint(5), uint(1)).Return((*models.Membership)(nil), nil)
+			},
+			wantErr: utils.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m orgMocks
+			m.users.On("FetchUserByEmail", "test@test.com").Return(user, nil)
+			test.wantMock(&m)
+			userService := &UserServiceImpl{
+				UserRepo:  &m.users,
+				TokenRepo: &m.tokens,
+				Tx:        &fakeTxManager{repos: TxRepositories{Users: &m.users, Tokens: &m.tokens, Organizations: &m.orgs}},
+				Tokens:    newTestTokenIssuer(),
+				Audit:     &fakeAuditRecorder{},
+			}
+
+			tokens, err := userService.SignIn(context.Background(), "test@test.com", "password", 5, utils.TokenOverrides{})
+			assert.ErrorIs(t, err, test.wantErr)
+			if test.wantErr == nil {
+				claims := jwt.MapClaims{}
+				_, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte("test_secret"), nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, float64(5), claims[utils.ClaimOrganization])
+				assert.Contains(t, claims, utils.ClaimAuthTime)
+			}
+			m.orgs.AssertExpectations(t)
+			m.tokens.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	defaultFilter := models.UserFilter{State: models.UserStateActive, Sort: models.UserSortCreatedAsc, Limit: defaultUserPageSize}
+	tests := []struct {
+		name           string
+		in             models.UserFilter
+		wantMock       func(mockUserRepo *MockUserRepository)
+		wantUsers      int
+		wantNextCursor bool
+		wantErr        error
+	}{
+		{
+			name: "Valid list users with defaults",
+			in:   models.UserFilter{},
 			wantMock: func(mockUserRepo *MockUserRepository) {
-				mockUserRepo.On("FetchUsers").Return([]models.User{
+				mockUserRepo.On("FetchUsers", defaultFilter).Return([]models.User{
 					{
 						Model: gorm.Model{
 							ID: 1,
@@ -179,16 +451,46 @@ func TestFetchAllUsers(t *testing.T) {
 					},
 				}, nil)
 			},
-			ErrMsg:  "",
-			wantErr: false,
+			wantUsers: 2,
 		},
 		{
-			name: "Fetch all users with get users error",
+			name: "Full page has a next cursor",
+			in:   models.UserFilter{Sort: models.UserSortEmailDesc, Limit: 1},
 			wantMock: func(mockUserRepo *MockUserRepository) {
-				mockUserRepo.On("FetchUsers").Return([]models.User{}, fmt.Errorf("Not Found"))
+				mockUserRepo.On("FetchUsers", models.UserFilter{State: models.UserStateActive, Sort: models.UserSortEmailDesc, Limit: 1}).
+					Return([]models.User{{Model: gorm.Model{ID: 1}, Email: "test@test.com"}}, nil)
 			},
-			ErrMsg:  "Not Found",
-			wantErr: true,
+			wantUsers:      1,
+			wantNextCursor: true,
+		},
+		{
+			name: "Page size is capped",
+			in:   models.UserFilter{Limit: 10000},
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("FetchUsers", models.UserFilter{State: models.UserStateActive, Sort: models.UserSortCreatedAsc, Limit: maxUserPageSize}).
+					Return([]models.User{}, nil)
+			},
+		},
+		{
+			name:     "Unknown sort",
+			in:       models.UserFilter{Sort: "password"},
+			wantMock: func(mockUserRepo *MockUserRepository) {},
+			wantErr:  utils.ErrValidationFailed,
+		},
+		{
+			name:     "Unknown state",
+			in:       models.UserFilter{State: "locked"},
+			wantMock: func(mockUserRepo *MockUserRepository) {},
+			wantErr:  utils.ErrValidationFailed,
+		},
+		{
+			name: "Invalid cursor",
+			in:   models.UserFilter{Cursor: "abc"},
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("FetchUsers", models.UserFilter{State: models.UserStateActive, Sort: models.UserSortCreatedAsc, Cursor: "abc", Limit: defaultUserPageSize}).
+					Return([]models.User{}, fmt.Errorf("failed to fetch users: %w", models.ErrInvalidCursor))
+			},
+			wantErr: utils.ErrBadRequest,
 		},
 	}
 
@@ -200,18 +502,137 @@ func TestFetchAllUsers(t *testing.T) {
 			userService := &UserServiceImpl{
 				UserRepo:  &mockUserRepo,
 				TokenRepo: &mockTokenRepo,
+				Tokens:    newTestTokenIssuer(),
 			}
 
-			users, err := userService.FetchAllUsers()
+			page, err := userService.ListUsers(context.Background(), test.in)
 
-			if test.wantErr && err != nil {
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, page.Users, test.wantUsers)
+				assert.Equal(t, test.wantNextCursor, page.NextCursor != "")
+			}
+			mockUserRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreateAdminUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantMock func(mockUserRepo *MockUserRepository)
+		wantErr  error
+	}{
+		{
+			name: "Valid create admin user",
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("CreateUser", mock.MatchedBy(func(user *models.User) bool {
+					return user.Role == models.RoleAdmin && user.RefreshToken.Token == ""
+				})).Return(uint(1), nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "Create admin user with duplicate email",
+			wantMock: func(mockUserRepo *MockUserRepository) {
+				mockUserRepo.On("CreateUser", mock.Anything).Return(uint(0), models.ErrDuplicateEmail)
+			},
+			wantErr: utils.ErrEmailTaken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockUserRepo MockUserRepository
+			var mockTokenRepo MockRefreshTokenRepository
+			test.wantMock(&mockUserRepo)
+			userService := NewUserServiceImpl(&mockUserRepo, &mockTokenRepo, newFakeTxManager(&mockUserRepo, &mockTokenRepo), newTestTokenIssuer(), &fakeAuditRecorder{})
+
+			_, err := userService.CreateAdminUser(context.Background(), "admin@test.com", "password1")
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockUserRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantMock  func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository)
+		wantErr   bool
+		wantErrIs error
+	}{
+		{
+			name: "Valid reset password",
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("FetchUserByEmail", "test@test.com").Return(&models.User{Model: gorm.Model{ID: 1}}, nil)
+				mockUserRepo.On("UpdatePassword", uint(1), mock.Anything).Return(nil)
+				mockTokenRepo.On("DeleteByUserID", uint(1)).Return(int64(1), nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "Reset password for unknown user",
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("FetchUserByEmail", "test@test.com").Return((*models.User)(nil), nil)
+			},
+			wantErr:   true,
+			wantErrIs: utils.ErrNotFound,
+		},
+		{
+			name: "Reset password with update error",
+			wantMock: func(mockUserRepo *MockUserRepository, mockTokenRepo *MockRefreshTokenRepository) {
+				mockUserRepo.On("FetchUserByEmail", "test@test.com").Return(&models.User{Model: gorm.Model{ID: 1}}, nil)
+				mockUserRepo.On("UpdatePassword", uint(1), mock.Anything).Return(fmt.Errorf("db error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockUserRepo MockUserRepository
+			var mockTokenRepo MockRefreshTokenRepository
+			test.wantMock(&mockUserRepo, &mockTokenRepo)
+			userService := NewUserServiceImpl(&mockUserRepo, &mockTokenRepo, newFakeTxManager(&mockUserRepo, &mockTokenRepo), newTestTokenIssuer(), &fakeAuditRecorder{})
+
+			err := userService.ResetPassword(context.Background(), "test@test.com", "password1")
+			if test.wantErr {
 				assert.Error(t, err)
-				assert.Equal(t, test.ErrMsg, err.Error())
+				if test.wantErrIs != nil {
+					assert.ErrorIs(t, err, test.wantErrIs)
+				}
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, users)
 			}
 			mockUserRepo.AssertExpectations(t)
+			mockTokenRepo.AssertExpectations(t)
 		})
 	}
 }
+
+func TestRevokeSessions(t *testing.T) {
+	var mockUserRepo MockUserRepository
+	var mockTokenRepo MockRefreshTokenRepository
+	mockUserRepo.On("FetchUserByEmail", "test@test.com").Return(&models.User{Model: gorm.Model{ID: 1}}, nil)
+	mockTokenRepo.On("DeleteByUserID", uint(1)).Return(int64(3), nil)
+	var audit fakeAuditRecorder
+	userService := NewUserServiceImpl(&mockUserRepo, &mockTokenRepo, newFakeTxManager(&mockUserRepo, &mockTokenRepo), newTestTokenIssuer(), &audit)
+
+	revoked, err := userService.RevokeSessions(context.Background(), "test@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), revoked)
+	if assert.Len(t, audit.events, 1) {
+		assert.Equal(t, models.AuditSessionsRevoke, audit.events[0].Type)
+		assert.Equal(t, models.AuditOutcomeSuccess, audit.events[0].Outcome)
+		assert.Equal(t, "user:1", audit.events[0].Target)
+	}
+	mockUserRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
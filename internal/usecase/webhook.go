@@ -0,0 +1,269 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/tracing"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	webhookSecretPrefix    = "whsec_"
+	webhookBatchSize       = 50
+	defaultWebhookPageSize = 50
+	maxWebhookPageSize     = 200
+	// maxWebhookErrorLength bounds the response body kept for diagnostics.
+	maxWebhookErrorLength = 512
+)
+
+// Delivery attempt results, used as metric labels.
+const (
+	webhookResultDelivered = "delivered"
+	webhookResultRetry     = "retry"
+	webhookResultDead      = "dead"
+)
+
+type WebhookServiceImpl struct {
+	Repo   WebhookRepository
+	Client *http.Client
+	Retry  WebhookRetryPolicy
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	FetchSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uint) error
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	UpdateDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error
+	FetchDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+	RequeueDelivery(ctx context.Context, id uint, now time.Time) error
+}
+
+// WebhookRetryPolicy waits BaseDelay after the first failed attempt and
+// doubles the wait after every further one, up to MaxDelay. A delivery is
+// dead-lettered after MaxAttempts failed attempts.
+type WebhookRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// WebhookDeliveryPage is one page of deliveries, newest first. NextCursor is
+// zero on the last page.
+type WebhookDeliveryPage struct {
+	Deliveries []models.WebhookDelivery
+	NextCursor uint
+}
+
+func NewWebhookServiceImpl(repo WebhookRepository, client *http.Client, retry WebhookRetryPolicy) *WebhookServiceImpl {
+	return &WebhookServiceImpl{
+		Repo:   repo,
+		Client: client,
+		Retry:  retry,
+		now:    time.Now,
+	}
+}
+
+// Backoff returns how long to wait after the given number of failed attempts.
+func (p WebhookRetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+// CreateSubscription subscribes url to eventTypes. The returned subscription
+// carries the signing secret, which receivers need to verify deliveries.
+func (s *WebhookServiceImpl) CreateSubscription(ctx context.Context, url string, eventTypes []string) (subscription *models.WebhookSubscription, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateSubscription")
+	defer func() { tracing.End(span, err) }()
+
+	for _, eventType := range eventTypes {
+		if !slices.Contains(models.WebhookEventTypes, eventType) {
+			return nil, utils.ErrValidationFailed.WithFields([]utils.FieldError{{
+				Field:   "events",
+				Rule:    "webhook_event",
+				Param:   eventType,
+				Message: fmt.Sprintf("events contains the unknown event type %s", eventType),
+			}})
+		}
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	subscription = models.NewWebhookSubscription(url, webhookSecretPrefix+token, eventTypes)
+	if err := s.Repo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (s *WebhookServiceImpl) ListSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ListSubscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	return s.Repo.FetchSubscriptions(ctx)
+}
+
+func (s *WebhookServiceImpl) DeleteSubscription(ctx context.Context, id uint) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteSubscription")
+	defer func() { tracing.End(span, err) }()
+
+	err = s.Repo.DeleteSubscription(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound.WithDetail("The webhook subscription was not found.")
+	}
+
+	return err
+}
+
+func (s *WebhookServiceImpl) ListDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (page WebhookDeliveryPage, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ListDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultWebhookPageSize
+	}
+	if filter.Limit > maxWebhookPageSize {
+		filter.Limit = maxWebhookPageSize
+	}
+
+	deliveries, err := s.Repo.FetchDeliveries(ctx, filter)
+	if err != nil {
+		return page, err
+	}
+
+	page.Deliveries = deliveries
+	if len(deliveries) == filter.Limit {
+		page.NextCursor = deliveries[len(deliveries)-1].ID
+	}
+
+	return page, nil
+}
+
+// Redeliver sends a delivery again, including dead-lettered and already
+// delivered ones, with a fresh set of attempts. Invitation events cannot be
+// sent again; the invitation has to be revoked and sent anew.
+func (s *WebhookServiceImpl) Redeliver(ctx context.Context, id uint) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Redeliver")
+	defer func() { tracing.End(span, err) }()
+
+	err = s.Repo.RequeueDelivery(ctx, id, s.now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound.WithDetail("The webhook delivery was not found.")
+	}
+	if errors.Is(err, models.ErrNotRedeliverable) {
+		return utils.ErrConflict.WithDetail("Invitation events cannot be redelivered. Revoke the invitation and invite again.")
+	}
+
+	return err
+}
+
+// DispatchPending sends the deliveries that are due and returns how many were
+// attempted. Failed attempts are rescheduled, not returned as errors.
+func (s *WebhookServiceImpl) DispatchPending(ctx context.Context) (attempted int, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DispatchPending")
+	defer func() { tracing.End(span, err) }()
+
+	// Claimed deliveries are hidden from other dispatchers until the lease
+	// ends, which must outlast sending the whole batch.
+	lease := s.Client.Timeout*webhookBatchSize + time.Minute
+	deliveries, err := s.Repo.ClaimDueDeliveries(ctx, s.now(), lease, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		// Deliveries left on shutdown are picked up again after the lease
+		if ctx.Err() != nil {
+			break
+		}
+
+		delivery := &deliveries[i]
+		s.deliver(ctx, delivery)
+		if err := s.Repo.UpdateDeliveryResult(ctx, delivery); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+
+	return attempted, nil
+}
+
+// deliver makes one attempt and records its outcome on delivery.
+func (s *WebhookServiceImpl) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	statusCode, err := s.send(ctx, delivery)
+	now := s.now()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		metrics.RecordWebhookDelivery(webhookResultDelivered)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	logger := logging.FromContext(ctx).With("delivery_id", delivery.ID, "event_type", delivery.EventType, "attempts", delivery.Attempts)
+	if delivery.Attempts >= s.Retry.MaxAttempts {
+		delivery.Status = models.DeliveryDead
+		metrics.RecordWebhookDelivery(webhookResultDead)
+		logger.Warn("webhook delivery dead-lettered", "error", err)
+		return
+	}
+
+	delivery.NextAttemptAt = now.Add(s.Retry.Backoff(delivery.Attempts))
+	metrics.RecordWebhookDelivery(webhookResultRetry)
+	logger.Info("webhook delivery failed", "error", err, "next_attempt_at", delivery.NextAttemptAt)
+}
+
+// send posts the signed payload and returns the response status code. Any
+// status outside 2xx is a failure.
+func (s *WebhookServiceImpl) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	now := s.now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(utils.HeaderWebhookID, delivery.EventID)
+	req.Header.Set(utils.HeaderWebhookTimestamp, fmt.Sprint(now.Unix()))
+	req.Header.Set(utils.HeaderWebhookSignature, utils.SignWebhook(delivery.Subscription.Secret, now, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorLength))
+		return resp.StatusCode, fmt.Errorf("webhook receiver responded %d: %s", resp.StatusCode, detail)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/models"
+	"github.com/soicchi/auth_api/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	args := m.Called(subscription)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) FetchSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	args := m.Called()
+	return args.Get(0).([]models.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) DeleteSubscription(ctx context.Context, id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	args := m.Called(now, limit)
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) UpdateDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error {
+	args := m.Called(*delivery)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) FetchDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) RequeueDelivery(ctx context.Context, id uint, now time.Time) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+var testRetryPolicy = WebhookRetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Minute,
+	MaxDelay:    10 * time.Minute,
+}
+
+func TestWebhookRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 4, want: 8 * time.Minute},
+		{attempts: 5, want: 10 * time.Minute},
+		{attempts: 100, want: 10 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.attempts), func(t *testing.T) {
+			assert.Equal(t, test.want, testRetryPolicy.Backoff(test.attempts))
+		})
+	}
+}
+
+func TestCreateSubscription(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventTypes []string
+		mock       func(mockRepo *MockWebhookRepository)
+		wantErr    error
+	}{
+		{
+			name:       "known event type",
+			eventTypes: []string{models.WebhookUserCreated},
+			mock: func(mockRepo *MockWebhookRepository) {
+				mockRepo.On("CreateSubscription", mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:       "unknown event type",
+			eventTypes: []string{"user.renamed"},
+			mock:       func(mockRepo *MockWebhookRepository) {},
+			wantErr:    utils.ErrValidationFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mockRepo MockWebhookRepository
+			test.mock(&mockRepo)
+			service := NewWebhookServiceImpl(&mockRepo, http.DefaultClient, testRetryPolicy)
+
+			subscription, err := service.CreateSubscription(context.Background(), "https://example.com/hook", test.eventTypes)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "https://example.com/hook", subscription.URL)
+				assert.Contains(t, subscription.Secret, "whsec_")
+				assert.True(t, subscription.Subscribes(models.WebhookUserCreated))
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteSubscriptionNotFound(t *testing.T) {
+	var mockRepo MockWebhookRepository
+	mockRepo.On("DeleteSubscription", uint(1)).Return(fmt.Errorf("failed: %w", gorm.ErrRecordNotFound))
+	service := NewWebhookServiceImpl(&mockRepo, http.DefaultClient, testRetryPolicy)
+
+	assert.ErrorIs(t, service.DeleteSubscription(context.Background(), 1), utils.ErrNotFound)
+}
+
+func TestRedeliver(t *testing.T) {
+	var mockRepo MockWebhookRepository
+	mockRepo.On("RequeueDelivery", uint(1)).Return(nil)
+	mockRepo.On("RequeueDelivery", uint(2)).Return(fmt.Errorf("failed: %w", gorm.ErrRecordNotFound))
+	mockRepo.On("RequeueDelivery", uint(3)).Return(fmt.Errorf("failed: %w", models.ErrNotRedeliverable))
+	service := NewWebhookServiceImpl(&mockRepo, http.DefaultClient, testRetryPolicy)
+
+	assert.NoError(t, service.Redeliver(context.Background(), 1))
+	assert.ErrorIs(t, service.Redeliver(context.Background(), 2), utils.ErrNotFound)
+	assert.ErrorIs(t, service.Redeliver(context.Background(), 3), utils.ErrConflict)
+}
+
+func TestDispatchPending(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name          string
+		status        int
+		attempts      int
+		wantStatus    string
+		wantAttempts  int
+		wantNext      time.Time
+		wantDelivered bool
+	}{
+		{
+			name:          "delivered",
+			status:        http.StatusNoContent,
+			wantStatus:    models.DeliveryDelivered,
+			wantAttempts:  1,
+			wantDelivered: true,
+		},
+		{
+			name:         "retried with backoff",
+			status:       http.StatusServiceUnavailable,
+			attempts:     1,
+			wantStatus:   models.DeliveryPending,
+			wantAttempts: 2,
+			wantNext:     now.Add(2 * time.Minute),
+		},
+		{
+			name:         "dead-lettered after the last attempt",
+			status:       http.StatusInternalServerError,
+			attempts:     2,
+			wantStatus:   models.DeliveryDead,
+			wantAttempts: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received *http.Request
+			var receivedBody []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				receivedBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			delivery := models.WebhookDelivery{
+				ID:            1,
+				EventID:       "evt_1",
+				EventType:     models.WebhookUserCreated,
+				Payload:       `{"id":"evt_1"}`,
+				Status:        models.DeliveryPending,
+				Attempts:      test.attempts,
+				NextAttemptAt: now,
+				Subscription: models.WebhookSubscription{
+					URL:    server.URL,
+					Secret: "whsec_secret",
+				},
+			}
+
+			var updated models.WebhookDelivery
+			var mockRepo MockWebhookRepository
+			mockRepo.On("ClaimDueDeliveries", now, webhookBatchSize).Return([]models.WebhookDelivery{delivery}, nil)
+			mockRepo.On("UpdateDeliveryResult", mock.Anything).Run(func(args mock.Arguments) {
+				updated = args.Get(0).(models.WebhookDelivery)
+			}).Return(nil)
+
+			service := NewWebhookServiceImpl(&mockRepo, server.Client(), testRetryPolicy)
+			service.now = func() time.Time { return now }
+
+			attempted, err := service.DispatchPending(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 1, attempted)
+
+			assert.Equal(t, "evt_1", received.Header.Get(utils.HeaderWebhookID))
+			assert.NoError(t, utils.VerifyWebhookSignature("whsec_secret", received.Header.Get(utils.HeaderWebhookSignature), receivedBody, time.Minute, now))
+
+			assert.Equal(t, test.wantStatus, updated.Status)
+			assert.Equal(t, test.wantAttempts, updated.Attempts)
+			assert.Equal(t, test.status, updated.LastStatusCode)
+			assert.Equal(t, test.wantDelivered, updated.DeliveredAt != nil)
+			if !test.wantNext.IsZero() {
+				assert.Equal(t, test.wantNext, updated.NextAttemptAt)
+			}
+			if !test.wantDelivered {
+				assert.NotEmpty(t, updated.LastError)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListDeliveries(t *testing.T) {
+	var mockRepo MockWebhookRepository
+	mockRepo.On("FetchDeliveries", models.WebhookDeliveryFilter{SubscriptionID: 1, Status: models.DeliveryDead, Limit: 2}).
+		Return([]models.WebhookDelivery{{ID: 5}, {ID: 3}}, nil)
+	service := NewWebhookServiceImpl(&mockRepo, http.DefaultClient, testRetryPolicy)
+
+	page, err := service.ListDeliveries(context.Background(), models.WebhookDeliveryFilter{SubscriptionID: 1, Status: models.DeliveryDead, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.Deliveries, 2)
+	assert.Equal(t, uint(3), page.NextCursor)
+	mockRepo.AssertExpectations(t)
+}
@@ -7,15 +7,22 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func SetCookie(ctx echo.Context, name, value, path string, expires time.Time) {
+type CookieOptions struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+func SetCookie(ctx echo.Context, opts CookieOptions, name, value, path string, expires time.Time) {
 	cookie := http.Cookie{
 		Name:     name,
 		Value:    value,
 		Path:     path,
+		Domain:   opts.Domain,
 		Expires:  expires,
 		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-		Secure:   false, // TODO: set true in production
+		SameSite: opts.SameSite,
+		Secure:   opts.Secure,
 	}
 	ctx.SetCookie(&cookie)
 }
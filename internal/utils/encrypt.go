@@ -1,12 +1,27 @@
 package utils
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"time"
+
+	"github.com/soicchi/auth_api/internal/metrics"
+	"github.com/soicchi/auth_api/internal/tracing"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
+// dummyHash is computed at startup, so the first sign-in of an unknown email
+// does not pay for it.
+var dummyHash = generateDummyHash()
+
+func HashPassword(ctx context.Context, password string) (string, error) {
+	defer metrics.ObservePasswordHash("bcrypt", "hash", time.Now())
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	defer span.End()
+
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password %w", err)
@@ -15,7 +30,39 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), nil
 }
 
-func ValidatePassword(hashedPassword, password string) bool {
+func ValidatePassword(ctx context.Context, hashedPassword, password string) bool {
+	defer metrics.ObservePasswordHash("bcrypt", "verify", time.Now())
+	_, span := tracing.Start(ctx, "bcrypt.verify")
+	defer span.End()
+
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
+
+// DummyPasswordHash returns a bcrypt hash with the same cost as real password
+// hashes. Comparing against it when no user exists keeps sign-in timing uniform.
+func DummyPasswordHash() string {
+	return dummyHash
+}
+
+func generateDummyHash() string {
+	bytes, err := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate dummy password hash: %v", err))
+	}
+
+	return string(bytes)
+}
+
+// HashAPIKey returns the SHA-256 hex digest of an API key. API keys are random
+// and long, so a fast hash is enough to keep them out of the database.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashToken returns the SHA-256 hex digest of a token from GenerateToken,
+// such as an invitation token, for the same reason as HashAPIKey.
+func HashToken(token string) string {
+	return HashAPIKey(token)
+}
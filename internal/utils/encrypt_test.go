@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,14 +9,28 @@ import (
 
 func TestEncryptPassword(t *testing.T) {
 	password := "password"
-	hashedPassword, err := HashPassword(password)
+	hashedPassword, err := HashPassword(context.Background(), password)
 	assert.NoError(t, err)
 	assert.NotEqual(t, password, hashedPassword)
 }
 
 func TestValidatePassword(t *testing.T) {
 	password := "password"
-	hashedPassword, err := HashPassword(password)
+	hashedPassword, err := HashPassword(context.Background(), password)
 	assert.NoError(t, err)
-	assert.True(t, ValidatePassword(hashedPassword, password))
+	assert.True(t, ValidatePassword(context.Background(), hashedPassword, password))
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	hashedPassword := DummyPasswordHash()
+	assert.NotEmpty(t, hashedPassword)
+	assert.Equal(t, hashedPassword, DummyPasswordHash())
+	assert.False(t, ValidatePassword(context.Background(), hashedPassword, "password"))
+}
+
+func TestHashAPIKey(t *testing.T) {
+	hashed := HashAPIKey("key")
+	assert.Equal(t, 64, len(hashed))
+	assert.Equal(t, hashed, HashAPIKey("key"))
+	assert.NotEqual(t, hashed, HashAPIKey("other"))
 }
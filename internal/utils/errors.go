@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type ErrorCode string
+
+const (
+	CodeBadRequest         ErrorCode = "bad_request"
+	CodeValidationFailed   ErrorCode = "validation_failed"
+	CodeUnauthorized       ErrorCode = "unauthorized"
+	CodeForbidden          ErrorCode = "forbidden"
+	CodeInvalidCredentials ErrorCode = "invalid_credentials"
+	CodeInvalidAPIKey      ErrorCode = "invalid_api_key"
+	CodeTokenMissing       ErrorCode = "token_missing"
+	CodeTokenInvalid       ErrorCode = "token_invalid"
+	CodeTokenExpired       ErrorCode = "token_expired"
+	CodeEmailTaken         ErrorCode = "email_taken"
+	CodeConflict           ErrorCode = "conflict"
+	CodePreconditionFailed ErrorCode = "precondition_failed"
+	CodeInvalidFilter      ErrorCode = "invalid_filter"
+	CodeAccountDisabled    ErrorCode = "account_disabled"
+	CodePasswordResetDue   ErrorCode = "password_reset_required"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	CodeTimeout            ErrorCode = "timeout"
+	CodeInternal           ErrorCode = "internal_error"
+)
+
+// AppError is an error that knows how it should be presented to API clients.
+// Usecases and middleware return these and HTTPErrorHandler renders them.
+type AppError struct {
+	Code   ErrorCode
+	Status int
+	Title  string
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError describes a single request field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	ErrBadRequest         = NewAppError(http.StatusBadRequest, CodeBadRequest, "Bad request", "The request could not be parsed.")
+	ErrValidationFailed   = NewAppError(http.StatusBadRequest, CodeValidationFailed, "Validation failed", "One or more fields are invalid.")
+	ErrUnauthorized       = NewAppError(http.StatusUnauthorized, CodeUnauthorized, "Unauthorized", "Authentication is required.")
+	ErrForbidden          = NewAppError(http.StatusForbidden, CodeForbidden, "Forbidden", "You are not allowed to access this resource.")
+	ErrInvalidCredentials = NewAppError(http.StatusUnauthorized, CodeInvalidCredentials, "Invalid credentials", "Invalid email or password.")
+	ErrInvalidAPIKey      = NewAppError(http.StatusUnauthorized, CodeInvalidAPIKey, "Invalid API key", "The API-KEY header is missing or invalid.")
+	ErrTokenMissing       = NewAppError(http.StatusUnauthorized, CodeTokenMissing, "Token missing", "No token was provided.")
+	ErrTokenInvalid       = NewAppError(http.StatusUnauthorized, CodeTokenInvalid, "Invalid token", "The token is invalid.")
+	ErrTokenExpired       = NewAppError(http.StatusUnauthorized, CodeTokenExpired, "Token expired", "The token has expired.")
+	ErrEmailTaken         = NewAppError(http.StatusConflict, CodeEmailTaken, "Email taken", "The email is already registered.")
+	ErrConflict           = NewAppError(http.StatusConflict, CodeConflict, "Conflict", "The request conflicts with the current state of the resource.")
+	ErrPreconditionFailed = NewAppError(http.StatusPreconditionFailed, CodePreconditionFailed, "Precondition failed", "The resource has changed since it was read.")
+	ErrInvalidFilter      = NewAppError(http.StatusBadRequest, CodeInvalidFilter, "Invalid filter", "The filter could not be parsed.")
+	ErrAccountDisabled    = NewAppError(http.StatusForbidden, CodeAccountDisabled, "Account disabled", "The account has been disabled.")
+	ErrPasswordResetDue   = NewAppError(http.StatusForbidden, CodePasswordResetDue, "Password reset required", "The password must be reset before signing in.")
+	ErrNotFound           = NewAppError(http.StatusNotFound, CodeNotFound, "Not found", "The requested resource was not found.")
+	ErrTimeout            = NewAppError(http.StatusServiceUnavailable, CodeTimeout, "Timeout", "The request took too long to complete.")
+	ErrInternal           = NewAppError(http.StatusInternalServerError, CodeInternal, "Internal server error", "An unexpected error occurred.")
+)
+
+func NewAppError(status int, code ErrorCode, title, detail string) *AppError {
+	return &AppError{
+		Code:   code,
+		Status: status,
+		Title:  title,
+		Detail: detail,
+	}
+}
+
+func (e *AppError) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+
+	return msg
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an AppError with the same code, so that
+// errors.Is works against the catalog values after WithDetail or Wrap.
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+func (e *AppError) WithDetail(detail string) *AppError {
+	c := *e
+	c.Detail = detail
+	return &c
+}
+
+func (e *AppError) WithFields(fields []FieldError) *AppError {
+	c := *e
+	c.Fields = fields
+	return &c
+}
+
+func (e *AppError) Wrap(err error) *AppError {
+	c := *e
+	c.Err = err
+	return &c
+}
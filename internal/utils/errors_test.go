@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppErrorIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{
+			name:   "same error",
+			err:    ErrTokenExpired,
+			target: ErrTokenExpired,
+			want:   true,
+		},
+		{
+			name:   "with detail",
+			err:    ErrTokenExpired.WithDetail("detail"),
+			target: ErrTokenExpired,
+			want:   true,
+		},
+		{
+			name:   "wrapped by fmt",
+			err:    fmt.Errorf("failed: %w", ErrInvalidCredentials),
+			target: ErrInvalidCredentials,
+			want:   true,
+		},
+		{
+			name:   "different code",
+			err:    ErrTokenExpired,
+			target: ErrTokenInvalid,
+			want:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, errors.Is(test.err, test.target))
+		})
+	}
+}
+
+func TestAppErrorWrap(t *testing.T) {
+	cause := fmt.Errorf("cause")
+	err := ErrBadRequest.Wrap(cause)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "The request could not be parsed.: cause", err.Error())
+	assert.Nil(t, ErrBadRequest.Err)
+}
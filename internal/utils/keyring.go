@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring holds the signing keys loaded from the database. While it has no
+// keys, tokens are signed and verified with the fallback secret. Once it has,
+// tokens without a key ID are only accepted until fallbackUntil.
+type Keyring struct {
+	mu            sync.RWMutex
+	fallback      []byte
+	active        *SigningKey
+	keys          map[string][]byte
+	fallbackUntil time.Time
+	loadedAt      time.Time
+}
+
+func NewKeyring(fallbackSecret string) *Keyring {
+	return &Keyring{
+		fallback: []byte(fallbackSecret),
+	}
+}
+
+// SetKeys replaces the loaded keys. active signs new tokens and every key in
+// verification is accepted when validating tokens, as is the fallback secret
+// until fallbackUntil.
+func (k *Keyring) SetKeys(active SigningKey, verification []SigningKey, fallbackUntil time.Time) {
+	keys := make(map[string][]byte, len(verification)+1)
+	for _, v := range verification {
+		keys[v.ID] = v.Secret
+	}
+	keys[active.ID] = active.Secret
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = &active
+	k.keys = keys
+	k.fallbackUntil = fallbackUntil
+	k.loadedAt = time.Now()
+}
+
+// Clear drops the loaded keys so that the fallback secret is used. It still
+// counts as a load, since it reflects that the database has no keys.
+func (k *Keyring) Clear() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = nil
+	k.keys = nil
+	k.fallbackUntil = time.Time{}
+	k.loadedAt = time.Now()
+}
+
+// LoadedAt reports when keys were last loaded, or the zero time if they never
+// were.
+func (k *Keyring) LoadedAt() time.Time {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.loadedAt
+}
+
+func (k *Keyring) Active() (SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active == nil {
+		return SigningKey{}, false
+	}
+
+	return *k.active, true
+}
+
+func (k *Keyring) Lookup(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	secret, ok := k.keys[id]
+	return secret, ok
+}
+
+func (k *Keyring) Fallback() []byte {
+	return k.fallback
+}
+
+// AcceptsFallback reports whether tokens signed with the fallback secret,
+// which carry no key ID, are still valid.
+func (k *Keyring) AcceptsFallback() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active == nil || time.Now().Before(k.fallbackUntil)
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeyring(t *testing.T) {
+	keys := NewKeyring("secret")
+	assert.Equal(t, []byte("secret"), keys.Fallback())
+	assert.True(t, keys.AcceptsFallback())
+
+	_, ok := keys.Active()
+	assert.False(t, ok)
+	assert.True(t, keys.LoadedAt().IsZero())
+}
+
+func TestKeyringSetKeys(t *testing.T) {
+	keys := NewKeyring("secret")
+
+	active := SigningKey{ID: "new", Secret: []byte("new_secret")}
+	retired := SigningKey{ID: "old", Secret: []byte("old_secret")}
+	keys.SetKeys(active, []SigningKey{retired}, time.Time{})
+
+	got, ok := keys.Active()
+	assert.True(t, ok)
+	assert.Equal(t, active, got)
+	assert.False(t, keys.LoadedAt().IsZero())
+
+	secret, ok := keys.Lookup("old")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("old_secret"), secret)
+
+	_, ok = keys.Lookup("unknown")
+	assert.False(t, ok)
+	assert.False(t, keys.AcceptsFallback())
+
+	keys.SetKeys(active, nil, time.Now().Add(time.Minute))
+	assert.True(t, keys.AcceptsFallback())
+
+	keys.Clear()
+	_, ok = keys.Active()
+	assert.False(t, ok)
+	assert.True(t, keys.AcceptsFallback())
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/soicchi/auth_api/internal/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     ErrorCode    `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+func NewProblem(appErr *AppError, instance string) Problem {
+	return Problem{
+		Type:     "/problems/" + string(appErr.Code),
+		Title:    appErr.Title,
+		Status:   appErr.Status,
+		Detail:   appErr.Detail,
+		Instance: instance,
+		Code:     appErr.Code,
+		Errors:   appErr.Fields,
+	}
+}
+
+// HTTPErrorHandler renders every error returned by handlers and middleware as
+// application/problem+json. Errors are logged by the request logger.
+func HTTPErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+
+	appErr := toAppError(err)
+	if cv, ok := ctx.Echo().Validator.(*CustomValidator); ok {
+		appErr = cv.Localize(appErr, ctx.Request().Header.Get("Accept-Language"))
+	}
+
+	if ctx.Request().Method == http.MethodHead {
+		ctx.NoContent(appErr.Status)
+		return
+	}
+
+	body, marshalErr := json.Marshal(NewProblem(appErr, ctx.Request().URL.Path))
+	if marshalErr != nil {
+		logging.FromContext(ctx.Request().Context()).Error("failed to marshal problem", "error", marshalErr)
+		ctx.NoContent(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Blob(appErr.Status, MIMEApplicationProblemJSON, body)
+}
+
+func toAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return fromHTTPError(he)
+	}
+
+	// Queries that ran past DB_QUERY_TIMEOUT
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+
+	return ErrInternal
+}
+
+func fromHTTPError(he *echo.HTTPError) *AppError {
+	var base *AppError
+	switch he.Code {
+	case http.StatusBadRequest:
+		base = ErrBadRequest
+	case http.StatusUnauthorized:
+		base = ErrUnauthorized
+	case http.StatusNotFound:
+		base = ErrNotFound
+	case http.StatusMethodNotAllowed:
+		base = NewAppError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed", "")
+	default:
+		if he.Code >= http.StatusInternalServerError {
+			return ErrInternal
+		}
+		base = NewAppError(he.Code, ErrorCode(snakeCase(http.StatusText(he.Code))), http.StatusText(he.Code), "")
+	}
+
+	if msg, ok := he.Message.(string); ok && he.Code < http.StatusInternalServerError {
+		return base.WithDetail(msg)
+	}
+
+	return base
+}
+
+func snakeCase(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+			out = append(out, c+('a'-'A'))
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			out = append(out, c)
+		default:
+			if len(out) > 0 && out[len(out)-1] != '_' {
+				out = append(out, '_')
+			}
+		}
+	}
+
+	return string(out)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "app error",
+			in:       ErrInvalidCredentials,
+			wantCode: http.StatusUnauthorized,
+			wantBody: "{\"type\":\"/problems/invalid_credentials\",\"title\":\"Invalid credentials\",\"status\":401,\"detail\":\"Invalid email or password.\",\"instance\":\"/signin\",\"code\":\"invalid_credentials\"}",
+		},
+		{
+			name:     "wrapped app error with fields",
+			in:       fmt.Errorf("failed: %w", ErrValidationFailed.WithFields([]FieldError{{Field: "email", Rule: "required"}})),
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"type\":\"/problems/validation_failed\",\"title\":\"Validation failed\",\"status\":400,\"detail\":\"One or more fields are invalid.\",\"instance\":\"/signin\",\"code\":\"validation_failed\",\"errors\":[{\"field\":\"email\",\"rule\":\"required\"}]}",
+		},
+		{
+			name:     "echo http error",
+			in:       echo.ErrNotFound,
+			wantCode: http.StatusNotFound,
+			wantBody: "{\"type\":\"/problems/not_found\",\"title\":\"Not found\",\"status\":404,\"detail\":\"Not Found\",\"instance\":\"/signin\",\"code\":\"not_found\"}",
+		},
+		{
+			name:     "deadline exceeded",
+			in:       fmt.Errorf("failed to fetch users: %w", context.DeadlineExceeded),
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "{\"type\":\"/problems/timeout\",\"title\":\"Timeout\",\"status\":503,\"detail\":\"The request took too long to complete.\",\"instance\":\"/signin\",\"code\":\"timeout\"}",
+		},
+		{
+			name:     "unknown error",
+			in:       fmt.Errorf("db error"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: "{\"type\":\"/problems/internal_error\",\"title\":\"Internal server error\",\"status\":500,\"detail\":\"An unexpected error occurred.\",\"instance\":\"/signin\",\"code\":\"internal_error\"}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/signin", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			HTTPErrorHandler(test.in, ctx)
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, test.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo describes who triggered an operation. Middleware fills it in
+// for API requests and authctl sets Operator, so that usecases can attribute
+// audit events without depending on echo.
+type RequestInfo struct {
+	RequestID string
+	IP        string
+	UserAgent string
+	// UserID is the authenticated user, zero when unauthenticated.
+	UserID uint
+	// AuthTime is when the authenticated user last signed in, zero unless
+	// the access token says.
+	AuthTime time.Time
+	// Operator names the person running an administrative command.
+	Operator string
+	// Client is the audit actor of a machine client, such as the SCIM token
+	// of a provisioning request.
+	Client string
+}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the info stored by WithRequestInfo, or the
+// zero value.
+func RequestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
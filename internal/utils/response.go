@@ -31,18 +31,3 @@ func StatusOKResponse(ctx echo.Context, message string, data interface{}) error
 	res := NewResponse(http.StatusOK, message, data)
 	return res.JSONResponse(ctx)
 }
-
-func BadRequestResponse(ctx echo.Context, message string) error {
-	res := NewResponse(http.StatusBadRequest, message, nil)
-	return res.JSONResponse(ctx)
-}
-
-func InternalServerErrorResponse(ctx echo.Context, message string) error {
-	res := NewResponse(http.StatusInternalServerError, message, nil)
-	return res.JSONResponse(ctx)
-}
-
-func UnauthorizedResponse(ctx echo.Context, message string) error {
-	res := NewResponse(http.StatusUnauthorized, message, nil)
-	return res.JSONResponse(ctx)
-}
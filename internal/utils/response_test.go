@@ -47,39 +47,3 @@ func TestStatusOKResponse(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "\"message\":\"OK\"")
 	assert.Contains(t, rec.Body.String(), "\"data\":\"TestData\"")
 }
-
-func TestBadRequestResponse(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/signup", bytes.NewReader([]byte{}))
-	rec := httptest.NewRecorder()
-
-	ctx := e.NewContext(req, rec)
-	err := BadRequestResponse(ctx, "Bad Request")
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
-	assert.Contains(t, rec.Body.String(), "\"message\":\"Bad Request\"")
-}
-
-func TestInternalServerErrorResponse(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/sigup", bytes.NewReader([]byte{}))
-	rec := httptest.NewRecorder()
-
-	ctx := e.NewContext(req, rec)
-	err := InternalServerErrorResponse(ctx, "Internal Error")
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusInternalServerError, rec.Code)
-	assert.Contains(t, rec.Body.String(), "\"message\":\"Internal Error\"")
-}
-
-func TestUnAuthorizedResponse(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/sigup", bytes.NewReader([]byte{}))
-	rec := httptest.NewRecorder()
-
-	ctx := e.NewContext(req, rec)
-	err := UnauthorizedResponse(ctx, "Unauthorized")
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusUnauthorized, rec.Code)
-	assert.Contains(t, rec.Body.String(), "\"message\":\"Unauthorized\"")
-}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/soicchi/auth_api/internal/logging"
+	"github.com/soicchi/auth_api/internal/scim"
+
+	"github.com/labstack/echo/v4"
+)
+
+// scimTypes are the SCIM error types of the error codes that have one.
+var scimTypes = map[ErrorCode]string{
+	CodeBadRequest:       scim.ErrorInvalidSyntax,
+	CodeValidationFailed: scim.ErrorInvalidValue,
+	CodeInvalidFilter:    scim.ErrorInvalidFilter,
+	CodeEmailTaken:       scim.ErrorUniqueness,
+	CodeConflict:         scim.ErrorUniqueness,
+}
+
+// SCIMErrorHandler renders err as a SCIM error (RFC 7644 section 3.12)
+// instead of problem details. Field errors are folded into the detail, as
+// SCIM errors have no place for them.
+func SCIMErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+
+	appErr := toAppError(err)
+	if ctx.Request().Method == http.MethodHead {
+		ctx.NoContent(appErr.Status)
+		return
+	}
+
+	detail := appErr.Detail
+	if len(appErr.Fields) > 0 {
+		fields := make([]string, 0, len(appErr.Fields))
+		for _, field := range appErr.Fields {
+			reason := field.Message
+			if reason == "" {
+				reason = field.Rule
+			}
+			fields = append(fields, field.Field+": "+reason)
+		}
+		detail = fmt.Sprintf("%s (%s)", detail, strings.Join(fields, "; "))
+	}
+
+	body, marshalErr := json.Marshal(scim.NewError(appErr.Status, scimTypes[appErr.Code], detail))
+	if marshalErr != nil {
+		logging.FromContext(ctx.Request().Context()).Error("failed to marshal scim error", "error", marshalErr)
+		ctx.NoContent(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Blob(appErr.Status, scim.MIMEApplicationSCIMJSON, body)
+}
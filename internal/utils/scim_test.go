@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soicchi/auth_api/internal/scim"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCIMErrorHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "not found",
+			in:       ErrNotFound.WithDetail("The user was not found."),
+			wantCode: http.StatusNotFound,
+			wantBody: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:Error\"],\"status\":\"404\",\"detail\":\"The user was not found.\"}",
+		},
+		{
+			name:     "invalid filter",
+			in:       fmt.Errorf("failed to list users: %w", ErrInvalidFilter.WithDetail("invalid filter: empty filter")),
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:Error\"],\"status\":\"400\",\"scimType\":\"invalidFilter\",\"detail\":\"invalid filter: empty filter\"}",
+		},
+		{
+			name:     "field errors",
+			in:       ErrValidationFailed.WithFields([]FieldError{{Field: "userName", Rule: "required"}}),
+			wantCode: http.StatusBadRequest,
+			wantBody: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:Error\"],\"status\":\"400\",\"scimType\":\"invalidValue\",\"detail\":\"One or more fields are invalid. (userName: required)\"}",
+		},
+		{
+			name:     "uniqueness",
+			in:       ErrEmailTaken,
+			wantCode: http.StatusConflict,
+			wantBody: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:Error\"],\"status\":\"409\",\"scimType\":\"uniqueness\",\"detail\":\"The email is already registered.\"}",
+		},
+		{
+			name:     "unknown error",
+			in:       fmt.Errorf("db error"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:Error\"],\"status\":\"500\",\"detail\":\"An unexpected error occurred.\"}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			SCIMErrorHandler(test.in, ctx)
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, scim.MIMEApplicationSCIMJSON, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, test.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -1,18 +1,81 @@
 package utils
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/soicchi/auth_api/internal/tenant"
+
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
 )
 
+// ContextKeyTokenOverrides is the echo context key under which key
+// authentication stores the token settings of the calling client.
+const ContextKeyTokenOverrides = "token_overrides"
+
+// ContextKeyUserID is the echo context key under which JWT authentication
+// stores the subject of the access token.
+const ContextKeyUserID = "user_id"
+
+// ClaimTenant is the access token claim naming the tenant of the subject.
+// Tokens without it belong to the default tenant.
+const ClaimTenant = "tid"
+
+// ClaimOrganization is the access token claim naming the active organization
+// of the subject, set once the user has switched to one.
+const ClaimOrganization = "org_id"
+
+// ClaimAuthTime is the access token claim recording when the subject last
+// presented credentials, set on tokens issued at sign-in.
+const ClaimAuthTime = "auth_time"
+
+// TokenSettings controls the claims and lifetimes of issued tokens.
+type TokenSettings struct {
+	Issuer          string
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Tenant is the tenant claim; it is left out when empty.
+	Tenant string
+	// OrganizationID is the organization claim; it is left out when zero.
+	OrganizationID uint
+	// AuthTime is the sign-in time claim; it is left out when zero.
+	AuthTime time.Time
+}
+
+// TokenOverrides are per-client changes to TokenSettings. Zero values keep
+// the configured defaults.
+type TokenOverrides struct {
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// TokenPair is what a client receives after signing up or in.
+type TokenPair struct {
+	AccessToken           string
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// TokenIssuer signs access tokens with the keyring and default settings.
+type TokenIssuer struct {
+	Keys     *Keyring
+	Settings TokenSettings
+}
+
 func GenerateToken() (string, error) {
-	tokenBytes := make([]byte, 32)
+	return generateRandomHex(32)
+}
+
+func generateRandomHex(n int) (string, error) {
+	tokenBytes := make([]byte, n)
 	_, err := rand.Read(tokenBytes)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate token: %w", err)
@@ -21,16 +84,96 @@ func GenerateToken() (string, error) {
 	return hex.EncodeToString(tokenBytes), nil
 }
 
-func GenerateJWT(userID uint) (string, error) {
+func (s TokenSettings) With(o TokenOverrides) TokenSettings {
+	if o.Audience != "" {
+		s.Audience = o.Audience
+	}
+	if o.AccessTokenTTL > 0 {
+		s.AccessTokenTTL = o.AccessTokenTTL
+	}
+	if o.RefreshTokenTTL > 0 {
+		s.RefreshTokenTTL = o.RefreshTokenTTL
+	}
+
+	return s
+}
+
+func NewTokenIssuer(keys *Keyring, settings TokenSettings) *TokenIssuer {
+	return &TokenIssuer{
+		Keys:     keys,
+		Settings: settings,
+	}
+}
+
+// AccessToken signs an access token for the user of the tenant in ctx.
+func (i *TokenIssuer) AccessToken(ctx context.Context, userID uint, o TokenOverrides) (string, error) {
+	return i.OrganizationAccessToken(ctx, userID, 0, o)
+}
+
+// OrganizationAccessToken signs an access token for the user acting in the
+// organization, or in none when orgID is zero.
+func (i *TokenIssuer) OrganizationAccessToken(ctx context.Context, userID, orgID uint, o TokenOverrides) (string, error) {
+	settings := i.Settings.With(o)
+	settings.Tenant = tenant.OfContext(ctx)
+	settings.OrganizationID = orgID
+	return GenerateJWT(i.Keys, settings, userID)
+}
+
+// SignInAccessToken signs an access token like OrganizationAccessToken for a
+// user who just signed in, so that it vouches for a recent sign-in.
+func (i *TokenIssuer) SignInAccessToken(ctx context.Context, userID, orgID uint, o TokenOverrides) (string, error) {
+	settings := i.Settings.With(o)
+	settings.Tenant = tenant.OfContext(ctx)
+	settings.OrganizationID = orgID
+	settings.AuthTime = time.Now()
+	return GenerateJWT(i.Keys, settings, userID)
+}
+
+func (i *TokenIssuer) RefreshTokenExpiry(o TokenOverrides) time.Time {
+	return time.Now().Add(i.Settings.With(o).RefreshTokenTTL)
+}
+
+// TokenOverridesFromContext returns the overrides stored by key
+// authentication, or none.
+func TokenOverridesFromContext(ctx echo.Context) TokenOverrides {
+	o, _ := ctx.Get(ContextKeyTokenOverrides).(TokenOverrides)
+	return o
+}
+
+func GenerateJWT(keys *Keyring, settings TokenSettings, userID uint) (string, error) {
+	jti, err := generateRandomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 1).Unix(),
-		"sub":     "auth_api",
+		"sub":     strconv.FormatUint(uint64(userID), 10),
+		"iss":     settings.Issuer,
+		"aud":     settings.Audience,
+		"iat":     now.Unix(),
+		"nbf":     now.Unix(),
+		"exp":     now.Add(settings.AccessTokenTTL).Unix(),
+		"jti":     jti,
+	}
+	if settings.Tenant != "" {
+		claims[ClaimTenant] = settings.Tenant
+	}
+	if settings.OrganizationID != 0 {
+		claims[ClaimOrganization] = settings.OrganizationID
+	}
+	if !settings.AuthTime.IsZero() {
+		claims[ClaimAuthTime] = settings.AuthTime.Unix()
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtKey := []byte(os.Getenv("JWT_SECRET"))
-	return token.SignedString(jwtKey)
+	if key, ok := keys.Active(); ok {
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Secret)
+	}
+
+	return token.SignedString(keys.Fallback())
 }
 
 func ExtractBearerToken(authHeader string) (string, error) {
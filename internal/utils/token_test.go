@@ -1,9 +1,13 @@
 package utils
 
 import (
-	"os"
+	"context"
 	"testing"
+	"time"
 
+	"github.com/soicchi/auth_api/internal/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,13 +40,151 @@ func TestGenerateToken(t *testing.T) {
 	}
 }
 
+var testTokenSettings = TokenSettings{
+	Issuer:          "auth_api",
+	Audience:        "auth_api",
+	AccessTokenTTL:  time.Hour,
+	RefreshTokenTTL: 24 * time.Hour,
+}
+
 func TestGenerateJWT(t *testing.T) {
-	os.Setenv("JWT_SECRET", "test_secret")
 	userID := uint(1)
 
-	tokenString, err := GenerateJWT(userID)
+	tokenString, err := GenerateJWT(NewKeyring("test_secret"), testTokenSettings, userID)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte("test_secret"), nil
+	}, jwt.WithIssuer("auth_api"), jwt.WithAudience("auth_api"), jwt.WithIssuedAt())
+	assert.NoError(t, err)
+
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, "1", claims["sub"])
+	assert.Len(t, claims["jti"], 32)
+	assert.Contains(t, claims, "nbf")
+	assert.NotContains(t, claims, ClaimTenant)
+	assert.NotContains(t, claims, ClaimOrganization)
+	exp, err := claims.GetExpirationTime()
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), exp.Time, time.Minute)
+}
+
+func TestAccessTokenTenant(t *testing.T) {
+	issuer := NewTokenIssuer(NewKeyring("test_secret"), testTokenSettings)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "tenant of the request", ctx: tenant.WithContext(context.Background(), "acme"), want: "acme"},
+		{name: "default tenant", ctx: context.Background(), want: tenant.Default},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenString, err := issuer.AccessToken(test.ctx, 1, TokenOverrides{})
+			assert.NoError(t, err)
+
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+				return []byte("test_secret"), nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, claims[ClaimTenant])
+		})
+	}
+}
+
+func TestOrganizationAccessToken(t *testing.T) {
+	issuer := NewTokenIssuer(NewKeyring("test_secret"), testTokenSettings)
+
+	tokenString, err := issuer.OrganizationAccessToken(context.Background(), 1, 7, TokenOverrides{})
+	assert.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("test_secret"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(7), claims[ClaimOrganization])
+}
+
+func TestSignInAccessToken(t *testing.T) {
+	issuer := NewTokenIssuer(NewKeyring("test_secret"), testTokenSettings)
+	parse := func(tokenString string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte("test_secret"), nil
+		})
+		assert.NoError(t, err)
+		return claims
+	}
+
+	tokenString, err := issuer.SignInAccessToken(context.Background(), 1, 0, TokenOverrides{})
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(time.Now().Unix()), parse(tokenString)[ClaimAuthTime], 5)
+	assert.NotContains(t, parse(tokenString), ClaimOrganization)
+
+	tokenString, err = issuer.SignInAccessToken(context.Background(), 1, 7, TokenOverrides{})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(7), parse(tokenString)[ClaimOrganization])
+
+	tokenString, err = issuer.AccessToken(context.Background(), 1, TokenOverrides{})
+	assert.NoError(t, err)
+	assert.NotContains(t, parse(tokenString), ClaimAuthTime)
+}
+
+func TestTokenSettingsWith(t *testing.T) {
+	tests := []struct {
+		name string
+		in   TokenOverrides
+		want TokenSettings
+	}{
+		{
+			name: "no overrides",
+			in:   TokenOverrides{},
+			want: testTokenSettings,
+		},
+		{
+			name: "all overrides",
+			in:   TokenOverrides{Audience: "mobile", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+			want: TokenSettings{Issuer: "auth_api", Audience: "mobile", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		},
+		{
+			name: "partial overrides",
+			in:   TokenOverrides{RefreshTokenTTL: time.Hour},
+			want: TokenSettings{Issuer: "auth_api", Audience: "auth_api", AccessTokenTTL: time.Hour, RefreshTokenTTL: time.Hour},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, testTokenSettings.With(test.in))
+		})
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	issuer := NewTokenIssuer(NewKeyring("test_secret"), testTokenSettings)
+
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), issuer.RefreshTokenExpiry(TokenOverrides{}), time.Minute)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), issuer.RefreshTokenExpiry(TokenOverrides{RefreshTokenTTL: time.Hour}), time.Minute)
+}
+
+func TestGenerateJWTWithSigningKey(t *testing.T) {
+	keys := NewKeyring("test_secret")
+	keys.SetKeys(SigningKey{ID: "kid", Secret: []byte("key_secret")}, nil, time.Time{})
+
+	tokenString, err := GenerateJWT(keys, testTokenSettings, uint(1))
+	assert.NoError(t, err)
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte("key_secret"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "kid", token.Header["kid"])
 }
 
 func TestExtractTokenFromHeader(t *testing.T) {
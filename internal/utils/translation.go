@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ja"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	ja_translations "github.com/go-playground/validator/v10/translations/ja"
+)
+
+// customTranslations holds messages for the rules registered in registerRules
+// and for built-in rules without a default translation.
+var customTranslations = map[string]map[string]string{
+	"en": {
+		"password_policy": "{0} must be 8 to 72 bytes long and contain at least one letter and one number",
+		"email_domain":    "{0} must use an allowed email domain",
+		"http_url":        "{0} must be an HTTP or HTTPS URL",
+	},
+	"ja": {
+		"password_policy": "{0}は8文字以上72バイト以下で、英字と数字をそれぞれ1文字以上含む必要があります",
+		"email_domain":    "{0}は許可されたドメインのメールアドレスである必要があります",
+		"http_url":        "{0}はHTTPまたはHTTPSのURLである必要があります",
+	},
+}
+
+func newUniversalTranslator(v *validator.Validate) (*ut.UniversalTranslator, error) {
+	enLocale := en.New()
+	uni := ut.New(enLocale, enLocale, ja.New())
+
+	enTrans, _ := uni.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		return nil, err
+	}
+
+	jaTrans, _ := uni.GetTranslator("ja")
+	if err := ja_translations.RegisterDefaultTranslations(v, jaTrans); err != nil {
+		return nil, err
+	}
+
+	for locale, messages := range customTranslations {
+		trans, _ := uni.GetTranslator(locale)
+		for tag, message := range messages {
+			if err := registerTranslation(v, trans, tag, message); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return uni, nil
+}
+
+func registerTranslation(v *validator.Validate, trans ut.Translator, tag, message string) error {
+	return v.RegisterTranslation(tag, trans,
+		func(ut ut.Translator) error {
+			return ut.Add(tag, message, true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, err := ut.T(tag, fe.Field())
+			if err != nil {
+				return fe.Error()
+			}
+			return t
+		},
+	)
+}
+
+// Localize fills in field messages for a validation_failed error using the
+// best match from an Accept-Language header. Other errors are returned as is.
+func (cv *CustomValidator) Localize(appErr *AppError, acceptLanguage string) *AppError {
+	var validationErrs validator.ValidationErrors
+	if cv.Translator == nil || !errors.As(appErr.Err, &validationErrs) {
+		return appErr
+	}
+
+	trans, _ := cv.Translator.FindTranslator(parseAcceptLanguage(acceptLanguage)...)
+
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fields = append(fields, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fe.Translate(trans),
+		})
+	}
+
+	return appErr.WithFields(fields)
+}
+
+// parseAcceptLanguage returns the base language tags of an Accept-Language
+// header ordered by quality.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if v, ok := strings.CutPrefix(param, "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		base, _, _ := strings.Cut(tag, "-")
+		langs = append(langs, weighted{tag: base, q: q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	tags := make([]string, 0, len(langs))
+	for _, l := range langs {
+		tags = append(tags, l.tag)
+	}
+
+	return tags
+}
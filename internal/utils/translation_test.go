@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{name: "empty", in: "", want: []string{}},
+		{name: "single", in: "ja", want: []string{"ja"}},
+		{name: "region", in: "ja-JP", want: []string{"ja"}},
+		{name: "quality order", in: "en;q=0.5, ja;q=0.9", want: []string{"ja", "en"}},
+		{name: "wildcard", in: "*", want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, parseAcceptLanguage(test.in))
+		})
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	type request struct {
+		Email string `json:"email" validate:"required"`
+	}
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "default english", acceptLanguage: "", want: "email is a required field"},
+		{name: "japanese", acceptLanguage: "ja", want: "emailは必須フィールドです"},
+		{name: "unsupported falls back to english", acceptLanguage: "fr", want: "email is a required field"},
+	}
+
+	cv := NewCustomValidator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := cv.Validate(request{})
+			appErr, ok := err.(*AppError)
+			assert.True(t, ok)
+
+			localized := cv.Localize(appErr, test.acceptLanguage)
+			assert.Equal(t, test.want, localized.Fields[0].Message)
+		})
+	}
+}
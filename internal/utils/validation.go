@@ -1,50 +1,77 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"reflect"
+	"strings"
 
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 )
 
 type CustomValidator struct {
-	Validator *validator.Validate
+	Validator  *validator.Validate
+	Translator *ut.UniversalTranslator
+	// AllowedEmailDomains restricts the email_domain rule. Empty allows any domain.
+	AllowedEmailDomains []string
 }
 
 func NewCustomValidator() *CustomValidator {
-	return &CustomValidator{
-		Validator: validator.New(),
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+
+	cv := &CustomValidator{
+		Validator: v,
+	}
+
+	if err := cv.registerRules(); err != nil {
+		panic(fmt.Sprintf("failed to register validation rules: %v", err))
 	}
+
+	uni, err := newUniversalTranslator(v)
+	if err != nil {
+		panic(fmt.Sprintf("failed to register validation translations: %v", err))
+	}
+	cv.Translator = uni
+
+	return cv
 }
 
 func (cv *CustomValidator) Validate(i interface{}) error {
-	if err := cv.Validator.Struct(i); err != nil {
-		return fmt.Errorf("error validating struct %v", err)
+	err := cv.Validator.Struct(i)
+	if err == nil {
+		return nil
 	}
-	return nil
-}
 
-func ValidateENVVars(vars []string) error {
-	for _, v := range vars {
-		if os.Getenv(v) == "" {
-			return fmt.Errorf("%s environment variable not set", v)
-		}
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return fmt.Errorf("error validating struct: %w", err)
 	}
-	return nil
+
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fields = append(fields, FieldError{
+			Field: fe.Field(),
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+		})
+	}
+
+	return ErrValidationFailed.WithFields(fields).Wrap(err)
 }
 
-func NewENVVars() []string {
-	return []string{
-		"DB_HOST",
-		"DB_PORT",
-		"DB_USER",
-		"DB_NAME",
-		"DB_PASSWORD",
-		"DB_SSL_MODE",
-		"API_PORT",
-		"BASIC_AUTH_USERNAME",
-		"BASIC_AUTH_PASSWORD",
-		"API_KEY",
-		"JWT_SECRET",
+// jsonFieldName reports fields by their JSON name so that validation errors
+// match what clients sent.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
 	}
+
+	if name == "" {
+		return field.Name
+	}
+
+	return name
 }
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	passwordMinLength = 8
+	// bcrypt ignores everything after 72 bytes.
+	passwordMaxBytes = 72
+)
+
+func (cv *CustomValidator) registerRules() error {
+	if err := cv.Validator.RegisterValidation("password_policy", validatePasswordPolicy); err != nil {
+		return err
+	}
+
+	return cv.Validator.RegisterValidation("email_domain", cv.validateEmailDomain)
+}
+
+func validatePasswordPolicy(fl validator.FieldLevel) bool {
+	return PasswordMeetsPolicy(fl.Field().String())
+}
+
+// PasswordMeetsPolicy requires at least 8 characters, no more than 72 bytes,
+// and at least one letter and one digit. It backs the password_policy rule.
+func PasswordMeetsPolicy(password string) bool {
+	if len([]rune(password)) < passwordMinLength || len(password) > passwordMaxBytes {
+		return false
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+
+	return hasLetter && hasDigit
+}
+
+func (cv *CustomValidator) validateEmailDomain(fl validator.FieldLevel) bool {
+	if len(cv.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	email := fl.Field().String()
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := email[at+1:]
+	for _, allowed := range cv.AllowedEmailDomains {
+		if strings.EqualFold(domain, strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
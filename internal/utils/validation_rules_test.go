@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	type request struct {
+		Password string `json:"password" validate:"password_policy"`
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{name: "valid", in: "password1", want: true},
+		{name: "too short", in: "pass1", want: false},
+		{name: "no digit", in: "password", want: false},
+		{name: "no letter", in: "12345678", want: false},
+		{name: "too long", in: "password1" + string(make([]byte, 64)), want: false},
+	}
+
+	cv := NewCustomValidator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := cv.Validate(request{Password: test.in})
+			assert.Equal(t, test.want, err == nil)
+		})
+	}
+}
+
+func TestEmailDomain(t *testing.T) {
+	type request struct {
+		Email string `json:"email" validate:"email_domain"`
+	}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		in      string
+		want    bool
+	}{
+		{name: "any domain allowed", allowed: nil, in: "test@example.com", want: true},
+		{name: "allowed domain", allowed: []string{"test.com"}, in: "test@test.com", want: true},
+		{name: "allowed domain ignores case", allowed: []string{"test.com"}, in: "test@TEST.com", want: true},
+		{name: "disallowed domain", allowed: []string{"test.com"}, in: "test@example.com", want: false},
+		{name: "no domain", allowed: []string{"test.com"}, in: "test", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cv := NewCustomValidator()
+			cv.AllowedEmailDomains = test.allowed
+			err := cv.Validate(request{Email: test.in})
+			assert.Equal(t, test.want, err == nil)
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"os"
 	"testing"
 
 	"github.com/go-playground/validator/v10"
@@ -16,44 +15,45 @@ func TestNewCustomValidator(t *testing.T) {
 	assert.IsType(t, &validator.Validate{}, cv.Validator)
 }
 
-func TestValidateENVVars(t *testing.T) {
+func TestValidate(t *testing.T) {
+	type request struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required,min=8"`
+	}
+
 	tests := []struct {
-		name    string
-		vars    []string
-		wantErr bool
+		name       string
+		in         request
+		wantFields []FieldError
 	}{
 		{
-			name:    "valid",
-			vars:    []string{"TEST"},
-			wantErr: false,
+			name:       "valid",
+			in:         request{Email: "test@test.com", Password: "password"},
+			wantFields: nil,
 		},
 		{
-			name:    "invalid",
-			vars:    []string{"TEST", "TEST2"},
-			wantErr: true,
-		},
-		{
-			name:    "empty",
-			vars:    []string{},
-			wantErr: false,
-		},
-		{
-			name:    "nil",
-			vars:    nil,
-			wantErr: false,
+			name: "invalid",
+			in:   request{Email: "test", Password: "pass"},
+			wantFields: []FieldError{
+				{Field: "email", Rule: "email"},
+				{Field: "password", Rule: "min", Param: "8"},
+			},
 		},
 	}
 
-	os.Setenv("TEST", "test")
-
+	cv := NewCustomValidator()
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			err := ValidateENVVars(test.vars)
-			if test.wantErr && err != nil {
-				assert.Error(t, err)
-			} else {
+			err := cv.Validate(test.in)
+			if test.wantFields == nil {
 				assert.NoError(t, err)
+				return
 			}
+
+			var appErr *AppError
+			assert.ErrorAs(t, err, &appErr)
+			assert.Equal(t, CodeValidationFailed, appErr.Code)
+			assert.Equal(t, test.wantFields, appErr.Fields)
 		})
 	}
 }
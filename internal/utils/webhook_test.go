@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	header := SignWebhook("whsec_secret", now, body)
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{
+			name:   "valid signature",
+			secret: "whsec_secret",
+			header: header,
+			body:   body,
+			now:    now.Add(time.Minute),
+		},
+		{
+			name:    "other secret",
+			secret:  "whsec_other",
+			header:  header,
+			body:    body,
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "changed body",
+			secret:  "whsec_secret",
+			header:  header,
+			body:    []byte(`{"id":"evt_2"}`),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "replayed later",
+			secret:  "whsec_secret",
+			header:  header,
+			body:    body,
+			now:     now.Add(time.Hour),
+			wantErr: true,
+		},
+		{
+			name:    "malformed header",
+			secret:  "whsec_secret",
+			header:  "v1=abc",
+			body:    body,
+			now:     now,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(test.secret, test.header, test.body, 5*time.Minute, test.now)
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrWebhookSignature)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}